@@ -0,0 +1,100 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+)
+
+// TagWrite is the tags to write on a resource and the keys to remove
+type TagWrite struct {
+	Account string      `json:"account"`
+	Region  string      `json:"region"`
+	ARN     string      `json:"arn"`
+	Tags    []TagChange `json:"tags"`
+	Untag   []string    `json:"untag,omitempty"`
+}
+
+// WriteOptions holds the parameters of ApplyTags
+// params:
+// 		roleName: string, the role assumed in the accounts of the writes
+// 		dryRun: bool, plan the writes without calling the tagging API
+// 		journal: *Journal, records every write of every resource
+type WriteOptions struct {
+	ScanOptions
+	RoleName string
+	DryRun   bool
+	Journal  *Journal
+}
+
+// ApplyTags writes the tags of a plan, the writes are grouped by account and region
+// Args:
+// 		ctx: context.Context
+// 		writes: []TagWrite
+// 		opts: WriteOptions
+// Returns:
+// 		[]ResourceChange: the writes in the plan order of each account/region
+// 		TargetReports: the status of each account/region
+// 		error: if the writes were stopped before the end
+func ApplyTags(ctx context.Context, writes []TagWrite, opts WriteOptions) ([]ResourceChange, TargetReports, error) {
+	var targets []Tags
+	groups := map[[2]string][]TagWrite{}
+	for _, write := range writes {
+		key := [2]string{write.Account, write.Region}
+		if _, ok := groups[key]; !ok {
+			targets = append(targets, Tags{Account: write.Account, Region: write.Region, RoleName: opts.RoleName})
+		}
+		groups[key] = append(groups[key], write)
+	}
+
+	var mu sync.Mutex
+	var changes []ResourceChange
+	reports := make(TargetReports, len(targets))
+	limiters := newLimiterPool(opts.RateLimit)
+	forEachTarget(len(targets), opts.Concurrency, func(idx int) {
+		target := targets[idx]
+		status := TargetReport{Account: target.Account, Region: target.Region, Status: StatusSkipped}
+		defer func() { reports[idx] = status }()
+		if ctx.Err() != nil {
+			return
+		}
+		tctx, cancel := targetContext(ctx, opts.ScanOptions)
+		defer cancel()
+
+		var written []ResourceChange
+		_, client, creds, err := connect(tctx, &target, opts.clientOptions(target, limiters, &status.Throttles))
+		if err == nil {
+			callOpts := func(o *resourcegroupstaggingapi.Options) {
+				o.Credentials = creds
+				o.Region = target.Region
+			}
+			api := tagresourcesapi(client)
+			for _, write := range groups[[2]string{target.Account, target.Region}] {
+				var change []ResourceChange
+				var removes []TagChange
+				for _, key := range write.Untag {
+					removes = append(removes, TagChange{Key: key})
+				}
+				// The new keys are written first, the count of the resource is not needed
+				change, err = writeResource(tctx, api, target, write.ARN, 0, write.Tags, removes, opts.DryRun, opts.Journal, callOpts)
+				written = append(written, change...)
+				if err != nil {
+					break
+				}
+			}
+		}
+		status.classify(ctx, tctx, err)
+		status.Count = len(written)
+
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, written...)
+	})
+
+	if ctx.Err() != nil {
+		return changes, reports, fmt.Errorf("write stopped: %w", ctx.Err())
+	}
+	return changes, reports, nil
+}
@@ -0,0 +1,84 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyTagsSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	resources := map[string]map[string]string{
+		"arn:aws:ec2:us-east-1:123456789012:volume/vol-1":      {"env": "dev"},
+		"arn:aws:ec2:eu-west-1:123456789012:volume/vol-2":      {},
+		"arn:aws:ec2:eu-west-1:123456789012:volume/readonly-3": {},
+	}
+	api := &fakeTagResources{resources: resources}
+	tagresourcesapi = func(client *resourcegroupstaggingapi.Client) TagResourcesAPI {
+		return api
+	}
+	defer func() { tagresourcesapi = newTagResourcesAPI }()
+
+	writes := []TagWrite{
+		{Account: "123456789012", Region: "us-east-1", ARN: "arn:aws:ec2:us-east-1:123456789012:volume/vol-1", Tags: []TagChange{
+			{Key: "env", Previous: aws.String("dev"), Value: aws.String("prod")},
+			{Key: "team", Value: aws.String("web")},
+		}},
+		{Account: "123456789012", Region: "eu-west-1", ARN: "arn:aws:ec2:eu-west-1:123456789012:volume/vol-2", Tags: []TagChange{
+			{Key: "team", Value: aws.String("web")},
+		}},
+		{Account: "123456789012", Region: "eu-west-1", ARN: "arn:aws:ec2:eu-west-1:123456789012:volume/readonly-3", Tags: []TagChange{
+			{Key: "team", Value: aws.String("web")},
+		}},
+	}
+
+	fixtures := []struct {
+		name     string
+		opts     WriteOptions
+		calls    int
+		statuses []ChangeStatus
+	}{
+		{
+			name:     "Test dry-run plans the writes",
+			opts:     WriteOptions{DryRun: true},
+			statuses: []ChangeStatus{ChangePlanned, ChangePlanned, ChangePlanned},
+		},
+		{
+			name:     "Test the writes are applied per account and region",
+			calls:    3,
+			statuses: []ChangeStatus{ChangeApplied, ChangeApplied, ChangeFailed},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			api.calls = nil
+			changes, targets, err := ApplyTags(context.TODO(), writes, fixture.opts)
+			assert.NoError(err)
+			assert.Len(api.calls, fixture.calls)
+			var statuses []ChangeStatus
+			for _, change := range changes {
+				statuses = append(statuses, change.Status)
+			}
+			assert.Equal(fixture.statuses, statuses)
+			assert.Len(targets, 2)
+			assert.Equal("us-east-1", targets[0].Region)
+			assert.Equal("eu-west-1", targets[1].Region)
+		})
+	}
+	assert.Equal(map[string]string{"env": "prod", "team": "web"}, resources["arn:aws:ec2:us-east-1:123456789012:volume/vol-1"])
+	assert.Equal(map[string]string{"team": "web"}, resources["arn:aws:ec2:eu-west-1:123456789012:volume/vol-2"])
+
+	t.Run("Test a canceled context stops the writes", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		_, targets, err := ApplyTags(ctx, writes, WriteOptions{})
+		assert.EqualError(err, "write stopped: context canceled")
+		assert.Equal(StatusSkipped, targets[0].Status)
+	})
+}
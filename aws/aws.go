@@ -2,32 +2,71 @@ package aws
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	rt "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"tagu/models"
 )
 
 var (
 	loadDefaultConfig                    = config.LoadDefaultConfig
 	newConfigForResourcegroupstaggingapi = resourcegroupstaggingapi.NewFromConfig
-	resourcegroupgetpaginator            = resourcegroupstaggingapi.NewGetResourcesPaginator
+	resourcegroupgetpaginator            = newGetResourcesPaginator
 	stsnewconfig                         = sts.NewFromConfig
 )
 
 // RessourceTagResult is the output of a GetResourcesTags call
 // It contains the account, region, service, resource, key and value of the tag
-// flattened in a single struct
+// flattened in a single struct, a resource without any tag has a single row
+// with an empty key and value
 type RessourceTagResult struct {
-	Account  string
-	Region   string
-	Service  string
-	Resource string
-	Key      string
-	Value    string
+	Account  string `json:"account"`
+	Region   string `json:"region"`
+	Service  string `json:"service"`
+	Resource string `json:"resource"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	// ResourceARN is the ARN returned by AWS, its partition and resource are kept whole
+	ResourceARN string `json:"arn,omitempty"`
+	// Compliant and the noncompliant keys of the resource are only set
+	// when the compliance details are requested
+	Compliant                  *bool    `json:"compliant,omitempty"`
+	NoncompliantKeys           []string `json:"noncompliant-keys,omitempty"`
+	KeysWithNoncompliantValues []string `json:"noncompliant-values,omitempty"`
+}
+
+// ARN returns the ARN of the resource, it is rebuilt in the aws partition for the
+// results stored without it
+// Returns:
+// 		string: arn:partition:service:region:account:resource
+func (r RessourceTagResult) ARN() string {
+	if r.ResourceARN != "" {
+		return r.ResourceARN
+	}
+	return strings.Join([]string{"arn", "aws", r.Service, r.Region, r.Account, r.Resource}, ":")
+}
+
+// Untagged tells whether the row stands for a resource without any tag
+func (r RessourceTagResult) Untagged() bool {
+	return r.Key == ""
+}
+
+// Type returns the service:type of the resource, the service alone
+// when the resource has no type prefix
+func (r RessourceTagResult) Type() string {
+	if i := strings.IndexAny(r.Resource, "/:"); i > 0 {
+		return r.Service + ":" + r.Resource[:i]
+	}
+	return r.Service
 }
 
 // Tags is stuct that dedfines the AWS tags input and filter
@@ -35,12 +74,39 @@ type RessourceTagResult struct {
 // 		account: string
 // 		roleName: string
 // 		region: string
+// 		filterResources: []string
+// 		filterTags: []models.Tags
+// 		paginationToken: string, the page to start from
+// 		complianceDetails: bool, include the tag policies compliance of each resource
 type Tags struct {
-	Account  string
-	Region   string
-	RoleName string
-	Output   []RessourceTagResult
-	length   int
+	Account           string
+	Region            string
+	RoleName          string
+	FilterResources   []string
+	FilterTags        []models.Tags
+	PaginationToken   string
+	ComplianceDetails bool
+	Output            []RessourceTagResult
+	length            int
+	// onPage is called after each page with the page results and the next page token
+	onPage func(token string, page []RessourceTagResult) error
+}
+
+// key identifies the target by its account, region and filters
+// Returns:
+// 		string: account/region followed by a digest of the filters if any
+func (t Tags) key() string {
+	key := t.Account + "/" + t.Region
+	if len(t.FilterResources) == 0 && len(t.FilterTags) == 0 && !t.ComplianceDetails {
+		return key
+	}
+	filters, _ := json.Marshal(struct {
+		Resources  []string
+		Tags       []models.Tags
+		Compliance bool `json:",omitempty"`
+	}{t.FilterResources, t.FilterTags, t.ComplianceDetails})
+	sum := sha256.Sum256(filters)
+	return fmt.Sprintf("%s/%x", key, sum[:8])
 }
 
 // GetResourcesTagsPager is the interface that defines the pagination logic
@@ -50,15 +116,21 @@ type GetResourcesTagsPager interface {
 	NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetResourcesOutput, error)
 }
 
+// newGetResourcesPaginator wraps the SDK paginator behind the GetResourcesTagsPager interface
+func newGetResourcesPaginator(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) GetResourcesTagsPager {
+	return resourcegroupstaggingapi.NewGetResourcesPaginator(client, params, optFns...)
+}
+
 // STSAssumeRoleAPI defines the interface for the AssumeRole function.
 // We use this interface to test the function using a mocked service.
 type STSAssumeRoleAPI interface {
 	AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
 }
 
-// GetAwsTagsApi defines the interface for the getResources, setupCredentials and setupRegion.
+// GetAwsTagsApi defines the interface for the getResources, setupCredentials, setupRegion and getResourcesInput.
 // This interface used to make unittest easy to mock
 type GetAwsTagsApi interface {
+	getResourcesInput() *resourcegroupstaggingapi.GetResourcesInput
 	setupCredentials(ctx context.Context, cfg aws.Config, stsAPI STSAssumeRoleAPI) (creds aws.CredentialsProvider, err error)
 	setupRegion(cfg aws.Config) string
 	getResourcesTags(ctx context.Context, cfg aws.Config, paginator GetResourcesTagsPager, creds aws.CredentialsProvider, region string) error
@@ -99,6 +171,29 @@ func (t Tags) setupRegion(cfg aws.Config) string {
 	return cfg.Region
 }
 
+// getResourcesInput builds the GetResources filters from the resources and tags filters
+// Return:
+// 		*resourcegroupstaggingapi.GetResourcesInput: the paginator input params
+func (t Tags) getResourcesInput() *resourcegroupstaggingapi.GetResourcesInput {
+	params := &resourcegroupstaggingapi.GetResourcesInput{
+		ResourceTypeFilters: t.FilterResources,
+	}
+	if t.PaginationToken != "" {
+		params.PaginationToken = aws.String(t.PaginationToken)
+	}
+	if t.ComplianceDetails {
+		params.IncludeComplianceDetails = aws.Bool(true)
+	}
+	for _, tag := range t.FilterTags {
+		filter := rt.TagFilter{Values: tag.Values}
+		if tag.Key != "" {
+			filter.Key = aws.String(tag.Key)
+		}
+		params.TagFilters = append(params.TagFilters, filter)
+	}
+	return params
+}
+
 // GetResourcesTags returns the tags for the given resources from AWS And fatterns the results in a single struct
 // Args:
 // 		ctx: context.Context
@@ -117,51 +212,91 @@ func (t *Tags) getResourcesTags(ctx context.Context, cfg aws.Config, paginator G
 			return err
 		}
 
+		start := len(t.Output)
 		for _, item := range output.ResourceTagMappingList {
-			for _, tag := range item.Tags {
-				infos := strings.Split(*item.ResourceARN, ":")
-				t.Output = append(
-					t.Output,
-					RessourceTagResult{
-						Account:  infos[4],
-						Region:   infos[3],
-						Service:  infos[2],
-						Resource: infos[5],
-						Key:      *tag.Key,
-						Value:    *tag.Value,
-					},
-				)
+			tags := item.Tags
+			if len(tags) == 0 {
+				// Keep the untagged resource for the coverage and its compliance
+				tags = []rt.Tag{{Key: aws.String(""), Value: aws.String("")}}
+			}
+			// The resource part of the ARN may contain colons, function:name or db:name
+			infos := strings.SplitN(*item.ResourceARN, ":", 6)
+			for _, tag := range tags {
+				result := RessourceTagResult{
+					Account:     infos[4],
+					Region:      infos[3],
+					Service:     infos[2],
+					Resource:    infos[5],
+					Key:         *tag.Key,
+					Value:       *tag.Value,
+					ResourceARN: *item.ResourceARN,
+				}
+				if details := item.ComplianceDetails; details != nil {
+					result.Compliant = details.ComplianceStatus
+					result.NoncompliantKeys = details.NoncompliantKeys
+					result.KeysWithNoncompliantValues = details.KeysWithNoncompliantValues
+				}
+				t.Output = append(t.Output, result)
 			}
 		}
 		t.length = len(t.Output)
+		if t.onPage != nil {
+			if err := t.onPage(aws.ToString(output.PaginationToken), t.Output[start:]); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-// Run executes the tagging logic
-// It represent the entrypoint for AWS tags modules
-func Run(t GetAwsTagsApi) error {
-	var creds aws.CredentialsProvider
-
-	ctx := context.TODO()
+// connect loads the AWS configuration, creates the ResourceGroupsTagging client and
+// resolves the target credentials, the clients retry the throttled calls and
+// share the opts limiter
+// Args:
+// 		ctx: context.Context
+// 		t: GetAwsTagsApi
+// 		opts: ClientOptions
+// Returns:
+// 		aws.Config: the default configuration
+// 		*resourcegroupstaggingapi.Client: the tagging client
+// 		aws.CredentialsProvider: the target credentials
+// 		error: if the configuration or the credentials can not be loaded
+func connect(ctx context.Context, t GetAwsTagsApi, opts ClientOptions) (aws.Config, *resourcegroupstaggingapi.Client, aws.CredentialsProvider, error) {
 	cfg, err := loadDefaultConfig(ctx)
 	if err != nil {
-		return err
+		return cfg, nil, nil, err
 	}
 
 	// Using the Config value, create the ResourceGroupsTagging client
-	rsclient := newConfigForResourcegroupstaggingapi(cfg)
-
-	params := &resourcegroupstaggingapi.GetResourcesInput{}
+	rsclient := newConfigForResourcegroupstaggingapi(cfg, func(o *resourcegroupstaggingapi.Options) {
+		o.Retryer = opts.retryer()
+		o.APIOptions = append(o.APIOptions, opts.rateLimitMiddleware)
+	})
 
-	paginator := resourcegroupgetpaginator(rsclient, params, func(o *resourcegroupstaggingapi.GetResourcesPaginatorOptions) {
-		o.Limit = 50
+	stsclient := stsnewconfig(cfg, func(o *sts.Options) {
+		o.Retryer = opts.retryer()
 	})
-	stsclient := stsnewconfig(cfg)
-	creds, err = t.setupCredentials(ctx, cfg, stsclient)
+	creds, err := t.setupCredentials(ctx, cfg, stsclient)
+	if err != nil {
+		return cfg, nil, nil, err
+	}
+	return cfg, rsclient, creds, nil
+}
+
+// Run executes the tagging logic
+// It represent the entrypoint for AWS tags modules, every AWS call is bound to ctx
+// so a cancelled or expired context stops the scan
+func Run(ctx context.Context, t GetAwsTagsApi, opts ClientOptions) error {
+	cfg, rsclient, creds, err := connect(ctx, t, opts)
 	if err != nil {
 		return err
 	}
+
+	params := t.getResourcesInput()
+
+	paginator := resourcegroupgetpaginator(rsclient, params, func(o *resourcegroupstaggingapi.GetResourcesPaginatorOptions) {
+		o.Limit = 50
+	})
 	err = t.getResourcesTags(ctx, cfg, paginator, creds, t.setupRegion(cfg))
 	if err != nil {
 		return err
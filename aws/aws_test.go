@@ -15,6 +15,8 @@ import (
 	st "github.com/aws/aws-sdk-go-v2/service/sts/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+
+	"tagu/models"
 )
 
 type mockGetResourceTagPager struct {
@@ -78,6 +80,10 @@ func (t *mockTags) setupRegion(cfg aws.Config) string {
 	return args.String(0)
 }
 
+func (t *mockTags) getResourcesInput() *resourcegroupstaggingapi.GetResourcesInput {
+	return &resourcegroupstaggingapi.GetResourcesInput{}
+}
+
 var ResourceTagsPagesOutput = []*resourcegroupstaggingapi.GetResourcesOutput{
 	{
 		ResourceTagMappingList: []rt.ResourceTagMapping{
@@ -160,12 +166,12 @@ func TestGetResourceTagPagerSuite(t *testing.T) {
 			"TestGetResourceTagPagerFunc",
 			errors.New("no more pages"),
 			[]RessourceTagResult{
-				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-12345678", Key: "Name", Value: "test-instance"},
-				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-12345678", Key: "Owner", Value: "test-owner"},
-				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-12345675", Key: "ENV", Value: "test-env"},
-				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-12345675", Key: "Name", Value: "test-instance2"},
-				{Account: "123456789012", Region: "us-east-2", Service: "ec2", Resource: "instance/i-123456100", Key: "Name", Value: "test-instance-p2"},
-				{Account: "123456789012", Region: "us-east-2", Service: "ec2", Resource: "instance/i-12345689", Key: "ENV", Value: "test-env-p2"},
+				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-12345678", Key: "Name", Value: "test-instance", ResourceARN: "arn:aws:ec2:us-east-1:123456789012:instance/i-12345678"},
+				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-12345678", Key: "Owner", Value: "test-owner", ResourceARN: "arn:aws:ec2:us-east-1:123456789012:instance/i-12345678"},
+				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-12345675", Key: "ENV", Value: "test-env", ResourceARN: "arn:aws:ec2:us-east-1:123456789012:instance/i-12345675"},
+				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-12345675", Key: "Name", Value: "test-instance2", ResourceARN: "arn:aws:ec2:us-east-1:123456789012:instance/i-12345675"},
+				{Account: "123456789012", Region: "us-east-2", Service: "ec2", Resource: "instance/i-123456100", Key: "Name", Value: "test-instance-p2", ResourceARN: "arn:aws:ec2:us-east-2:123456789012:instance/i-123456100"},
+				{Account: "123456789012", Region: "us-east-2", Service: "ec2", Resource: "instance/i-12345689", Key: "ENV", Value: "test-env-p2", ResourceARN: "arn:aws:ec2:us-east-2:123456789012:instance/i-12345689"},
 			},
 			6,
 		},
@@ -192,6 +198,112 @@ func TestGetResourceTagPagerSuite(t *testing.T) {
 	}
 }
 
+func TestGetResourcesTagsUntaggedSuite(t *testing.T) {
+	assert := assert.New(t)
+	pager := &mockGetResourceTagPager{Pages: []*resourcegroupstaggingapi.GetResourcesOutput{{
+		ResourceTagMappingList: []rt.ResourceTagMapping{
+			{
+				ResourceARN:       aws.String("arn:aws:ec2:us-east-1:123456789012:instance/i-1"),
+				Tags:              []rt.Tag{{Key: aws.String("env"), Value: aws.String("prod")}},
+				ComplianceDetails: &rt.ComplianceDetails{ComplianceStatus: aws.Bool(true)},
+			},
+			{
+				ResourceARN:       aws.String("arn:aws:ec2:us-east-1:123456789012:volume/vol-2"),
+				ComplianceDetails: &rt.ComplianceDetails{ComplianceStatus: aws.Bool(false), NoncompliantKeys: []string{"env"}},
+			},
+		},
+	}}}
+	pager.On("HasMorePages").Return(true).Once()
+	pager.On("HasMorePages").Return(false)
+
+	tags := Tags{Account: "123456789012", Region: "us-east-1", ComplianceDetails: true}
+	assert.NoError(tags.getResourcesTags(context.TODO(), aws.Config{}, pager, nil, "us-east-1"))
+	assert.Equal([]RessourceTagResult{
+		{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod", ResourceARN: "arn:aws:ec2:us-east-1:123456789012:instance/i-1", Compliant: aws.Bool(true)},
+		{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "volume/vol-2", ResourceARN: "arn:aws:ec2:us-east-1:123456789012:volume/vol-2", Compliant: aws.Bool(false), NoncompliantKeys: []string{"env"}},
+	}, tags.Output)
+	assert.False(tags.Output[0].Untagged())
+	assert.True(tags.Output[1].Untagged())
+}
+
+func TestGetResourcesTagsARNSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		arn      string
+		expected RessourceTagResult
+		kind     string
+	}{
+		{
+			name:     "Test a lambda function ARN",
+			arn:      "arn:aws:lambda:us-east-1:123456789012:function:my-function",
+			expected: RessourceTagResult{Account: "123456789012", Region: "us-east-1", Service: "lambda", Resource: "function:my-function"},
+			kind:     "lambda:function",
+		},
+		{
+			name:     "Test a rds database ARN",
+			arn:      "arn:aws:rds:eu-west-1:123456789012:db:my-db",
+			expected: RessourceTagResult{Account: "123456789012", Region: "eu-west-1", Service: "rds", Resource: "db:my-db"},
+			kind:     "rds:db",
+		},
+		{
+			name:     "Test a log group ARN",
+			arn:      "arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/my-function:*",
+			expected: RessourceTagResult{Account: "123456789012", Region: "us-east-1", Service: "logs", Resource: "log-group:/aws/lambda/my-function:*"},
+			kind:     "logs:log-group",
+		},
+		{
+			name:     "Test a GovCloud ARN",
+			arn:      "arn:aws-us-gov:ec2:us-gov-west-1:123456789012:instance/i-1",
+			expected: RessourceTagResult{Account: "123456789012", Region: "us-gov-west-1", Service: "ec2", Resource: "instance/i-1"},
+			kind:     "ec2:instance",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			pager := &mockGetResourceTagPager{Pages: []*resourcegroupstaggingapi.GetResourcesOutput{{
+				ResourceTagMappingList: []rt.ResourceTagMapping{{
+					ResourceARN: aws.String(fixture.arn),
+					Tags:        []rt.Tag{{Key: aws.String("env"), Value: aws.String("prod")}},
+				}},
+			}}}
+			pager.On("HasMorePages").Return(true).Once()
+			pager.On("HasMorePages").Return(false)
+
+			tags := Tags{}
+			assert.NoError(tags.getResourcesTags(context.TODO(), aws.Config{}, pager, nil, ""))
+			expected := fixture.expected
+			expected.Key, expected.Value, expected.ResourceARN = "env", "prod", fixture.arn
+			assert.Equal([]RessourceTagResult{expected}, tags.Output)
+			assert.Equal(fixture.arn, tags.Output[0].ARN())
+			assert.Equal(fixture.kind, tags.Output[0].Type())
+		})
+	}
+
+	// The results stored without the ARN rebuild it in the aws partition
+	assert.Equal("arn:aws:ec2:us-east-1:1:instance/i-1", RessourceTagResult{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1"}.ARN())
+}
+
+func TestTypeSuite(t *testing.T) {
+	assert := assert.New(t)
+	fixtures := []struct {
+		name     string
+		result   RessourceTagResult
+		expected string
+	}{
+		{"Resource with a type", RessourceTagResult{Service: "ec2", Resource: "instance/i-1"}, "ec2:instance"},
+		{"Resource with a colon type", RessourceTagResult{Service: "lambda", Resource: "function:my-function"}, "lambda:function"},
+		{"Resource without a type", RessourceTagResult{Service: "s3", Resource: "bucket"}, "s3"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, fixture.result.Type())
+		})
+	}
+}
+
 func TestSetupCredentialsSuite(t *testing.T) {
 	cfg := aws.Config{
 		Region: "us-east-2",
@@ -308,6 +420,45 @@ func TestSetupRegionSuite(t *testing.T) {
 	}
 }
 
+func TestGetResourcesInputSuite(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		input    Tags
+		expected *resourcegroupstaggingapi.GetResourcesInput
+	}{
+		{
+			"GetResourcesInput without filters",
+			Tags{Account: "123456789012"},
+			&resourcegroupstaggingapi.GetResourcesInput{},
+		},
+		{
+			"GetResourcesInput with resources and tags filters",
+			Tags{
+				Account:         "123456789012",
+				FilterResources: []string{"ec2:instance", "rds"},
+				FilterTags: []models.Tags{
+					{Key: "env", Values: []string{"prod"}},
+					{Values: []string{"dev"}},
+				},
+			},
+			&resourcegroupstaggingapi.GetResourcesInput{
+				ResourceTypeFilters: []string{"ec2:instance", "rds"},
+				TagFilters: []rt.TagFilter{
+					{Key: aws.String("env"), Values: []string{"prod"}},
+					{Values: []string{"dev"}},
+				},
+			},
+		},
+	}
+
+	assert := assert.New(t)
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.EqualValues(fixture.expected, fixture.input.getResourcesInput())
+		})
+	}
+}
+
 func TestRunFuncSuite(t *testing.T) {
 	// cfg := aws.Config{
 	// 	Region: "us-east-2",
@@ -320,7 +471,7 @@ func TestRunFuncSuite(t *testing.T) {
 	newConfigForResourcegroupstaggingapi = func(cfg aws.Config, optFns ...func(*resourcegroupstaggingapi.Options)) *resourcegroupstaggingapi.Client {
 		return &resourcegroupstaggingapi.Client{}
 	}
-	resourcegroupgetpaginator = func(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) *resourcegroupstaggingapi.GetResourcesPaginator {
+	resourcegroupgetpaginator = func(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) GetResourcesTagsPager {
 		return &resourcegroupstaggingapi.GetResourcesPaginator{}
 	}
 	stsnewconfig = func(cfg aws.Config, optFns ...func(*sts.Options)) *sts.Client {
@@ -358,7 +509,7 @@ func TestRunFuncSuite(t *testing.T) {
 			tags.On("setupCredentials", mock.Anything, mock.Anything, mock.Anything).Return(credentials.StaticCredentialsProvider{}, nil)
 			tags.On("setupRegion", mock.Anything).Return("us-east-1")
 			tags.On("getResourcesTags", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "us-east-1").Return(fixture.err)
-			err := Run(&tags)
+			err := Run(context.TODO(), &tags, ClientOptions{})
 			assert.Equal(tags.Output, fixture.expected)
 			assert.Equal(err, fixture.err)
 			assert.Equal(tags.length, 0)
@@ -0,0 +1,207 @@
+package aws
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"tagu/models"
+)
+
+// now is the cache clock, replaced in the unittest
+var now = time.Now
+
+// CacheEntry is the content of a cached target scan
+type CacheEntry struct {
+	Key             string               `json:"key"`
+	Account         string               `json:"account"`
+	Region          string               `json:"region"`
+	FilterResources []string             `json:"resources,omitempty"`
+	FilterTags      []models.Tags        `json:"filter-tags,omitempty"`
+	CreatedAt       time.Time            `json:"created-at"`
+	Results         []RessourceTagResult `json:"results"`
+	file            string
+}
+
+// Cache stores the results of the completed targets on disk
+// The entries are keyed by the account, region, resources filters and tags filters
+// params:
+// 		dir: string, the cache directory
+// 		ttl: time.Duration, the age after which an entry is expired
+type Cache struct {
+	Dir string
+	TTL time.Duration
+}
+
+// DefaultCacheDir returns the tagu directory in the user cache directory
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "tagu")
+}
+
+// Expired reports whether the entry is older than the ttl
+func (c *Cache) Expired(entry CacheEntry) bool {
+	return now().Sub(entry.CreatedAt) > c.TTL
+}
+
+// Age returns the time elapsed since the entry was written
+func (c *Cache) Age(entry CacheEntry) time.Duration {
+	return now().Sub(entry.CreatedAt)
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(key))))
+}
+
+// get returns the cached results of the target if they did not expire
+// Args:
+// 		t: Tags
+// Returns:
+// 		[]RessourceTagResult: the cached results
+// 		bool: if a fresh entry was found
+// 		error: if the entry can not be read
+func (c *Cache) get(t Tags) ([]RessourceTagResult, bool, error) {
+	entry, err := readCacheEntry(c.path(t.key()))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil || c.Expired(entry) {
+		return nil, false, err
+	}
+	return entry.Results, true, nil
+}
+
+// put writes the results of the target, replacing the previous entry
+func (c *Cache) put(t Tags, results []RessourceTagResult) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(CacheEntry{
+		Key:             t.key(),
+		Account:         t.Account,
+		Region:          t.Region,
+		FilterResources: t.FilterResources,
+		FilterTags:      t.FilterTags,
+		CreatedAt:       now(),
+		Results:         results,
+	})
+	if err != nil {
+		return err
+	}
+	// Write then rename so a reader never sees a half written entry
+	tmp, err := os.CreateTemp(c.Dir, "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(t.key()))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Entries lists the cache entries sorted by account, region and key
+// An unreadable or corrupt entry is skipped so a single bad file does not hide the others
+// Returns:
+// 		[]CacheEntry: the entries, expired ones included
+// 		[]error: the entries that were skipped
+// 		error: if the cache directory can not be read
+func (c *Cache) Entries() ([]CacheEntry, []error, error) {
+	entries, skipped, _, err := c.scan()
+	return entries, skipped, err
+}
+
+// Clear removes the cache entries
+// The unreadable or corrupt entries and the temporary files left by an interrupted
+// write are always removed
+// Args:
+// 		expiredOnly: bool, keep the entries that did not expire
+// Returns:
+// 		int: the number of removed entries
+// 		error: if an entry can not be removed
+func (c *Cache) Clear(expiredOnly bool) (int, error) {
+	entries, _, bad, err := c.scan()
+	if err != nil {
+		return 0, err
+	}
+	tmps, err := filepath.Glob(filepath.Join(c.Dir, "entry-*.tmp"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if expiredOnly && !c.Expired(entry) {
+			continue
+		}
+		bad = append(bad, entry.file)
+	}
+	for _, file := range bad {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	for _, file := range tmps {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// scan reads the cache entries
+// Returns:
+// 		[]CacheEntry: the valid entries sorted by key
+// 		[]error: the errors of the skipped entries
+// 		[]string: the files of the skipped entries
+// 		error: if the cache directory can not be read
+func (c *Cache) scan() ([]CacheEntry, []error, []string, error) {
+	files, err := filepath.Glob(filepath.Join(c.Dir, "*.json"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var entries []CacheEntry
+	var skipped []error
+	var bad []string
+	for _, file := range files {
+		entry, err := readCacheEntry(file)
+		if err != nil {
+			skipped = append(skipped, err)
+			bad = append(bad, file)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, skipped, bad, nil
+}
+
+func readCacheEntry(path string) (entry CacheEntry, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry, err
+	}
+	if err = json.Unmarshal(data, &entry); err != nil {
+		return entry, fmt.Errorf("invalid cache entry %s: %w", path, err)
+	}
+	entry.file = path
+	return entry, nil
+}
@@ -0,0 +1,152 @@
+package aws
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+func TestCacheSuite(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { now = time.Now }()
+	start := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return start }
+
+	cache := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+	prod := Tags{Account: "123456789012", Region: "us-east-1", FilterTags: []models.Tags{{Key: "env", Values: []string{"prod"}}}}
+	dev := Tags{Account: "123456789012", Region: "us-east-1", FilterTags: []models.Tags{{Key: "env", Values: []string{"dev"}}}}
+	rows := []RessourceTagResult{{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"}}
+
+	_, ok, err := cache.get(prod)
+	assert.False(ok)
+	assert.NoError(err)
+
+	assert.NoError(cache.put(prod, rows))
+	cached, ok, err := cache.get(prod)
+	assert.True(ok)
+	assert.NoError(err)
+	assert.Equal(rows, cached)
+
+	// The tags filters are part of the key
+	_, ok, _ = cache.get(dev)
+	assert.False(ok)
+	assert.NoError(cache.put(dev, nil))
+
+	now = func() time.Time { return start.Add(30 * time.Minute) }
+	assert.NoError(cache.put(Tags{Account: "210987654321", Region: "eu-west-1"}, rows))
+
+	// Expired after the ttl
+	now = func() time.Time { return start.Add(61 * time.Minute) }
+	_, ok, _ = cache.get(prod)
+	assert.False(ok)
+
+	entries, skipped, err := cache.Entries()
+	assert.NoError(err)
+	assert.Empty(skipped)
+	assert.Len(entries, 3)
+	assert.Equal("123456789012", entries[0].Account)
+	assert.Equal("210987654321", entries[2].Account)
+	assert.True(cache.Expired(entries[0]))
+	assert.False(cache.Expired(entries[2]))
+	assert.Equal(31*time.Minute, cache.Age(entries[2]))
+
+	removed, err := cache.Clear(true)
+	assert.NoError(err)
+	assert.Equal(2, removed)
+	removed, err = cache.Clear(false)
+	assert.NoError(err)
+	assert.Equal(1, removed)
+	entries, _, err = cache.Entries()
+	assert.NoError(err)
+	assert.Empty(entries)
+}
+
+func TestCacheInvalidEntrySuite(t *testing.T) {
+	assert := assert.New(t)
+	cache := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+	target := Tags{Account: "123456789012", Region: "us-east-1"}
+	assert.NoError(os.WriteFile(cache.path(target.key()), []byte("{"), 0o644))
+
+	_, ok, err := cache.get(target)
+	assert.False(ok)
+	assert.Error(err)
+
+	// A bad entry is skipped without hiding the valid ones
+	valid := Tags{Account: "210987654321", Region: "eu-west-1"}
+	assert.NoError(cache.put(valid, nil))
+	tmp := filepath.Join(cache.Dir, "entry-123.tmp")
+	assert.NoError(os.WriteFile(tmp, []byte("{"), 0o644))
+	entries, skipped, err := cache.Entries()
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Len(skipped, 1)
+	assert.Contains(skipped[0].Error(), cache.path(target.key()))
+
+	// Clear removes the bad entries and the leftover temporary files, even when only clearing the expired entries
+	removed, err := cache.Clear(true)
+	assert.NoError(err)
+	assert.Equal(1, removed)
+	assert.NoFileExists(cache.path(target.key()))
+	assert.NoFileExists(tmp)
+	assert.FileExists(cache.path(valid.key()))
+	entries, skipped, err = cache.Entries()
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Empty(skipped)
+}
+
+func TestScanCacheSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	var calls int
+	resourcegroupgetpaginator = func(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) GetResourcesTagsPager {
+		calls++
+		return &fakeRegionPager{}
+	}
+	defer mockScanClients()
+
+	cache := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+	spec := models.Spec{FilterInput: []models.InputTag{{Account: "123456789012", Regions: []string{"us-east-1", "fail"}}}}
+
+	fixtures := []struct {
+		name    string
+		opts    ScanOptions
+		calls   int
+		cached  []bool
+		results int
+	}{
+		{"Scan fills the cache with the completed targets", ScanOptions{Cache: cache}, 2, []bool{false, false}, 1},
+		{"Scan reads the completed targets from the cache", ScanOptions{Cache: cache}, 1, []bool{true, false}, 1},
+		{"Scan refreshes the cache", ScanOptions{Cache: cache, RefreshCache: true}, 2, []bool{false, false}, 1},
+		{"Scan without cache", ScanOptions{}, 2, []bool{false, false}, 1},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			calls = 0
+			report, err := Scan(context.TODO(), spec, fixture.opts)
+			assert.NoError(err)
+			assert.Equal(fixture.calls, calls)
+			assert.Equal(fixture.cached, []bool{report.Targets[0].Cached, report.Targets[1].Cached})
+			assert.Len(report.Results, fixture.results)
+		})
+	}
+
+	t.Run("Scan keeps a target that can not be cached", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		assert.NoError(os.WriteFile(file, nil, 0o644))
+		report, err := Scan(context.TODO(), spec, ScanOptions{Cache: &Cache{Dir: filepath.Join(file, "cache"), TTL: time.Hour}})
+		assert.NoError(err)
+		assert.Equal(StatusOK, report.Targets[0].Status)
+		assert.Error(report.Targets[0].CacheErr)
+		assert.Len(report.Targets.Failed(), 1, "only the failed region fails")
+	})
+}
@@ -0,0 +1,164 @@
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// checkpointEvent is a single line of the state file
+// A page event carries the results of a page and the token of the next one,
+// a done event closes the target and a reset event drops its partial results
+// The last page has no next token, so its page event closes the target as well
+// for a scan killed before writing the done event
+type checkpointEvent struct {
+	Target  string               `json:"target"`
+	Token   string               `json:"token,omitempty"`
+	Results []RessourceTagResult `json:"results,omitempty"`
+	Done    bool                 `json:"done,omitempty"`
+	Reset   bool                 `json:"reset,omitempty"`
+}
+
+// targetState is the progress of a target rebuilt from the state file
+type targetState struct {
+	Token   string
+	Results []RessourceTagResult
+	Done    bool
+}
+
+// Checkpoint persists the scan progress to an append-only state file
+// Every page is written as soon as it is fetched, so a killed scan can be
+// resumed from the last written page
+type Checkpoint struct {
+	mu      sync.Mutex
+	file    *os.File
+	targets map[string]*targetState
+}
+
+// OpenCheckpoint opens the state file of a scan
+// Args:
+// 		path: string
+// 		resume: bool, load the progress already recorded in the file instead of truncating it
+// Returns:
+// 		*Checkpoint: the checkpoint to pass to the scan
+// 		error: if the file can not be read or written
+func OpenCheckpoint(path string, resume bool) (*Checkpoint, error) {
+	c := &Checkpoint{targets: map[string]*targetState{}}
+	if !resume {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		c.file = file
+		return c, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := c.load(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	// Drop a line left half written by a killed scan before appending
+	if err = file.Truncate(size); err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	c.file = file
+	return c, nil
+}
+
+// load replays the state file events
+// Returns:
+// 		int64: the size of the complete lines
+// 		error: if a complete line is not a valid event
+func (c *Checkpoint) load(r io.Reader) (int64, error) {
+	var size int64
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+		var event checkpointEvent
+		if err := json.Unmarshal(bytes.TrimSpace(line), &event); err != nil {
+			return size, err
+		}
+		c.apply(event)
+		size += int64(len(line))
+	}
+}
+
+func (c *Checkpoint) apply(event checkpointEvent) {
+	state, ok := c.targets[event.Target]
+	if !ok || event.Reset {
+		state = &targetState{}
+		c.targets[event.Target] = state
+	}
+	state.Token = event.Token
+	state.Results = append(state.Results, event.Results...)
+	state.Done = state.Done || event.Done || (!event.Reset && event.Token == "")
+}
+
+// write appends the event to the state file and applies it
+func (c *Checkpoint) write(event checkpointEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err = c.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	c.apply(event)
+	return nil
+}
+
+// state returns a copy of the recorded progress of the target
+func (c *Checkpoint) state(key string) targetState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.targets[key]
+	if !ok {
+		return targetState{}
+	}
+	return targetState{
+		Token:   state.Token,
+		Results: append([]RessourceTagResult(nil), state.Results...),
+		Done:    state.Done,
+	}
+}
+
+// page records the results of a page and the token of the next page
+func (c *Checkpoint) page(key, token string, results []RessourceTagResult) error {
+	return c.write(checkpointEvent{Target: key, Token: token, Results: results})
+}
+
+// done records the end of the target
+func (c *Checkpoint) done(key string) error {
+	return c.write(checkpointEvent{Target: key, Done: true})
+}
+
+// reset drops the progress of the target so it restarts from the first page
+func (c *Checkpoint) reset(key string) error {
+	return c.write(checkpointEvent{Target: key, Reset: true})
+}
+
+// Close closes the state file
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
@@ -0,0 +1,184 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	rt "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+// fakeTokenPager serves two pages chained by the "page-2" token
+type fakeTokenPager struct {
+	token    *string
+	started  bool
+	requests *[]string
+	failPage string
+}
+
+func (p *fakeTokenPager) HasMorePages() bool {
+	return !p.started || aws.ToString(p.token) != ""
+}
+
+func (p *fakeTokenPager) NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
+	token := aws.ToString(p.token)
+	*p.requests = append(*p.requests, token)
+	if token == p.failPage {
+		return nil, &smithy.GenericAPIError{Code: "ThrottlingException"}
+	}
+	p.started = true
+	resource := "instance/i-1"
+	p.token = aws.String("page-2")
+	if token == "page-2" {
+		resource = "instance/i-2"
+		p.token = nil
+	}
+	return &resourcegroupstaggingapi.GetResourcesOutput{
+		PaginationToken: p.token,
+		ResourceTagMappingList: []rt.ResourceTagMapping{
+			{
+				ResourceARN: aws.String("arn:aws:ec2:us-east-1:123456789012:" + resource),
+				Tags:        []rt.Tag{{Key: aws.String("env"), Value: aws.String("prod")}},
+			},
+		},
+	}, nil
+}
+
+func TestCheckpointLoadSuite(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+
+	c, err := OpenCheckpoint(path, false)
+	assert.NoError(err)
+	row := RessourceTagResult{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"}
+	assert.NoError(c.page("a", "page-2", []RessourceTagResult{row}))
+	assert.NoError(c.page("b", "", []RessourceTagResult{row}))
+	assert.NoError(c.done("b"))
+	assert.NoError(c.Close())
+
+	// Simulate a scan killed while writing a line
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	_, _ = file.WriteString(`{"target":"a","tok`)
+	file.Close()
+
+	c, err = OpenCheckpoint(path, true)
+	assert.NoError(err)
+	assert.Equal(targetState{Token: "page-2", Results: []RessourceTagResult{row}}, c.state("a"))
+	assert.Equal(targetState{Results: []RessourceTagResult{row}, Done: true}, c.state("b"))
+	assert.Equal(targetState{}, c.state("c"))
+	assert.NoError(c.reset("a"))
+	assert.NoError(c.Close())
+
+	c, err = OpenCheckpoint(path, true)
+	assert.NoError(err)
+	assert.Equal(targetState{}, c.state("a"))
+	assert.NoError(c.Close())
+
+	_, err = OpenCheckpoint(filepath.Join(t.TempDir(), "missing.jsonl"), true)
+	assert.Error(err)
+}
+
+func TestScanResumeSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	var requests []string
+	failPage := "page-2"
+	resourcegroupgetpaginator = func(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) GetResourcesTagsPager {
+		return &fakeTokenPager{token: params.PaginationToken, requests: &requests, failPage: failPage}
+	}
+	defer mockScanClients()
+
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	spec := models.Spec{FilterInput: []models.InputTag{{Account: "123456789012", Regions: []string{"us-east-1"}}}}
+
+	// First scan fails on the second page
+	checkpoint, err := OpenCheckpoint(path, false)
+	assert.NoError(err)
+	report, err := Scan(context.TODO(), spec, ScanOptions{Checkpoint: checkpoint})
+	assert.NoError(err)
+	assert.NoError(checkpoint.Close())
+	assert.Equal(StatusFailed, report.Targets[0].Status)
+	assert.Len(report.Results, 1)
+	assert.Equal([]string{"", "page-2"}, requests)
+
+	// Resumed scan starts from the second page and merges the first one
+	requests, failPage = nil, "none"
+	checkpoint, err = OpenCheckpoint(path, true)
+	assert.NoError(err)
+	report, err = Scan(context.TODO(), spec, ScanOptions{Checkpoint: checkpoint})
+	assert.NoError(err)
+	assert.NoError(checkpoint.Close())
+	assert.Equal(StatusOK, report.Targets[0].Status)
+	assert.Equal([]string{"page-2"}, requests)
+	assert.Equal([]string{"instance/i-1", "instance/i-2"}, []string{report.Results[0].Resource, report.Results[1].Resource})
+
+	// A completed target is read back from the state file
+	requests = nil
+	checkpoint, err = OpenCheckpoint(path, true)
+	assert.NoError(err)
+	report, err = Scan(context.TODO(), spec, ScanOptions{Checkpoint: checkpoint})
+	assert.NoError(err)
+	assert.NoError(checkpoint.Close())
+	assert.Empty(requests)
+	assert.Len(report.Results, 2)
+	assert.Equal(2, report.Targets[0].Count)
+
+	// A scan killed after the last page and before the done event is complete
+	checkpoint, err = OpenCheckpoint(path, false)
+	assert.NoError(err)
+	key := Targets(spec)[0].key()
+	assert.NoError(checkpoint.page(key, "page-2", report.Results[:1]))
+	assert.NoError(checkpoint.page(key, "", report.Results[1:]))
+	assert.NoError(checkpoint.Close())
+
+	requests = nil
+	checkpoint, err = OpenCheckpoint(path, true)
+	assert.NoError(err)
+	report, err = Scan(context.TODO(), spec, ScanOptions{Checkpoint: checkpoint})
+	assert.NoError(err)
+	assert.NoError(checkpoint.Close())
+	assert.Empty(requests)
+	assert.Equal([]string{"instance/i-1", "instance/i-2"}, []string{report.Results[0].Resource, report.Results[1].Resource})
+	state, _ := os.ReadFile(path)
+	assert.Equal(2, bytes.Count(state, []byte("\n")), "the resumed scan records nothing")
+
+	// A target served from the cache is recorded, the resumed scan does not scan it again
+	cache := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+	assert.NoError(cache.put(Targets(spec)[0], report.Results))
+	checkpoint, err = OpenCheckpoint(path, false)
+	assert.NoError(err)
+	report, err = Scan(context.TODO(), spec, ScanOptions{Checkpoint: checkpoint, Cache: cache})
+	assert.NoError(err)
+	assert.NoError(checkpoint.Close())
+	assert.True(report.Targets[0].Cached)
+
+	requests = nil
+	checkpoint, err = OpenCheckpoint(path, true)
+	assert.NoError(err)
+	report, err = Scan(context.TODO(), spec, ScanOptions{Checkpoint: checkpoint})
+	assert.NoError(err)
+	assert.NoError(checkpoint.Close())
+	assert.Empty(requests)
+	assert.False(report.Targets[0].Cached)
+	assert.Len(report.Results, 2)
+}
+
+func TestTagsKeySuite(t *testing.T) {
+	assert := assert.New(t)
+	base := Tags{Account: "123456789012", Region: "us-east-1"}
+	filtered := Tags{Account: "123456789012", Region: "us-east-1", FilterTags: []models.Tags{{Key: "env"}}}
+
+	assert.Equal("123456789012/us-east-1", base.key())
+	assert.Regexp("^123456789012/us-east-1/[0-9a-f]{16}$", filtered.key())
+	assert.NotEqual(filtered.key(), Tags{Account: "123456789012", Region: "us-east-1", FilterResources: []string{"ec2"}}.key())
+}
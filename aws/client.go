@@ -0,0 +1,114 @@
+package aws
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/time/rate"
+)
+
+// ClientOptions tunes the AWS clients created for a target
+// params:
+// 		retryMode: aws.RetryMode, adaptive unless set to standard
+// 		maxAttempts: int, zero keeps the SDK default
+// 		maxBackoff: time.Duration, zero keeps the SDK default
+// 		limiter: *rate.Limiter, shared by every client calling the same account/region
+// 		throttles: *int64, incremented on each throttled attempt
+type ClientOptions struct {
+	RetryMode   aws.RetryMode
+	MaxAttempts int
+	MaxBackoff  time.Duration
+	Limiter     *rate.Limiter
+	Throttles   *int64
+}
+
+// throttleRetryer counts the throttled attempts before delegating
+// the retry decision to the wrapped retryer
+type throttleRetryer struct {
+	aws.RetryerV2
+	throttles *int64
+}
+
+func (r throttleRetryer) IsErrorRetryable(err error) bool {
+	if ClassifyError(err) == CauseThrottled {
+		atomic.AddInt64(r.throttles, 1)
+	}
+	return r.RetryerV2.IsErrorRetryable(err)
+}
+
+// retryer builds the clients retryer, the adaptive mode also slows the attempts
+// down when the API answers with throttling errors
+// Returns:
+// 		aws.Retryer: the retryer set on the clients
+func (o ClientOptions) retryer() aws.Retryer {
+	standard := func(so *retry.StandardOptions) {
+		if o.MaxAttempts > 0 {
+			so.MaxAttempts = o.MaxAttempts
+		}
+		if o.MaxBackoff > 0 {
+			so.MaxBackoff = o.MaxBackoff
+		}
+	}
+	var r aws.RetryerV2
+	if o.RetryMode == aws.RetryModeStandard {
+		r = retry.NewStandard(standard)
+	} else {
+		r = retry.NewAdaptiveMode(func(ao *retry.AdaptiveModeOptions) {
+			ao.StandardOptions = append(ao.StandardOptions, standard)
+		})
+	}
+	if o.Throttles != nil {
+		r = throttleRetryer{RetryerV2: r, throttles: o.Throttles}
+	}
+	return r
+}
+
+// rateLimitMiddleware waits for a token before every attempt, retries included
+// Args:
+// 		stack: *middleware.Stack
+// Returns:
+// 		error: if the middleware could not be added
+func (o ClientOptions) rateLimitMiddleware(stack *middleware.Stack) error {
+	if o.Limiter == nil {
+		return nil
+	}
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("TaguRateLimit", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		if err := o.Limiter.Wait(ctx); err != nil {
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+		}
+		return next.HandleFinalize(ctx, in)
+	}), middleware.After)
+}
+
+// limiterPool hands out one token bucket per account and region
+// so concurrent workers share the API quota of the same target
+type limiterPool struct {
+	mu       sync.Mutex
+	limit    rate.Limit
+	limiters map[string]*rate.Limiter
+}
+
+func newLimiterPool(limit float64) *limiterPool {
+	return &limiterPool{limit: rate.Limit(limit), limiters: map[string]*rate.Limiter{}}
+}
+
+// get returns the limiter of the account and region, nil when the rate is not limited
+func (p *limiterPool) get(account, region string) *rate.Limiter {
+	if p.limit <= 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := account + "/" + region
+	limiter, ok := p.limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(p.limit, 1)
+		p.limiters[key] = limiter
+	}
+	return limiter
+}
@@ -0,0 +1,108 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// newTestTaggingClient returns a tagging client calling the local server
+func newTestTaggingClient(url string, opts ClientOptions) *resourcegroupstaggingapi.Client {
+	return resourcegroupstaggingapi.New(resourcegroupstaggingapi.Options{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		EndpointResolver: resourcegroupstaggingapi.EndpointResolverFunc(func(region string, options resourcegroupstaggingapi.EndpointResolverOptions) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: url}, nil
+		}),
+		Retryer:    opts.retryer(),
+		APIOptions: []func(*middleware.Stack) error{opts.rateLimitMiddleware},
+	})
+}
+
+func TestClientRetrySuite(t *testing.T) {
+	fixtures := []struct {
+		name        string
+		throttled   int32
+		maxAttempts int
+		throttles   int64
+		err         bool
+	}{
+		{"Retry throttled calls until success", 2, 5, 2, false},
+		{"Retry throttled calls until max attempts", 5, 3, 3, true},
+	}
+
+	assert := assert.New(t)
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+				if atomic.AddInt32(&calls, 1) <= fixture.throttled {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"__type":"ThrottlingException","message":"Rate exceeded"}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"ResourceTagMappingList":[]}`))
+			}))
+			defer server.Close()
+
+			var throttles int64
+			opts := ClientOptions{RetryMode: aws.RetryModeStandard, MaxAttempts: fixture.maxAttempts, MaxBackoff: time.Millisecond, Throttles: &throttles}
+			_, err := newTestTaggingClient(server.URL, opts).GetResources(context.TODO(), &resourcegroupstaggingapi.GetResourcesInput{})
+			assert.Equal(fixture.err, err != nil)
+			assert.Equal(fixture.throttles, throttles)
+		})
+	}
+}
+
+func TestClientRateLimitSuite(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		_, _ = w.Write([]byte(`{"ResourceTagMappingList":[]}`))
+	}))
+	defer server.Close()
+
+	client := newTestTaggingClient(server.URL, ClientOptions{Limiter: rate.NewLimiter(rate.Every(50*time.Millisecond), 1)})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := client.GetResources(context.TODO(), &resourcegroupstaggingapi.GetResourcesInput{})
+		assert.NoError(err)
+	}
+	assert.GreaterOrEqual(time.Since(start), 100*time.Millisecond)
+}
+
+func TestThrottleRetryerSuite(t *testing.T) {
+	assert := assert.New(t)
+	var throttles int64
+	r := ClientOptions{MaxAttempts: 7, Throttles: &throttles}.retryer()
+	assert.Equal(7, r.MaxAttempts())
+	assert.Equal(3, ClientOptions{RetryMode: aws.RetryModeStandard}.retryer().MaxAttempts())
+	assert.True(r.IsErrorRetryable(&smithy.GenericAPIError{Code: "ThrottlingException"}))
+	assert.False(r.IsErrorRetryable(&smithy.GenericAPIError{Code: "AccessDenied"}))
+	assert.Equal(int64(1), throttles)
+}
+
+func TestLimiterPoolSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(newLimiterPool(0).get("111111111111", "us-east-1"))
+
+	pool := newLimiterPool(2)
+	limiter := pool.get("111111111111", "us-east-1")
+	assert.NotNil(limiter)
+	assert.Equal(rate.Limit(2), limiter.Limit())
+	assert.Same(limiter, pool.get("111111111111", "us-east-1"))
+	assert.NotSame(limiter, pool.get("111111111111", "eu-west-1"))
+}
@@ -0,0 +1,219 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	rt "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+
+	"tagu/models"
+)
+
+var (
+	compliancesummarygetpaginator = newGetComplianceSummaryPaginator
+	reportcreationapi             = newReportCreationAPI
+	// reportPollInterval is the delay between two DescribeReportCreation calls, replaced in the unittest
+	reportPollInterval = 10 * time.Second
+)
+
+// ComplianceRegion is the only region serving the organization compliance APIs
+const ComplianceRegion = "us-east-1"
+
+// GetComplianceSummaryPager is the interface that defines the GetComplianceSummary pagination logic
+// Used to make the test API simple and easy to mock
+type GetComplianceSummaryPager interface {
+	HasMorePages() bool
+	NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetComplianceSummaryOutput, error)
+}
+
+// ReportCreationAPI defines the interface for the organization report job functions.
+// We use this interface to test the function using a mocked service.
+type ReportCreationAPI interface {
+	StartReportCreation(ctx context.Context, params *resourcegroupstaggingapi.StartReportCreationInput, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.StartReportCreationOutput, error)
+	DescribeReportCreation(ctx context.Context, params *resourcegroupstaggingapi.DescribeReportCreationInput, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.DescribeReportCreationOutput, error)
+}
+
+func newGetComplianceSummaryPaginator(client resourcegroupstaggingapi.GetComplianceSummaryAPIClient, params *resourcegroupstaggingapi.GetComplianceSummaryInput) GetComplianceSummaryPager {
+	return resourcegroupstaggingapi.NewGetComplianceSummaryPaginator(client, params)
+}
+
+func newReportCreationAPI(client *resourcegroupstaggingapi.Client) ReportCreationAPI {
+	return client
+}
+
+// ComplianceFilters restricts the compliance summary
+// params:
+// 		accounts: []string, the target ids, accounts, organizational units or root
+// 		regions: []string
+// 		resourceTypes: []string, in the service[:resourceType] format
+// 		tagKeys: []string, the tag policy keys
+type ComplianceFilters struct {
+	Accounts      []string
+	Regions       []string
+	ResourceTypes []string
+	TagKeys       []string
+}
+
+// ComplianceFiltersFromSpec returns the distinct accounts, regions and resources of the spec
+func ComplianceFiltersFromSpec(spec models.Spec) (filters ComplianceFilters) {
+	seen := map[string]bool{}
+	add := func(values []string, value string) []string {
+		if value == "" || seen[value] {
+			return values
+		}
+		seen[value] = true
+		return append(values, value)
+	}
+	for _, input := range spec.FilterInput {
+		filters.Accounts = add(filters.Accounts, input.Account)
+		for _, region := range input.Regions {
+			filters.Regions = add(filters.Regions, region)
+		}
+		for _, resource := range input.FilterResources {
+			filters.ResourceTypes = add(filters.ResourceTypes, resource)
+		}
+	}
+	return filters
+}
+
+// ComplianceSummary is the number of noncompliant resources of a target, region and resource type
+type ComplianceSummary struct {
+	TargetID              string `json:"target-id"`
+	TargetIDType          string `json:"target-id-type"`
+	Region                string `json:"region"`
+	ResourceType          string `json:"resource-type"`
+	NonCompliantResources int64  `json:"noncompliant-resources"`
+	LastUpdated           string `json:"last-updated"`
+}
+
+// ReportJob is the state of the organization compliance report job
+type ReportJob struct {
+	Status       string `json:"status"`
+	S3Location   string `json:"s3-location,omitempty"`
+	StartDate    string `json:"start-date,omitempty"`
+	ErrorMessage string `json:"error-message,omitempty"`
+}
+
+// ComplianceReport is the output of Compliance
+type ComplianceReport struct {
+	Summaries []ComplianceSummary
+	Job       *ReportJob
+	Targets   TargetReports
+}
+
+// Compliance reads the organization tag policies compliance computed by AWS, grouped by
+// target, region and resource type. The target must be the organization management account,
+// an empty region defaults to ComplianceRegion. When bucket is set, a report job writing the
+// detailed compliance to the bucket is started, or joined if one is running, and waited for
+// Args:
+// 		ctx: context.Context
+// 		target: Tags
+// 		filters: ComplianceFilters
+// 		bucket: string
+// 		opts: ScanOptions
+// Returns:
+// 		ComplianceReport: the summaries, the report job and the status of the target
+// 		error: if the scan was stopped before the end
+func Compliance(ctx context.Context, target Tags, filters ComplianceFilters, bucket string, opts ScanOptions) (report ComplianceReport, err error) {
+	if target.Region == "" {
+		target.Region = ComplianceRegion
+	}
+	status := TargetReport{Account: target.Account, Region: target.Region, Status: StatusSkipped}
+	defer func() { report.Targets = TargetReports{status} }()
+	if ctx.Err() != nil {
+		return report, fmt.Errorf("scan stopped: %w", ctx.Err())
+	}
+
+	tctx, cancel := targetContext(ctx, opts)
+	defer cancel()
+
+	_, client, creds, err := connect(tctx, &target, opts.clientOptions(target, newLimiterPool(opts.RateLimit), &status.Throttles))
+	callOpts := func(o *resourcegroupstaggingapi.Options) {
+		o.Credentials = creds
+		o.Region = target.Region
+	}
+	if err == nil && bucket != "" {
+		report.Job, err = createReport(tctx, reportcreationapi(client), bucket, callOpts)
+	}
+	if err == nil {
+		report.Summaries, err = complianceSummaries(tctx, client, filters, callOpts)
+	}
+	status.classify(ctx, tctx, err)
+	status.Count = len(report.Summaries)
+	if ctx.Err() != nil {
+		return report, fmt.Errorf("scan stopped: %w", ctx.Err())
+	}
+	return report, nil
+}
+
+// complianceSummaries pages through GetComplianceSummary
+func complianceSummaries(ctx context.Context, client *resourcegroupstaggingapi.Client, filters ComplianceFilters, callOpts func(*resourcegroupstaggingapi.Options)) ([]ComplianceSummary, error) {
+	var summaries []ComplianceSummary
+	paginator := compliancesummarygetpaginator(client, &resourcegroupstaggingapi.GetComplianceSummaryInput{
+		GroupBy:             []rt.GroupByAttribute{rt.GroupByAttributeTargetId, rt.GroupByAttributeRegion, rt.GroupByAttributeResourceType},
+		TargetIdFilters:     filters.Accounts,
+		RegionFilters:       filters.Regions,
+		ResourceTypeFilters: filters.ResourceTypes,
+		TagKeyFilters:       filters.TagKeys,
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx, callOpts)
+		if err != nil {
+			return summaries, err
+		}
+		for _, s := range output.SummaryList {
+			summaries = append(summaries, ComplianceSummary{
+				TargetID:              aws.ToString(s.TargetId),
+				TargetIDType:          string(s.TargetIdType),
+				Region:                aws.ToString(s.Region),
+				ResourceType:          aws.ToString(s.ResourceType),
+				NonCompliantResources: s.NonCompliantResources,
+				LastUpdated:           aws.ToString(s.LastUpdated),
+			})
+		}
+	}
+	return summaries, nil
+}
+
+// createReport starts the report job and polls it until it succeeds or fails
+// A job already running is joined instead of failing the call
+// Args:
+// 		ctx: context.Context
+// 		api: ReportCreationAPI
+// 		bucket: string
+// 		callOpts: func(*resourcegroupstaggingapi.Options)
+// Returns:
+// 		*ReportJob: the last known state of the job
+// 		error: if the job failed or can not be started
+func createReport(ctx context.Context, api ReportCreationAPI, bucket string, callOpts func(*resourcegroupstaggingapi.Options)) (*ReportJob, error) {
+	_, err := api.StartReportCreation(ctx, &resourcegroupstaggingapi.StartReportCreationInput{S3Bucket: aws.String(bucket)}, callOpts)
+	if err != nil && errorCode(err) != "ConcurrentModificationException" {
+		return nil, err
+	}
+	for {
+		output, err := api.DescribeReportCreation(ctx, &resourcegroupstaggingapi.DescribeReportCreationInput{}, callOpts)
+		if err != nil {
+			return nil, err
+		}
+		job := &ReportJob{
+			Status:       aws.ToString(output.Status),
+			S3Location:   aws.ToString(output.S3Location),
+			StartDate:    aws.ToString(output.StartDate),
+			ErrorMessage: aws.ToString(output.ErrorMessage),
+		}
+		switch job.Status {
+		case "SUCCEEDED":
+			return job, nil
+		case "FAILED":
+			return job, fmt.Errorf("report creation failed: %s", job.ErrorMessage)
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(reportPollInterval):
+		}
+	}
+}
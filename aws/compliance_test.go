@@ -0,0 +1,242 @@
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	rt "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+type fakeComplianceSummaryPager struct {
+	params *resourcegroupstaggingapi.GetComplianceSummaryInput
+	region *string
+	done   bool
+}
+
+func (p *fakeComplianceSummaryPager) HasMorePages() bool {
+	return !p.done
+}
+
+func (p *fakeComplianceSummaryPager) NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetComplianceSummaryOutput, error) {
+	opts := resourcegroupstaggingapi.Options{}
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	*p.region = opts.Region
+	p.done = true
+	return &resourcegroupstaggingapi.GetComplianceSummaryOutput{
+		SummaryList: []rt.Summary{
+			{
+				TargetId:              aws.String("111111111111"),
+				TargetIdType:          rt.TargetIdTypeAccount,
+				Region:                aws.String("eu-west-1"),
+				ResourceType:          aws.String("ec2:instance"),
+				NonCompliantResources: 3,
+				LastUpdated:           aws.String("2022-06-01T12:00:00Z"),
+			},
+		},
+	}, nil
+}
+
+// fakeReportCreation runs the report job for the given number of polls
+type fakeReportCreation struct {
+	startErr error
+	polls    int
+	status   string
+	started  string
+}
+
+func (f *fakeReportCreation) StartReportCreation(ctx context.Context, params *resourcegroupstaggingapi.StartReportCreationInput, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.StartReportCreationOutput, error) {
+	f.started = aws.ToString(params.S3Bucket)
+	return &resourcegroupstaggingapi.StartReportCreationOutput{}, f.startErr
+}
+
+func (f *fakeReportCreation) DescribeReportCreation(ctx context.Context, params *resourcegroupstaggingapi.DescribeReportCreationInput, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.DescribeReportCreationOutput, error) {
+	f.polls--
+	status := "RUNNING"
+	if f.polls <= 0 {
+		status = f.status
+	}
+	return &resourcegroupstaggingapi.DescribeReportCreationOutput{
+		Status:       aws.String(status),
+		S3Location:   aws.String("s3://reports/report.csv"),
+		ErrorMessage: aws.String("access denied to the bucket"),
+	}, nil
+}
+
+func TestComplianceFiltersFromSpecSuite(t *testing.T) {
+	assert := assert.New(t)
+	spec := models.Spec{FilterInput: []models.InputTag{
+		{Account: "111111111111", Regions: []string{"us-east-1", "eu-west-1"}, FilterResources: []string{"ec2:instance"}},
+		{Account: "222222222222", Regions: []string{"us-east-1"}, FilterResources: []string{"ec2:instance", "s3"}},
+	}}
+	assert.Equal(ComplianceFilters{
+		Accounts:      []string{"111111111111", "222222222222"},
+		Regions:       []string{"us-east-1", "eu-west-1"},
+		ResourceTypes: []string{"ec2:instance", "s3"},
+	}, ComplianceFiltersFromSpec(spec))
+}
+
+func TestComplianceSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	var params *resourcegroupstaggingapi.GetComplianceSummaryInput
+	var region string
+	compliancesummarygetpaginator = func(client resourcegroupstaggingapi.GetComplianceSummaryAPIClient, input *resourcegroupstaggingapi.GetComplianceSummaryInput) GetComplianceSummaryPager {
+		params = input
+		return &fakeComplianceSummaryPager{region: &region}
+	}
+	reportPollInterval = time.Millisecond
+	defer func() {
+		compliancesummarygetpaginator = newGetComplianceSummaryPaginator
+		reportcreationapi = newReportCreationAPI
+		reportPollInterval = 10 * time.Second
+	}()
+
+	filters := ComplianceFilters{Accounts: []string{"111111111111"}, TagKeys: []string{"env"}}
+
+	fixtures := []struct {
+		name    string
+		target  Tags
+		bucket  string
+		reports *fakeReportCreation
+		region  string
+		job     *ReportJob
+		status  TargetStatus
+		count   int
+	}{
+		{
+			name:   "Compliance summary in the default region",
+			target: Tags{Account: "111111111111"},
+			region: "us-east-1",
+			status: StatusOK,
+			count:  1,
+		},
+		{
+			name:    "Compliance waits for the report job",
+			target:  Tags{Account: "111111111111", Region: "us-east-1"},
+			bucket:  "reports",
+			reports: &fakeReportCreation{polls: 3, status: "SUCCEEDED"},
+			region:  "us-east-1",
+			job:     &ReportJob{Status: "SUCCEEDED", S3Location: "s3://reports/report.csv", ErrorMessage: "access denied to the bucket"},
+			status:  StatusOK,
+			count:   1,
+		},
+		{
+			name:    "Compliance joins the running report job",
+			target:  Tags{Account: "111111111111"},
+			bucket:  "reports",
+			reports: &fakeReportCreation{startErr: &smithy.GenericAPIError{Code: "ConcurrentModificationException"}, polls: 1, status: "SUCCEEDED"},
+			region:  "us-east-1",
+			job:     &ReportJob{Status: "SUCCEEDED", S3Location: "s3://reports/report.csv", ErrorMessage: "access denied to the bucket"},
+			status:  StatusOK,
+			count:   1,
+		},
+		{
+			name:    "Compliance reports the failed job",
+			target:  Tags{Account: "111111111111"},
+			bucket:  "reports",
+			reports: &fakeReportCreation{polls: 1, status: "FAILED"},
+			job:     &ReportJob{Status: "FAILED", S3Location: "s3://reports/report.csv", ErrorMessage: "access denied to the bucket"},
+			status:  StatusFailed,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			region, params = "", nil
+			reportcreationapi = func(client *resourcegroupstaggingapi.Client) ReportCreationAPI {
+				return fixture.reports
+			}
+			report, err := Compliance(context.TODO(), fixture.target, filters, fixture.bucket, ScanOptions{})
+			assert.NoError(err)
+			assert.Equal(fixture.region, region)
+			assert.Equal(fixture.job, report.Job)
+			assert.Equal(fixture.status, report.Targets[0].Status)
+			assert.Equal(fixture.count, report.Targets[0].Count)
+			if fixture.reports != nil {
+				assert.Equal(fixture.bucket, fixture.reports.started)
+			}
+			if fixture.count > 0 {
+				assert.Equal([]rt.GroupByAttribute{rt.GroupByAttributeTargetId, rt.GroupByAttributeRegion, rt.GroupByAttributeResourceType}, params.GroupBy)
+				assert.Equal([]string{"111111111111"}, params.TargetIdFilters)
+				assert.Equal([]string{"env"}, params.TagKeyFilters)
+				assert.Equal(ComplianceSummary{
+					TargetID:              "111111111111",
+					TargetIDType:          "ACCOUNT",
+					Region:                "eu-west-1",
+					ResourceType:          "ec2:instance",
+					NonCompliantResources: 3,
+					LastUpdated:           "2022-06-01T12:00:00Z",
+				}, report.Summaries[0])
+			}
+		})
+	}
+
+	t.Run("Compliance stops on a canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		report, err := Compliance(ctx, Tags{Account: "111111111111"}, filters, "", ScanOptions{})
+		assert.EqualError(err, "scan stopped: context canceled")
+		assert.Equal(StatusSkipped, report.Targets[0].Status)
+	})
+}
+
+// fakeCompliancePager returns a single resource with its compliance details
+type fakeCompliancePager struct {
+	params *resourcegroupstaggingapi.GetResourcesInput
+	done   bool
+}
+
+func (p *fakeCompliancePager) HasMorePages() bool {
+	return !p.done
+}
+
+func (p *fakeCompliancePager) NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
+	p.done = true
+	item := rt.ResourceTagMapping{
+		ResourceARN: aws.String("arn:aws:ec2:us-east-1:123456789012:instance/i-1"),
+		Tags:        []rt.Tag{{Key: aws.String("env"), Value: aws.String("Prod")}},
+	}
+	if aws.ToBool(p.params.IncludeComplianceDetails) {
+		item.ComplianceDetails = &rt.ComplianceDetails{
+			ComplianceStatus:           aws.Bool(false),
+			NoncompliantKeys:           []string{"cost-center"},
+			KeysWithNoncompliantValues: []string{"env"},
+		}
+	}
+	return &resourcegroupstaggingapi.GetResourcesOutput{ResourceTagMappingList: []rt.ResourceTagMapping{item}}, nil
+}
+
+func TestScanComplianceDetailsSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+	resourcegroupgetpaginator = func(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) GetResourcesTagsPager {
+		return &fakeCompliancePager{params: params}
+	}
+	defer mockScanClients()
+
+	spec := models.Spec{FilterInput: []models.InputTag{{Account: "123456789012", Regions: []string{"us-east-1"}}}}
+
+	report, err := Scan(context.TODO(), spec, ScanOptions{})
+	assert.NoError(err)
+	assert.Nil(report.Results[0].Compliant)
+	assert.Empty(report.Results[0].NoncompliantKeys)
+
+	report, err = Scan(context.TODO(), spec, ScanOptions{ComplianceDetails: true})
+	assert.NoError(err)
+	assert.Equal(aws.Bool(false), report.Results[0].Compliant)
+	assert.Equal([]string{"cost-center"}, report.Results[0].NoncompliantKeys)
+	assert.Equal([]string{"env"}, report.Results[0].KeysWithNoncompliantValues)
+
+	// The compliance details are part of the cache key
+	assert.NotEqual(Tags{Account: "123456789012", Region: "us-east-1"}.key(), Tags{Account: "123456789012", Region: "us-east-1", ComplianceDetails: true}.key())
+}
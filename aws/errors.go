@@ -0,0 +1,102 @@
+package aws
+
+import (
+	"errors"
+	"net"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ErrorCause is the classified reason of a target failure
+type ErrorCause string
+
+const (
+	// CauseNone the target did not fail
+	CauseNone ErrorCause = ""
+	// CauseAccessDenied the role can not be assumed or the call is not allowed
+	CauseAccessDenied ErrorCause = "access-denied"
+	// CauseRegionDisabled the region is not enabled for the account
+	CauseRegionDisabled ErrorCause = "region-disabled"
+	// CauseThrottled the API rejected the calls because of the request rate
+	CauseThrottled ErrorCause = "throttled"
+	// CauseNetwork the request never reached the API
+	CauseNetwork ErrorCause = "network"
+	// CauseUnknown any other error
+	CauseUnknown ErrorCause = "unknown"
+)
+
+var errorCodeCauses = map[string]ErrorCause{
+	"AccessDenied":                CauseAccessDenied,
+	"AccessDeniedException":       CauseAccessDenied,
+	"UnauthorizedOperation":       CauseAccessDenied,
+	"AuthorizationError":          CauseAccessDenied,
+	"ExpiredToken":                CauseAccessDenied,
+	"RegionDisabledException":     CauseRegionDisabled,
+	"OptInRequired":               CauseRegionDisabled,
+	"InvalidClientTokenId":        CauseAccessDenied,
+	"UnrecognizedClientException": CauseAccessDenied,
+	"Throttling":                  CauseThrottled,
+	"ThrottlingException":         CauseThrottled,
+	"ThrottledException":          CauseThrottled,
+	"TooManyRequestsException":    CauseThrottled,
+	"RequestLimitExceeded":        CauseThrottled,
+}
+
+// ClassifyError maps an AWS SDK error to its cause
+// An invalid token is reported as access denied, the scan tells it apart from
+// an opt-in region not enabled for the account with isInvalidToken
+// Args:
+// 		err: error
+// Returns:
+// 		ErrorCause: the error cause, CauseNone for a nil error
+func ClassifyError(err error) ErrorCause {
+	if err == nil {
+		return CauseNone
+	}
+	var disabled regionDisabledError
+	if errors.As(err, &disabled) {
+		return CauseRegionDisabled
+	}
+	if code := errorCode(err); code != "" {
+		if cause, ok := errorCodeCauses[code]; ok {
+			return cause
+		}
+		return CauseUnknown
+	}
+	var sendErr *smithyhttp.RequestSendError
+	var netErr net.Error
+	if errors.As(err, &sendErr) || errors.As(err, &netErr) {
+		return CauseNetwork
+	}
+	return CauseUnknown
+}
+
+// regionDisabledError is an invalid token error of an opt-in region not enabled for the account
+type regionDisabledError struct {
+	err error
+}
+
+func (e regionDisabledError) Error() string {
+	return e.err.Error()
+}
+
+func (e regionDisabledError) Unwrap() error {
+	return e.err
+}
+
+// isInvalidToken tells whether the credentials were rejected, opt-in regions not
+// enabled for the account answer with the same codes as invalid credentials
+func isInvalidToken(err error) bool {
+	code := errorCode(err)
+	return code == "InvalidClientTokenId" || code == "UnrecognizedClientException"
+}
+
+// errorCode returns the AWS error code of err, empty if it is not an API error
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
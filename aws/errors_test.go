@@ -0,0 +1,42 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyErrorSuite(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		input    error
+		expected ErrorCause
+	}{
+		{"Classify nil error", nil, CauseNone},
+		{"Classify access denied", &smithy.GenericAPIError{Code: "AccessDenied"}, CauseAccessDenied},
+		{
+			"Classify wrapped access denied",
+			&smithy.OperationError{ServiceID: "STS", OperationName: "AssumeRole", Err: &smithy.GenericAPIError{Code: "AccessDenied"}},
+			CauseAccessDenied,
+		},
+		{"Classify disabled region", &smithy.GenericAPIError{Code: "OptInRequired"}, CauseRegionDisabled},
+		{"Classify invalid token", &smithy.GenericAPIError{Code: "UnrecognizedClientException"}, CauseAccessDenied},
+		{"Classify invalid token of a disabled region", regionDisabledError{err: &smithy.GenericAPIError{Code: "InvalidClientTokenId"}}, CauseRegionDisabled},
+		{"Classify throttling", fmt.Errorf("page: %w", &smithy.GenericAPIError{Code: "ThrottlingException"}), CauseThrottled},
+		{"Classify network error", &smithyhttp.RequestSendError{Err: &net.DNSError{Err: "no such host"}}, CauseNetwork},
+		{"Classify unknown api error", &smithy.GenericAPIError{Code: "InternalServiceException"}, CauseUnknown},
+		{"Classify unknown error", errors.New("boom"), CauseUnknown},
+	}
+
+	assert := assert.New(t)
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, ClassifyError(fixture.input))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+
+	"tagu/models"
+)
+
+var (
+	tagkeysgetpaginator   = newGetTagKeysPaginator
+	tagvaluesgetpaginator = newGetTagValuesPaginator
+)
+
+// GetTagKeysPager is the interface that defines the GetTagKeys pagination logic
+// Used to make the test API simple and easy to mock
+type GetTagKeysPager interface {
+	HasMorePages() bool
+	NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetTagKeysOutput, error)
+}
+
+// GetTagValuesPager is the interface that defines the GetTagValues pagination logic
+// Used to make the test API simple and easy to mock
+type GetTagValuesPager interface {
+	HasMorePages() bool
+	NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetTagValuesOutput, error)
+}
+
+func newGetTagKeysPaginator(client resourcegroupstaggingapi.GetTagKeysAPIClient, params *resourcegroupstaggingapi.GetTagKeysInput) GetTagKeysPager {
+	return resourcegroupstaggingapi.NewGetTagKeysPaginator(client, params)
+}
+
+func newGetTagValuesPaginator(client resourcegroupstaggingapi.GetTagValuesAPIClient, params *resourcegroupstaggingapi.GetTagValuesInput) GetTagValuesPager {
+	return resourcegroupstaggingapi.NewGetTagValuesPaginator(client, params)
+}
+
+// Location is an account and region where a tag key or value is used
+type Location struct {
+	Account string
+	Region  string
+}
+
+// InventoryItem is a distinct tag key or value with the locations using it
+type InventoryItem struct {
+	Name      string
+	Locations []Location
+}
+
+// Accounts returns the distinct accounts using the item
+func (i InventoryItem) Accounts() []string {
+	return i.distinct(func(l Location) string { return l.Account })
+}
+
+// Regions returns the distinct regions using the item
+func (i InventoryItem) Regions() []string {
+	return i.distinct(func(l Location) string { return l.Region })
+}
+
+func (i InventoryItem) distinct(field func(Location) string) []string {
+	seen := map[string]bool{}
+	var values []string
+	for _, location := range i.Locations {
+		if value := field(location); !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// Inventory is the output of TagKeys and TagValues
+type Inventory struct {
+	Items   []InventoryItem
+	Targets TargetReports
+}
+
+// tagLister lists the tag keys or values of a single account/region
+type tagLister func(ctx context.Context, client *resourcegroupstaggingapi.Client, callOpts func(*resourcegroupstaggingapi.Options)) ([]string, error)
+
+// TagKeys lists the distinct tag keys used in every account/region of the spec
+// Args:
+// 		ctx: context.Context
+// 		spec: models.Spec
+// 		opts: ScanOptions
+// Returns:
+// 		Inventory: the keys sorted by name and the status of each target
+// 		error: if the scan was stopped before the end
+func TagKeys(ctx context.Context, spec models.Spec, opts ScanOptions) (Inventory, error) {
+	return inventory(ctx, spec, opts, func(ctx context.Context, client *resourcegroupstaggingapi.Client, callOpts func(*resourcegroupstaggingapi.Options)) ([]string, error) {
+		var keys []string
+		paginator := tagkeysgetpaginator(client, &resourcegroupstaggingapi.GetTagKeysInput{})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx, callOpts)
+			if err != nil {
+				return keys, err
+			}
+			keys = append(keys, output.TagKeys...)
+		}
+		return keys, nil
+	})
+}
+
+// TagValues lists the distinct values of the tag key used in every account/region of the spec
+// Args:
+// 		ctx: context.Context
+// 		spec: models.Spec
+// 		key: string
+// 		opts: ScanOptions
+// Returns:
+// 		Inventory: the values sorted by name and the status of each target
+// 		error: if the scan was stopped before the end
+func TagValues(ctx context.Context, spec models.Spec, key string, opts ScanOptions) (Inventory, error) {
+	return inventory(ctx, spec, opts, func(ctx context.Context, client *resourcegroupstaggingapi.Client, callOpts func(*resourcegroupstaggingapi.Options)) ([]string, error) {
+		var values []string
+		paginator := tagvaluesgetpaginator(client, &resourcegroupstaggingapi.GetTagValuesInput{Key: aws.String(key)})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx, callOpts)
+			if err != nil {
+				return values, err
+			}
+			values = append(values, output.TagValues...)
+		}
+		return values, nil
+	})
+}
+
+// inventory runs the lister once per distinct account/region of the spec,
+// the filters of the spec do not apply to the tag keys and values APIs
+func inventory(ctx context.Context, spec models.Spec, opts ScanOptions, list tagLister) (inventory Inventory, err error) {
+	var targets []Tags
+	seen := map[string]bool{}
+	for _, target := range Targets(spec) {
+		target.FilterResources, target.FilterTags = nil, nil
+		if !seen[target.key()] {
+			seen[target.key()] = true
+			targets = append(targets, target)
+		}
+	}
+
+	var mu sync.Mutex
+	usage := map[string][]Location{}
+	reports := make(TargetReports, len(targets))
+	limiters := newLimiterPool(opts.RateLimit)
+	forEachTarget(len(targets), opts.Concurrency, func(idx int) {
+		target := targets[idx]
+		report := TargetReport{Account: target.Account, Region: target.Region, Status: StatusSkipped}
+		defer func() { reports[idx] = report }()
+		if ctx.Err() != nil {
+			return
+		}
+		tctx, cancel := targetContext(ctx, opts)
+		defer cancel()
+
+		cfg, client, creds, err := connect(tctx, &target, opts.clientOptions(target, limiters, &report.Throttles))
+		var names []string
+		if err == nil {
+			region := target.setupRegion(cfg)
+			report.Region = region
+			names, err = list(tctx, client, func(o *resourcegroupstaggingapi.Options) {
+				o.Credentials = creds
+				o.Region = region
+			})
+		}
+		report.classify(ctx, tctx, err)
+		report.Count = len(names)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, name := range names {
+			usage[name] = append(usage[name], Location{Account: target.Account, Region: report.Region})
+		}
+	})
+
+	for name, locations := range usage {
+		sort.Slice(locations, func(i, j int) bool {
+			if locations[i].Account != locations[j].Account {
+				return locations[i].Account < locations[j].Account
+			}
+			return locations[i].Region < locations[j].Region
+		})
+		inventory.Items = append(inventory.Items, InventoryItem{Name: name, Locations: locations})
+	}
+	sort.Slice(inventory.Items, func(i, j int) bool {
+		return inventory.Items[i].Name < inventory.Items[j].Name
+	})
+	inventory.Targets = reports
+	if ctx.Err() != nil {
+		return inventory, fmt.Errorf("scan stopped: %w", ctx.Err())
+	}
+	return inventory, nil
+}
@@ -0,0 +1,126 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+// fakeInventoryPager returns the names of the region on a single page,
+// the region named "fail" returns an error
+type fakeInventoryPager struct {
+	names map[string][]string
+	done  bool
+}
+
+func (p *fakeInventoryPager) HasMorePages() bool {
+	return !p.done
+}
+
+func (p *fakeInventoryPager) page(optFns []func(*resourcegroupstaggingapi.Options)) ([]string, error) {
+	opts := resourcegroupstaggingapi.Options{}
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	if opts.Region == "fail" {
+		return nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized"}
+	}
+	p.done = true
+	return p.names[opts.Region], nil
+}
+
+type fakeTagKeysPager struct{ fakeInventoryPager }
+
+func (p *fakeTagKeysPager) NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetTagKeysOutput, error) {
+	keys, err := p.page(optFns)
+	if err != nil {
+		return nil, err
+	}
+	return &resourcegroupstaggingapi.GetTagKeysOutput{TagKeys: keys}, nil
+}
+
+type fakeTagValuesPager struct{ fakeInventoryPager }
+
+func (p *fakeTagValuesPager) NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetTagValuesOutput, error) {
+	values, err := p.page(optFns)
+	if err != nil {
+		return nil, err
+	}
+	return &resourcegroupstaggingapi.GetTagValuesOutput{TagValues: values}, nil
+}
+
+func TestInventorySuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	var keysRequests int
+	tagkeysgetpaginator = func(client resourcegroupstaggingapi.GetTagKeysAPIClient, params *resourcegroupstaggingapi.GetTagKeysInput) GetTagKeysPager {
+		keysRequests++
+		return &fakeTagKeysPager{fakeInventoryPager{names: map[string][]string{
+			"us-east-1": {"env", "team"},
+			"eu-west-1": {"env", "Env"},
+		}}}
+	}
+	var valuesKey string
+	tagvaluesgetpaginator = func(client resourcegroupstaggingapi.GetTagValuesAPIClient, params *resourcegroupstaggingapi.GetTagValuesInput) GetTagValuesPager {
+		valuesKey = aws.ToString(params.Key)
+		return &fakeTagValuesPager{fakeInventoryPager{names: map[string][]string{
+			"us-east-1": {"prod"},
+			"eu-west-1": {"dev", "prod"},
+		}}}
+	}
+	defer func() {
+		tagkeysgetpaginator = newGetTagKeysPaginator
+		tagvaluesgetpaginator = newGetTagValuesPaginator
+	}()
+
+	spec := models.Spec{FilterInput: []models.InputTag{
+		{Account: "111111111111", Regions: []string{"us-east-1", "eu-west-1"}, FilterResources: []string{"ec2"}},
+		{Account: "111111111111", Regions: []string{"us-east-1"}, FilterResources: []string{"s3"}},
+		{Account: "222222222222", Regions: []string{"us-east-1", "fail"}},
+	}}
+
+	t.Run("TagKeys aggregates the keys of the distinct targets", func(t *testing.T) {
+		inventory, err := TagKeys(context.TODO(), spec, ScanOptions{})
+		assert.NoError(err)
+		assert.Equal(4, keysRequests)
+		assert.Equal([]string{"Env", "env", "team"}, []string{inventory.Items[0].Name, inventory.Items[1].Name, inventory.Items[2].Name})
+		assert.Equal([]Location{
+			{Account: "111111111111", Region: "eu-west-1"},
+			{Account: "111111111111", Region: "us-east-1"},
+			{Account: "222222222222", Region: "us-east-1"},
+		}, inventory.Items[1].Locations)
+		assert.Equal([]string{"111111111111", "222222222222"}, inventory.Items[1].Accounts())
+		assert.Equal([]string{"eu-west-1", "us-east-1"}, inventory.Items[1].Regions())
+		assert.Equal([]TargetStatus{StatusOK, StatusOK, StatusOK, StatusFailed}, []TargetStatus{
+			inventory.Targets[0].Status, inventory.Targets[1].Status, inventory.Targets[2].Status, inventory.Targets[3].Status,
+		})
+		assert.Equal(CauseAccessDenied, inventory.Targets[3].Cause)
+		assert.Equal(2, inventory.Targets[0].Count)
+	})
+
+	t.Run("TagValues lists the values of the key", func(t *testing.T) {
+		inventory, err := TagValues(context.TODO(), spec, "env", ScanOptions{})
+		assert.NoError(err)
+		assert.Equal("env", valuesKey)
+		assert.Len(inventory.Items, 2)
+		assert.Equal("dev", inventory.Items[0].Name)
+		assert.Equal("prod", inventory.Items[1].Name)
+		assert.Len(inventory.Items[1].Locations, 3)
+	})
+
+	t.Run("TagKeys stops on a canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		inventory, err := TagKeys(ctx, spec, ScanOptions{})
+		assert.EqualError(err, "scan stopped: context canceled")
+		assert.Empty(inventory.Items)
+		assert.Equal(StatusSkipped, inventory.Targets[0].Status)
+	})
+}
@@ -0,0 +1,118 @@
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ChangeStatus is the outcome of a tag write on a resource
+type ChangeStatus string
+
+const (
+	// ChangePlanned the write was only planned by a dry-run
+	ChangePlanned ChangeStatus = "planned"
+	// ChangeApplied the write succeeded
+	ChangeApplied ChangeStatus = "applied"
+	// ChangeFailed the write returned an error
+	ChangeFailed ChangeStatus = "failed"
+)
+
+// TagChange is the mutation of a single tag key
+// A nil Previous means the key was absent, a nil Value means the key is removed
+type TagChange struct {
+	Key      string  `json:"key"`
+	Previous *string `json:"previous"`
+	Value    *string `json:"value"`
+}
+
+// ResourceChange is a tag write on a resource, a single TagResources or UntagResources call
+// RoleName is the role assumed in the account, empty when the default credentials were used
+type ResourceChange struct {
+	Time     time.Time    `json:"time"`
+	Account  string       `json:"account"`
+	Region   string       `json:"region"`
+	RoleName string       `json:"role-name,omitempty"`
+	ARN      string       `json:"arn"`
+	Changes  []TagChange  `json:"changes"`
+	Status   ChangeStatus `json:"status"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// Journal records the tag writes to an append-only JSON lines file
+// Every write is recorded as soon as it returns, the planned ones included
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenJournal opens the journal file, the records are appended to the existing ones
+// Args:
+// 		path: string
+// Returns:
+// 		*Journal: the journal to pass to the writes
+// 		error: if the file can not be opened
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{file: file}, nil
+}
+
+// record appends the change to the journal, a nil journal records nothing
+func (j *Journal) record(change ResourceChange) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	line, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// ReadJournal reads the changes recorded in a journal file
+// A last line left half written by a killed run is ignored
+// Args:
+// 		path: string
+// Returns:
+// 		[]ResourceChange: the changes in the recorded order
+// 		error: if the file can not be read or a complete line is not a valid change
+func ReadJournal(path string) ([]ResourceChange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var changes []ResourceChange
+	reader := bufio.NewReader(file)
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return changes, nil
+		}
+		if err != nil {
+			return changes, err
+		}
+		var change ResourceChange
+		if err := json.Unmarshal(bytes.TrimSpace(line), &change); err != nil {
+			return changes, fmt.Errorf("invalid journal %s line %d: %w", path, n, err)
+		}
+		changes = append(changes, change)
+	}
+}
@@ -0,0 +1,83 @@
+package aws
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalSuite(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	// A nil journal records nothing
+	var none *Journal
+	assert.NoError(none.record(ResourceChange{ARN: "arn"}))
+
+	for _, arn := range []string{"arn-1", "arn-2"} {
+		journal, err := OpenJournal(path)
+		assert.NoError(err)
+		assert.NoError(journal.record(ResourceChange{ARN: arn, Status: ChangeApplied}))
+		assert.NoError(journal.Close())
+	}
+
+	// The records of every run are kept
+	data, err := os.ReadFile(path)
+	assert.NoError(err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(lines, 2)
+	assert.Contains(lines[0], `"arn":"arn-1"`)
+	assert.Contains(lines[1], `"arn":"arn-2"`)
+
+	_, err = OpenJournal(filepath.Join(t.TempDir(), "missing", "journal.jsonl"))
+	assert.Error(err)
+}
+
+func TestReadJournalSuite(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	fixtures := []struct {
+		name    string
+		content string
+		arns    []string
+		err     string
+	}{
+		{
+			name:    "Read the changes",
+			content: "{\"arn\":\"arn-1\",\"status\":\"applied\"}\n{\"arn\":\"arn-2\",\"status\":\"failed\"}\n",
+			arns:    []string{"arn-1", "arn-2"},
+		},
+		{
+			name:    "Ignore a half written last line",
+			content: "{\"arn\":\"arn-1\",\"status\":\"applied\"}\n{\"arn\":\"ar",
+			arns:    []string{"arn-1"},
+		},
+		{
+			name:    "Reject an invalid line",
+			content: "{\"arn\":\"arn-1\"}\nnot json\n",
+			err:     "line 2",
+		},
+	}
+
+	for i, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+".jsonl")
+			assert.NoError(os.WriteFile(path, []byte(fixture.content), 0o644))
+			changes, err := ReadJournal(path)
+			if fixture.err != "" {
+				assert.ErrorContains(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			var arns []string
+			for _, change := range changes {
+				arns = append(arns, change.ARN)
+			}
+			assert.Equal(fixture.arns, arns)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"tagu/models"
+	"tagu/provider"
+)
+
+// ProviderName is the name of the AWS provider
+const ProviderName = "aws"
+
+// Provider scans the spec behind provider.Provider, a target is an account and
+// region input of the spec listed with the tagging API. The targets use the
+// retries, rate limits, state file and cache of the options
+type Provider struct {
+	spec     models.Spec
+	opts     ScanOptions
+	targets  []Tags
+	limiters *limiterPool
+}
+
+// NewProvider creates the provider of the spec
+// Args:
+// 		spec: models.Spec
+// 		opts: ScanOptions, the concurrency is left to provider.Scan
+// Returns:
+// 		*Provider
+func NewProvider(spec models.Spec, opts ScanOptions) *Provider {
+	targets := Targets(spec)
+	for i := range targets {
+		targets[i].ComplianceDetails = opts.ComplianceDetails
+	}
+	return &Provider{spec: spec, opts: opts, targets: targets, limiters: newLimiterPool(opts.RateLimit)}
+}
+
+// Name returns aws
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// Targets returns a target per account and region input of the spec, the id
+// is the digest of the input filters if any
+func (p *Provider) Targets(ctx context.Context) ([]provider.Target, error) {
+	var targets []provider.Target
+	for _, t := range p.targets {
+		targets = append(targets, targetOf(t))
+	}
+	return targets, nil
+}
+
+func targetOf(t Tags) provider.Target {
+	id := strings.TrimPrefix(t.key(), t.Account+"/"+t.Region)
+	return provider.Target{Scope: t.Account, Location: t.Region, ID: strings.TrimPrefix(id, "/")}
+}
+
+// Resources lists the tagged resources of the target
+func (p *Provider) Resources(ctx context.Context, target provider.Target) ([]provider.Resource, error) {
+	for _, t := range p.targets {
+		if targetOf(t) != target {
+			continue
+		}
+		result := scanTarget(ctx, t, p.opts, p.limiters)
+		if result.Status == StatusSkipped {
+			return ToResources(result.output), ctx.Err()
+		}
+		return ToResources(result.output), result.Err
+	}
+	return nil, fmt.Errorf("unknown target %s", target)
+}
+
+// Classify returns the cause of a tagging API error
+func (p *Provider) Classify(err error) string {
+	return string(ClassifyError(err))
+}
+
+// WriteTags writes the tags with the role of the spec, the keys are set then removed
+func (p *Provider) WriteTags(ctx context.Context, writes []provider.TagWrite) ([]provider.WriteResult, error) {
+	var awsWrites []TagWrite
+	for _, w := range writes {
+		write := TagWrite{Account: w.Resource.Scope, Region: w.Resource.Location, ARN: w.Resource.ID, Untag: w.Remove}
+		keys := make([]string, 0, len(w.Set))
+		for key := range w.Set {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := w.Set[key]
+			write.Tags = append(write.Tags, TagChange{Key: key, Value: &value})
+		}
+		awsWrites = append(awsWrites, write)
+	}
+
+	changes, targets, err := ApplyTags(ctx, awsWrites, WriteOptions{ScanOptions: p.opts, RoleName: p.spec.RoleName})
+	failures := map[string]string{}
+	for _, change := range changes {
+		if change.Status == ChangeFailed && failures[change.ARN] == "" {
+			failures[change.ARN] = change.Error
+		}
+	}
+	for _, t := range targets {
+		if t.Err != nil {
+			for _, w := range awsWrites {
+				if w.Account == t.Account && w.Region == t.Region && failures[w.ARN] == "" {
+					failures[w.ARN] = t.Err.Error()
+				}
+			}
+		}
+	}
+	var results []provider.WriteResult
+	for _, w := range awsWrites {
+		results = append(results, provider.WriteResult{ID: w.ARN, Error: failures[w.ARN]})
+	}
+	return results, err
+}
+
+// ToResources groups the tags of the results by resource in the results order
+// Args:
+// 		results: []RessourceTagResult
+// Returns:
+// 		[]provider.Resource: the resources identified by their ARN
+func ToResources(results []RessourceTagResult) []provider.Resource {
+	var resources []provider.Resource
+	index := map[string]int{}
+	for _, r := range results {
+		arn := r.ARN()
+		idx, ok := index[arn]
+		if !ok {
+			idx = len(resources)
+			index[arn] = idx
+			resources = append(resources, provider.Resource{
+				Provider: ProviderName,
+				Scope:    r.Account,
+				Location: r.Region,
+				Type:     r.Type(),
+				ID:       arn,
+				Tags:     map[string]string{},
+			})
+		}
+		if !r.Untagged() {
+			resources[idx].Tags[r.Key] = r.Value
+		}
+	}
+	return resources
+}
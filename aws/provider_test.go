@@ -0,0 +1,92 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+	"tagu/provider"
+)
+
+func TestToResourcesSuite(t *testing.T) {
+	assert := assert.New(t)
+	results := []RessourceTagResult{
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"},
+		{Account: "1", Region: "", Service: "s3", Resource: "logs", Key: "env", Value: "dev"},
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "owner", Value: "web"},
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "volume/vol-1"},
+	}
+	assert.Equal([]provider.Resource{
+		{Provider: "aws", Scope: "1", Location: "us-east-1", Type: "ec2:instance", ID: "arn:aws:ec2:us-east-1:1:instance/i-1", Tags: map[string]string{"env": "prod", "owner": "web"}},
+		{Provider: "aws", Scope: "1", Location: "", Type: "s3", ID: "arn:aws:s3::1:logs", Tags: map[string]string{"env": "dev"}},
+		{Provider: "aws", Scope: "1", Location: "us-east-1", Type: "ec2:volume", ID: "arn:aws:ec2:us-east-1:1:volume/vol-1", Tags: map[string]string{}},
+	}, ToResources(results))
+	assert.Nil(ToResources(nil))
+}
+
+func TestProviderSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	spec := models.Spec{FilterInput: []models.InputTag{
+		{Account: "123456789012", Regions: []string{"us-east-1", "fail"}},
+		{Account: "123456789012", Regions: []string{"eu-west-1"}, FilterResources: []string{"ec2:instance"}},
+	}}
+	p := NewProvider(spec, ScanOptions{})
+	assert.Equal("aws", p.Name())
+
+	targets, err := p.Targets(context.TODO())
+	assert.NoError(err)
+	assert.Len(targets, 3)
+	assert.Equal(provider.Target{Scope: "123456789012", Location: "us-east-1"}, targets[0])
+	assert.Equal("eu-west-1", targets[2].Location)
+	assert.Len(targets[2].ID, 16)
+
+	report, err := provider.Scan(context.TODO(), p, provider.ScanOptions{Concurrency: 2})
+	assert.NoError(err)
+	assert.Equal([]provider.Resource{
+		{Provider: "aws", Scope: "123456789012", Location: "us-east-1", Type: "ec2:instance", ID: "arn:aws:ec2:us-east-1:123456789012:instance/i-12345678", Tags: map[string]string{"env": "prod"}},
+		{Provider: "aws", Scope: "123456789012", Location: "eu-west-1", Type: "ec2:instance", ID: "arn:aws:ec2:eu-west-1:123456789012:instance/i-12345678", Tags: map[string]string{"env": "prod"}},
+	}, report.Resources)
+	assert.Equal(provider.StatusFailed, report.Targets[1].Status)
+	assert.Equal(string(CauseAccessDenied), report.Targets[1].Cause)
+
+	_, err = p.Resources(context.TODO(), provider.Target{Scope: "000000000000", Location: "us-east-1"})
+	assert.EqualError(err, "unknown target 000000000000/us-east-1")
+}
+
+func TestProviderWriteTagsSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	resources := map[string]map[string]string{
+		"arn:aws:ec2:us-east-1:123456789012:volume/vol-1":      {"Env": "dev"},
+		"arn:aws:ec2:us-east-1:123456789012:volume/readonly-2": {},
+	}
+	api := &fakeTagResources{resources: resources}
+	tagresourcesapi = func(client *resourcegroupstaggingapi.Client) TagResourcesAPI {
+		return api
+	}
+	defer func() { tagresourcesapi = newTagResourcesAPI }()
+
+	p := NewProvider(models.Spec{}, ScanOptions{})
+	results, err := p.WriteTags(context.TODO(), []provider.TagWrite{
+		{
+			Resource: provider.Resource{Scope: "123456789012", Location: "us-east-1", ID: "arn:aws:ec2:us-east-1:123456789012:volume/vol-1"},
+			Set:      map[string]string{"env": "dev"},
+			Remove:   []string{"Env"},
+		},
+		{
+			Resource: provider.Resource{Scope: "123456789012", Location: "us-east-1", ID: "arn:aws:ec2:us-east-1:123456789012:volume/readonly-2"},
+			Set:      map[string]string{"env": "dev"},
+		},
+	})
+	assert.NoError(err)
+	assert.Len(results, 2)
+	assert.Equal(provider.WriteResult{ID: "arn:aws:ec2:us-east-1:123456789012:volume/vol-1"}, results[0])
+	assert.NotEmpty(results[1].Error)
+	assert.Equal(map[string]string{"env": "dev"}, resources["arn:aws:ec2:us-east-1:123456789012:volume/vol-1"])
+}
@@ -0,0 +1,61 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// statusRegion is called for the opt status when the target region is the default one
+const statusRegion = "us-east-1"
+
+// DescribeRegionsAPI defines the interface for the DescribeRegions function.
+// We use this interface to test the function using a mocked service.
+type DescribeRegionsAPI interface {
+	DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
+}
+
+var ec2describeregions = func(cfg aws.Config, optFns ...func(*ec2.Options)) DescribeRegionsAPI {
+	return ec2.NewFromConfig(cfg, optFns...)
+}
+
+// regionDisabled tells whether the target region is an opt-in region not enabled for
+// the account, the opt status is read from another region with the target credentials
+// Any error reading the status keeps the region as enabled
+// Args:
+// 		ctx: context.Context
+// 		t: Tags
+// 		opts: ClientOptions
+// Returns:
+// 		bool: true if the account did not opt in the region
+func regionDisabled(ctx context.Context, t Tags, opts ClientOptions) bool {
+	cfg, err := loadDefaultConfig(ctx)
+	if err != nil {
+		return false
+	}
+	creds, err := t.setupCredentials(ctx, cfg, stsnewconfig(cfg, func(o *sts.Options) {
+		o.Retryer = opts.retryer()
+	}))
+	if err != nil {
+		return false
+	}
+	region := t.setupRegion(cfg)
+	from := cfg.Region
+	if from == "" || from == region {
+		from = statusRegion
+	}
+	output, err := ec2describeregions(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{
+		AllRegions:  aws.Bool(true),
+		RegionNames: []string{region},
+	}, func(o *ec2.Options) {
+		o.Credentials = creds
+		o.Region = from
+		o.Retryer = opts.retryer()
+	})
+	if err != nil || len(output.Regions) == 0 {
+		return false
+	}
+	return aws.ToString(output.Regions[0].OptInStatus) == "not-opted-in"
+}
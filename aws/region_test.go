@@ -0,0 +1,64 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDescribeRegions answers the opt status of the requested region from the
+// disabled regions, every call fails when err is set
+type fakeDescribeRegions struct {
+	disabled map[string]bool
+	err      error
+	calls    []string
+}
+
+func (f *fakeDescribeRegions) DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	opts := ec2.Options{}
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	f.calls = append(f.calls, opts.Region)
+	if f.err != nil {
+		return nil, f.err
+	}
+	status := "opt-in-not-required"
+	if f.disabled[params.RegionNames[0]] {
+		status = "not-opted-in"
+	}
+	return &ec2.DescribeRegionsOutput{Regions: []et.Region{{RegionName: aws.String(params.RegionNames[0]), OptInStatus: aws.String(status)}}}, nil
+}
+
+func TestRegionDisabledSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		region   string
+		api      *fakeDescribeRegions
+		expected bool
+		from     string
+	}{
+		{name: "Test an opt-in region not enabled", region: "ap-east-1", api: &fakeDescribeRegions{disabled: map[string]bool{"ap-east-1": true}}, expected: true, from: "us-east-2"},
+		{name: "Test an enabled region", region: "eu-west-1", api: &fakeDescribeRegions{disabled: map[string]bool{"ap-east-1": true}}, from: "us-east-2"},
+		{name: "Test the default region is read from us-east-1", region: "us-east-2", api: &fakeDescribeRegions{}, from: "us-east-1"},
+		{name: "Test an unreadable status keeps the region", region: "ap-east-1", api: &fakeDescribeRegions{err: &smithy.GenericAPIError{Code: "AuthFailure"}}, from: "us-east-2"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			ec2describeregions = func(cfg aws.Config, optFns ...func(*ec2.Options)) DescribeRegionsAPI {
+				return fixture.api
+			}
+			assert.Equal(fixture.expected, regionDisabled(context.TODO(), Tags{Account: "123456789012", Region: fixture.region}, ClientOptions{}))
+			assert.Equal([]string{fixture.from}, fixture.api.calls)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// DescribeEC2API defines the interface for the EC2 describe functions of the relations.
+// We use this interface to test the function using a mocked service.
+type DescribeEC2API interface {
+	ec2.DescribeVolumesAPIClient
+	ec2.DescribeSnapshotsAPIClient
+	ec2.DescribeNetworkInterfacesAPIClient
+}
+
+var ec2describeapi = func(cfg aws.Config, optFns ...func(*ec2.Options)) DescribeEC2API {
+	return ec2.NewFromConfig(cfg, optFns...)
+}
+
+// Relation links an EC2 resource to the id of a related resource of the same region
+// params:
+// 		region: string
+// 		id: string, the volume, snapshot or network interface id
+// 		related: string, the attached instance, the source volume or the requester of the interface
+type Relation struct {
+	Region  string
+	ID      string
+	Related string
+}
+
+// EC2Relations describes the volumes, the snapshots owned by the account and the network
+// interfaces of every target, AWS never tags them with the resource they belong to
+// Args:
+// 		ctx: context.Context
+// 		targets: []Tags
+// 		opts: ScanOptions
+// Returns:
+// 		[]Relation: the relations in the targets order
+// 		TargetReports: the status of each account/region
+// 		error: if the calls were stopped before the end
+func EC2Relations(ctx context.Context, targets []Tags, opts ScanOptions) ([]Relation, TargetReports, error) {
+	found := make([][]Relation, len(targets))
+	reports := make(TargetReports, len(targets))
+	limiters := newLimiterPool(opts.RateLimit)
+	forEachTarget(len(targets), opts.Concurrency, func(idx int) {
+		target := targets[idx]
+		status := TargetReport{Account: target.Account, Region: target.Region, Status: StatusSkipped}
+		defer func() { reports[idx] = status }()
+		if ctx.Err() != nil {
+			return
+		}
+		tctx, cancel := targetContext(ctx, opts)
+		defer cancel()
+
+		clientOpts := opts.clientOptions(target, limiters, &status.Throttles)
+		cfg, _, creds, err := connect(tctx, &target, clientOpts)
+		var relations []Relation
+		if err == nil {
+			region := target.setupRegion(cfg)
+			api := ec2describeapi(cfg, func(o *ec2.Options) {
+				o.Retryer = clientOpts.retryer()
+				o.APIOptions = append(o.APIOptions, clientOpts.rateLimitMiddleware)
+			})
+			relations, err = describeRelations(tctx, api, region, func(o *ec2.Options) {
+				o.Credentials = creds
+				o.Region = region
+			})
+		}
+		status.classify(ctx, tctx, err)
+		status.Count = len(relations)
+		found[idx] = relations
+	})
+
+	var relations []Relation
+	for _, r := range found {
+		relations = append(relations, r...)
+	}
+	if ctx.Err() != nil {
+		return relations, reports, fmt.Errorf("describe stopped: %w", ctx.Err())
+	}
+	return relations, reports, nil
+}
+
+// describeRelations lists the volume attachments, the snapshot volumes and the
+// network interface attachments and requesters of a region
+func describeRelations(ctx context.Context, api DescribeEC2API, region string, callOpts func(*ec2.Options)) ([]Relation, error) {
+	var relations []Relation
+	add := func(id, related string) {
+		if id != "" && related != "" {
+			relations = append(relations, Relation{Region: region, ID: id, Related: related})
+		}
+	}
+
+	volumes := ec2.NewDescribeVolumesPaginator(api, &ec2.DescribeVolumesInput{})
+	for volumes.HasMorePages() {
+		output, err := volumes.NextPage(ctx, callOpts)
+		if err != nil {
+			return relations, err
+		}
+		for _, volume := range output.Volumes {
+			for _, attachment := range volume.Attachments {
+				add(aws.ToString(volume.VolumeId), aws.ToString(attachment.InstanceId))
+			}
+		}
+	}
+
+	snapshots := ec2.NewDescribeSnapshotsPaginator(api, &ec2.DescribeSnapshotsInput{OwnerIds: []string{"self"}})
+	for snapshots.HasMorePages() {
+		output, err := snapshots.NextPage(ctx, callOpts)
+		if err != nil {
+			return relations, err
+		}
+		for _, snapshot := range output.Snapshots {
+			add(aws.ToString(snapshot.SnapshotId), aws.ToString(snapshot.VolumeId))
+		}
+	}
+
+	interfaces := ec2.NewDescribeNetworkInterfacesPaginator(api, &ec2.DescribeNetworkInterfacesInput{})
+	for interfaces.HasMorePages() {
+		output, err := interfaces.NextPage(ctx, callOpts)
+		if err != nil {
+			return relations, err
+		}
+		for _, eni := range output.NetworkInterfaces {
+			if eni.Attachment != nil {
+				add(aws.ToString(eni.NetworkInterfaceId), aws.ToString(eni.Attachment.InstanceId))
+			}
+			add(aws.ToString(eni.NetworkInterfaceId), aws.ToString(eni.RequesterId))
+		}
+	}
+	return relations, nil
+}
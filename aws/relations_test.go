@@ -0,0 +1,75 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDescribeEC2 answers a single page of each describe call, every call fails when err is set
+type fakeDescribeEC2 struct {
+	err       error
+	snapshots *ec2.DescribeSnapshotsInput
+}
+
+func (f *fakeDescribeEC2) DescribeVolumes(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ec2.DescribeVolumesOutput{Volumes: []et.Volume{
+		{VolumeId: aws.String("vol-1"), Attachments: []et.VolumeAttachment{{InstanceId: aws.String("i-1")}}},
+		{VolumeId: aws.String("vol-2")},
+	}}, nil
+}
+
+func (f *fakeDescribeEC2) DescribeSnapshots(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+	f.snapshots = params
+	return &ec2.DescribeSnapshotsOutput{Snapshots: []et.Snapshot{{SnapshotId: aws.String("snap-1"), VolumeId: aws.String("vol-1")}}}, nil
+}
+
+func (f *fakeDescribeEC2) DescribeNetworkInterfaces(ctx context.Context, params *ec2.DescribeNetworkInterfacesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	return &ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []et.NetworkInterface{
+		{NetworkInterfaceId: aws.String("eni-1"), Attachment: &et.NetworkInterfaceAttachment{InstanceId: aws.String("i-1")}},
+		{NetworkInterfaceId: aws.String("eni-2"), RequesterId: aws.String("amazon-elb")},
+	}}, nil
+}
+
+func TestEC2RelationsSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+	defer mockScanClients()
+
+	t.Run("EC2Relations describes the attachments, snapshots and requesters", func(t *testing.T) {
+		api := &fakeDescribeEC2{}
+		ec2describeapi = func(cfg aws.Config, optFns ...func(*ec2.Options)) DescribeEC2API {
+			return api
+		}
+		relations, reports, err := EC2Relations(context.TODO(), []Tags{{Account: "123456789012"}}, ScanOptions{})
+		assert.NoError(err)
+		assert.Equal([]Relation{
+			{Region: "us-east-2", ID: "vol-1", Related: "i-1"},
+			{Region: "us-east-2", ID: "snap-1", Related: "vol-1"},
+			{Region: "us-east-2", ID: "eni-1", Related: "i-1"},
+			{Region: "us-east-2", ID: "eni-2", Related: "amazon-elb"},
+		}, relations)
+		assert.Equal([]string{"self"}, api.snapshots.OwnerIds)
+		assert.Equal(StatusOK, reports[0].Status)
+		assert.Equal(4, reports[0].Count)
+	})
+
+	t.Run("EC2Relations reports a failed target", func(t *testing.T) {
+		ec2describeapi = func(cfg aws.Config, optFns ...func(*ec2.Options)) DescribeEC2API {
+			return &fakeDescribeEC2{err: &smithy.GenericAPIError{Code: "UnauthorizedOperation"}}
+		}
+		relations, reports, err := EC2Relations(context.TODO(), []Tags{{Account: "123456789012", Region: "eu-west-1"}}, ScanOptions{})
+		assert.NoError(err)
+		assert.Empty(relations)
+		assert.Equal(StatusFailed, reports[0].Status)
+		assert.Equal(CauseAccessDenied, reports[0].Cause)
+	})
+}
@@ -0,0 +1,375 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	rt "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+
+	"tagu/models"
+)
+
+// tagresourcesapi returns the tag writes API of the client, replaced in the unittest
+var tagresourcesapi = newTagResourcesAPI
+
+// MaxTagsPerResource is the AWS limit of user tags on a resource
+const MaxTagsPerResource = 50
+
+// TagResourcesAPI defines the interface for the TagResources and UntagResources functions.
+// We use this interface to test the function using a mocked service.
+type TagResourcesAPI interface {
+	TagResources(ctx context.Context, params *resourcegroupstaggingapi.TagResourcesInput, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.TagResourcesOutput, error)
+	UntagResources(ctx context.Context, params *resourcegroupstaggingapi.UntagResourcesInput, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.UntagResourcesOutput, error)
+}
+
+func newTagResourcesAPI(client *resourcegroupstaggingapi.Client) TagResourcesAPI {
+	return client
+}
+
+// RenameOptions holds the parameters of a Rename
+// params:
+// 		dryRun: bool, plan the writes without calling the tagging API
+// 		journal: *Journal, records every write of every resource
+type RenameOptions struct {
+	ScanOptions
+	DryRun  bool
+	Journal *Journal
+}
+
+// RenameConflict is a key that can not be renamed because the resource
+// already has the new key with another value
+type RenameConflict struct {
+	Account  string
+	Region   string
+	ARN      string
+	Key      string
+	Value    string
+	NewKey   string
+	Existing string
+}
+
+// RenameReport is the output of Rename
+type RenameReport struct {
+	Changes   []ResourceChange
+	Conflicts []RenameConflict
+	Targets   TargetReports
+}
+
+// Rename renames the tag keys and values of the mapping on the resources of every target
+// The resources are found with one GetResources tag filter per renamed key, narrowed by the
+// resources and tags filters of the spec. The new tags are added before the old keys are
+// removed, unless adding them would exceed MaxTagsPerResource. A key whose new key is already
+// set to another value is left untouched and reported as a conflict
+// Args:
+// 		ctx: context.Context
+// 		spec: models.Spec
+// 		mapping: models.Mapping
+// 		opts: RenameOptions
+// Returns:
+// 		RenameReport: the writes, the conflicts and the status of each target
+// 		error: if the rename was stopped before the end
+func Rename(ctx context.Context, spec models.Spec, mapping models.Mapping, opts RenameOptions) (report RenameReport, err error) {
+	targets := Targets(spec)
+	var mu sync.Mutex
+	reports := make(TargetReports, len(targets))
+	limiters := newLimiterPool(opts.RateLimit)
+	forEachTarget(len(targets), opts.Concurrency, func(idx int) {
+		target := targets[idx]
+		status := TargetReport{Account: target.Account, Region: target.Region, Status: StatusSkipped}
+		defer func() { reports[idx] = status }()
+		if ctx.Err() != nil {
+			return
+		}
+		tctx, cancel := targetContext(ctx, opts.ScanOptions)
+		defer cancel()
+
+		var changes []ResourceChange
+		var conflicts []RenameConflict
+		cfg, client, creds, err := connect(tctx, &target, opts.clientOptions(target, limiters, &status.Throttles))
+		if err == nil {
+			// The journal records the region the resources were written in
+			target.Region = target.setupRegion(cfg)
+			status.Region = target.Region
+			callOpts := func(o *resourcegroupstaggingapi.Options) {
+				o.Credentials = creds
+				o.Region = status.Region
+			}
+			changes, conflicts, err = renameTarget(tctx, client, target, mapping, opts, callOpts)
+		}
+		status.classify(ctx, tctx, err)
+		status.Count = len(changes)
+
+		mu.Lock()
+		defer mu.Unlock()
+		report.Changes = append(report.Changes, changes...)
+		report.Conflicts = append(report.Conflicts, conflicts...)
+	})
+
+	sort.SliceStable(report.Changes, func(i, j int) bool {
+		return report.Changes[i].ARN < report.Changes[j].ARN
+	})
+	report.Targets = reports
+	if ctx.Err() != nil {
+		return report, fmt.Errorf("rename stopped: %w", ctx.Err())
+	}
+	return report, nil
+}
+
+// renameTarget finds the resources of the target using the mapping and renames their tags
+func renameTarget(ctx context.Context, client *resourcegroupstaggingapi.Client, target Tags, mapping models.Mapping, opts RenameOptions, callOpts func(*resourcegroupstaggingapi.Options)) (changes []ResourceChange, conflicts []RenameConflict, err error) {
+	resources, arns, err := findResources(ctx, client, target, renameFilters(mapping), callOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	api := tagresourcesapi(client)
+	for _, arn := range arns {
+		tags := resources[arn]
+		adds, removes, keyConflicts := planRename(tags, mapping)
+		for _, c := range keyConflicts {
+			c.Account, c.Region, c.ARN = target.Account, target.Region, arn
+			conflicts = append(conflicts, c)
+		}
+		if len(adds) == 0 && len(removes) == 0 {
+			continue
+		}
+
+		written, err := writeResource(ctx, api, target, arn, len(tags), adds, removes, opts.DryRun, opts.Journal, callOpts)
+		changes = append(changes, written...)
+		if err != nil {
+			return changes, conflicts, err
+		}
+	}
+	return changes, conflicts, nil
+}
+
+// writeResource writes the tags then removes the keys of a resource and records each call in the
+// journal. The keys are removed first when adding the tags would exceed MaxTagsPerResource, their
+// old values are then tagged back when the new tags fail to be written
+// Args:
+// 		ctx: context.Context
+// 		api: TagResourcesAPI
+// 		target: Tags, the account, region and role of the resource
+// 		arn: string
+// 		count: int, the number of tags on the resource
+// 		adds: []TagChange, the tags to write
+// 		removes: []TagChange, the keys to remove
+// 		dryRun: bool
+// 		journal: *Journal
+// 		callOpts: func(*resourcegroupstaggingapi.Options)
+// Returns:
+// 		[]ResourceChange: the calls, the second one is skipped when the first one failed
+// 		and followed by the restore of the removed keys when they were removed first
+// 		error: if the journal can not be written
+func writeResource(ctx context.Context, api TagResourcesAPI, target Tags, arn string, count int, adds, removes []TagChange, dryRun bool, journal *Journal, callOpts func(*resourcegroupstaggingapi.Options)) ([]ResourceChange, error) {
+	phases := [][]TagChange{adds, removes}
+	newKeys := 0
+	for _, add := range adds {
+		if add.Previous == nil {
+			newKeys++
+		}
+	}
+	removesFirst := count+newKeys > MaxTagsPerResource
+	if removesFirst {
+		// Free the old keys first so the resource stays within the limit
+		phases = [][]TagChange{removes, adds}
+	}
+
+	var changes []ResourceChange
+	write := func(phase []TagChange) (ResourceChange, error) {
+		change := writeTags(ctx, api, arn, phase, dryRun, callOpts)
+		change.Account, change.Region, change.RoleName = target.Account, target.Region, target.RoleName
+		changes = append(changes, change)
+		return change, journal.record(change)
+	}
+	for i, phase := range phases {
+		if len(phase) == 0 {
+			continue
+		}
+		change, err := write(phase)
+		if err != nil {
+			return changes, err
+		}
+		if change.Status != ChangeFailed {
+			continue
+		}
+		if removesFirst && i == 1 && len(removes) > 0 {
+			// Never leave the old keys removed when the new ones were not written
+			var restores []TagChange
+			for _, remove := range removes {
+				restores = append(restores, TagChange{Key: remove.Key, Value: remove.Previous})
+			}
+			if _, err := write(restores); err != nil {
+				return changes, err
+			}
+		}
+		// Never remove the old keys when the new ones were not written
+		break
+	}
+	return changes, nil
+}
+
+// renameFilters returns one tag filter per renamed key and per key with renamed values
+func renameFilters(mapping models.Mapping) [][]models.Tags {
+	var filters [][]models.Tags
+	for _, key := range sortedKeys(mapping.Keys) {
+		filters = append(filters, []models.Tags{{Key: key}})
+	}
+	var valueKeys []string
+	for key := range mapping.Values {
+		valueKeys = append(valueKeys, key)
+	}
+	sort.Strings(valueKeys)
+	for _, key := range valueKeys {
+		filters = append(filters, []models.Tags{{Key: key, Values: sortedKeys(mapping.Values[key])}})
+	}
+	return filters
+}
+
+// findResources returns the tags of the resources matching any of the filters,
+// the target tags filters apply to every query
+// Returns:
+// 		map[string]map[string]string: the tags of each resource
+// 		[]string: the resources ARN in the order they were found
+// 		error: if a GetResources call failed
+func findResources(ctx context.Context, client *resourcegroupstaggingapi.Client, target Tags, filters [][]models.Tags, callOpts func(*resourcegroupstaggingapi.Options)) (map[string]map[string]string, []string, error) {
+	resources := map[string]map[string]string{}
+	var arns []string
+	for _, filter := range filters {
+		query := target
+		query.FilterTags = append(append([]models.Tags{}, target.FilterTags...), filter...)
+		paginator := resourcegroupgetpaginator(client, query.getResourcesInput(), func(o *resourcegroupstaggingapi.GetResourcesPaginatorOptions) {
+			o.Limit = 50
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx, callOpts)
+			if err != nil {
+				return resources, arns, err
+			}
+			for _, item := range output.ResourceTagMappingList {
+				arn := aws.ToString(item.ResourceARN)
+				if _, ok := resources[arn]; ok {
+					continue
+				}
+				tags := map[string]string{}
+				for _, tag := range item.Tags {
+					tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+				resources[arn] = tags
+				arns = append(arns, arn)
+			}
+		}
+	}
+	return resources, arns, nil
+}
+
+// planRename computes the tags to add or overwrite and the keys to remove on a resource
+// Args:
+// 		tags: map[string]string, the current tags of the resource
+// 		mapping: models.Mapping
+// Returns:
+// 		[]TagChange: the tags to write
+// 		[]TagChange: the keys to remove
+// 		[]RenameConflict: the keys left untouched, without their resource
+func planRename(tags map[string]string, mapping models.Mapping) (adds, removes []TagChange, conflicts []RenameConflict) {
+	normalize := func(key, value string) string {
+		if v, ok := mapping.Values[key][value]; ok {
+			return v
+		}
+		return value
+	}
+	planned := map[string]string{}
+	for _, key := range sortedKeys(tags) {
+		value := tags[key]
+		newKey, ok := mapping.Keys[key]
+		if !ok {
+			newKey = key
+		}
+		newValue := normalize(newKey, value)
+		if newKey == key {
+			if newValue != value {
+				adds = append(adds, TagChange{Key: key, Previous: aws.String(value), Value: aws.String(newValue)})
+			}
+			continue
+		}
+
+		// The new key may already be set on the resource or planned by another variant
+		current, exists := tags[newKey]
+		existing := normalize(newKey, current)
+		if !exists {
+			existing, exists = planned[newKey]
+			current = existing
+		}
+		if exists && existing != newValue {
+			conflicts = append(conflicts, RenameConflict{Key: key, Value: value, NewKey: newKey, Existing: current})
+			continue
+		}
+		if !exists {
+			adds = append(adds, TagChange{Key: newKey, Value: aws.String(newValue)})
+			planned[newKey] = newValue
+		}
+		removes = append(removes, TagChange{Key: key, Previous: aws.String(value)})
+	}
+	return adds, removes, conflicts
+}
+
+// writeTags writes the tags, or removes the keys when the changes have no value
+func writeTags(ctx context.Context, api TagResourcesAPI, arn string, changes []TagChange, dryRun bool, callOpts func(*resourcegroupstaggingapi.Options)) ResourceChange {
+	change := ResourceChange{Time: now(), ARN: arn, Changes: changes, Status: ChangePlanned}
+	if dryRun {
+		return change
+	}
+
+	var failed map[string]string
+	var err error
+	if changes[0].Value != nil {
+		tags := map[string]string{}
+		for _, c := range changes {
+			tags[c.Key] = aws.ToString(c.Value)
+		}
+		var output *resourcegroupstaggingapi.TagResourcesOutput
+		output, err = api.TagResources(ctx, &resourcegroupstaggingapi.TagResourcesInput{ResourceARNList: []string{arn}, Tags: tags}, callOpts)
+		if err == nil {
+			failed = failureMessages(output.FailedResourcesMap)
+		}
+	} else {
+		var keys []string
+		for _, c := range changes {
+			keys = append(keys, c.Key)
+		}
+		var output *resourcegroupstaggingapi.UntagResourcesOutput
+		output, err = api.UntagResources(ctx, &resourcegroupstaggingapi.UntagResourcesInput{ResourceARNList: []string{arn}, TagKeys: keys}, callOpts)
+		if err == nil {
+			failed = failureMessages(output.FailedResourcesMap)
+		}
+	}
+
+	change.Status = ChangeApplied
+	if err != nil {
+		change.Status, change.Error = ChangeFailed, err.Error()
+	} else if msg, ok := failed[arn]; ok {
+		change.Status, change.Error = ChangeFailed, msg
+	}
+	return change
+}
+
+// failureMessages returns the error message of each resource the tagging API failed to write
+func failureMessages(failures map[string]rt.FailureInfo) map[string]string {
+	messages := map[string]string{}
+	for arn, failure := range failures {
+		messages[arn] = fmt.Sprintf("%s: %s", failure.ErrorCode, aws.ToString(failure.ErrorMessage))
+	}
+	return messages
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,322 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	rt "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+// fakeFilterPager returns the resources matching every tag filter of the params,
+// or the resources of the ARN list
+type fakeFilterPager struct {
+	resources map[string]map[string]string
+	params    *resourcegroupstaggingapi.GetResourcesInput
+	done      bool
+}
+
+func (p *fakeFilterPager) HasMorePages() bool {
+	return !p.done
+}
+
+func (p *fakeFilterPager) NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
+	p.done = true
+	output := &resourcegroupstaggingapi.GetResourcesOutput{}
+	for _, arn := range sortedResources(p.resources) {
+		tags := p.resources[arn]
+		if !matchFilters(tags, p.params.TagFilters) || !matchARNs(arn, p.params.ResourceARNList) {
+			continue
+		}
+		item := rt.ResourceTagMapping{ResourceARN: aws.String(arn)}
+		for _, key := range sortedKeys(tags) {
+			item.Tags = append(item.Tags, rt.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+		}
+		output.ResourceTagMappingList = append(output.ResourceTagMappingList, item)
+	}
+	return output, nil
+}
+
+func sortedResources(resources map[string]map[string]string) []string {
+	var arns []string
+	for arn := range resources {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	return arns
+}
+
+func matchARNs(arn string, arns []string) bool {
+	for _, a := range arns {
+		if a == arn {
+			return true
+		}
+	}
+	return len(arns) == 0
+}
+
+func matchFilters(tags map[string]string, filters []rt.TagFilter) bool {
+	for _, filter := range filters {
+		value, ok := tags[aws.ToString(filter.Key)]
+		if !ok {
+			return false
+		}
+		if len(filter.Values) == 0 {
+			continue
+		}
+		found := false
+		for _, v := range filter.Values {
+			found = found || v == value
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeTagResources applies the writes to the resources, the ARNs containing
+// "readonly" fail to be tagged
+type fakeTagResources struct {
+	resources map[string]map[string]string
+	calls     []string
+	// failTags is the number of the next TagResources calls failing
+	failTags int
+}
+
+func (f *fakeTagResources) TagResources(ctx context.Context, params *resourcegroupstaggingapi.TagResourcesInput, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.TagResourcesOutput, error) {
+	arn := params.ResourceARNList[0]
+	f.calls = append(f.calls, "tag "+arn)
+	if f.failTags > 0 {
+		f.failTags--
+		return nil, &smithy.GenericAPIError{Code: "InternalServiceException", Message: "try again"}
+	}
+	if strings.Contains(arn, "readonly") {
+		return &resourcegroupstaggingapi.TagResourcesOutput{FailedResourcesMap: map[string]rt.FailureInfo{
+			arn: {ErrorCode: rt.ErrorCodeInvalidParameterException, ErrorMessage: aws.String("read only")},
+		}}, nil
+	}
+	for key, value := range params.Tags {
+		f.resources[arn][key] = value
+	}
+	return &resourcegroupstaggingapi.TagResourcesOutput{}, nil
+}
+
+func (f *fakeTagResources) UntagResources(ctx context.Context, params *resourcegroupstaggingapi.UntagResourcesInput, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.UntagResourcesOutput, error) {
+	arn := params.ResourceARNList[0]
+	f.calls = append(f.calls, "untag "+arn)
+	for _, key := range params.TagKeys {
+		delete(f.resources[arn], key)
+	}
+	return &resourcegroupstaggingapi.UntagResourcesOutput{}, nil
+}
+
+func TestPlanRenameSuite(t *testing.T) {
+	assert := assert.New(t)
+	mapping := models.Mapping{
+		Keys:   map[string]string{"Env": "env", "environment": "env"},
+		Values: map[string]map[string]string{"env": {"PROD": "prod"}},
+	}
+
+	fixtures := []struct {
+		name      string
+		tags      map[string]string
+		adds      []TagChange
+		removes   []TagChange
+		conflicts []RenameConflict
+	}{
+		{
+			name:    "Rename the key and normalize the value",
+			tags:    map[string]string{"Env": "PROD", "team": "web"},
+			adds:    []TagChange{{Key: "env", Value: aws.String("prod")}},
+			removes: []TagChange{{Key: "Env", Previous: aws.String("PROD")}},
+		},
+		{
+			name: "Normalize the value",
+			tags: map[string]string{"env": "PROD"},
+			adds: []TagChange{{Key: "env", Previous: aws.String("PROD"), Value: aws.String("prod")}},
+		},
+		{
+			name:    "Drop the variant already set to the same value",
+			tags:    map[string]string{"Env": "PROD", "env": "prod"},
+			removes: []TagChange{{Key: "Env", Previous: aws.String("PROD")}},
+		},
+		{
+			name:      "Keep the variant set to another value",
+			tags:      map[string]string{"Env": "dev", "env": "prod"},
+			conflicts: []RenameConflict{{Key: "Env", Value: "dev", NewKey: "env", Existing: "prod"}},
+		},
+		{
+			name:      "Keep the second variant planned to another value",
+			tags:      map[string]string{"Env": "dev", "environment": "prod"},
+			adds:      []TagChange{{Key: "env", Value: aws.String("dev")}},
+			removes:   []TagChange{{Key: "Env", Previous: aws.String("dev")}},
+			conflicts: []RenameConflict{{Key: "environment", Value: "prod", NewKey: "env", Existing: "dev"}},
+		},
+		{
+			name: "Nothing to rename",
+			tags: map[string]string{"team": "web"},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			adds, removes, conflicts := planRename(fixture.tags, mapping)
+			assert.Equal(fixture.adds, adds)
+			assert.Equal(fixture.removes, removes)
+			assert.Equal(fixture.conflicts, conflicts)
+		})
+	}
+}
+
+func TestRenameSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	newResources := func() map[string]map[string]string {
+		full := map[string]string{"Env": "PROD"}
+		for i := 0; len(full) < MaxTagsPerResource; i++ {
+			full[string(rune('a'+i%26))+strings.Repeat("x", i/26)] = "v"
+		}
+		return map[string]map[string]string{
+			"arn:aws:ec2:us-east-1:123456789012:instance/i-1":        {"Env": "PROD", "team": "web"},
+			"arn:aws:ec2:us-east-1:123456789012:instance/i-2":        {"env": "PROD"},
+			"arn:aws:ec2:us-east-1:123456789012:instance/i-3":        {"team": "web"},
+			"arn:aws:ec2:us-east-1:123456789012:instance/i-full":     full,
+			"arn:aws:ec2:us-east-1:123456789012:instance/i-readonly": {"Env": "dev"},
+		}
+	}
+	var resources map[string]map[string]string
+	var api *fakeTagResources
+	resourcegroupgetpaginator = func(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) GetResourcesTagsPager {
+		return &fakeFilterPager{resources: resources, params: params}
+	}
+	tagresourcesapi = func(client *resourcegroupstaggingapi.Client) TagResourcesAPI {
+		return api
+	}
+	defer func() {
+		mockScanClients()
+		tagresourcesapi = newTagResourcesAPI
+	}()
+
+	spec := models.Spec{FilterInput: []models.InputTag{{Account: "123456789012", Regions: []string{"us-east-1"}}}}
+	mapping := models.Mapping{
+		Keys:   map[string]string{"Env": "env"},
+		Values: map[string]map[string]string{"env": {"PROD": "prod"}},
+	}
+
+	t.Run("Rename dry-run plans the writes", func(t *testing.T) {
+		resources = newResources()
+		api = &fakeTagResources{resources: resources}
+		report, err := Rename(context.TODO(), spec, mapping, RenameOptions{DryRun: true})
+		assert.NoError(err)
+		assert.Empty(api.calls)
+		assert.Equal(newResources(), resources)
+		assert.Len(report.Changes, 7)
+		for _, change := range report.Changes {
+			assert.Equal(ChangePlanned, change.Status)
+		}
+		assert.Equal(StatusOK, report.Targets[0].Status)
+	})
+
+	t.Run("Rename writes the tags and records the journal", func(t *testing.T) {
+		resources = newResources()
+		api = &fakeTagResources{resources: resources}
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+		journal, err := OpenJournal(path)
+		assert.NoError(err)
+		report, err := Rename(context.TODO(), spec, mapping, RenameOptions{Journal: journal})
+		assert.NoError(err)
+		assert.NoError(journal.Close())
+
+		assert.Equal([]string{
+			"tag arn:aws:ec2:us-east-1:123456789012:instance/i-1",
+			"untag arn:aws:ec2:us-east-1:123456789012:instance/i-1",
+			// The resource is full, the old key is removed first
+			"untag arn:aws:ec2:us-east-1:123456789012:instance/i-full",
+			"tag arn:aws:ec2:us-east-1:123456789012:instance/i-full",
+			// The old key is kept when the new one can not be written
+			"tag arn:aws:ec2:us-east-1:123456789012:instance/i-readonly",
+			// Found by the values query after the keys query
+			"tag arn:aws:ec2:us-east-1:123456789012:instance/i-2",
+		}, api.calls)
+		assert.Equal(map[string]string{"env": "prod", "team": "web"}, resources["arn:aws:ec2:us-east-1:123456789012:instance/i-1"])
+		assert.Equal(map[string]string{"env": "prod"}, resources["arn:aws:ec2:us-east-1:123456789012:instance/i-2"])
+		assert.Equal(map[string]string{"Env": "dev"}, resources["arn:aws:ec2:us-east-1:123456789012:instance/i-readonly"])
+		assert.Len(resources["arn:aws:ec2:us-east-1:123456789012:instance/i-full"], MaxTagsPerResource)
+
+		last := report.Changes[len(report.Changes)-1]
+		assert.Equal(ChangeFailed, last.Status)
+		assert.Equal("InvalidParameterException: read only", last.Error)
+
+		data, err := os.ReadFile(path)
+		assert.NoError(err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		assert.Len(lines, 6)
+		var first ResourceChange
+		assert.NoError(json.Unmarshal([]byte(lines[0]), &first))
+		assert.Equal(ResourceChange{
+			Time:    now(),
+			Account: "123456789012",
+			Region:  "us-east-1",
+			ARN:     "arn:aws:ec2:us-east-1:123456789012:instance/i-1",
+			Changes: []TagChange{{Key: "env", Value: aws.String("prod")}},
+			Status:  ChangeApplied,
+		}, first)
+	})
+
+	t.Run("Rename tags the old values back when the new ones fail after the untag", func(t *testing.T) {
+		resources = newResources()
+		api = &fakeTagResources{resources: resources, failTags: 1}
+		arn := "arn:aws:ec2:us-east-1:123456789012:instance/i-full"
+		target := Tags{Account: "123456789012", Region: "us-east-1"}
+		adds := []TagChange{{Key: "env", Value: aws.String("prod")}}
+		removes := []TagChange{{Key: "Env", Previous: aws.String("PROD")}}
+		changes, err := writeResource(context.TODO(), api, target, arn, MaxTagsPerResource, adds, removes, false, nil, nil)
+		assert.NoError(err)
+
+		assert.Equal([]string{"untag " + arn, "tag " + arn, "tag " + arn}, api.calls)
+		assert.Equal("PROD", resources[arn]["Env"])
+		assert.NotContains(resources[arn], "env")
+		assert.Len(changes, 3)
+		assert.Equal(ChangeApplied, changes[0].Status)
+		assert.Equal(ChangeFailed, changes[1].Status)
+		assert.Equal(ChangeApplied, changes[2].Status)
+		assert.Equal([]TagChange{{Key: "Env", Value: aws.String("PROD")}}, changes[2].Changes)
+	})
+
+	t.Run("Rename reports a failed target", func(t *testing.T) {
+		resourcegroupgetpaginator = func(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) GetResourcesTagsPager {
+			return &fakeRegionPager{}
+		}
+		report, err := Rename(context.TODO(), models.Spec{FilterInput: []models.InputTag{{Account: "123456789012", Regions: []string{"fail"}}}}, mapping, RenameOptions{})
+		assert.NoError(err)
+		assert.Equal(StatusFailed, report.Targets[0].Status)
+		assert.Equal(CauseAccessDenied, report.Targets[0].Cause)
+	})
+
+	t.Run("Rename stops on a canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		report, err := Rename(ctx, spec, mapping, RenameOptions{})
+		assert.EqualError(err, "rename stopped: context canceled")
+		assert.Equal(StatusSkipped, report.Targets[0].Status)
+	})
+
+	assert.Equal(map[string]string{"arn": "ThrottlingException: slow down"}, failureMessages(map[string]rt.FailureInfo{
+		"arn": {ErrorCode: rt.ErrorCode("ThrottlingException"), ErrorMessage: aws.String("slow down")},
+	}))
+}
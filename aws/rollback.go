@@ -0,0 +1,238 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+)
+
+// maxResourceARNs is the GetResources limit of resources looked up by ARN in a single call
+const maxResourceARNs = 100
+
+// RollbackOptions holds the parameters of a Rollback
+// params:
+// 		dryRun: bool, plan the writes without calling the tagging API
+// 		force: bool, also restore the resources changed by someone else since
+// 		journal: *Journal, records the rollback writes
+type RollbackOptions struct {
+	ScanOptions
+	DryRun  bool
+	Force   bool
+	Journal *Journal
+}
+
+// Drift is a key whose current value is not the one written by the journal
+// A nil Expected or Actual means the key is absent
+type Drift struct {
+	Account  string
+	Region   string
+	ARN      string
+	Key      string
+	Expected *string
+	Actual   *string
+}
+
+// RollbackReport is the output of Rollback
+type RollbackReport struct {
+	Changes []ResourceChange
+	Drifts  []Drift
+	Targets TargetReports
+}
+
+// resourceHistory is the state of the keys of a resource before and after the journal changes
+type resourceHistory struct {
+	arn      string
+	original map[string]*string
+	written  map[string]*string
+}
+
+// rollbackTarget is an account, region and role with the resources written in it
+type rollbackTarget struct {
+	target    Tags
+	resources []*resourceHistory
+}
+
+// Rollback restores the tags of the resources to their state before the applied changes of the
+// journal. The current tags of every resource are read first, a resource whose keys are no longer
+// the ones written by the journal was changed by someone else since, it is reported as drifted
+// and left untouched unless opts.Force is set
+// Args:
+// 		ctx: context.Context
+// 		changes: []ResourceChange, the journal changes in the recorded order
+// 		opts: RollbackOptions
+// Returns:
+// 		RollbackReport: the writes, the drifts and the status of each account/region
+// 		error: if the rollback was stopped before the end
+func Rollback(ctx context.Context, changes []ResourceChange, opts RollbackOptions) (report RollbackReport, err error) {
+	targets := rollbackTargets(changes)
+	var mu sync.Mutex
+	reports := make(TargetReports, len(targets))
+	limiters := newLimiterPool(opts.RateLimit)
+	forEachTarget(len(targets), opts.Concurrency, func(idx int) {
+		target := targets[idx].target
+		status := TargetReport{Account: target.Account, Region: target.Region, Status: StatusSkipped}
+		defer func() { reports[idx] = status }()
+		if ctx.Err() != nil {
+			return
+		}
+		tctx, cancel := targetContext(ctx, opts.ScanOptions)
+		defer cancel()
+
+		var written []ResourceChange
+		var drifts []Drift
+		cfg, client, creds, err := connect(tctx, &target, opts.clientOptions(target, limiters, &status.Throttles))
+		if err == nil {
+			target.Region = target.setupRegion(cfg)
+			status.Region = target.Region
+			callOpts := func(o *resourcegroupstaggingapi.Options) {
+				o.Credentials = creds
+				o.Region = target.Region
+			}
+			written, drifts, err = rollbackResources(tctx, client, target, targets[idx].resources, opts, callOpts)
+		}
+		status.classify(ctx, tctx, err)
+		status.Count = len(written)
+
+		mu.Lock()
+		defer mu.Unlock()
+		report.Changes = append(report.Changes, written...)
+		report.Drifts = append(report.Drifts, drifts...)
+	})
+
+	report.Targets = reports
+	if ctx.Err() != nil {
+		return report, fmt.Errorf("rollback stopped: %w", ctx.Err())
+	}
+	return report, nil
+}
+
+// rollbackTargets groups the applied changes by account, region and role then by resource
+func rollbackTargets(changes []ResourceChange) []rollbackTarget {
+	var targets []rollbackTarget
+	index := map[[3]string]int{}
+	histories := map[string]*resourceHistory{}
+	for _, change := range changes {
+		if change.Status != ChangeApplied {
+			continue
+		}
+		key := [3]string{change.Account, change.Region, change.RoleName}
+		idx, ok := index[key]
+		if !ok {
+			idx = len(targets)
+			index[key] = idx
+			targets = append(targets, rollbackTarget{target: Tags{Account: change.Account, Region: change.Region, RoleName: change.RoleName}})
+		}
+		history, ok := histories[change.ARN]
+		if !ok {
+			history = &resourceHistory{arn: change.ARN, original: map[string]*string{}, written: map[string]*string{}}
+			histories[change.ARN] = history
+			targets[idx].resources = append(targets[idx].resources, history)
+		}
+		for _, c := range change.Changes {
+			if _, ok := history.original[c.Key]; !ok {
+				history.original[c.Key] = c.Previous
+			}
+			history.written[c.Key] = c.Value
+		}
+	}
+	return targets
+}
+
+// rollbackResources restores the resources of a target and returns the writes and the drifts
+func rollbackResources(ctx context.Context, client *resourcegroupstaggingapi.Client, target Tags, resources []*resourceHistory, opts RollbackOptions, callOpts func(*resourcegroupstaggingapi.Options)) (changes []ResourceChange, drifts []Drift, err error) {
+	var arns []string
+	for _, history := range resources {
+		arns = append(arns, history.arn)
+	}
+	current, err := resourcesTags(ctx, client, arns, callOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	api := tagresourcesapi(client)
+	for _, history := range resources {
+		tags := current[history.arn]
+		var keys []string
+		for key := range history.written {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var resourceDrifts []Drift
+		var adds, removes []TagChange
+		for _, key := range keys {
+			var actual *string
+			if value, ok := tags[key]; ok {
+				actual = aws.String(value)
+			}
+			if !sameValue(actual, history.written[key]) {
+				resourceDrifts = append(resourceDrifts, Drift{
+					Account:  target.Account,
+					Region:   target.Region,
+					ARN:      history.arn,
+					Key:      key,
+					Expected: history.written[key],
+					Actual:   actual,
+				})
+			}
+			switch original := history.original[key]; {
+			case sameValue(actual, original):
+			case original == nil:
+				removes = append(removes, TagChange{Key: key, Previous: actual})
+			default:
+				adds = append(adds, TagChange{Key: key, Previous: actual, Value: original})
+			}
+		}
+		drifts = append(drifts, resourceDrifts...)
+		if len(resourceDrifts) > 0 && !opts.Force {
+			continue
+		}
+		if len(adds) == 0 && len(removes) == 0 {
+			continue
+		}
+		written, err := writeResource(ctx, api, target, history.arn, len(tags), adds, removes, opts.DryRun, opts.Journal, callOpts)
+		changes = append(changes, written...)
+		if err != nil {
+			return changes, drifts, err
+		}
+	}
+	return changes, drifts, nil
+}
+
+// resourcesTags returns the current tags of the resources, a deleted resource is missing
+func resourcesTags(ctx context.Context, client *resourcegroupstaggingapi.Client, arns []string, callOpts func(*resourcegroupstaggingapi.Options)) (map[string]map[string]string, error) {
+	resources := map[string]map[string]string{}
+	for start := 0; start < len(arns); start += maxResourceARNs {
+		end := start + maxResourceARNs
+		if end > len(arns) {
+			end = len(arns)
+		}
+		paginator := resourcegroupgetpaginator(client, &resourcegroupstaggingapi.GetResourcesInput{ResourceARNList: arns[start:end]})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx, callOpts)
+			if err != nil {
+				return resources, err
+			}
+			for _, item := range output.ResourceTagMappingList {
+				tags := map[string]string{}
+				for _, tag := range item.Tags {
+					tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+				resources[aws.ToString(item.ResourceARN)] = tags
+			}
+		}
+	}
+	return resources, nil
+}
+
+// sameValue compares two optional values, nil being an absent key
+func sameValue(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
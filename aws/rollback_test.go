@@ -0,0 +1,129 @@
+package aws
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+func TestRollbackSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	original := func() map[string]map[string]string {
+		return map[string]map[string]string{
+			"arn:aws:ec2:us-east-1:123456789012:instance/i-1": {"Env": "PROD", "team": "web"},
+			"arn:aws:ec2:us-east-1:123456789012:instance/i-2": {"env": "PROD"},
+			"arn:aws:ec2:us-east-1:123456789012:instance/i-3": {"Env": "dev"},
+		}
+	}
+	resources := original()
+	api := &fakeTagResources{resources: resources}
+	resourcegroupgetpaginator = func(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) GetResourcesTagsPager {
+		return &fakeFilterPager{resources: resources, params: params}
+	}
+	tagresourcesapi = func(client *resourcegroupstaggingapi.Client) TagResourcesAPI {
+		return api
+	}
+	defer func() {
+		mockScanClients()
+		tagresourcesapi = newTagResourcesAPI
+	}()
+
+	// Rename then read the journal back
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := OpenJournal(path)
+	assert.NoError(err)
+	spec := models.Spec{FilterInput: []models.InputTag{{Account: "123456789012", Regions: []string{"us-east-1"}}}}
+	_, err = Rename(context.TODO(), spec, models.Mapping{
+		Keys:   map[string]string{"Env": "env"},
+		Values: map[string]map[string]string{"env": {"PROD": "prod"}},
+	}, RenameOptions{Journal: journal})
+	assert.NoError(err)
+	assert.NoError(journal.Close())
+	changes, err := ReadJournal(path)
+	assert.NoError(err)
+	assert.Len(changes, 5)
+
+	// Someone else changes i-3 after the rename
+	resources["arn:aws:ec2:us-east-1:123456789012:instance/i-3"]["env"] = "staging"
+
+	t.Run("Rollback dry-run plans the writes", func(t *testing.T) {
+		api.calls = nil
+		report, err := Rollback(context.TODO(), changes, RollbackOptions{DryRun: true})
+		assert.NoError(err)
+		assert.Empty(api.calls)
+		assert.Len(report.Changes, 3)
+		assert.Equal(StatusOK, report.Targets[0].Status)
+	})
+
+	t.Run("Rollback restores the resources and reports the drifts", func(t *testing.T) {
+		api.calls = nil
+		report, err := Rollback(context.TODO(), changes, RollbackOptions{})
+		assert.NoError(err)
+		assert.Equal(map[string]string{"Env": "PROD", "team": "web"}, resources["arn:aws:ec2:us-east-1:123456789012:instance/i-1"])
+		assert.Equal(map[string]string{"env": "PROD"}, resources["arn:aws:ec2:us-east-1:123456789012:instance/i-2"])
+		assert.Equal(map[string]string{"env": "staging"}, resources["arn:aws:ec2:us-east-1:123456789012:instance/i-3"])
+		assert.Equal([]Drift{{
+			Account:  "123456789012",
+			Region:   "us-east-1",
+			ARN:      "arn:aws:ec2:us-east-1:123456789012:instance/i-3",
+			Key:      "env",
+			Expected: aws.String("dev"),
+			Actual:   aws.String("staging"),
+		}}, report.Drifts)
+		assert.Equal([]TagChange{
+			{Key: "Env", Value: aws.String("PROD")},
+		}, report.Changes[0].Changes)
+		assert.Equal([]TagChange{
+			{Key: "env", Previous: aws.String("prod")},
+		}, report.Changes[1].Changes)
+		// i-1 and i-2 are restored, i-3 is left untouched
+		assert.Len(report.Changes, 3)
+	})
+
+	t.Run("Rollback forces the drifted resources", func(t *testing.T) {
+		report, err := Rollback(context.TODO(), changes, RollbackOptions{Force: true})
+		assert.NoError(err)
+		// The resources already restored drift from the journal too, only i-3 is written
+		assert.Len(report.Drifts, 4)
+		assert.Len(report.Changes, 2)
+		assert.Equal(map[string]string{"Env": "dev"}, resources["arn:aws:ec2:us-east-1:123456789012:instance/i-3"])
+	})
+
+	t.Run("Rollback stops on a canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		report, err := Rollback(ctx, changes, RollbackOptions{})
+		assert.EqualError(err, "rollback stopped: context canceled")
+		assert.Equal(StatusSkipped, report.Targets[0].Status)
+	})
+}
+
+func TestRollbackTargetsSuite(t *testing.T) {
+	assert := assert.New(t)
+	changes := []ResourceChange{
+		{Account: "1", Region: "us-east-1", ARN: "a", Changes: []TagChange{{Key: "env", Previous: aws.String("PROD"), Value: aws.String("prod")}}, Status: ChangeApplied},
+		{Account: "1", Region: "us-east-1", ARN: "a", Changes: []TagChange{{Key: "env", Previous: aws.String("prod"), Value: aws.String("dev")}}, Status: ChangeApplied},
+		{Account: "1", Region: "us-east-1", ARN: "b", Changes: []TagChange{{Key: "env", Value: aws.String("prod")}}, Status: ChangeFailed},
+		{Account: "2", Region: "eu-west-1", RoleName: "tagger", ARN: "c", Changes: []TagChange{{Key: "Env", Previous: aws.String("dev")}}, Status: ChangeApplied},
+		{Account: "2", Region: "eu-west-1", ARN: "d", Changes: []TagChange{{Key: "Env", Previous: aws.String("dev")}}, Status: ChangePlanned},
+	}
+	targets := rollbackTargets(changes)
+	assert.Len(targets, 2)
+	assert.Equal(Tags{Account: "1", Region: "us-east-1"}, targets[0].target)
+	assert.Equal(Tags{Account: "2", Region: "eu-west-1", RoleName: "tagger"}, targets[1].target)
+	// The first previous value and the last written value of each key
+	assert.Equal([]*resourceHistory{{
+		arn:      "a",
+		original: map[string]*string{"env": aws.String("PROD")},
+		written:  map[string]*string{"env": aws.String("dev")},
+	}}, targets[0].resources)
+	assert.Equal(map[string]*string{"Env": nil}, targets[1].resources[0].written)
+}
@@ -0,0 +1,299 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"tagu/models"
+)
+
+// TargetStatus is the final state of a scanned account/region target
+type TargetStatus string
+
+const (
+	// StatusOK the target was fully scanned
+	StatusOK TargetStatus = "ok"
+	// StatusFailed the target scan returned an error
+	StatusFailed TargetStatus = "failed"
+	// StatusTimeout the target scan exceeded the target or the global timeout
+	StatusTimeout TargetStatus = "timeout"
+	// StatusCanceled the target scan was interrupted
+	StatusCanceled TargetStatus = "canceled"
+	// StatusSkipped the target was never scanned
+	StatusSkipped TargetStatus = "skipped"
+)
+
+// ScanOptions holds the tuning parameters of a Scan
+// params:
+// 		targetTimeout: time.Duration, zero means no limit
+// 		concurrency: int, number of targets scanned in parallel
+// 		retryMode: aws.RetryMode, adaptive unless set to standard
+// 		maxAttempts: int, attempts of each API call, zero keeps the SDK default
+// 		maxBackoff: time.Duration, maximum delay between two attempts
+// 		rateLimit: float64, requests per second for each account/region, zero means no limit
+// 		checkpoint: *Checkpoint, records the progress and resumes the recorded targets
+// 		cache: *Cache, reuses the results of the targets scanned within the cache ttl
+// 		refreshCache: bool, scan every target again and replace the cache entries
+// 		complianceDetails: bool, include the tag policies compliance of each resource
+type ScanOptions struct {
+	TargetTimeout     time.Duration
+	Concurrency       int
+	RetryMode         aws.RetryMode
+	MaxAttempts       int
+	MaxBackoff        time.Duration
+	RateLimit         float64
+	Checkpoint        *Checkpoint
+	Cache             *Cache
+	RefreshCache      bool
+	ComplianceDetails bool
+}
+
+// TargetReport is the outcome of a single account/region scan
+type TargetReport struct {
+	Account   string
+	Region    string
+	Status    TargetStatus
+	Cause     ErrorCause
+	Count     int
+	Throttles int64
+	Cached    bool
+	Err       error
+	// CacheErr is the error writing the results to the cache, the target status is kept
+	CacheErr error
+}
+
+// TargetReports is the status of every scanned target
+type TargetReports []TargetReport
+
+// Failed returns the targets that did not complete, either on error or timeout
+func (r TargetReports) Failed() TargetReports {
+	var failed TargetReports
+	for _, target := range r {
+		if target.Status == StatusFailed || target.Status == StatusTimeout {
+			failed = append(failed, target)
+		}
+	}
+	return failed
+}
+
+// Throttles returns the number of throttled attempts of all the targets
+func (r TargetReports) Throttles() int64 {
+	var throttles int64
+	for _, target := range r {
+		throttles += target.Throttles
+	}
+	return throttles
+}
+
+// Report is the output of a Scan, it keeps the results collected so far
+// even when the scan was stopped before the end
+type Report struct {
+	Results []RessourceTagResult
+	Targets TargetReports
+}
+
+// Targets flattens the spec into one Tags per account and region
+// Args:
+// 		spec: models.Spec
+// Returns:
+// 		[]Tags: the targets to scan in the spec order
+func Targets(spec models.Spec) []Tags {
+	var targets []Tags
+	for _, input := range spec.FilterInput {
+		regions := input.Regions
+		if len(regions) == 0 {
+			// Keep a single target using the default configuration region
+			regions = []string{""}
+		}
+		for _, region := range regions {
+			targets = append(targets, Tags{
+				Account:         input.Account,
+				Region:          region,
+				RoleName:        spec.RoleName,
+				FilterResources: input.FilterResources,
+				FilterTags:      input.FilterTags,
+			})
+		}
+	}
+	return targets
+}
+
+// Scan runs the tagging logic on every target of the spec
+// The targets are spread over opts.Concurrency workers sharing one rate limiter
+// per account/region. A failed target is recorded with its cause and the scan
+// moves on to the next one, only a done ctx stops the scan, the targets scanned
+// so far and their results are always returned in the report in the spec order
+// Args:
+// 		ctx: context.Context
+// 		spec: models.Spec
+// 		opts: ScanOptions
+// Returns:
+// 		Report: the collected results and the status of each target
+// 		error: if the scan was stopped before the end
+func Scan(ctx context.Context, spec models.Spec, opts ScanOptions) (report Report, err error) {
+	targets := Targets(spec)
+	results := make([]targetResult, len(targets))
+	limiters := newLimiterPool(opts.RateLimit)
+	forEachTarget(len(targets), opts.Concurrency, func(idx int) {
+		targets[idx].ComplianceDetails = opts.ComplianceDetails
+		results[idx] = scanTarget(ctx, targets[idx], opts, limiters)
+	})
+
+	for _, result := range results {
+		report.Results = append(report.Results, result.output...)
+		report.Targets = append(report.Targets, result.TargetReport)
+	}
+	if ctx.Err() != nil {
+		return report, fmt.Errorf("scan stopped: %w", ctx.Err())
+	}
+	return report, nil
+}
+
+// forEachTarget calls fn with the index of every target from the given number of workers
+func forEachTarget(count, workers int, fn func(idx int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				fn(idx)
+			}
+		}()
+	}
+	for idx := 0; idx < count; idx++ {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// targetContext bounds ctx with the target timeout if any
+func targetContext(ctx context.Context, opts ScanOptions) (context.Context, context.CancelFunc) {
+	if opts.TargetTimeout > 0 {
+		return context.WithTimeout(ctx, opts.TargetTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// clientOptions returns the client options of the target, its limiter is shared
+// with the other workers calling the same account and region
+func (opts ScanOptions) clientOptions(target Tags, limiters *limiterPool, throttles *int64) ClientOptions {
+	return ClientOptions{
+		RetryMode:   opts.RetryMode,
+		MaxAttempts: opts.MaxAttempts,
+		MaxBackoff:  opts.MaxBackoff,
+		Limiter:     limiters.get(target.Account, target.Region),
+		Throttles:   throttles,
+	}
+}
+
+// classify sets how the target ended from its error, the scan context and the target context
+func (r *TargetReport) classify(ctx, tctx context.Context, err error) {
+	r.Status = StatusOK
+	r.Err = err
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.Canceled):
+		r.Status = StatusCanceled
+	case errors.Is(tctx.Err(), context.DeadlineExceeded):
+		r.Status = StatusTimeout
+	default:
+		r.Status = StatusFailed
+		r.Cause = ClassifyError(err)
+	}
+}
+
+type targetResult struct {
+	TargetReport
+	output []RessourceTagResult
+}
+
+// scanTarget runs a single target bounded by the target timeout
+// and classifies how it ended, a target picked after ctx is done is skipped
+// With a checkpoint, a completed target is read back from the state and
+// an in-flight target restarts from its last recorded page
+func scanTarget(ctx context.Context, target Tags, opts ScanOptions, limiters *limiterPool) targetResult {
+	result := targetResult{
+		TargetReport: TargetReport{
+			Account: target.Account,
+			Region:  target.Region,
+			Status:  StatusSkipped,
+		},
+	}
+
+	var previous []RessourceTagResult
+	key := target.key()
+	if opts.Checkpoint != nil {
+		state := opts.Checkpoint.state(key)
+		if state.Done {
+			result.output = state.Results
+			result.Count = len(state.Results)
+			result.Status = StatusOK
+			return result
+		}
+		previous = state.Results
+		target.PaginationToken = state.Token
+		target.onPage = func(token string, page []RessourceTagResult) error {
+			return opts.Checkpoint.page(key, token, page)
+		}
+	}
+	if ctx.Err() != nil {
+		result.output = previous
+		result.Count = len(previous)
+		return result
+	}
+	if opts.Cache != nil && !opts.RefreshCache && target.PaginationToken == "" {
+		// An unreadable entry is scanned again and replaced
+		if cached, ok, _ := opts.Cache.get(target); ok {
+			if opts.Checkpoint != nil {
+				// Record the cached results so a resumed scan reads them back from the state
+				if err := opts.Checkpoint.page(key, "", cached); err != nil {
+					result.classify(ctx, ctx, err)
+					return result
+				}
+			}
+			result.output = cached
+			result.Count = len(cached)
+			result.Status = StatusOK
+			result.Cached = true
+			return result
+		}
+	}
+
+	tctx, cancel := targetContext(ctx, opts)
+	defer cancel()
+
+	clientOpts := opts.clientOptions(target, limiters, &result.Throttles)
+	err := Run(tctx, &target, clientOpts)
+	if target.PaginationToken != "" && errorCode(err) == "PaginationTokenExpiredException" {
+		// The recorded token is too old to resume, restart the target from the first page
+		if err = opts.Checkpoint.reset(key); err == nil {
+			previous, target.PaginationToken, target.Output = nil, "", nil
+			err = Run(tctx, &target, clientOpts)
+		}
+	}
+	if err == nil && opts.Checkpoint != nil {
+		err = opts.Checkpoint.done(key)
+	}
+
+	result.output = append(previous, target.Output...)
+	if err == nil && opts.Cache != nil {
+		result.CacheErr = opts.Cache.put(target, result.output)
+	}
+	result.Count = len(result.output)
+	if ctx.Err() == nil && isInvalidToken(err) && regionDisabled(ctx, target, clientOpts) {
+		err = regionDisabledError{err: err}
+	}
+	result.classify(ctx, tctx, err)
+	return result
+}
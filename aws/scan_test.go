@@ -0,0 +1,223 @@
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	rt "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+// fakeRegionPager returns a single page per region, the region named
+// "hang" blocks until the context is done and "fail" returns an error,
+// the opt-in region ap-east-1 and "expired" reject the token
+type fakeRegionPager struct {
+	done bool
+}
+
+func (p *fakeRegionPager) HasMorePages() bool {
+	return !p.done
+}
+
+func (p *fakeRegionPager) NextPage(ctx context.Context, optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
+	opts := resourcegroupstaggingapi.Options{}
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	switch opts.Region {
+	case "hang":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case "fail":
+		return nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized"}
+	case "ap-east-1", "expired":
+		return nil, &smithy.GenericAPIError{Code: "UnrecognizedClientException", Message: "The security token included in the request is invalid"}
+	}
+	p.done = true
+	return &resourcegroupstaggingapi.GetResourcesOutput{
+		ResourceTagMappingList: []rt.ResourceTagMapping{
+			{
+				ResourceARN: aws.String("arn:aws:ec2:" + opts.Region + ":123456789012:instance/i-12345678"),
+				Tags:        []rt.Tag{{Key: aws.String("env"), Value: aws.String("prod")}},
+			},
+		},
+	}, nil
+}
+
+func mockScanClients() {
+	loadDefaultConfig = func(ctx context.Context, optFns ...func(*config.LoadOptions) error) (cfg aws.Config, err error) {
+		return aws.Config{Region: "us-east-2"}, nil
+	}
+	newConfigForResourcegroupstaggingapi = func(cfg aws.Config, optFns ...func(*resourcegroupstaggingapi.Options)) *resourcegroupstaggingapi.Client {
+		return &resourcegroupstaggingapi.Client{}
+	}
+	resourcegroupgetpaginator = func(client resourcegroupstaggingapi.GetResourcesAPIClient, params *resourcegroupstaggingapi.GetResourcesInput, optFns ...func(*resourcegroupstaggingapi.GetResourcesPaginatorOptions)) GetResourcesTagsPager {
+		return &fakeRegionPager{}
+	}
+	stsnewconfig = func(cfg aws.Config, optFns ...func(*sts.Options)) *sts.Client {
+		return &sts.Client{}
+	}
+	ec2describeregions = func(cfg aws.Config, optFns ...func(*ec2.Options)) DescribeRegionsAPI {
+		return &fakeDescribeRegions{disabled: map[string]bool{"ap-east-1": true}}
+	}
+	ec2describeapi = func(cfg aws.Config, optFns ...func(*ec2.Options)) DescribeEC2API {
+		return &fakeDescribeEC2{}
+	}
+}
+
+func TestTargetsSuite(t *testing.T) {
+	assert := assert.New(t)
+	spec := models.Spec{
+		RoleName: "test-role",
+		FilterInput: []models.InputTag{
+			{Account: "111111111111", Regions: []string{"us-east-1", "eu-west-1"}, FilterResources: []string{"ec2"}},
+			{Account: "222222222222"},
+		},
+	}
+	assert.Equal([]Tags{
+		{Account: "111111111111", Region: "us-east-1", RoleName: "test-role", FilterResources: []string{"ec2"}},
+		{Account: "111111111111", Region: "eu-west-1", RoleName: "test-role", FilterResources: []string{"ec2"}},
+		{Account: "222222222222", Region: "", RoleName: "test-role"},
+	}, Targets(spec))
+}
+
+func TestScanSuite(t *testing.T) {
+	mockScanClients()
+
+	fixtures := []struct {
+		name          string
+		regions       []string
+		timeout       time.Duration
+		targetTimeout time.Duration
+		concurrency   int
+		statuses      []TargetStatus
+		causes        []ErrorCause
+		count         int
+		err           string
+	}{
+		{
+			name:     "Scan all targets OK",
+			regions:  []string{"us-east-1", "eu-west-1"},
+			statuses: []TargetStatus{StatusOK, StatusOK},
+			causes:   []ErrorCause{CauseNone, CauseNone},
+			count:    2,
+		},
+		{
+			name:          "Scan continues after a target timeout",
+			regions:       []string{"us-east-1", "hang", "eu-west-1"},
+			targetTimeout: 10 * time.Millisecond,
+			statuses:      []TargetStatus{StatusOK, StatusTimeout, StatusOK},
+			causes:        []ErrorCause{CauseNone, CauseNone, CauseNone},
+			count:         2,
+		},
+		{
+			name:     "Scan stops on the global timeout",
+			regions:  []string{"us-east-1", "hang", "eu-west-1"},
+			timeout:  20 * time.Millisecond,
+			statuses: []TargetStatus{StatusOK, StatusTimeout, StatusSkipped},
+			causes:   []ErrorCause{CauseNone, CauseNone, CauseNone},
+			count:    1,
+			err:      "scan stopped: context deadline exceeded",
+		},
+		{
+			name:          "Scan targets concurrently in the spec order",
+			regions:       []string{"hang", "us-east-1", "fail", "eu-west-1"},
+			concurrency:   3,
+			targetTimeout: 20 * time.Millisecond,
+			statuses:      []TargetStatus{StatusTimeout, StatusOK, StatusFailed, StatusOK},
+			causes:        []ErrorCause{CauseNone, CauseNone, CauseAccessDenied, CauseNone},
+			count:         2,
+		},
+		{
+			name:     "Scan tells a disabled region from an invalid token",
+			regions:  []string{"ap-east-1", "expired"},
+			statuses: []TargetStatus{StatusFailed, StatusFailed},
+			causes:   []ErrorCause{CauseRegionDisabled, CauseAccessDenied},
+		},
+		{
+			name:     "Scan continues after a failed target",
+			regions:  []string{"us-east-1", "fail", "eu-west-1"},
+			statuses: []TargetStatus{StatusOK, StatusFailed, StatusOK},
+			causes:   []ErrorCause{CauseNone, CauseAccessDenied, CauseNone},
+			count:    2,
+		},
+	}
+
+	assert := assert.New(t)
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			ctx := context.Background()
+			if fixture.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, fixture.timeout)
+				defer cancel()
+			}
+			spec := models.Spec{FilterInput: []models.InputTag{{Account: "123456789012", Regions: fixture.regions}}}
+			report, err := Scan(ctx, spec, ScanOptions{TargetTimeout: fixture.targetTimeout, Concurrency: fixture.concurrency})
+			var statuses []TargetStatus
+			var causes []ErrorCause
+			for _, target := range report.Targets {
+				statuses = append(statuses, target.Status)
+				causes = append(causes, target.Cause)
+			}
+			assert.Equal(fixture.statuses, statuses)
+			assert.Equal(fixture.causes, causes)
+			assert.Len(report.Results, fixture.count)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
+
+func TestScanInterruptedSuite(t *testing.T) {
+	mockScanClients()
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	spec := models.Spec{FilterInput: []models.InputTag{{Account: "123456789012", Regions: []string{"us-east-1", "hang", "eu-west-1"}}}}
+	report, err := Scan(ctx, spec, ScanOptions{})
+	assert.EqualError(err, "scan stopped: context canceled")
+	assert.Len(report.Results, 1)
+	assert.Equal(StatusCanceled, report.Targets[1].Status)
+	assert.Equal(StatusSkipped, report.Targets[2].Status)
+}
+
+func TestReportFailedSuite(t *testing.T) {
+	assert := assert.New(t)
+	report := Report{
+		Targets: TargetReports{
+			{Account: "111111111111", Region: "us-east-1", Status: StatusOK},
+			{Account: "111111111111", Region: "eu-west-1", Status: StatusFailed, Cause: CauseAccessDenied},
+			{Account: "222222222222", Region: "us-east-1", Status: StatusTimeout},
+			{Account: "222222222222", Region: "eu-west-1", Status: StatusSkipped},
+		},
+	}
+	assert.Equal(TargetReports{report.Targets[1], report.Targets[2]}, report.Targets.Failed())
+}
+
+func TestReportThrottlesSuite(t *testing.T) {
+	assert := assert.New(t)
+	report := Report{
+		Targets: TargetReports{
+			{Account: "111111111111", Region: "us-east-1", Status: StatusOK, Throttles: 3},
+			{Account: "111111111111", Region: "eu-west-1", Status: StatusFailed, Cause: CauseThrottled, Throttles: 5},
+		},
+	}
+	assert.Equal(int64(8), report.Targets.Throttles())
+}
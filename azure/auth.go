@@ -0,0 +1,150 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"tagu/provider"
+)
+
+// DefaultScope is the scope of the Azure Resource Manager tokens
+const DefaultScope = "https://management.azure.com/.default"
+
+// DefaultAuthority is the Microsoft Entra ID login endpoint
+const DefaultAuthority = "https://login.microsoftonline.com"
+
+// azCommand runs the az CLI, replaced in the unittest
+var azCommand = func(ctx context.Context, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, "az", args...).Output()
+}
+
+// TokenSource returns the bearer token of the Resource Manager calls
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a token obtained out of band, AZURE_ACCESS_TOKEN for instance
+type StaticToken string
+
+// Token returns the token as is
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// ClientCredentials requests the tokens of a service principal with its client secret
+// params:
+// 		tenantID: string
+// 		clientID: string
+// 		clientSecret: string
+// 		authority: string, DefaultAuthority when empty
+type ClientCredentials struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	Authority    string
+	HTTPClient   *http.Client
+	cache        provider.TokenCache
+}
+
+// Token returns the cached token or requests a new one
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	return c.cache.Get(ctx, c.fetch)
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (string, time.Time, error) {
+	authority := c.Authority
+	if authority == "" {
+		authority = DefaultAuthority
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"scope":         {DefaultScope},
+	}
+	endpoint := strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(c.TenantID) + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", time.Time{}, &APIError{StatusCode: resp.StatusCode, Code: body.Error, Message: body.ErrorDescription}
+	}
+	return body.AccessToken, time.Now().Add(time.Duration(body.ExpiresIn) * time.Second), nil
+}
+
+// CLIToken gets the tokens of the account logged in the az CLI
+type CLIToken struct {
+	cache provider.TokenCache
+}
+
+// Token returns the cached token or asks the az CLI for a new one
+func (c *CLIToken) Token(ctx context.Context) (string, error) {
+	return c.cache.Get(ctx, func(ctx context.Context) (string, time.Time, error) {
+		out, err := azCommand(ctx, "account", "get-access-token", "--scope", DefaultScope, "--output", "json")
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+				return "", time.Time{}, fmt.Errorf("az account get-access-token: %s", strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return "", time.Time{}, fmt.Errorf("az account get-access-token: %w", err)
+		}
+		var body struct {
+			AccessToken string `json:"accessToken"`
+			ExpiresOn   int64  `json:"expires_on"`
+		}
+		if err := json.Unmarshal(out, &body); err != nil {
+			return "", time.Time{}, fmt.Errorf("az account get-access-token: %w", err)
+		}
+		expires := time.Now().Add(5 * time.Minute)
+		if body.ExpiresOn > 0 {
+			expires = time.Unix(body.ExpiresOn, 0)
+		}
+		return body.AccessToken, expires, nil
+	})
+}
+
+// DefaultTokenSource picks the credentials from the environment, in this order
+// AZURE_ACCESS_TOKEN, the service principal of AZURE_TENANT_ID, AZURE_CLIENT_ID
+// and AZURE_CLIENT_SECRET, then the az CLI
+// Args:
+// 		getenv: func(string) string, os.Getenv
+// Returns:
+// 		TokenSource
+func DefaultTokenSource(getenv func(string) string) TokenSource {
+	if token := getenv("AZURE_ACCESS_TOKEN"); token != "" {
+		return StaticToken(token)
+	}
+	tenant, client, secret := getenv("AZURE_TENANT_ID"), getenv("AZURE_CLIENT_ID"), getenv("AZURE_CLIENT_SECRET")
+	if tenant != "" && client != "" && secret != "" {
+		return &ClientCredentials{TenantID: tenant, ClientID: client, ClientSecret: secret, Authority: getenv("AZURE_AUTHORITY_HOST")}
+	}
+	return &CLIToken{}
+}
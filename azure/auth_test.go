@@ -0,0 +1,97 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCredentialsSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		r.ParseForm()
+		if r.URL.Path != "/tenant-1/oauth2/v2.0/token" || r.Form.Get("client_secret") != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client", "error_description": "bad secret"})
+			return
+		}
+		assert.Equal("client_credentials", r.Form.Get("grant_type"))
+		assert.Equal(DefaultScope, r.Form.Get("scope"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token-1", "expires_in": 3600})
+	}))
+	defer server.Close()
+
+	credentials := &ClientCredentials{TenantID: "tenant-1", ClientID: "client", ClientSecret: "s3cret", Authority: server.URL}
+	for i := 0; i < 2; i++ {
+		token, err := credentials.Token(context.TODO())
+		assert.NoError(err)
+		assert.Equal("token-1", token)
+	}
+	assert.Equal(1, calls, "the token is cached")
+
+	invalid := &ClientCredentials{TenantID: "tenant-1", ClientID: "client", ClientSecret: "wrong", Authority: server.URL}
+	_, err := invalid.Token(context.TODO())
+	assert.EqualError(err, "azure: status 401: invalid_client: bad secret")
+}
+
+func TestCLITokenSuite(t *testing.T) {
+	assert := assert.New(t)
+	defer func(previous func(ctx context.Context, args ...string) ([]byte, error)) { azCommand = previous }(azCommand)
+
+	var args []string
+	azCommand = func(ctx context.Context, a ...string) ([]byte, error) {
+		args = a
+		return []byte(`{"accessToken": "cli-token", "expires_on": 4102444800}`), nil
+	}
+	token, err := (&CLIToken{}).Token(context.TODO())
+	assert.NoError(err)
+	assert.Equal("cli-token", token)
+	assert.Equal([]string{"account", "get-access-token", "--scope", DefaultScope, "--output", "json"}, args)
+
+	azCommand = func(ctx context.Context, a ...string) ([]byte, error) {
+		return nil, errors.New("executable file not found in $PATH")
+	}
+	_, err = (&CLIToken{}).Token(context.TODO())
+	assert.EqualError(err, "az account get-access-token: executable file not found in $PATH")
+}
+
+func TestDefaultTokenSourceSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		env      map[string]string
+		expected TokenSource
+	}{
+		{
+			name:     "Test the access token",
+			env:      map[string]string{"AZURE_ACCESS_TOKEN": "token", "AZURE_TENANT_ID": "tenant"},
+			expected: StaticToken("token"),
+		},
+		{
+			name:     "Test the service principal",
+			env:      map[string]string{"AZURE_TENANT_ID": "tenant", "AZURE_CLIENT_ID": "client", "AZURE_CLIENT_SECRET": "secret"},
+			expected: &ClientCredentials{TenantID: "tenant", ClientID: "client", ClientSecret: "secret"},
+		},
+		{
+			name:     "Test the az CLI without credentials",
+			env:      map[string]string{"AZURE_TENANT_ID": "tenant"},
+			expected: &CLIToken{},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			getenv := func(name string) string { return fixture.env[name] }
+			assert.Equal(fixture.expected, DefaultTokenSource(getenv))
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tagu/provider"
+)
+
+const (
+	// DefaultEndpoint is the Azure Resource Manager endpoint of the public cloud
+	DefaultEndpoint = "https://management.azure.com"
+	// DefaultPageSize is the maximum page size of Resource Graph
+	DefaultPageSize = 1000
+	// APIVersion is the Resource Graph API version
+	APIVersion = "2021-03-01"
+)
+
+// APIError is an error answered by Resource Manager or the token endpoint
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("azure: status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("azure: status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// HTTPStatus returns the status code of the answer
+func (e *APIError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// Client queries Resource Graph, the throttled and the failed calls are retried
+// params:
+// 		endpoint: string, DefaultEndpoint when empty
+// 		token: TokenSource
+// 		pageSize: int, DefaultPageSize when zero
+// 		maxAttempts: int, the attempts of each call, 3 when zero
+// 		backoff: time.Duration, the delay before the second attempt doubled on each attempt,
+// 		a Retry-After header takes precedence
+type Client struct {
+	Endpoint    string
+	Token       TokenSource
+	HTTPClient  *http.Client
+	PageSize    int
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// queryRequest is the body of a Resource Graph query
+type queryRequest struct {
+	Subscriptions []string     `json:"subscriptions,omitempty"`
+	Query         string       `json:"query"`
+	Options       queryOptions `json:"options"`
+}
+
+type queryOptions struct {
+	Top          int    `json:"$top"`
+	SkipToken    string `json:"$skipToken,omitempty"`
+	ResultFormat string `json:"resultFormat"`
+}
+
+// queryResponse is a page of the results of a Resource Graph query
+type queryResponse struct {
+	TotalRecords int64             `json:"totalRecords"`
+	SkipToken    string            `json:"$skipToken"`
+	Data         []json.RawMessage `json:"data"`
+}
+
+// Query runs the query on the subscriptions and follows the pages, onRow is called
+// with each row of the results
+// Args:
+// 		ctx: context.Context
+// 		subscriptions: []string, every subscription readable by the credentials when empty
+// 		query: string, the Kusto query
+// 		onRow: func(json.RawMessage) error, stops the query on error
+// Returns:
+// 		error: if a page can not be fetched or onRow failed
+func (c *Client) Query(ctx context.Context, subscriptions []string, query string, onRow func(row json.RawMessage) error) error {
+	request := queryRequest{
+		Subscriptions: subscriptions,
+		Query:         query,
+		Options:       queryOptions{Top: c.PageSize, ResultFormat: "objectArray"},
+	}
+	if request.Options.Top <= 0 {
+		request.Options.Top = DefaultPageSize
+	}
+	for {
+		var page queryResponse
+		if err := c.post(ctx, "/providers/Microsoft.ResourceGraph/resources?api-version="+APIVersion, request, &page); err != nil {
+			return err
+		}
+		for _, row := range page.Data {
+			if err := onRow(row); err != nil {
+				return err
+			}
+		}
+		if page.SkipToken == "" {
+			return nil
+		}
+		request.Options.SkipToken = page.SkipToken
+	}
+}
+
+// post sends the body and decodes the response, the 429 and 5xx answers are retried
+func (c *Client) post(ctx context.Context, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	caller := provider.HTTPCaller{Client: c.HTTPClient, MaxAttempts: c.MaxAttempts, Backoff: c.Backoff}
+	return caller.Call(ctx, func(ctx context.Context) (*http.Request, error) {
+		token, err := c.Token.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("azure credentials: %w", err)
+		}
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultEndpoint
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, decodeError, out)
+}
+
+// decodeError returns the APIError of a failed answer
+func decodeError(status int, body []byte) error {
+	apiErr := &APIError{StatusCode: status, Message: http.StatusText(status)}
+	var failure struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &failure) == nil && failure.Error.Code != "" {
+		apiErr.Code, apiErr.Message = failure.Error.Code, failure.Error.Message
+	}
+	return apiErr
+}
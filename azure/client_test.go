@@ -0,0 +1,167 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGraph serves the rows of each subscription in pages of two rows, the skip
+// token is the offset of the next page. The subscription named "denied" answers
+// 403 and the first throttled calls answer 429
+type fakeGraph struct {
+	mu        sync.Mutex
+	rows      map[string][]map[string]interface{}
+	throttled int
+	requests  []queryRequest
+}
+
+func (f *fakeGraph) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/providers/Microsoft.ResourceGraph/resources" || r.URL.Query().Get("api-version") != APIVersion {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": "InvalidAuthenticationToken", "message": "bad token"}})
+		return
+	}
+	if f.throttled > 0 {
+		f.throttled--
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": "RateLimiting", "message": "slow down"}})
+		return
+	}
+	var request queryRequest
+	json.NewDecoder(r.Body).Decode(&request)
+	f.requests = append(f.requests, request)
+
+	var rows []map[string]interface{}
+	if len(request.Subscriptions) == 0 {
+		for subscription := range f.rows {
+			rows = append(rows, map[string]interface{}{"subscriptionId": subscription})
+		}
+	}
+	for _, subscription := range request.Subscriptions {
+		if subscription == "denied" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": "AuthorizationFailed", "message": "no read access"}})
+			return
+		}
+		rows = append(rows, f.rows[subscription]...)
+	}
+	start, _ := strconv.Atoi(request.Options.SkipToken)
+	end := start + 2
+	response := map[string]interface{}{"totalRecords": len(rows)}
+	if end < len(rows) {
+		response["$skipToken"] = strconv.Itoa(end)
+	} else {
+		end = len(rows)
+	}
+	response["data"] = rows[start:end]
+	json.NewEncoder(w).Encode(response)
+}
+
+func newFakeClient(graph *fakeGraph) (*Client, func()) {
+	server := httptest.NewServer(graph)
+	return &Client{Endpoint: server.URL, Token: StaticToken("secret"), HTTPClient: server.Client(), Backoff: time.Millisecond}, server.Close
+}
+
+func TestClientQuerySuite(t *testing.T) {
+	assert := assert.New(t)
+
+	var rows []map[string]interface{}
+	for i := 0; i < 5; i++ {
+		rows = append(rows, map[string]interface{}{"id": strconv.Itoa(i)})
+	}
+
+	fixtures := []struct {
+		name     string
+		graph    *fakeGraph
+		token    TokenSource
+		ids      []string
+		requests int
+		err      string
+	}{
+		{
+			name:     "Test the pages are followed",
+			graph:    &fakeGraph{rows: map[string][]map[string]interface{}{"sub-1": rows}},
+			ids:      []string{"0", "1", "2", "3", "4"},
+			requests: 3,
+		},
+		{
+			name:     "Test the throttled calls are retried",
+			graph:    &fakeGraph{rows: map[string][]map[string]interface{}{"sub-1": rows[:1]}, throttled: 2},
+			ids:      []string{"0"},
+			requests: 1,
+		},
+		{
+			name:  "Test the retries give up after the attempts",
+			graph: &fakeGraph{rows: map[string][]map[string]interface{}{"sub-1": rows[:1]}, throttled: 3},
+			err:   "azure: status 429: RateLimiting: slow down",
+		},
+		{
+			name:  "Test an invalid token is not retried",
+			graph: &fakeGraph{rows: map[string][]map[string]interface{}{"sub-1": rows[:1]}, throttled: 3},
+			token: StaticToken("expired"),
+			err:   "azure: status 401: InvalidAuthenticationToken: bad token",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			client, stop := newFakeClient(fixture.graph)
+			defer stop()
+			if fixture.token != nil {
+				client.Token = fixture.token
+			}
+			var ids []string
+			err := client.Query(context.TODO(), []string{"sub-1"}, "resources", func(row json.RawMessage) error {
+				var r struct{ ID string }
+				json.Unmarshal(row, &r)
+				ids = append(ids, r.ID)
+				return nil
+			})
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(fixture.ids, ids)
+			assert.Len(fixture.graph.requests, fixture.requests)
+			for _, request := range fixture.graph.requests {
+				assert.Equal(DefaultPageSize, request.Options.Top)
+				assert.Equal("objectArray", request.Options.ResultFormat)
+			}
+		})
+	}
+}
+
+func TestClientQueryStopsSuite(t *testing.T) {
+	assert := assert.New(t)
+	graph := &fakeGraph{rows: map[string][]map[string]interface{}{"sub-1": {{"id": "0"}, {"id": "1"}, {"id": "2"}}}}
+	client, stop := newFakeClient(graph)
+	defer stop()
+
+	err := client.Query(context.TODO(), []string{"sub-1"}, "resources", func(row json.RawMessage) error {
+		return errors.New("invalid row")
+	})
+	assert.EqualError(err, "invalid row")
+	assert.Len(graph.requests, 1)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = client.Query(ctx, []string{"sub-1"}, "resources", func(row json.RawMessage) error { return nil })
+	assert.True(errors.Is(err, context.Canceled))
+}
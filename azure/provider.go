@@ -0,0 +1,98 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+
+	"tagu/models"
+	"tagu/provider"
+)
+
+// ProviderName is the name of the Azure provider
+const ProviderName = "azure"
+
+// Provider lists the resources of the spec with Resource Graph, a target is a subscription
+type Provider struct {
+	spec   models.AzureSpec
+	client *Client
+}
+
+// NewProvider creates the provider of the spec
+// Args:
+// 		spec: models.AzureSpec
+// 		client: *Client
+// Returns:
+// 		*Provider
+func NewProvider(spec models.AzureSpec, client *Client) *Provider {
+	return &Provider{spec: spec, client: client}
+}
+
+// Name returns azure
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// Targets returns the subscriptions of the spec, every subscription readable by
+// the credentials when the spec has none
+func (p *Provider) Targets(ctx context.Context) ([]provider.Target, error) {
+	var targets []provider.Target
+	for _, subscription := range p.spec.Subscriptions {
+		targets = append(targets, provider.Target{Scope: subscription})
+	}
+	if len(targets) > 0 {
+		return targets, nil
+	}
+	err := p.client.Query(ctx, nil, SubscriptionsQuery, func(row json.RawMessage) error {
+		var container struct {
+			SubscriptionID string `json:"subscriptionId"`
+		}
+		if err := json.Unmarshal(row, &container); err != nil {
+			return err
+		}
+		targets = append(targets, provider.Target{Scope: container.SubscriptionID})
+		return nil
+	})
+	return targets, err
+}
+
+// resourceRow is a row of the BuildQuery results
+type resourceRow struct {
+	ID             string            `json:"id"`
+	Type           string            `json:"type"`
+	Location       string            `json:"location"`
+	SubscriptionID string            `json:"subscriptionId"`
+	Tags           map[string]string `json:"tags"`
+}
+
+// Resources lists the resources of the subscription matching the spec filters,
+// the resources without tags are listed too
+func (p *Provider) Resources(ctx context.Context, target provider.Target) ([]provider.Resource, error) {
+	var resources []provider.Resource
+	err := p.client.Query(ctx, []string{target.Scope}, BuildQuery(p.spec), func(row json.RawMessage) error {
+		var r resourceRow
+		if err := json.Unmarshal(row, &r); err != nil {
+			return err
+		}
+		if r.Tags == nil {
+			r.Tags = map[string]string{}
+		}
+		if !provider.MatchValues(p.spec.FilterTags, r.Tags) {
+			return nil
+		}
+		resources = append(resources, provider.Resource{
+			Provider: ProviderName,
+			Scope:    r.SubscriptionID,
+			Location: r.Location,
+			Type:     r.Type,
+			ID:       r.ID,
+			Tags:     r.Tags,
+		})
+		return nil
+	})
+	return resources, err
+}
+
+// Classify maps the Resource Manager errors to their cause
+func (p *Provider) Classify(err error) string {
+	return provider.ClassifyHTTP(err)
+}
@@ -0,0 +1,89 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+	"tagu/provider"
+)
+
+var graphRows = map[string][]map[string]interface{}{
+	"sub-1": {
+		{"id": "/subscriptions/sub-1/resourceGroups/web/providers/Microsoft.Compute/virtualMachines/vm-1", "type": "microsoft.compute/virtualmachines", "location": "westeurope", "subscriptionId": "sub-1", "tags": map[string]string{"env": "prod", "owner": "web"}},
+		{"id": "/subscriptions/sub-1/resourceGroups/web/providers/Microsoft.Network/virtualNetworks/vnet-1", "type": "microsoft.network/virtualnetworks", "location": "westeurope", "subscriptionId": "sub-1", "tags": nil},
+		{"id": "/subscriptions/sub-1/resourceGroups/web/providers/Microsoft.Storage/storageAccounts/logs", "type": "microsoft.storage/storageaccounts", "location": "northeurope", "subscriptionId": "sub-1", "tags": map[string]string{"env": "dev"}},
+	},
+	"sub-2": {
+		{"id": "/subscriptions/sub-2/resourceGroups/data/providers/Microsoft.Sql/servers/db", "type": "microsoft.sql/servers", "location": "eastus", "subscriptionId": "sub-2", "tags": map[string]string{"env": "prod"}},
+	},
+}
+
+func TestProviderTargetsSuite(t *testing.T) {
+	assert := assert.New(t)
+	client, stop := newFakeClient(&fakeGraph{rows: graphRows})
+	defer stop()
+
+	targets, err := NewProvider(models.AzureSpec{Subscriptions: []string{"sub-2"}}, client).Targets(context.TODO())
+	assert.NoError(err)
+	assert.Equal([]provider.Target{{Scope: "sub-2"}}, targets)
+
+	targets, err = NewProvider(models.AzureSpec{}, client).Targets(context.TODO())
+	assert.NoError(err)
+	assert.ElementsMatch([]provider.Target{{Scope: "sub-1"}, {Scope: "sub-2"}}, targets)
+}
+
+func TestProviderScanSuite(t *testing.T) {
+	assert := assert.New(t)
+	graph := &fakeGraph{rows: graphRows}
+	client, stop := newFakeClient(graph)
+	defer stop()
+
+	spec := models.AzureSpec{Subscriptions: []string{"sub-1", "denied", "sub-2"}, FilterTags: []models.Tags{{Values: []string{"prod", "web"}}}}
+	report, err := provider.Scan(context.TODO(), NewProvider(spec, client), provider.ScanOptions{Concurrency: 2})
+	assert.NoError(err)
+	assert.Equal([]provider.Resource{
+		{Provider: "azure", Scope: "sub-1", Location: "westeurope", Type: "microsoft.compute/virtualmachines", ID: "/subscriptions/sub-1/resourceGroups/web/providers/Microsoft.Compute/virtualMachines/vm-1", Tags: map[string]string{"env": "prod", "owner": "web"}},
+		{Provider: "azure", Scope: "sub-2", Location: "eastus", Type: "microsoft.sql/servers", ID: "/subscriptions/sub-2/resourceGroups/data/providers/Microsoft.Sql/servers/db", Tags: map[string]string{"env": "prod"}},
+	}, report.Resources)
+	assert.Equal(provider.StatusOK, report.Targets[0].Status)
+	assert.Equal(provider.StatusFailed, report.Targets[1].Status)
+	assert.Equal(provider.CauseAccessDenied, report.Targets[1].Cause)
+	assert.Equal("azure: status 403: AuthorizationFailed: no read access", report.Targets[1].Error)
+	for _, request := range graph.requests {
+		assert.Equal(BuildQuery(spec), request.Query)
+	}
+
+	resources, err := NewProvider(models.AzureSpec{}, client).Resources(context.TODO(), provider.Target{Scope: "sub-1"})
+	assert.NoError(err)
+	assert.Len(resources, 3)
+	assert.Equal(map[string]string{}, resources[1].Tags)
+}
+
+func TestProviderClassifySuite(t *testing.T) {
+	assert := assert.New(t)
+	p := NewProvider(models.AzureSpec{}, nil)
+
+	fixtures := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "Test unauthorized", err: &APIError{StatusCode: 401}, expected: provider.CauseAccessDenied},
+		{name: "Test forbidden", err: &APIError{StatusCode: 403}, expected: provider.CauseAccessDenied},
+		{name: "Test throttled", err: &APIError{StatusCode: 429}, expected: provider.CauseThrottled},
+		{name: "Test server error", err: &APIError{StatusCode: 500}, expected: provider.CauseUnknown},
+		{name: "Test network", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: provider.CauseNetwork},
+		{name: "Test other", err: errors.New("invalid row"), expected: provider.CauseUnknown},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, p.Classify(fixture.err))
+		})
+	}
+}
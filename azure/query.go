@@ -0,0 +1,59 @@
+package azure
+
+import (
+	"strings"
+
+	"tagu/models"
+)
+
+// SubscriptionsQuery lists the subscriptions readable by the credentials
+const SubscriptionsQuery = `resourcecontainers
+| where type =~ 'microsoft.resources/subscriptions'
+| project subscriptionId
+| order by subscriptionId asc`
+
+// quote returns s as a Kusto string literal
+func quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = quote(value)
+	}
+	return "(" + strings.Join(quoted, ", ") + ")"
+}
+
+// BuildQuery builds the Resource Graph query of the spec filters
+// The resource groups and the types are compared case insensitively like Azure does,
+// a tag filter with a key keeps the resources having the key and one of the values
+// if any. The filters with values only are applied by provider.MatchValues as Kusto can not
+// match the values of every key without expanding the rows
+// Args:
+// 		spec: models.AzureSpec
+// Returns:
+// 		string: the Kusto query sorted by resource id
+func BuildQuery(spec models.AzureSpec) string {
+	lines := []string{"resources"}
+	if len(spec.ResourceGroups) > 0 {
+		lines = append(lines, "| where resourceGroup in~ "+quoteAll(spec.ResourceGroups))
+	}
+	if len(spec.FilterResources) > 0 {
+		lines = append(lines, "| where type in~ "+quoteAll(spec.FilterResources))
+	}
+	for _, tag := range spec.FilterTags {
+		switch {
+		case tag.Key == "":
+		case len(tag.Values) == 0:
+			lines = append(lines, "| where isnotnull(tags["+quote(tag.Key)+"])")
+		default:
+			lines = append(lines, "| where tostring(tags["+quote(tag.Key)+"]) in "+quoteAll(tag.Values))
+		}
+	}
+	lines = append(lines,
+		"| project id, type, location, subscriptionId, resourceGroup, tags",
+		"| order by id asc",
+	)
+	return strings.Join(lines, "\n")
+}
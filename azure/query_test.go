@@ -0,0 +1,48 @@
+package azure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+func TestBuildQuerySuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		spec     models.AzureSpec
+		expected string
+	}{
+		{
+			name:     "Test no filter",
+			expected: "resources\n| project id, type, location, subscriptionId, resourceGroup, tags\n| order by id asc",
+		},
+		{
+			name: "Test every filter",
+			spec: models.AzureSpec{
+				ResourceGroups:  []string{"web-prod", "web-dev"},
+				FilterResources: []string{"microsoft.compute/virtualmachines"},
+				FilterTags: []models.Tags{
+					{Key: "env", Values: []string{"prod", "it's"}},
+					{Key: "owner"},
+					{Values: []string{"dev"}},
+				},
+			},
+			expected: "resources\n" +
+				"| where resourceGroup in~ ('web-prod', 'web-dev')\n" +
+				"| where type in~ ('microsoft.compute/virtualmachines')\n" +
+				"| where tostring(tags['env']) in ('prod', 'it\\'s')\n" +
+				"| where isnotnull(tags['owner'])\n" +
+				"| project id, type, location, subscriptionId, resourceGroup, tags\n| order by id asc",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, BuildQuery(fixture.spec))
+		})
+	}
+}
@@ -22,11 +22,24 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"tagu/aws"
+	"tagu/export"
 	"tagu/models"
+	"tagu/query"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -43,29 +56,502 @@ to quickly create a Cobra application.`,
 	RunE: awsCmdRunE,
 }
 
+// awsScan is the scan entrypoint, replaced in the unittest
+var awsScan = aws.Scan
+
+// awsOutputs are the formats of the output flag
+var awsOutputs = []string{"table", "csv", "xlsx", "sqlite", "parquet"}
+
+// awsOutputOptions are the output flags of the aws command
+type awsOutputOptions struct {
+	Format    string
+	File      string
+	Pivot     bool
+	Columns   []string
+	Partition bool
+}
+
 func awsCmdRunE(c *cobra.Command, args []string) (err error) {
-	filePath, err := c.Flags().GetString("input-file")
+	spec, err := awsLoadSpec(c)
+	if err != nil {
+		return err
+	}
+	failOn, err := awsFailOn(c)
+	if err != nil {
+		return err
+	}
+	output, err := awsOutput(c)
 	if err != nil {
 		return err
 	}
-	_, err = awsloadConfig(filePath)
+
+	// Open everything the scan needs first so a failure leaves the output untouched
+	scanner, err := awsOpenScanner(c)
+	if err != nil {
+		return err
+	}
+	defer scanner.Close()
+	ctx, cancel, err := awsContext(c)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	meta := export.Metadata{Started: time.Now(), InputFile: viper.ConfigFileUsed()}
+	report, err := scanner.scan(ctx, spec)
+	meta.Finished = time.Now()
+	// The results of a scan stopped by the timeout or an interrupt are written
+	if err != nil && ctx.Err() == nil {
+		printTargets(c.OutOrStdout(), report.Targets)
+		return err
+	}
+	if werr := writeReport(c, output, report, meta); werr != nil {
+		return werr
+	}
 	if err != nil {
 		return err
 	}
-	c.Printf("Load configuration file %s", viper.ConfigFileUsed())
+	return checkFailOn(failOn, report.Targets)
+}
+
+// writeReport writes the report in the output format, the partial results of a
+// stopped scan are written too. The targets go to stderr when the results are
+// written to stdout in a machine readable format
+func writeReport(c *cobra.Command, output awsOutputOptions, report aws.Report, meta export.Metadata) error {
+	table := export.FlatTable(report.Results)
+	if output.Pivot {
+		table = export.PivotTable(report.Results, output.Columns)
+	}
+
+	switch output.Format {
+	case "sqlite":
+		printTargets(c.OutOrStdout(), report.Targets)
+		scanID, err := export.WriteSQLite(output.File, report, meta)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.OutOrStdout(), "\nScan %d written to %s\n", scanID, output.File)
+	case "parquet":
+		printTargets(c.OutOrStdout(), report.Targets)
+		files, err := export.WriteParquet(output.File, report, meta, output.Partition)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.OutOrStdout())
+		for _, file := range files {
+			fmt.Fprintf(c.OutOrStdout(), "Resources written to %s\n", file)
+		}
+	case "xlsx":
+		printTargets(c.OutOrStdout(), report.Targets)
+		file, err := os.Create(output.File)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err = export.WriteXLSX(file, report, output.Columns); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.OutOrStdout(), "\nReport written to %s\n", output.File)
+	case "csv":
+		if output.File == "" {
+			printTargets(c.ErrOrStderr(), report.Targets)
+			return export.WriteCSV(c.OutOrStdout(), table)
+		}
+		printTargets(c.OutOrStdout(), report.Targets)
+		file, err := os.Create(output.File)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return export.WriteCSV(file, table)
+	default:
+		if !output.Pivot {
+			printReport(c.OutOrStdout(), report)
+			return nil
+		}
+		printTable(c.OutOrStdout(), table, len(export.ResourceColumns))
+		fmt.Fprintln(c.OutOrStdout())
+		printTargets(c.OutOrStdout(), report.Targets)
+	}
 	return nil
 }
 
+// awsOutput reads and validates the output, output-file, pivot and columns flags
+// Selecting columns pivots the results
+func awsOutput(c *cobra.Command) (output awsOutputOptions, err error) {
+	if output.Format, err = c.Flags().GetString("output"); err != nil {
+		return output, err
+	}
+	if output.File, err = c.Flags().GetString("output-file"); err != nil {
+		return output, err
+	}
+	if output.Pivot, err = c.Flags().GetBool("pivot"); err != nil {
+		return output, err
+	}
+	if output.Columns, err = c.Flags().GetStringSlice("columns"); err != nil {
+		return output, err
+	}
+	output.Pivot = output.Pivot || len(output.Columns) > 0
+	if output.Partition, err = c.Flags().GetBool("partition"); err != nil {
+		return output, err
+	}
+	return output, checkOutput(output)
+}
+
+// checkOutput validates the combination of the output options
+func checkOutput(output awsOutputOptions) error {
+	if output.Partition && output.Format != "parquet" {
+		return errors.New("--partition requires the parquet output")
+	}
+
+	switch output.Format {
+	case "table":
+		if output.File != "" {
+			return errors.New("--output-file is not supported by the table output")
+		}
+	case "csv":
+	case "xlsx", "sqlite", "parquet":
+		if output.File == "" {
+			return fmt.Errorf("--output %s requires --output-file", output.Format)
+		}
+		if output.Pivot && output.Format != "xlsx" {
+			return fmt.Errorf("--pivot is not supported by the %s output", output.Format)
+		}
+	default:
+		return fmt.Errorf("invalid output %q, expected %s", output.Format, strings.Join(awsOutputs, ", "))
+	}
+	return nil
+}
+
+// awsScanner is a scan whose flags are validated and whose cache and state file
+// are open, so nothing is written before the scan can start
+type awsScanner struct {
+	where *query.Expression
+	opts  aws.ScanOptions
+}
+
+// awsOpenScanner reads the scan, cache and state file flags of c
+// Returns:
+// 		*awsScanner: the scanner to close once the scan is done
+// 		error: if a flag is invalid or the state file can not be opened
+func awsOpenScanner(c *cobra.Command) (scanner *awsScanner, err error) {
+	scanner = &awsScanner{}
+	if scanner.where, err = awsWhere(c); err != nil {
+		return nil, err
+	}
+	if scanner.opts, err = awsScanOptions(c); err != nil {
+		return nil, err
+	}
+	if scanner.opts.ComplianceDetails, err = c.Flags().GetBool("compliance-details"); err != nil {
+		return nil, err
+	}
+	if scanner.opts.Cache, scanner.opts.RefreshCache, err = awsCache(c); err != nil {
+		return nil, err
+	}
+	if scanner.opts.Checkpoint, err = awsCheckpoint(c); err != nil {
+		return nil, err
+	}
+	return scanner, nil
+}
+
+// scan scans the spec, the where expression is evaluated on the collected results,
+// the cache and the state file keep every scanned resource
+func (s *awsScanner) scan(ctx context.Context, spec models.Spec) (aws.Report, error) {
+	report, err := awsScan(ctx, spec, s.opts)
+	if s.where != nil {
+		report.Results = query.Filter(report.Results, s.where)
+	}
+	return report, err
+}
+
+// Close closes the state file
+func (s *awsScanner) Close() error {
+	if s.opts.Checkpoint != nil {
+		return s.opts.Checkpoint.Close()
+	}
+	return nil
+}
+
+// awsRunScan scans the spec with the scan, cache and state file flags of c
+func awsRunScan(c *cobra.Command, spec models.Spec) (report aws.Report, err error) {
+	scanner, err := awsOpenScanner(c)
+	if err != nil {
+		return report, err
+	}
+	defer scanner.Close()
+
+	ctx, cancel, err := awsContext(c)
+	if err != nil {
+		return report, err
+	}
+	defer cancel()
+	return scanner.scan(ctx, spec)
+}
+
+// awsWhere compiles the where flag, nil when not set
+func awsWhere(c *cobra.Command) (*query.Expression, error) {
+	where, err := c.Flags().GetString("where")
+	if err != nil || where == "" {
+		return nil, err
+	}
+	expr, err := query.Compile(where)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --where: %w", err)
+	}
+	return expr, nil
+}
+
+// awsLoadSpec loads the spec from the input-file flag or the AWS_CONFIG variable
+func awsLoadSpec(c *cobra.Command) (spec models.Spec, err error) {
+	filePath, err := c.Flags().GetString("input-file")
+	if err != nil {
+		return spec, err
+	}
+	spec, err = awsloadConfig(filePath)
+	if err != nil {
+		return spec, err
+	}
+	c.Printf("Load configuration file %s\n", viper.ConfigFileUsed())
+	return spec, nil
+}
+
+// awsContext returns the scan context, bounded by the timeout flag
+// Ctrl-C cancels the running scan, the partial results are still printed
+func awsContext(c *cobra.Command) (context.Context, context.CancelFunc, error) {
+	timeout, err := c.Flags().GetDuration("timeout")
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, stop := signal.NotifyContext(c.Context(), os.Interrupt)
+	if timeout <= 0 {
+		return ctx, stop, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}, nil
+}
+
+// awsFailOn reads and validates the fail-on flag
+func awsFailOn(c *cobra.Command) (string, error) {
+	failOn, err := c.Flags().GetString("fail-on")
+	if err != nil {
+		return failOn, err
+	}
+	if failOn != "any" && failOn != "all" && failOn != "none" {
+		return failOn, fmt.Errorf("invalid fail-on value %q, expected any, all or none", failOn)
+	}
+	return failOn, nil
+}
+
+// awsScanOptions reads the target timeout, concurrency, retry and rate limit flags
+func awsScanOptions(c *cobra.Command) (opts aws.ScanOptions, err error) {
+	if opts.TargetTimeout, err = c.Flags().GetDuration("target-timeout"); err != nil {
+		return opts, err
+	}
+	if opts.Concurrency, err = c.Flags().GetInt("concurrency"); err != nil {
+		return opts, err
+	}
+	retryMode, err := c.Flags().GetString("retry-mode")
+	if err != nil {
+		return opts, err
+	}
+	if opts.RetryMode, err = awssdk.ParseRetryMode(retryMode); err != nil {
+		return opts, err
+	}
+	if opts.MaxAttempts, err = c.Flags().GetInt("max-attempts"); err != nil {
+		return opts, err
+	}
+	if opts.MaxBackoff, err = c.Flags().GetDuration("max-backoff"); err != nil {
+		return opts, err
+	}
+	if opts.RateLimit, err = c.Flags().GetFloat64("rate-limit"); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// awsCache returns the results cache unless --no-cache is set
+// and whether the cached results must be refreshed
+func awsCache(c *cobra.Command) (*aws.Cache, bool, error) {
+	noCache, err := c.Flags().GetBool("no-cache")
+	if err != nil || noCache {
+		return nil, false, err
+	}
+	refresh, err := c.Flags().GetBool("refresh")
+	if err != nil {
+		return nil, false, err
+	}
+	cache, err := cacheFromFlags(c)
+	return cache, refresh, err
+}
+
+// awsCheckpoint opens the state file, --resume continues the scan recorded
+// in the file while --state-file starts a new one, they can not be combined
+func awsCheckpoint(c *cobra.Command) (*aws.Checkpoint, error) {
+	resume, err := c.Flags().GetString("resume")
+	if err != nil {
+		return nil, err
+	}
+	stateFile, err := c.Flags().GetString("state-file")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resume != "" && stateFile != "":
+		return nil, errors.New("--resume and --state-file can not be combined, --resume keeps recording to its file")
+	case resume != "":
+		return aws.OpenCheckpoint(resume, true)
+	case stateFile != "":
+		return aws.OpenCheckpoint(stateFile, false)
+	}
+	return nil, nil
+}
+
+// checkFailOn turns the failed targets into an error according to the fail-on policy
+// any: at least one target failed, all: every target failed, none: never
+func checkFailOn(failOn string, targets aws.TargetReports) error {
+	return failOnError(failOn, len(targets.Failed()), len(targets))
+}
+
+// failOnError applies the fail-on policy to the count of failed targets
+func failOnError(failOn string, failed, total int) error {
+	if failed == 0 || failOn == "none" || (failOn == "all" && failed < total) {
+		return nil
+	}
+	return fmt.Errorf("%d of %d targets failed", failed, total)
+}
+
+// printReport writes the collected tags followed by the status of each target
+// The compliance columns are only written when the results hold compliance details
+func printReport(out io.Writer, report aws.Report) {
+	compliance := false
+	for _, r := range report.Results {
+		compliance = compliance || r.Compliant != nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "ACCOUNT\tREGION\tSERVICE\tRESOURCE\tKEY\tVALUE")
+	if compliance {
+		fmt.Fprint(w, "\tCOMPLIANT\tNONCOMPLIANT KEYS")
+	}
+	fmt.Fprintln(w)
+	for _, r := range report.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s", r.Account, r.Region, r.Service, r.Resource, r.Key, r.Value)
+		if compliance {
+			keys := append(append([]string{}, r.NoncompliantKeys...), r.KeysWithNoncompliantValues...)
+			fmt.Fprintf(w, "\t%t\t%s", awssdk.ToBool(r.Compliant), strings.Join(keys, ","))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	fmt.Fprintln(out)
+	printTargets(out, report.Targets)
+}
+
+// printTable writes a table, the first columns identifying the resource are upper-cased
+// and the tag key columns kept as is
+func printTable(out io.Writer, table export.Table, resourceColumns int) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, column := range table.Header {
+		if i < resourceColumns {
+			column = strings.ToUpper(column)
+		}
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, column)
+	}
+	fmt.Fprintln(w)
+	for _, row := range table.Rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// printTargets writes the status of each target and the errors of the failed ones
+func printTargets(out io.Writer, targets aws.TargetReports) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tREGION\tSTATUS\tCAUSE\tTAGS\tTHROTTLES")
+	for _, t := range targets {
+		status := string(t.Status)
+		if t.Cached {
+			status += " (cached)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\n", t.Account, t.Region, status, t.Cause, t.Count, t.Throttles)
+	}
+	w.Flush()
+
+	for _, t := range targets {
+		if t.CacheErr != nil {
+			fmt.Fprintf(out, "Warning: %s/%s not cached: %s\n", t.Account, t.Region, t.CacheErr)
+		}
+	}
+	failed := targets.Failed()
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tREGION\tERROR")
+	for _, t := range failed {
+		msg := string(t.Status)
+		if t.Err != nil {
+			msg = t.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", t.Account, t.Region, msg)
+	}
+	w.Flush()
+}
+
 func initAwsFlags(c *cobra.Command) {
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
 	// and all subcommands, e.g.:
-	c.Flags().StringP("input-file", "i", "", "the input file")
+	initAwsCommonFlags(c.PersistentFlags())
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	// awsCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	c.Flags().String("output", "table", "the output format, "+strings.Join(awsOutputs, ", "))
+	c.Flags().String("output-file", "", "write the csv, xlsx, sqlite or parquet output to this file, the sqlite scans are appended")
+	c.Flags().Bool("pivot", false, "write one row per resource and one column per tag key")
+	c.Flags().Bool("partition", false, "write the parquet output to account=<account>/region=<region>/ directories under --output-file")
+	c.Flags().StringSlice("columns", nil, "the tag key columns of the pivoted output and of the xlsx sheets in this order, implies --pivot (default every key)")
+	initAwsScanFlags(c)
+}
+
+// initAwsCommonFlags defines the input file, timeout, retry and rate limit flags shared by the aws commands
+func initAwsCommonFlags(flags *pflag.FlagSet) {
+	initProviderCommonFlags(flags)
+	initAwsClientFlags(flags)
+}
+
+// initAwsClientFlags defines the retry and rate limit flags of the AWS clients
+func initAwsClientFlags(flags *pflag.FlagSet) {
+	flags.String("retry-mode", "adaptive", "AWS retry mode, adaptive or standard")
+	flags.Int("max-attempts", 10, "maximum attempts of each AWS call")
+	flags.Duration("max-backoff", 20*time.Second, "maximum delay between two attempts of an AWS call")
+	flags.Float64("rate-limit", 5, "maximum tagging API requests per second for each account/region (0 means no limit)")
+}
+
+// initAwsScanFlags defines the state file, cache, compliance and where flags of the commands scanning the tags
+func initAwsScanFlags(c *cobra.Command) {
+	c.Flags().String("state-file", "", "persist the scan progress to this file")
+	c.Flags().String("resume", "", "resume the scan recorded in this state file")
+	initAwsRepeatedScanFlags(c)
+}
+
+// initAwsRepeatedScanFlags defines the cache, compliance and where flags of the commands
+// scanning the tags again and again, a state file only records a single scan
+func initAwsRepeatedScanFlags(c *cobra.Command) {
+	c.Flags().Bool("no-cache", false, "neither read nor write the results cache")
+	c.Flags().Bool("refresh", false, "scan every target again and replace the cached results")
+	c.Flags().Bool("compliance-details", false, "include the tag policies compliance of each resource")
+	c.Flags().String("where", "", `keep the resources matching this expression, service == "ec2" && !has(tags.owner) || tags.env =~ "^prod"`)
+	initCacheFlags(c.Flags())
 }
 
 func init() {
@@ -87,21 +573,37 @@ func awsloadConfig(tags string) (spec models.Spec, err error) {
 	if err != nil {
 		return spec, fmt.Errorf("%s", err)
 	}
-	if viper.IsSet("accounts") {
+	return decodeSpec(viper.GetViper())
+}
+
+// decodeSpec decodes the general or the detailed spec read by v
+func decodeSpec(v *viper.Viper) (spec models.Spec, err error) {
+	if v.IsSet("accounts") {
 		var gspec models.GeneralSpec
-		err = viper.Unmarshal(&gspec) // Load config file in struct object
+		err = v.Unmarshal(&gspec) // Load config file in struct object
 		if err != nil {
 			return spec, err
 		}
 		spec.UniformConfig(gspec) // Build generic config into detailed one
-	} else if viper.IsSet("filter-input") {
-		err = viper.Unmarshal(&spec) // Load config file in struct object
+	} else if v.IsSet("filter-input") {
+		err = v.Unmarshal(&spec) // Load config file in struct object
 		if err != nil {
 			return spec, err
 		}
 	} else {
-		return spec, fmt.Errorf("invalid configuration format for file %s", viper.ConfigFileUsed())
+		return spec, fmt.Errorf("invalid configuration format for file %s", v.ConfigFileUsed())
 	}
 
 	return spec, nil
 }
+
+// loadSpecFile reads a spec file without changing the global configuration
+func loadSpecFile(path string) (models.Spec, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return models.Spec{}, fmt.Errorf("%s", err)
+	}
+	return decodeSpec(v)
+}
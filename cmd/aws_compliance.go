@@ -0,0 +1,124 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"tagu/aws"
+
+	"github.com/spf13/cobra"
+)
+
+// awsComplianceCmd represents the aws compliance command
+var awsComplianceCmd = &cobra.Command{
+	Use:   "compliance",
+	Short: "Summarize the organization tag policies compliance",
+	Long: `Summarize the noncompliant resources by account, region and resource type as computed
+by AWS for the organization tag policies. The summary is read from the organization
+management account, the first account of the configuration unless --account is set.
+
+With --report-bucket, a report job writing the compliance of every resource to the
+bucket is started and waited for before reading the summary.`,
+	Args: cobra.NoArgs,
+	RunE: awsComplianceCmdRunE,
+}
+
+// awsCompliance is the compliance entrypoint, replaced in the unittest
+var awsCompliance = aws.Compliance
+
+func awsComplianceCmdRunE(c *cobra.Command, args []string) (err error) {
+	spec, err := awsLoadSpec(c)
+	if err != nil {
+		return err
+	}
+	failOn, err := awsFailOn(c)
+	if err != nil {
+		return err
+	}
+	opts, err := awsScanOptions(c)
+	if err != nil {
+		return err
+	}
+
+	target := aws.Tags{RoleName: spec.RoleName}
+	if target.Account, err = c.Flags().GetString("account"); err != nil {
+		return err
+	}
+	if target.Account == "" && len(spec.FilterInput) > 0 {
+		target.Account = spec.FilterInput[0].Account
+	}
+	if target.Region, err = c.Flags().GetString("region"); err != nil {
+		return err
+	}
+	filters := aws.ComplianceFiltersFromSpec(spec)
+	if filters.TagKeys, err = c.Flags().GetStringSlice("tag-key"); err != nil {
+		return err
+	}
+	bucket, err := c.Flags().GetString("report-bucket")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, err := awsContext(c)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	report, err := awsCompliance(ctx, target, filters, bucket, opts)
+	printCompliance(c.OutOrStdout(), report)
+	if err != nil {
+		return err
+	}
+	return checkFailOn(failOn, report.Targets)
+}
+
+// printCompliance writes the report job, the compliance summaries and the status of the target
+func printCompliance(out io.Writer, report aws.ComplianceReport) {
+	if job := report.Job; job != nil {
+		fmt.Fprintf(out, "Report %s %s\n\n", job.Status, job.S3Location)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tTYPE\tREGION\tRESOURCE TYPE\tNONCOMPLIANT\tLAST UPDATED")
+	for _, s := range report.Summaries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", s.TargetID, s.TargetIDType, s.Region, s.ResourceType, s.NonCompliantResources, s.LastUpdated)
+	}
+	w.Flush()
+
+	fmt.Fprintln(out)
+	printTargets(out, report.Targets)
+}
+
+func initAwsComplianceFlags(c *cobra.Command) {
+	c.Flags().String("account", "", "the organization management account (default the first account of the configuration)")
+	c.Flags().String("region", aws.ComplianceRegion, "the region serving the organization compliance")
+	c.Flags().StringSlice("tag-key", nil, "only count the resources noncompliant for these tag policy keys")
+	c.Flags().String("report-bucket", "", "start a compliance report job writing to this S3 bucket and wait for it")
+}
+
+func init() {
+	awsCmd.AddCommand(awsComplianceCmd)
+	initAwsComplianceFlags(awsComplianceCmd)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"tagu/aws"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsComplianceCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+
+	var target aws.Tags
+	var filters aws.ComplianceFilters
+	awsCompliance = func(ctx context.Context, t aws.Tags, f aws.ComplianceFilters, bucket string, opts aws.ScanOptions) (aws.ComplianceReport, error) {
+		target, filters = t, f
+		report := aws.ComplianceReport{
+			Summaries: []aws.ComplianceSummary{
+				{TargetID: "123456789012", TargetIDType: "ACCOUNT", Region: "us-east-1", ResourceType: "ec2:instance", NonCompliantResources: 3, LastUpdated: "2022-06-01"},
+			},
+			Targets: []aws.TargetReport{
+				{Account: t.Account, Region: "us-east-1", Status: aws.StatusOK, Count: 1},
+			},
+		}
+		if bucket != "" {
+			report.Job = &aws.ReportJob{Status: "SUCCEEDED", S3Location: "s3://" + bucket + "/report.csv"}
+		}
+		return report, nil
+	}
+	defer func() { awsCompliance = aws.Compliance }()
+
+	summary := "TARGET        TYPE     REGION     RESOURCE TYPE  NONCOMPLIANT  LAST UPDATED\n123456789012  ACCOUNT  us-east-1  ec2:instance   3             2022-06-01\n\n"
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+		account  string
+		tagKeys  []string
+	}{
+		{
+			name:     "Test AWS compliance from the first account",
+			args:     []string{"compliance", "-i", absConfig + "/examples/aws-tags.yaml"},
+			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml\n" + summary + "ACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n236534879095  us-east-1  ok             1     0",
+			account:  "236534879095",
+			tagKeys:  []string{},
+		},
+		{
+			name:     "Test AWS compliance with a report job",
+			args:     []string{"compliance", "-i", absConfig + "/examples/aws-tags.yaml", "--account", "999999999999", "--tag-key", "env,team", "--report-bucket", "reports"},
+			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml\nReport SUCCEEDED s3://reports/report.csv\n\n" + summary + "ACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n999999999999  us-east-1  ok             1     0",
+			account:  "999999999999",
+			tagKeys:  []string{"env", "team"},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			aws := &cobra.Command{Use: "aws"}
+			initAwsFlags(aws)
+			compliance := &cobra.Command{Use: "compliance", RunE: awsComplianceCmdRunE}
+			initAwsComplianceFlags(compliance)
+			aws.AddCommand(compliance)
+
+			defer viper.Reset()
+			res, err := execute(t, aws, fixture.args...)
+			assert.NoError(err)
+			assert.Equal(fixture.expected, res)
+			assert.Equal(fixture.account, target.Account)
+			assert.Equal("us-east-1", target.Region)
+			assert.Equal(fixture.tagKeys, filters.TagKeys)
+		})
+	}
+}
+
+func TestPrintReportComplianceSuite(t *testing.T) {
+	assert := assert.New(t)
+	out := new(bytes.Buffer)
+	printReport(out, aws.Report{Results: []aws.RessourceTagResult{
+		{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "Prod", Compliant: awssdk.Bool(false), NoncompliantKeys: []string{"team"}, KeysWithNoncompliantValues: []string{"env"}},
+	}})
+	assert.Equal("ACCOUNT       REGION     SERVICE  RESOURCE      KEY  VALUE  COMPLIANT  NONCOMPLIANT KEYS\n123456789012  us-east-1  ec2      instance/i-1  env  Prod   false      team,env\n\nACCOUNT  REGION  STATUS  CAUSE  TAGS  THROTTLES\n", out.String())
+}
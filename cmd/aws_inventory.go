@@ -0,0 +1,128 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"tagu/aws"
+	"tagu/models"
+
+	"github.com/spf13/cobra"
+)
+
+// awsKeysCmd represents the aws keys command
+var awsKeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "List the distinct tag keys of the spec accounts and regions",
+	Args:  cobra.NoArgs,
+	RunE:  awsKeysCmdRunE,
+}
+
+// awsValuesCmd represents the aws values command
+var awsValuesCmd = &cobra.Command{
+	Use:   "values",
+	Short: "List the distinct values of a tag key in the spec accounts and regions",
+	Args:  cobra.NoArgs,
+	RunE:  awsValuesCmdRunE,
+}
+
+// awsTagKeys and awsTagValues are the inventory entrypoints, replaced in the unittest
+var (
+	awsTagKeys   = aws.TagKeys
+	awsTagValues = aws.TagValues
+)
+
+func awsKeysCmdRunE(c *cobra.Command, args []string) (err error) {
+	return awsInventoryRunE(c, "KEY", func(ctx context.Context, spec models.Spec, opts aws.ScanOptions) (aws.Inventory, error) {
+		return awsTagKeys(ctx, spec, opts)
+	})
+}
+
+func awsValuesCmdRunE(c *cobra.Command, args []string) (err error) {
+	key, err := c.Flags().GetString("key")
+	if err != nil {
+		return err
+	}
+	return awsInventoryRunE(c, "VALUE", func(ctx context.Context, spec models.Spec, opts aws.ScanOptions) (aws.Inventory, error) {
+		return awsTagValues(ctx, spec, key, opts)
+	})
+}
+
+// awsInventoryRunE loads the spec, lists the keys or values and prints them
+func awsInventoryRunE(c *cobra.Command, header string, list func(context.Context, models.Spec, aws.ScanOptions) (aws.Inventory, error)) error {
+	spec, err := awsLoadSpec(c)
+	if err != nil {
+		return err
+	}
+	failOn, err := awsFailOn(c)
+	if err != nil {
+		return err
+	}
+	opts, err := awsScanOptions(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel, err := awsContext(c)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	inventory, err := list(ctx, spec, opts)
+	printInventory(c.OutOrStdout(), header, inventory)
+	if err != nil {
+		return err
+	}
+	return checkFailOn(failOn, inventory.Targets)
+}
+
+// printInventory writes the keys or values with the accounts and regions using them
+func printInventory(out io.Writer, header string, inventory aws.Inventory) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tACCOUNTS\tREGIONS\tLOCATIONS\n", header)
+	for _, item := range inventory.Items {
+		var locations []string
+		for _, l := range item.Locations {
+			locations = append(locations, l.Account+"/"+l.Region)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", item.Name, len(item.Accounts()), len(item.Regions()), strings.Join(locations, ","))
+	}
+	w.Flush()
+
+	fmt.Fprintln(out)
+	printTargets(out, inventory.Targets)
+}
+
+func initAwsValuesFlags(c *cobra.Command) {
+	c.Flags().StringP("key", "k", "", "the tag key to list the values of")
+	_ = c.MarkFlagRequired("key")
+}
+
+func init() {
+	awsCmd.AddCommand(awsKeysCmd, awsValuesCmd)
+	initAwsValuesFlags(awsValuesCmd)
+}
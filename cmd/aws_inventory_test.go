@@ -0,0 +1,117 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tagu/aws"
+	"tagu/models"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockAwsInventory(spec models.Spec) aws.Inventory {
+	return aws.Inventory{
+		Items: []aws.InventoryItem{
+			{Name: "env", Locations: []aws.Location{{Account: "123456789012", Region: "eu-west-1"}, {Account: "123456789012", Region: "us-east-1"}}},
+			{Name: "team", Locations: []aws.Location{{Account: "123456789012", Region: "us-east-1"}}},
+		},
+		Targets: []aws.TargetReport{
+			{Account: "123456789012", Region: "us-east-1", Status: aws.StatusOK, Count: 2},
+		},
+	}
+}
+
+func TestAwsInventoryCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+
+	var valuesKey string
+	awsTagKeys = func(ctx context.Context, spec models.Spec, opts aws.ScanOptions) (aws.Inventory, error) {
+		return mockAwsInventory(spec), nil
+	}
+	awsTagValues = func(ctx context.Context, spec models.Spec, key string, opts aws.ScanOptions) (aws.Inventory, error) {
+		valuesKey = key
+		return mockAwsInventory(spec), nil
+	}
+	defer func() {
+		awsTagKeys = aws.TagKeys
+		awsTagValues = aws.TagValues
+	}()
+
+	targets := "ACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n123456789012  us-east-1  ok             2     0"
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+		key      string
+		err      error
+	}{
+		{
+			name:     "Test AWS keys",
+			args:     []string{"keys", "-i", absConfig + "/examples/aws-tags.yaml"},
+			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml\nKEY   ACCOUNTS  REGIONS  LOCATIONS\nenv   1         2        123456789012/eu-west-1,123456789012/us-east-1\nteam  1         1        123456789012/us-east-1\n\n" + targets,
+		},
+		{
+			name:     "Test AWS values",
+			args:     []string{"values", "-i", absConfig + "/examples/aws-tags.yaml", "--key", "env"},
+			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml\nVALUE  ACCOUNTS  REGIONS  LOCATIONS\nenv    1         2        123456789012/eu-west-1,123456789012/us-east-1\nteam   1         1        123456789012/us-east-1\n\n" + targets,
+			key:      "env",
+		},
+		{
+			name:     "Test AWS values without key",
+			args:     []string{"values", "-i", absConfig + "/examples/aws-tags.yaml"},
+			expected: "Error: required flag(s) \"key\" not set",
+			err:      errors.New("required flag(s) \"key\" not set"),
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			aws := &cobra.Command{Use: "aws"}
+			initAwsFlags(aws)
+			keys := &cobra.Command{Use: "keys", RunE: awsKeysCmdRunE}
+			values := &cobra.Command{Use: "values", RunE: awsValuesCmdRunE}
+			initAwsValuesFlags(values)
+			aws.AddCommand(keys, values)
+
+			valuesKey = ""
+			defer viper.Reset()
+			res, err := execute(t, aws, fixture.args...)
+			if fixture.err != nil {
+				assert.True(strings.HasPrefix(res, fixture.expected), res)
+			} else {
+				assert.Equal(fixture.expected, res)
+			}
+			assert.Equal(fixture.err, err)
+			assert.Equal(fixture.key, valuesKey)
+		})
+	}
+}
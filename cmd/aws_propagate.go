@@ -0,0 +1,250 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"tagu/aws"
+	"tagu/models"
+	"tagu/propagation"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// awsPropagateCmd represents the aws propagate command
+var awsPropagateCmd = &cobra.Command{
+	Use:   "propagate",
+	Short: "Copy the tags of parent resources to their children",
+	Long: `Scan the tags then apply the propagation rules of --rules to compute the tags the
+children inherit from their parents:
+
+  rules:
+    - source: elasticloadbalancing:loadbalancer
+      target: elasticloadbalancing:listener
+      relationship: arn
+      keys: [owner, cost-center]
+    - source: ec2:instance
+      target: ec2:volume
+      relationship: tag
+      via-key: instance-id
+      overwrite: always
+    - source: ec2:instance
+      target: ec2:network-interface
+      relationship: ec2
+
+The arn relationship finds the parent from the ARN of the well-known children, the
+listeners and listener rules of a load balancer, the services and tasks of an ECS
+cluster and the node groups, add-ons and Fargate profiles of an EKS cluster. The tag
+relationship reads the parent id or ARN from the via-key tag of the child. The ec2
+relationship describes the EC2 resources of the scanned regions, the instance a
+volume or a network interface is attached to, the requester of a network interface
+and the volume of a snapshot.
+
+The plan is printed and written to --plan-file, --apply writes it and records every
+write in the journal file. The tags of --apply are always scanned again instead of
+read from the results cache, and --timeout bounds the scan and the writes together.`,
+	Args: cobra.NoArgs,
+	RunE: awsPropagateCmdRunE,
+}
+
+// awsApplyTags is the write entrypoint, replaced in the unittest
+var awsApplyTags = aws.ApplyTags
+
+// awsEC2Relations is the EC2 describe entrypoint, replaced in the unittest
+var awsEC2Relations = aws.EC2Relations
+
+func awsPropagateCmdRunE(c *cobra.Command, args []string) (err error) {
+	spec, err := awsLoadSpec(c)
+	if err != nil {
+		return err
+	}
+	failOn, err := awsFailOn(c)
+	if err != nil {
+		return err
+	}
+	rulesFile, err := c.Flags().GetString("rules")
+	if err != nil {
+		return err
+	}
+	rules, err := loadPropagation(rulesFile)
+	if err != nil {
+		return err
+	}
+	planFile, err := c.Flags().GetString("plan-file")
+	if err != nil {
+		return err
+	}
+	apply, err := c.Flags().GetBool("apply")
+	if err != nil {
+		return err
+	}
+
+	scanner, err := awsOpenScanner(c)
+	if err != nil {
+		return err
+	}
+	defer scanner.Close()
+	// The plan written by --apply must not be computed from cached tags
+	scanner.opts.RefreshCache = scanner.opts.RefreshCache || apply
+
+	// A single context so --timeout bounds the scan, the describe and the writes
+	ctx, cancel, err := awsContext(c)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	report, err := scanner.scan(ctx, spec)
+	if err != nil {
+		printTargets(c.OutOrStdout(), report.Targets)
+		return err
+	}
+	relations, targets, err := awsDescribeRelations(ctx, spec, rules.Rules, scanner.opts)
+	report.Targets = append(report.Targets, targets...)
+	if err != nil {
+		printTargets(c.OutOrStdout(), report.Targets)
+		return err
+	}
+	plan, err := propagation.Compute(report.Results, rules.Rules, relations)
+	if err != nil {
+		return err
+	}
+	printPlan(c.OutOrStdout(), plan)
+	if planFile != "" {
+		if err = writePlan(planFile, plan); err != nil {
+			return err
+		}
+	}
+	if !apply {
+		fmt.Fprintln(c.OutOrStdout())
+		printTargets(c.OutOrStdout(), report.Targets)
+		return checkFailOn(failOn, report.Targets)
+	}
+
+	scanOpts, err := awsScanOptions(c)
+	if err != nil {
+		return err
+	}
+	opts := aws.WriteOptions{ScanOptions: scanOpts, RoleName: spec.RoleName}
+	journal, err := c.Flags().GetString("journal")
+	if err != nil {
+		return err
+	}
+	if journal != "" {
+		if opts.Journal, err = aws.OpenJournal(journal); err != nil {
+			return err
+		}
+		defer opts.Journal.Close()
+	}
+
+	changes, targets, err := awsApplyTags(ctx, plan.Writes, opts)
+	fmt.Fprintln(c.OutOrStdout())
+	printChanges(c.OutOrStdout(), changes)
+	fmt.Fprintln(c.OutOrStdout())
+	printTargets(c.OutOrStdout(), append(report.Targets, targets...))
+	if err != nil {
+		return err
+	}
+	if err = checkChanges(changes); err != nil {
+		return err
+	}
+	return checkFailOn(failOn, append(report.Targets, targets...))
+}
+
+// awsDescribeRelations describes the EC2 relations of the spec targets when a rule
+// uses the ec2 relationship
+func awsDescribeRelations(ctx context.Context, spec models.Spec, rules []models.PropagationRule, opts aws.ScanOptions) ([]aws.Relation, aws.TargetReports, error) {
+	used := false
+	for _, rule := range rules {
+		used = used || rule.Relationship == "ec2"
+	}
+	if !used {
+		return nil, nil, nil
+	}
+	return awsEC2Relations(ctx, aws.Targets(spec), opts)
+}
+
+// loadPropagation reads and validates a YAML propagation rules file
+func loadPropagation(path string) (spec models.PropagationSpec, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return spec, err
+	}
+	if err = yaml.Unmarshal(data, &spec); err != nil {
+		return spec, fmt.Errorf("invalid rules file %s: %w", path, err)
+	}
+	if err = propagation.Validate(spec.Rules); err != nil {
+		return spec, fmt.Errorf("invalid rules file %s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// writePlan writes the plan as indented JSON
+func writePlan(path string, plan propagation.Plan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// printPlan writes a line per inherited tag followed by the skipped keys
+func printPlan(out io.Writer, plan propagation.Plan) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ARN\tKEY\tFROM\tTO\tSOURCE")
+	for _, change := range plan.Changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", change.Target, change.Key, awssdk.ToString(change.Previous), change.Value, change.Source)
+	}
+	w.Flush()
+
+	if len(plan.Skipped) > 0 {
+		fmt.Fprintln(out)
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ARN\tKEY\tSKIPPED")
+		for _, skip := range plan.Skipped {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", skip.Target, skip.Key, skip.Reason)
+		}
+		w.Flush()
+	}
+}
+
+func initAwsPropagateFlags(c *cobra.Command) {
+	c.Flags().String("rules", "", "the YAML file of the propagation rules")
+	c.Flags().String("plan-file", "", "write the plan as JSON to this file")
+	c.Flags().Bool("apply", false, "write the inherited tags of the plan")
+	c.Flags().String("journal", "tagu-journal.jsonl", "append every tag write to this file")
+	_ = c.MarkFlagRequired("rules")
+	initAwsScanFlags(c)
+}
+
+func init() {
+	awsCmd.AddCommand(awsPropagateCmd)
+	initAwsPropagateFlags(awsPropagateCmd)
+}
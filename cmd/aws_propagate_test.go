@@ -0,0 +1,164 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tagu/aws"
+	"tagu/models"
+	"tagu/propagation"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsPropagateCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	dir := t.TempDir()
+	rulesFile := filepath.Join(dir, "rules.yaml")
+	assert.NoError(os.WriteFile(rulesFile, []byte("rules:\n  - source: ecs:cluster\n    target: ecs:service\n    relationship: arn\n    keys: [team]\n"), 0o644))
+	invalidFile := filepath.Join(dir, "invalid.yaml")
+	assert.NoError(os.WriteFile(invalidFile, []byte("rules:\n  - source: ecs:cluster\n    target: ecs:service\n    relationship: parent\n"), 0o644))
+	ec2File := filepath.Join(dir, "ec2.yaml")
+	assert.NoError(os.WriteFile(ec2File, []byte("rules:\n  - source: ec2:instance\n    target: ec2:volume\n    relationship: ec2\n"), 0o644))
+	planFile := filepath.Join(dir, "plan.json")
+
+	var refreshed bool
+	var scanDeadline time.Time
+	awsScan = func(ctx context.Context, spec models.Spec, opts aws.ScanOptions) (aws.Report, error) {
+		refreshed = opts.RefreshCache
+		scanDeadline, _ = ctx.Deadline()
+		return aws.Report{
+			Results: []aws.RessourceTagResult{
+				{Account: "123456789012", Region: "us-east-1", Service: "ecs", Resource: "cluster/prod", Key: "team", Value: "web"},
+				{Account: "123456789012", Region: "us-east-1", Service: "ecs", Resource: "service/prod/api", Key: "env", Value: "prod"},
+				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "owner", Value: "alice"},
+				{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "volume/vol-1"},
+			},
+			Targets: []aws.TargetReport{{Account: "123456789012", Region: "us-east-1", Status: aws.StatusOK, Count: 2}},
+		}, nil
+	}
+	var writes []aws.TagWrite
+	var applyDeadline time.Time
+	awsApplyTags = func(ctx context.Context, w []aws.TagWrite, opts aws.WriteOptions) ([]aws.ResourceChange, aws.TargetReports, error) {
+		writes = w
+		applyDeadline, _ = ctx.Deadline()
+		return []aws.ResourceChange{{ARN: w[0].ARN, Changes: w[0].Tags, Status: aws.ChangeApplied}},
+			aws.TargetReports{{Account: "123456789012", Region: "us-east-1", Status: aws.StatusOK, Count: 1}}, nil
+	}
+	var described []aws.Tags
+	awsEC2Relations = func(ctx context.Context, targets []aws.Tags, opts aws.ScanOptions) ([]aws.Relation, aws.TargetReports, error) {
+		described = targets
+		return []aws.Relation{{Region: "us-east-1", ID: "vol-1", Related: "i-1"}},
+			aws.TargetReports{{Account: "123456789012", Region: "us-east-1", Status: aws.StatusOK, Count: 1}}, nil
+	}
+	defer func() {
+		awsScan = aws.Scan
+		awsApplyTags = aws.ApplyTags
+		awsEC2Relations = aws.EC2Relations
+	}()
+
+	plan := "ARN                                                  KEY   FROM  TO   SOURCE\narn:aws:ecs:us-east-1:123456789012:service/prod/api  team        web  arn:aws:ecs:us-east-1:123456789012:cluster/prod\n"
+
+	fixtures := []struct {
+		name      string
+		args      []string
+		applied   bool
+		described bool
+		expected  string
+		err       string
+	}{
+		{
+			name:     "Test AWS propagate plan",
+			args:     []string{"--rules", rulesFile, "--plan-file", planFile},
+			expected: plan + "\nACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n123456789012  us-east-1  ok             2     0",
+		},
+		{
+			name:     "Test AWS propagate apply",
+			args:     []string{"--rules", rulesFile, "--apply", "--journal", filepath.Join(dir, "journal.jsonl"), "--timeout", "1h"},
+			applied:  true,
+			expected: plan + "\nARN                                                  ACTION  KEY   FROM  TO   STATUS\narn:aws:ecs:us-east-1:123456789012:service/prod/api  tag     team        web  applied\n",
+		},
+		{
+			name:      "Test AWS propagate EC2 relations",
+			args:      []string{"--rules", ec2File},
+			described: true,
+			expected:  "ARN                                              KEY    FROM  TO     SOURCE\narn:aws:ec2:us-east-1:123456789012:volume/vol-1  owner        alice  arn:aws:ec2:us-east-1:123456789012:instance/i-1\n",
+		},
+		{
+			name: "Test AWS propagate invalid rules",
+			args: []string{"--rules", invalidFile},
+			err:  "invalid rules file " + invalidFile + `: rule 0: unknown relationship "parent"`,
+		},
+		{
+			name: "Test AWS propagate without rules",
+			args: []string{},
+			err:  `required flag(s) "rules" not set`,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			writes, described, refreshed = nil, nil, false
+			aws := &cobra.Command{Use: "aws", SilenceUsage: true}
+			initAwsFlags(aws)
+			propagate := &cobra.Command{Use: "propagate", RunE: awsPropagateCmdRunE}
+			initAwsPropagateFlags(propagate)
+			aws.AddCommand(propagate)
+
+			defer viper.Reset()
+			args := append([]string{"propagate", "-i", absConfig + "/examples/aws-tags.yaml", "--no-cache"}, fixture.args...)
+			res, err := execute(t, aws, args...)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			res = strings.TrimPrefix(res, "Load configuration file "+absConfig+"/examples/aws-tags.yaml\n")
+			assert.True(strings.HasPrefix(res, fixture.expected), res)
+			assert.Equal(fixture.applied, writes != nil)
+			assert.Equal(fixture.described, described != nil)
+			// --apply rescans the tags and shares the --timeout deadline with the scan
+			assert.Equal(fixture.applied, refreshed)
+			if fixture.applied {
+				assert.False(scanDeadline.IsZero())
+				assert.Equal(scanDeadline, applyDeadline)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(planFile)
+	assert.NoError(err)
+	var written propagation.Plan
+	assert.NoError(json.Unmarshal(data, &written))
+	assert.Len(written.Writes, 1)
+	assert.Equal("123456789012", written.Writes[0].Account)
+}
@@ -0,0 +1,221 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"tagu/aws"
+	"tagu/models"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// awsRenameCmd represents the aws rename command
+var awsRenameCmd = &cobra.Command{
+	Use:   "rename",
+	Short: "Rename tag keys and values on the resources of the spec",
+	Long: `Rename a tag key with --from-key and --to-key, or the keys and values of a mapping file
+such as the one written by "tagu aws variants --mapping-file":
+
+  keys:
+    Env: env
+  values:
+    env:
+      PROD: prod
+
+The resources using the renamed keys and values are found in every account and region
+of the spec, the new tags are written then the old keys removed. Use --dry-run to print
+the planned writes. Every write is recorded in the journal file.`,
+	Args: cobra.NoArgs,
+	RunE: awsRenameCmdRunE,
+}
+
+// awsRename is the rename entrypoint, replaced in the unittest
+var awsRename = aws.Rename
+
+func awsRenameCmdRunE(c *cobra.Command, args []string) (err error) {
+	spec, err := awsLoadSpec(c)
+	if err != nil {
+		return err
+	}
+	failOn, err := awsFailOn(c)
+	if err != nil {
+		return err
+	}
+	mapping, err := awsRenameMapping(c)
+	if err != nil {
+		return err
+	}
+	scanOpts, err := awsScanOptions(c)
+	if err != nil {
+		return err
+	}
+	opts := aws.RenameOptions{ScanOptions: scanOpts}
+	if opts.DryRun, err = c.Flags().GetBool("dry-run"); err != nil {
+		return err
+	}
+	journal, err := c.Flags().GetString("journal")
+	if err != nil {
+		return err
+	}
+	// A dry-run only writes the journal when asked to
+	if journal != "" && (!opts.DryRun || c.Flags().Changed("journal")) {
+		if opts.Journal, err = aws.OpenJournal(journal); err != nil {
+			return err
+		}
+		defer opts.Journal.Close()
+	}
+
+	ctx, cancel, err := awsContext(c)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	report, err := awsRename(ctx, spec, mapping, opts)
+	printRename(c.OutOrStdout(), report)
+	if err != nil {
+		return err
+	}
+	if err = checkChanges(report.Changes); err != nil {
+		return err
+	}
+	return checkFailOn(failOn, report.Targets)
+}
+
+// checkChanges returns an error when a tag write failed
+func checkChanges(changes []aws.ResourceChange) error {
+	failed := 0
+	for _, change := range changes {
+		if change.Status == aws.ChangeFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tag writes failed", failed, len(changes))
+	}
+	return nil
+}
+
+// awsRenameMapping builds the mapping from the mapping file and the from-key and to-key flags
+func awsRenameMapping(c *cobra.Command) (mapping models.Mapping, err error) {
+	mappingFile, err := c.Flags().GetString("mapping-file")
+	if err != nil {
+		return mapping, err
+	}
+	if mappingFile != "" {
+		if mapping, err = loadMapping(mappingFile); err != nil {
+			return mapping, err
+		}
+	}
+	fromKey, err := c.Flags().GetString("from-key")
+	if err != nil {
+		return mapping, err
+	}
+	toKey, err := c.Flags().GetString("to-key")
+	if err != nil {
+		return mapping, err
+	}
+	if (fromKey == "") != (toKey == "") {
+		return mapping, errors.New("--from-key and --to-key must be set together")
+	}
+	if fromKey != "" {
+		if mapping.Keys == nil {
+			mapping.Keys = map[string]string{}
+		}
+		mapping.Keys[fromKey] = toKey
+	}
+	if len(mapping.Keys) == 0 && len(mapping.Values) == 0 {
+		return mapping, errors.New("nothing to rename, set --from-key and --to-key or --mapping-file")
+	}
+	return mapping, nil
+}
+
+// loadMapping reads a YAML remediation mapping
+func loadMapping(path string) (mapping models.Mapping, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return mapping, err
+	}
+	if err = yaml.Unmarshal(data, &mapping); err != nil {
+		return mapping, fmt.Errorf("invalid mapping file %s: %w", path, err)
+	}
+	return mapping, nil
+}
+
+// printRename writes every tag write, the conflicts and the status of each target
+func printRename(out io.Writer, report aws.RenameReport) {
+	printChanges(out, report.Changes)
+
+	if len(report.Conflicts) > 0 {
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ARN\tKEY\tVALUE\tCONFLICT")
+		for _, c := range report.Conflicts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s=%s already set\n", c.ARN, c.Key, c.Value, c.NewKey, c.Existing)
+		}
+		w.Flush()
+	}
+
+	fmt.Fprintln(out)
+	printTargets(out, report.Targets)
+}
+
+// printChanges writes a line per written or removed key
+func printChanges(out io.Writer, changes []aws.ResourceChange) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ARN\tACTION\tKEY\tFROM\tTO\tSTATUS")
+	for _, change := range changes {
+		for _, c := range change.Changes {
+			action := "tag"
+			if c.Value == nil {
+				action = "untag"
+			}
+			status := string(change.Status)
+			if change.Error != "" {
+				status += ": " + change.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", change.ARN, action, c.Key, awssdk.ToString(c.Previous), awssdk.ToString(c.Value), status)
+		}
+	}
+	w.Flush()
+}
+
+func initAwsRenameFlags(c *cobra.Command) {
+	c.Flags().String("from-key", "", "the tag key to rename")
+	c.Flags().String("to-key", "", "the new name of --from-key")
+	c.Flags().String("mapping-file", "", "the YAML file mapping the keys and values to rename")
+	c.Flags().Bool("dry-run", false, "print the planned writes without changing any tag")
+	c.Flags().String("journal", "tagu-journal.jsonl", "append every tag write to this file")
+}
+
+func init() {
+	awsCmd.AddCommand(awsRenameCmd)
+	initAwsRenameFlags(awsRenameCmd)
+}
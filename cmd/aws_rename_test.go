@@ -0,0 +1,128 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tagu/aws"
+	"tagu/models"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsRenameCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	dir := t.TempDir()
+	mappingFile := filepath.Join(dir, "mapping.yaml")
+	assert.NoError(os.WriteFile(mappingFile, []byte("keys:\n  environment: env\nvalues:\n  env:\n    PROD: prod\n"), 0o644))
+
+	var mapping models.Mapping
+	var opts aws.RenameOptions
+	awsRename = func(ctx context.Context, spec models.Spec, m models.Mapping, o aws.RenameOptions) (aws.RenameReport, error) {
+		mapping, opts = m, o
+		status := aws.ChangeApplied
+		if o.DryRun {
+			status = aws.ChangePlanned
+		}
+		return aws.RenameReport{
+			Changes: []aws.ResourceChange{
+				{ARN: "arn:1", Changes: []aws.TagChange{{Key: "env", Value: awssdk.String("prod")}}, Status: status},
+				{ARN: "arn:1", Changes: []aws.TagChange{{Key: "Env", Previous: awssdk.String("PROD")}}, Status: status},
+			},
+			Conflicts: []aws.RenameConflict{{ARN: "arn:2", Key: "Env", Value: "dev", NewKey: "env", Existing: "prod"}},
+			Targets:   []aws.TargetReport{{Account: "123456789012", Region: "us-east-1", Status: aws.StatusOK, Count: 2}},
+		}, nil
+	}
+	defer func() { awsRename = aws.Rename }()
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		mapping  models.Mapping
+		dryRun   bool
+		journal  bool
+		expected string
+		err      error
+	}{
+		{
+			name:    "Test AWS rename dry-run",
+			args:    []string{"--from-key", "Env", "--to-key", "env", "--dry-run"},
+			mapping: models.Mapping{Keys: map[string]string{"Env": "env"}},
+			dryRun:  true,
+			expected: "ARN    ACTION  KEY  FROM  TO    STATUS\narn:1  tag     env        prod  planned\narn:1  untag   Env  PROD        planned\n\n" +
+				"ARN    KEY  VALUE  CONFLICT\narn:2  Env  dev    env=prod already set",
+		},
+		{
+			name:    "Test AWS rename mapping file and journal",
+			args:    []string{"--mapping-file", mappingFile, "--from-key", "Env", "--to-key", "env", "--journal", filepath.Join(dir, "journal.jsonl")},
+			mapping: models.Mapping{Keys: map[string]string{"environment": "env", "Env": "env"}, Values: map[string]map[string]string{"env": {"PROD": "prod"}}},
+			journal: true,
+			expected: "ARN    ACTION  KEY  FROM  TO    STATUS\narn:1  tag     env        prod  applied\narn:1  untag   Env  PROD        applied\n\n" +
+				"ARN    KEY  VALUE  CONFLICT\narn:2  Env  dev    env=prod already set",
+		},
+		{
+			name: "Test AWS rename without mapping",
+			args: []string{},
+			err:  errors.New("nothing to rename, set --from-key and --to-key or --mapping-file"),
+		},
+		{
+			name: "Test AWS rename without to-key",
+			args: []string{"--from-key", "Env"},
+			err:  errors.New("--from-key and --to-key must be set together"),
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			mapping, opts = models.Mapping{}, aws.RenameOptions{}
+			aws := &cobra.Command{Use: "aws", SilenceUsage: true}
+			initAwsFlags(aws)
+			rename := &cobra.Command{Use: "rename", RunE: awsRenameCmdRunE}
+			initAwsRenameFlags(rename)
+			aws.AddCommand(rename)
+
+			defer viper.Reset()
+			args := append([]string{"rename", "-i", absConfig + "/examples/aws-tags.yaml"}, fixture.args...)
+			res, err := execute(t, aws, args...)
+			assert.Equal(fixture.err, err)
+			if fixture.err != nil {
+				return
+			}
+			assert.True(strings.Contains(res, fixture.expected), res)
+			assert.Equal(fixture.mapping, mapping)
+			assert.Equal(fixture.dryRun, opts.DryRun)
+			assert.Equal(fixture.journal, opts.Journal != nil)
+		})
+	}
+	_, err := os.Stat(filepath.Join(dir, "journal.jsonl"))
+	assert.NoError(err)
+}
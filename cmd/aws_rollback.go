@@ -0,0 +1,137 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"tagu/aws"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+)
+
+// awsRollbackCmd represents the aws rollback command
+var awsRollbackCmd = &cobra.Command{
+	Use:   "rollback <journal>",
+	Short: "Restore the tags changed by the writes recorded in a journal",
+	Long: `Restore the tags of every resource written by tagu to their value before the applied
+changes recorded in the journal, the accounts, regions and roles are read from the journal.
+
+A resource whose tags were changed by someone else since is reported as drifted and left
+untouched unless --force is set. The rollback writes are recorded in their own journal.`,
+	Args: cobra.ExactArgs(1),
+	RunE: awsRollbackCmdRunE,
+}
+
+// awsRollback is the rollback entrypoint, replaced in the unittest
+var awsRollback = aws.Rollback
+
+func awsRollbackCmdRunE(c *cobra.Command, args []string) (err error) {
+	failOn, err := awsFailOn(c)
+	if err != nil {
+		return err
+	}
+	changes, err := aws.ReadJournal(args[0])
+	if err != nil {
+		return err
+	}
+	scanOpts, err := awsScanOptions(c)
+	if err != nil {
+		return err
+	}
+	opts := aws.RollbackOptions{ScanOptions: scanOpts}
+	if opts.DryRun, err = c.Flags().GetBool("dry-run"); err != nil {
+		return err
+	}
+	if opts.Force, err = c.Flags().GetBool("force"); err != nil {
+		return err
+	}
+	journal, err := c.Flags().GetString("journal")
+	if err != nil {
+		return err
+	}
+	if journal == "" {
+		journal = args[0] + ".rollback"
+	}
+	if !opts.DryRun || c.Flags().Changed("journal") {
+		if opts.Journal, err = aws.OpenJournal(journal); err != nil {
+			return err
+		}
+		defer opts.Journal.Close()
+	}
+
+	ctx, cancel, err := awsContext(c)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	report, err := awsRollback(ctx, changes, opts)
+	printRollback(c.OutOrStdout(), report)
+	if err != nil {
+		return err
+	}
+	if err = checkChanges(report.Changes); err != nil {
+		return err
+	}
+	return checkFailOn(failOn, report.Targets)
+}
+
+// printRollback writes the restoring writes, the drifted keys and the status of each target
+func printRollback(out io.Writer, report aws.RollbackReport) {
+	printChanges(out, report.Changes)
+
+	if len(report.Drifts) > 0 {
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ARN\tKEY\tEXPECTED\tACTUAL")
+		for _, d := range report.Drifts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.ARN, d.Key, optionalValue(d.Expected), optionalValue(d.Actual))
+		}
+		w.Flush()
+	}
+
+	fmt.Fprintln(out)
+	printTargets(out, report.Targets)
+}
+
+// optionalValue formats a value, nil being an absent key
+func optionalValue(value *string) string {
+	if value == nil {
+		return "(absent)"
+	}
+	return awssdk.ToString(value)
+}
+
+func initAwsRollbackFlags(c *cobra.Command) {
+	c.Flags().Bool("dry-run", false, "print the planned writes without changing any tag")
+	c.Flags().Bool("force", false, "also restore the resources changed by someone else since")
+	c.Flags().String("journal", "", "append every rollback write to this file (default <journal>.rollback)")
+}
+
+func init() {
+	awsCmd.AddCommand(awsRollbackCmd)
+	initAwsRollbackFlags(awsRollbackCmd)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tagu/aws"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsRollbackCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	journal := filepath.Join(dir, "journal.jsonl")
+	assert.NoError(os.WriteFile(journal, []byte(`{"account":"123456789012","region":"us-east-1","arn":"arn:1","changes":[{"key":"env","previous":"PROD","value":"prod"}],"status":"applied"}`+"\n"), 0o644))
+
+	var changes []aws.ResourceChange
+	var opts aws.RollbackOptions
+	awsRollback = func(ctx context.Context, c []aws.ResourceChange, o aws.RollbackOptions) (aws.RollbackReport, error) {
+		changes, opts = c, o
+		return aws.RollbackReport{
+			Changes: []aws.ResourceChange{
+				{ARN: "arn:1", Changes: []aws.TagChange{{Key: "env", Previous: awssdk.String("prod"), Value: awssdk.String("PROD")}}, Status: aws.ChangeApplied},
+			},
+			Drifts:  []aws.Drift{{ARN: "arn:2", Key: "team", Expected: awssdk.String("web")}},
+			Targets: []aws.TargetReport{{Account: "123456789012", Region: "us-east-1", Status: aws.StatusOK, Count: 1}},
+		}, nil
+	}
+	defer func() { awsRollback = aws.Rollback }()
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		dryRun   bool
+		force    bool
+		journal  bool
+		expected string
+		err      string
+	}{
+		{
+			name:    "Test AWS rollback",
+			args:    []string{"rollback", journal, "--force"},
+			force:   true,
+			journal: true,
+			expected: "ARN    ACTION  KEY  FROM  TO    STATUS\narn:1  tag     env  prod  PROD  applied\n\n" +
+				"ARN    KEY   EXPECTED  ACTUAL\narn:2  team  web       (absent)\n\n" +
+				"ACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n123456789012  us-east-1  ok             1     0",
+		},
+		{
+			name:     "Test AWS rollback dry-run",
+			args:     []string{"rollback", journal, "--dry-run"},
+			dryRun:   true,
+			expected: "ARN    ACTION  KEY  FROM  TO    STATUS\narn:1  tag     env  prod  PROD  applied",
+		},
+		{
+			name: "Test AWS rollback missing journal",
+			args: []string{"rollback", filepath.Join(dir, "missing.jsonl")},
+			err:  "no such file or directory",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			changes, opts = nil, aws.RollbackOptions{}
+			aws := &cobra.Command{Use: "aws", SilenceUsage: true}
+			initAwsFlags(aws)
+			rollback := &cobra.Command{Use: "rollback", Args: cobra.ExactArgs(1), RunE: awsRollbackCmdRunE}
+			initAwsRollbackFlags(rollback)
+			aws.AddCommand(rollback)
+
+			res, err := execute(t, aws, fixture.args...)
+			if fixture.err != "" {
+				assert.ErrorContains(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.True(strings.HasPrefix(res, fixture.expected), res)
+			assert.Len(changes, 1)
+			assert.Equal(fixture.dryRun, opts.DryRun)
+			assert.Equal(fixture.force, opts.Force)
+			assert.Equal(fixture.journal, opts.Journal != nil)
+		})
+	}
+
+	// The rollback writes are recorded next to the journal
+	_, err := os.Stat(journal + ".rollback")
+	assert.NoError(err)
+}
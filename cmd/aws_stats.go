@@ -0,0 +1,108 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"tagu/stats"
+
+	"github.com/spf13/cobra"
+)
+
+// awsStatsCmd represents the aws stats command
+var awsStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Compute the tag coverage per account, region, service and resource type",
+	Long: `Scan the tags then compute the share of the resources tagged with each key per account,
+region, service and resource type, the number of distinct values of each key and its
+most used values. A resource without any tag is counted as not covered by any key,
+AWS only returns the resources tagged at least once.`,
+	Args: cobra.NoArgs,
+	RunE: awsStatsCmdRunE,
+}
+
+func awsStatsCmdRunE(c *cobra.Command, args []string) (err error) {
+	spec, err := awsLoadSpec(c)
+	if err != nil {
+		return err
+	}
+	failOn, err := awsFailOn(c)
+	if err != nil {
+		return err
+	}
+	format, err := c.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	outputFile, err := c.Flags().GetString("output-file")
+	if err != nil {
+		return err
+	}
+	var opts stats.Options
+	if opts.Keys, err = c.Flags().GetStringSlice("keys"); err != nil {
+		return err
+	}
+	if opts.Top, err = c.Flags().GetInt("top"); err != nil {
+		return err
+	}
+	// Check the format before scanning
+	if err = stats.Write(io.Discard, format, stats.Report{}); err != nil {
+		return err
+	}
+
+	report, err := awsRunScan(c, spec)
+	// The status of the targets goes to stderr so the report can be piped
+	printTargets(c.ErrOrStderr(), report.Targets)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = c.OutOrStdout()
+	if outputFile != "" {
+		file, err := os.Create(outputFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	if err = stats.Write(out, format, stats.Compute(report.Results, opts)); err != nil {
+		return err
+	}
+	return checkFailOn(failOn, report.Targets)
+}
+
+func initAwsStatsFlags(c *cobra.Command) {
+	c.Flags().StringP("format", "f", "table", "the report format, "+strings.Join(stats.Formats, ", "))
+	c.Flags().StringP("output-file", "o", "", "write the report to this file instead of stdout")
+	c.Flags().StringSlice("keys", nil, "only report these keys, a missing key has a 0% coverage (default every collected key)")
+	c.Flags().Int("top", 5, "number of most used values reported per key (0 means every value)")
+	initAwsScanFlags(c)
+}
+
+func init() {
+	awsCmd.AddCommand(awsStatsCmd)
+	initAwsStatsFlags(awsStatsCmd)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tagu/aws"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsStatsCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	outputFile := filepath.Join(t.TempDir(), "report.html")
+
+	awsScan = mockAwsScan
+	defer func() { awsScan = aws.Scan }()
+
+	targets := "ACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n123456789012  us-east-1  ok             1     0\n"
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Test AWS stats table",
+			args:     []string{"stats", "-i", absConfig + "/examples/aws-tags.yaml", "--no-cache", "--keys", "env,team"},
+			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml\n" + targets + "KEY   RESOURCES  COVERAGE  CARDINALITY  TOP VALUES\nenv   1/1        100.0%    1            prod(1)\nteam  0/1        0.0%      0",
+		},
+		{
+			name:     "Test AWS stats HTML file",
+			args:     []string{"stats", "-i", absConfig + "/examples/aws-tags.yaml", "--no-cache", "-f", "html", "-o", outputFile},
+			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml\n" + strings.TrimSpace(targets),
+		},
+		{
+			name: "Test AWS stats invalid format",
+			args: []string{"stats", "-i", absConfig + "/examples/aws-tags.yaml", "-f", "xml"},
+			err:  `invalid format "xml", expected table, json, html`,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			aws := &cobra.Command{Use: "aws", SilenceUsage: true}
+			initAwsFlags(aws)
+			stats := &cobra.Command{Use: "stats", RunE: awsStatsCmdRunE}
+			initAwsStatsFlags(stats)
+			aws.AddCommand(stats)
+
+			defer viper.Reset()
+			res, err := execute(t, aws, fixture.args...)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.True(strings.HasPrefix(res, fixture.expected), res)
+		})
+	}
+
+	html, err := os.ReadFile(outputFile)
+	assert.NoError(err)
+	assert.Contains(string(html), "<td>env</td><td>1</td><td>100.0%</td>")
+}
@@ -23,26 +23,59 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"tagu/aws"
 	"tagu/models"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
+// mockAwsScan returns a single target report, it waits for the end of the
+// context when a global timeout is set
+func mockAwsScan(ctx context.Context, spec models.Spec, opts aws.ScanOptions) (aws.Report, error) {
+	report := aws.Report{
+		Results: []aws.RessourceTagResult{
+			{Account: "123456789012", Region: "us-east-1", Service: "ec2", Resource: "instance/i-12345678", Key: "env", Value: "prod"},
+		},
+		Targets: []aws.TargetReport{
+			{Account: "123456789012", Region: "us-east-1", Status: aws.StatusOK, Count: 1},
+		},
+	}
+	if _, ok := ctx.Deadline(); ok {
+		<-ctx.Done()
+		report.Targets[0].Status = aws.StatusTimeout
+		report.Targets[0].Err = ctx.Err()
+		return report, fmt.Errorf("scan stopped: %w", ctx.Err())
+	}
+	return report, nil
+}
+
 func TestAwsCmdSuite(t *testing.T) {
 	assert := assert.New(t)
 
 	// Get the current project
 	absConfig, _ := filepath.Abs("../")
 
+	awsScan = mockAwsScan
+	defer func() { awsScan = aws.Scan }()
+
 	aws := &cobra.Command{Use: "aws", RunE: awsCmdRunE}
 	initAwsFlags(aws)
+	aws.InitDefaultHelpFlag()
+	awsUsage := strings.TrimSpace(aws.UsageString())
+
+	report := "ACCOUNT       REGION     SERVICE  RESOURCE             KEY  VALUE\n123456789012  us-east-1  ec2      instance/i-12345678  env  prod\n\n"
 
 	fixtures := []struct {
 		name     string
@@ -54,14 +87,14 @@ func TestAwsCmdSuite(t *testing.T) {
 		{
 			name:     "Test AWS config no option specified",
 			args:     []string{},
-			expected: "Error: Config File \"config\" Not Found in \"[]\"\nUsage:\n  aws [flags]\n\nFlags:\n  -h, --help                help for aws\n  -i, --input-file string   the input file",
+			expected: "Error: Config File \"config\" Not Found in \"[]\"\n" + awsUsage,
 			err:      errors.New("Config File \"config\" Not Found in \"[]\""),
 		},
 		{
 			name:     "Test AWS config from AWS_CONFIG",
 			args:     []string{},
 			env:      absConfig + "/examples/input-tags.yaml",
-			expected: "Load configuration file " + absConfig + "/examples/input-tags.yaml",
+			expected: "Load configuration file " + absConfig + "/examples/input-tags.yaml\n" + report + "ACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n123456789012  us-east-1  ok             1     0",
 			err:      nil,
 		},
 		{
@@ -70,9 +103,20 @@ func TestAwsCmdSuite(t *testing.T) {
 				"-i",
 				absConfig + "/examples/aws-tags.yaml",
 			},
-			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml",
+			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml\n" + report + "ACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n123456789012  us-east-1  ok             1     0",
 			err:      nil,
 		},
+		{
+			name: "Test AWS scan global timeout",
+			args: []string{
+				"-i",
+				absConfig + "/examples/aws-tags.yaml",
+				"--timeout",
+				"1ms",
+			},
+			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml\n" + report + "ACCOUNT       REGION     STATUS   CAUSE  TAGS  THROTTLES\n123456789012  us-east-1  timeout         1     0\n\nACCOUNT       REGION     ERROR\n123456789012  us-east-1  context deadline exceeded\nError: scan stopped: context deadline exceeded\n" + awsUsage,
+			err:      fmt.Errorf("scan stopped: %w", context.DeadlineExceeded),
+		},
 	}
 
 	for _, fixture := range fixtures {
@@ -89,6 +133,353 @@ func TestAwsCmdSuite(t *testing.T) {
 	}
 }
 
+func TestAwsOutputSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	outputFile := filepath.Join(t.TempDir(), "tags.db")
+	csvFile := filepath.Join(t.TempDir(), "tags.csv")
+	xlsxFile := filepath.Join(t.TempDir(), "tags.xlsx")
+	lakeDir := filepath.Join(t.TempDir(), "lake")
+
+	awsScan = mockAwsScan
+	defer func() { awsScan = aws.Scan }()
+
+	targets := "ACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n123456789012  us-east-1  ok             1     0\n"
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Test AWS sqlite output",
+			args:     []string{"--output", "sqlite", "--output-file", outputFile},
+			expected: targets + "\nScan 1 written to " + outputFile,
+		},
+		{
+			name:     "Test AWS sqlite output appends the scans",
+			args:     []string{"--output", "sqlite", "--output-file", outputFile},
+			expected: targets + "\nScan 2 written to " + outputFile,
+		},
+		{
+			name: "Test AWS sqlite output without file",
+			args: []string{"--output", "sqlite"},
+			err:  "--output sqlite requires --output-file",
+		},
+		{
+			name: "Test AWS invalid output",
+			args: []string{"--output", "xml"},
+			err:  `invalid output "xml", expected table, csv, xlsx, sqlite, parquet`,
+		},
+		{
+			name:     "Test AWS pivot table",
+			args:     []string{"--columns", "owner,env"},
+			expected: "ACCOUNT       REGION     SERVICE  RESOURCE             owner  env\n123456789012  us-east-1  ec2      instance/i-12345678         prod\n\n" + strings.TrimSpace(targets),
+		},
+		{
+			name:     "Test AWS csv output",
+			args:     []string{"--output", "csv", "--pivot"},
+			expected: targets + "account,region,service,resource,env\n123456789012,us-east-1,ec2,instance/i-12345678,prod",
+		},
+		{
+			name:     "Test AWS csv output file",
+			args:     []string{"--output", "csv", "--output-file", csvFile},
+			expected: strings.TrimSpace(targets),
+		},
+		{
+			name:     "Test AWS xlsx output",
+			args:     []string{"--output", "xlsx", "--output-file", xlsxFile},
+			expected: targets + "\nReport written to " + xlsxFile,
+		},
+		{
+			name: "Test AWS xlsx output without file",
+			args: []string{"--output", "xlsx"},
+			err:  "--output xlsx requires --output-file",
+		},
+		{
+			name:     "Test AWS partitioned parquet output",
+			args:     []string{"--output", "parquet", "--output-file", lakeDir, "--partition"},
+			expected: targets + "\nResources written to " + filepath.Join(lakeDir, "account=123456789012", "region=us-east-1"),
+		},
+		{
+			name: "Test AWS partition without parquet",
+			args: []string{"--output", "csv", "--partition"},
+			err:  "--partition requires the parquet output",
+		},
+		{
+			name: "Test AWS table output file",
+			args: []string{"--output-file", csvFile},
+			err:  "--output-file is not supported by the table output",
+		},
+		{
+			name: "Test AWS sqlite pivot",
+			args: []string{"--output", "sqlite", "--output-file", outputFile, "--pivot"},
+			err:  "--pivot is not supported by the sqlite output",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			aws := &cobra.Command{Use: "aws", RunE: awsCmdRunE, SilenceUsage: true}
+			initAwsFlags(aws)
+
+			defer viper.Reset()
+			args := append([]string{"-i", absConfig + "/examples/aws-tags.yaml", "--no-cache"}, fixture.args...)
+			res, err := execute(t, aws, args...)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.True(strings.HasPrefix(res, "Load configuration file "+absConfig+"/examples/aws-tags.yaml\n"+fixture.expected), res)
+		})
+	}
+
+	data, err := os.ReadFile(csvFile)
+	assert.NoError(err)
+	assert.Equal("account,region,service,resource,key,value\n123456789012,us-east-1,ec2,instance/i-12345678,env,prod\n", string(data))
+}
+
+func TestAwsWhereSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+
+	awsScan = mockAwsScan
+	defer func() { awsScan = aws.Scan }()
+
+	header := "ACCOUNT       REGION     SERVICE  RESOURCE             KEY  VALUE\n"
+	targets := "\nACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n123456789012  us-east-1  ok             1     0"
+
+	fixtures := []struct {
+		name     string
+		where    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Test AWS where matching the resource",
+			where:    `service == "ec2" && tags.env =~ "^prod"`,
+			expected: header + "123456789012  us-east-1  ec2      instance/i-12345678  env  prod\n" + targets,
+		},
+		{
+			name:     "Test AWS where filtering the resource",
+			where:    `!has(tags.owner) && service != "ec2"`,
+			expected: "ACCOUNT  REGION  SERVICE  RESOURCE  KEY  VALUE\n" + targets,
+		},
+		{
+			name:  "Test AWS invalid where",
+			where: `tags.env`,
+			err:   "invalid --where: invalid expression at 0: expected a condition, use has() to test a tag",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			aws := &cobra.Command{Use: "aws", RunE: awsCmdRunE, SilenceUsage: true}
+			initAwsFlags(aws)
+
+			defer viper.Reset()
+			res, err := execute(t, aws, "-i", absConfig+"/examples/aws-tags.yaml", "--no-cache", "--where", fixture.where)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal("Load configuration file "+absConfig+"/examples/aws-tags.yaml\n"+fixture.expected, res)
+		})
+	}
+}
+
+func TestAwsOutputUntouchedSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "tags.csv")
+	assert.NoError(os.WriteFile(csvFile, []byte("previous scan\n"), 0o644))
+
+	awsScan = mockAwsScan
+	defer func() { awsScan = aws.Scan }()
+
+	fixtures := []struct {
+		name string
+		file string
+		args []string
+		err  string
+	}{
+		{
+			name: "Test AWS invalid where keeps the sqlite history",
+			file: filepath.Join(dir, "history.db"),
+			args: []string{"--output", "sqlite", "--where", "tags.env =="},
+			err:  "invalid --where: invalid expression at 11: expected a value, found the end of the expression",
+		},
+		{
+			name: "Test AWS missing state file keeps the csv file",
+			file: csvFile,
+			args: []string{"--output", "csv", "--resume", filepath.Join(dir, "nonexistent.jsonl")},
+			err:  "open " + filepath.Join(dir, "nonexistent.jsonl") + ": no such file or directory",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			before, _ := os.ReadFile(fixture.file)
+			aws := &cobra.Command{Use: "aws", RunE: awsCmdRunE, SilenceUsage: true}
+			initAwsFlags(aws)
+
+			defer viper.Reset()
+			args := append([]string{"-i", absConfig + "/examples/aws-tags.yaml", "--no-cache", "--output-file", fixture.file}, fixture.args...)
+			res, err := execute(t, aws, args...)
+			assert.EqualError(err, fixture.err)
+			assert.NotContains(res, "written")
+			after, _ := os.ReadFile(fixture.file)
+			assert.Equal(before, after)
+		})
+	}
+}
+
+func TestAwsScanOptionsSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected aws.ScanOptions
+		err      error
+	}{
+		{
+			name:     "Scan options defaults",
+			args:     []string{},
+			expected: aws.ScanOptions{Concurrency: 4, RetryMode: awssdk.RetryModeAdaptive, MaxAttempts: 10, MaxBackoff: 20 * time.Second, RateLimit: 5},
+		},
+		{
+			name:     "Scan options from flags",
+			args:     []string{"--target-timeout", "1m", "--concurrency", "8", "--retry-mode", "standard", "--max-attempts", "3", "--max-backoff", "1s", "--rate-limit", "0"},
+			expected: aws.ScanOptions{TargetTimeout: time.Minute, Concurrency: 8, RetryMode: awssdk.RetryModeStandard, MaxAttempts: 3, MaxBackoff: time.Second},
+		},
+		{
+			name: "Scan options invalid retry mode",
+			args: []string{"--retry-mode", "legacy"},
+			err:  fmt.Errorf("unknown RetryMode, legacy"),
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			c := &cobra.Command{Use: "aws"}
+			initAwsFlags(c)
+			assert.NoError(c.ParseFlags(fixture.args))
+			opts, err := awsScanOptions(c)
+			assert.Equal(fixture.err, err)
+			if fixture.err == nil {
+				assert.Equal(fixture.expected, opts)
+			}
+		})
+	}
+}
+
+func TestAwsCacheSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name    string
+		args    []string
+		cache   *aws.Cache
+		refresh bool
+	}{
+		{"Cache defaults", []string{}, &aws.Cache{Dir: aws.DefaultCacheDir(), TTL: 15 * time.Minute}, false},
+		{"Cache disabled", []string{"--no-cache", "--refresh"}, nil, false},
+		{"Cache refreshed", []string{"--refresh", "--cache-dir", "/tmp/tagu", "--cache-ttl", "1h"}, &aws.Cache{Dir: "/tmp/tagu", TTL: time.Hour}, true},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			c := &cobra.Command{Use: "aws"}
+			initAwsFlags(c)
+			assert.NoError(c.ParseFlags(fixture.args))
+			cache, refresh, err := awsCache(c)
+			assert.NoError(err)
+			assert.Equal(fixture.cache, cache)
+			assert.Equal(fixture.refresh, refresh)
+		})
+	}
+}
+
+func TestAwsCheckpointSuite(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	fixtures := []struct {
+		name string
+		args []string
+		open bool
+		err  string
+	}{
+		{name: "Checkpoint disabled", args: []string{}},
+		{name: "Checkpoint of a new scan", args: []string{"--state-file", filepath.Join(dir, "state.jsonl")}, open: true},
+		{name: "Checkpoint resumed", args: []string{"--resume", filepath.Join(dir, "state.jsonl")}, open: true},
+		{
+			name: "Checkpoint resumed and new",
+			args: []string{"--resume", filepath.Join(dir, "state.jsonl"), "--state-file", filepath.Join(dir, "other.jsonl")},
+			err:  "--resume and --state-file can not be combined, --resume keeps recording to its file",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			c := &cobra.Command{Use: "aws"}
+			initAwsFlags(c)
+			assert.NoError(c.ParseFlags(fixture.args))
+			checkpoint, err := awsCheckpoint(c)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.open, checkpoint != nil)
+			if checkpoint != nil {
+				assert.NoError(checkpoint.Close())
+			}
+		})
+	}
+}
+
+func TestPrintTargetsCacheErrSuite(t *testing.T) {
+	assert := assert.New(t)
+	var out strings.Builder
+	printTargets(&out, aws.TargetReports{
+		{Account: "111111111111", Region: "us-east-1", Status: aws.StatusOK, Count: 2, CacheErr: errors.New("read-only file system")},
+	})
+	assert.Equal("ACCOUNT       REGION     STATUS  CAUSE  TAGS  THROTTLES\n111111111111  us-east-1  ok             2     0\nWarning: 111111111111/us-east-1 not cached: read-only file system\n", out.String())
+}
+
+func TestCheckFailOnSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	ok := aws.TargetReport{Account: "111111111111", Region: "us-east-1", Status: aws.StatusOK}
+	failed := aws.TargetReport{Account: "111111111111", Region: "eu-west-1", Status: aws.StatusFailed, Cause: aws.CauseAccessDenied}
+
+	fixtures := []struct {
+		name    string
+		failOn  string
+		targets aws.TargetReports
+		err     error
+	}{
+		{"Fail on any without failure", "any", aws.TargetReports{ok, ok}, nil},
+		{"Fail on any with a failure", "any", aws.TargetReports{ok, failed}, errors.New("1 of 2 targets failed")},
+		{"Fail on all with a failure", "all", aws.TargetReports{ok, failed}, nil},
+		{"Fail on all with only failures", "all", aws.TargetReports{failed, failed}, errors.New("2 of 2 targets failed")},
+		{"Fail on none with only failures", "none", aws.TargetReports{failed, failed}, nil},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			err := checkFailOn(fixture.failOn, fixture.targets)
+			assert.Equal(fixture.err, err)
+		})
+	}
+}
+
 func TestLoadAwsConfigSuite(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,114 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"tagu/stats"
+
+	"github.com/spf13/cobra"
+)
+
+// awsVariantsCmd represents the aws variants command
+var awsVariantsCmd = &cobra.Command{
+	Use:   "variants",
+	Short: "Detect the inconsistent spelling and casing of the tag keys and values",
+	Long: `Scan the tags then cluster the keys, and the values of each key, by normalized form:
+lower case without separators, so only the casing and separator variants are clustered by
+default. With --max-distance, the spellings within this edit distance join the same cluster
+as well, word by word. With --prefix, a spelling prefixing a single other one such as env
+and environment joins its cluster. Spellings with different numbers, web1 and web2, or only
+differing by a short suffix, team-a and team-b, are never clustered. The clusters having
+more than one spelling are reported with the number of resources using each spelling.
+
+With --mapping-file, the mapping renaming every variant to the most used spelling is
+written as YAML, ready to be reviewed and used for a bulk rename.`,
+	Args: cobra.NoArgs,
+	RunE: awsVariantsCmdRunE,
+}
+
+func awsVariantsCmdRunE(c *cobra.Command, args []string) (err error) {
+	spec, err := awsLoadSpec(c)
+	if err != nil {
+		return err
+	}
+	failOn, err := awsFailOn(c)
+	if err != nil {
+		return err
+	}
+	format, err := c.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	mappingFile, err := c.Flags().GetString("mapping-file")
+	if err != nil {
+		return err
+	}
+	var opts stats.VariantOptions
+	if opts.MaxDistance, err = c.Flags().GetInt("max-distance"); err != nil {
+		return err
+	}
+	if opts.Prefix, err = c.Flags().GetBool("prefix"); err != nil {
+		return err
+	}
+	// Check the format before scanning
+	if err = stats.WriteVariants(io.Discard, format, stats.VariantReport{}); err != nil {
+		return err
+	}
+
+	report, err := awsRunScan(c, spec)
+	printTargets(c.ErrOrStderr(), report.Targets)
+	if err != nil {
+		return err
+	}
+
+	variants := stats.Variants(report.Results, opts)
+	if err = stats.WriteVariants(c.OutOrStdout(), format, variants); err != nil {
+		return err
+	}
+	if mappingFile != "" {
+		file, err := os.Create(mappingFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err = stats.WriteMapping(file, variants.Mapping()); err != nil {
+			return err
+		}
+	}
+	return checkFailOn(failOn, report.Targets)
+}
+
+func initAwsVariantsFlags(c *cobra.Command) {
+	c.Flags().StringP("format", "f", "table", "the report format, table or json")
+	c.Flags().String("mapping-file", "", "write the remediation mapping to this YAML file")
+	c.Flags().Int("max-distance", 0, "maximum edit distance between two spellings of a cluster, 0 only clusters the casing and separator variants")
+	c.Flags().Bool("prefix", false, "cluster a spelling prefixing a single other one, such as env and environment")
+	initAwsScanFlags(c)
+}
+
+func init() {
+	awsCmd.AddCommand(awsVariantsCmd)
+	initAwsVariantsFlags(awsVariantsCmd)
+}
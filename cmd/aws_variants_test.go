@@ -0,0 +1,61 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tagu/aws"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsVariantsCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	mappingFile := filepath.Join(t.TempDir(), "mapping.yaml")
+
+	awsScan = mockAwsScan
+	defer func() { awsScan = aws.Scan }()
+
+	aws := &cobra.Command{Use: "aws", SilenceUsage: true}
+	initAwsFlags(aws)
+	variants := &cobra.Command{Use: "variants", RunE: awsVariantsCmdRunE}
+	initAwsVariantsFlags(variants)
+	aws.AddCommand(variants)
+	defer viper.Reset()
+
+	res, err := execute(t, aws, "variants", "-i", absConfig+"/examples/aws-tags.yaml", "--no-cache", "--mapping-file", mappingFile)
+	assert.NoError(err)
+	assert.True(strings.HasSuffix(res, "ok             1     0\nKIND  KEY  CANONICAL  VARIANTS"), res)
+	mapping, err := os.ReadFile(mappingFile)
+	assert.NoError(err)
+	assert.Equal("{}\n", string(mapping))
+
+	_, err = execute(t, aws, "variants", "-i", absConfig+"/examples/aws-tags.yaml", "-f", "html")
+	assert.EqualError(err, `invalid format "html", expected table, json`)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"tagu/azure"
+	"tagu/models"
+	"tagu/provider"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// azureCmd represents the azure command
+var azureCmd = &cobra.Command{
+	Use:   "azure",
+	Short: "Dump tags from Azure with Resource Graph",
+	Long: `Query Azure Resource Graph for the resources of the subscriptions and their tags.
+Without input file every subscription readable by the credentials is scanned.
+
+The credentials are read from AZURE_ACCESS_TOKEN, the service principal of
+AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET, or the az CLI login.`,
+	RunE: azureCmdRunE,
+}
+
+// azureGetenv reads the credentials variables, replaced in the unittest
+var azureGetenv = os.Getenv
+
+func azureCmdRunE(c *cobra.Command, args []string) error {
+	p, err := azureProvider(c)
+	if err != nil {
+		return err
+	}
+	return runProvider(c, p)
+}
+
+// azureProvider builds the Azure provider from the input file and the endpoint flags,
+// the commands without those flags use the public cloud defaults
+func azureProvider(c *cobra.Command) (provider.Provider, error) {
+	inputFile, err := c.Flags().GetString("input-file")
+	if err != nil {
+		return nil, err
+	}
+	spec, err := loadAzureSpec(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	if inputFile != "" {
+		c.Printf("Load configuration file %s\n", inputFile)
+	}
+	client := &azure.Client{Endpoint: azure.DefaultEndpoint, Token: azure.DefaultTokenSource(azureGetenv)}
+	if c.Flags().Lookup("endpoint") != nil {
+		if client.Endpoint, err = c.Flags().GetString("endpoint"); err != nil {
+			return nil, err
+		}
+		if client.PageSize, err = c.Flags().GetInt("page-size"); err != nil {
+			return nil, err
+		}
+		if client.PageSize < 1 || client.PageSize > azure.DefaultPageSize {
+			return nil, fmt.Errorf("invalid page-size %d, expected 1 to %d", client.PageSize, azure.DefaultPageSize)
+		}
+	}
+	return azure.NewProvider(spec, client), nil
+}
+
+// loadAzureSpec reads the Azure spec, an empty path is an empty spec
+func loadAzureSpec(path string) (spec models.AzureSpec, err error) {
+	if path == "" {
+		return spec, nil
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetConfigFile(path)
+	if err = v.ReadInConfig(); err != nil {
+		return spec, fmt.Errorf("%s", err)
+	}
+	if err = v.Unmarshal(&spec); err != nil {
+		return spec, err
+	}
+	return spec, nil
+}
+
+func initAzureFlags(c *cobra.Command) {
+	initProviderCommonFlags(c.Flags())
+	initProviderOutputFlags(c.Flags())
+	c.Flags().String("endpoint", azure.DefaultEndpoint, "the Azure Resource Manager endpoint")
+	c.Flags().Int("page-size", azure.DefaultPageSize, "the Resource Graph page size, 1000 at most")
+}
+
+func init() {
+	rootCmd.AddCommand(azureCmd)
+	initAzureFlags(azureCmd)
+	scanProviders[azure.ProviderName] = azureProvider
+}
@@ -0,0 +1,144 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tagu/models"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeResourceGraph answers every query with a single virtual machine of the
+// first subscription of the request
+func fakeResourceGraph(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var request struct {
+			Subscriptions []string `json:"subscriptions"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if len(request.Subscriptions) == 0 {
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": []map[string]string{{"subscriptionId": "sub-1"}}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []map[string]interface{}{{
+			"id":             "/subscriptions/" + request.Subscriptions[0] + "/resourceGroups/web/providers/Microsoft.Compute/virtualMachines/vm-1",
+			"type":           "microsoft.compute/virtualmachines",
+			"location":       "westeurope",
+			"subscriptionId": request.Subscriptions[0],
+			"tags":           map[string]string{"env": "prod"},
+		}}})
+	}))
+}
+
+func TestAzureCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	server := fakeResourceGraph(t)
+	defer server.Close()
+
+	azureGetenv = func(name string) string {
+		if name == "AZURE_ACCESS_TOKEN" {
+			return "token"
+		}
+		return ""
+	}
+	defer func() { azureGetenv = os.Getenv }()
+
+	spec := filepath.Join(t.TempDir(), "azure.yaml")
+	assert.NoError(os.WriteFile(spec, []byte("subscriptions:\n  - sub-2\n"), 0o600))
+
+	newAzure := func() *cobra.Command {
+		c := &cobra.Command{Use: "azure", RunE: azureCmdRunE}
+		initAzureFlags(c)
+		c.InitDefaultHelpFlag()
+		return c
+	}
+	usage := strings.TrimSpace(newAzure().UsageString())
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Test the subscriptions are discovered without input file",
+			args:     []string{"--endpoint", server.URL, "--output", "csv"},
+			expected: "TARGET  STATUS  CAUSE  RESOURCES\nsub-1   ok             1\nprovider,scope,location,type,id,key,value\nazure,sub-1,westeurope,microsoft.compute/virtualmachines,/subscriptions/sub-1/resourceGroups/web/providers/Microsoft.Compute/virtualMachines/vm-1,env,prod",
+		},
+		{
+			name:     "Test the subscriptions of the input file",
+			args:     []string{"-i", spec, "--endpoint", server.URL, "--columns", "env"},
+			expected: "Load configuration file " + spec + "\nPROVIDER  SCOPE  LOCATION    TYPE                               ID                                                                                        env\nazure     sub-2  westeurope  microsoft.compute/virtualmachines  /subscriptions/sub-2/resourceGroups/web/providers/Microsoft.Compute/virtualMachines/vm-1  prod\n\nTARGET  STATUS  CAUSE  RESOURCES\nsub-2   ok             1",
+		},
+		{
+			name:     "Test an invalid page size",
+			args:     []string{"--page-size", "5000"},
+			expected: "Error: invalid page-size 5000, expected 1 to 1000\n" + usage,
+			err:      "invalid page-size 5000, expected 1 to 1000",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			res, err := execute(t, newAzure(), fixture.args...)
+			assert.Equal(fixture.expected, res)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
+
+func TestLoadAzureSpecSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	spec, err := loadAzureSpec("../examples/azure.yaml")
+	assert.NoError(err)
+	assert.Equal(models.AzureSpec{
+		Subscriptions:   []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"},
+		ResourceGroups:  []string{"web-prod"},
+		FilterResources: []string{"microsoft.compute/virtualmachines", "microsoft.storage/storageaccounts"},
+		FilterTags:      []models.Tags{{Key: "env", Values: []string{"prod"}}, {Key: "owner"}},
+	}, spec)
+
+	spec, err = loadAzureSpec("")
+	assert.NoError(err)
+	assert.Equal(models.AzureSpec{}, spec)
+
+	_, err = loadAzureSpec("missing.yaml")
+	assert.Error(err)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"tagu/aws"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the cached scan results",
+}
+
+// cacheLsCmd represents the cache ls command
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the cached scan results",
+	Args:  cobra.NoArgs,
+	RunE:  cacheLsCmdRunE,
+}
+
+// cacheClearCmd represents the cache clear command
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove the cached scan results",
+	Args:  cobra.NoArgs,
+	RunE:  cacheClearCmdRunE,
+}
+
+func cacheLsCmdRunE(c *cobra.Command, args []string) (err error) {
+	cache, err := cacheFromFlags(c)
+	if err != nil {
+		return err
+	}
+	entries, skipped, err := cache.Entries()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(c.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tREGION\tRESOURCES\tFILTER-TAGS\tTAGS\tAGE\tEXPIRED")
+	for _, entry := range entries {
+		var filterTags []string
+		for _, tag := range entry.FilterTags {
+			filterTags = append(filterTags, tag.Key+"="+strings.Join(tag.Values, "|"))
+		}
+		age := cache.Age(entry).Truncate(time.Second)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%t\n", entry.Account, entry.Region, strings.Join(entry.FilterResources, ","), strings.Join(filterTags, ","), len(entry.Results), age, cache.Expired(entry))
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	for _, err := range skipped {
+		fmt.Fprintf(c.OutOrStdout(), "Warning: skipped %s, run cache clear to remove it\n", err)
+	}
+	return nil
+}
+
+func cacheClearCmdRunE(c *cobra.Command, args []string) (err error) {
+	cache, err := cacheFromFlags(c)
+	if err != nil {
+		return err
+	}
+	expired, err := c.Flags().GetBool("expired")
+	if err != nil {
+		return err
+	}
+	removed, err := cache.Clear(expired)
+	if err != nil {
+		return err
+	}
+	c.Printf("Removed %d cache entries from %s\n", removed, cache.Dir)
+	return nil
+}
+
+// initCacheFlags defines the cache location and ttl flags
+func initCacheFlags(flags *pflag.FlagSet) {
+	flags.String("cache-dir", aws.DefaultCacheDir(), "the results cache directory")
+	flags.Duration("cache-ttl", 15*time.Minute, "the age after which a cached result is scanned again")
+}
+
+// cacheFromFlags builds the results cache from the cache-dir and cache-ttl flags
+func cacheFromFlags(c *cobra.Command) (*aws.Cache, error) {
+	dir, err := c.Flags().GetString("cache-dir")
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := c.Flags().GetDuration("cache-ttl")
+	if err != nil {
+		return nil, err
+	}
+	return &aws.Cache{Dir: dir, TTL: ttl}, nil
+}
+
+func initCacheClearFlags(c *cobra.Command) {
+	c.Flags().Bool("expired", false, "only remove the expired entries")
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheLsCmd, cacheClearCmd)
+	initCacheFlags(cacheCmd.PersistentFlags())
+	initCacheClearFlags(cacheClearCmd)
+}
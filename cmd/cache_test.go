@@ -0,0 +1,91 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tagu/aws"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	entries := []aws.CacheEntry{
+		{Key: "123456789012/us-east-1", Account: "123456789012", Region: "us-east-1", CreatedAt: time.Now().Add(-time.Hour), Results: []aws.RessourceTagResult{{Key: "env", Value: "prod"}}},
+		{Key: "123456789012/eu-west-1/0011223344556677", Account: "123456789012", Region: "eu-west-1", FilterResources: []string{"ec2"}, CreatedAt: time.Now()},
+	}
+	for i, entry := range entries {
+		data, _ := json.Marshal(entry)
+		assert.NoError(os.WriteFile(filepath.Join(dir, string(rune('a'+i))+".json"), data, 0o644))
+	}
+	assert.NoError(os.WriteFile(filepath.Join(dir, "c.json"), []byte("{"), 0o644))
+
+	newCacheCmd := func() *cobra.Command {
+		cache := &cobra.Command{Use: "cache"}
+		ls := &cobra.Command{Use: "ls", RunE: cacheLsCmdRunE}
+		clear := &cobra.Command{Use: "clear", RunE: cacheClearCmdRunE}
+		initCacheClearFlags(clear)
+		cache.AddCommand(ls, clear)
+		initCacheFlags(cache.PersistentFlags())
+		return cache
+	}
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "Test cache ls",
+			args:     []string{"ls", "--cache-dir", dir},
+			expected: "ACCOUNT       REGION     RESOURCES  FILTER-TAGS  TAGS  AGE     EXPIRED\n123456789012  eu-west-1  ec2                     0     0s      false\n123456789012  us-east-1                          1     1h0m0s  true\nWarning: skipped invalid cache entry " + filepath.Join(dir, "c.json") + ": unexpected end of JSON input, run cache clear to remove it",
+		},
+		{
+			name:     "Test cache clear expired entries",
+			args:     []string{"clear", "--cache-dir", dir, "--expired"},
+			expected: "Removed 2 cache entries from " + dir,
+		},
+		{
+			name:     "Test cache ls after clear",
+			args:     []string{"ls", "--cache-dir", dir},
+			expected: "ACCOUNT       REGION     RESOURCES  FILTER-TAGS  TAGS  AGE  EXPIRED\n123456789012  eu-west-1  ec2                     0     0s   false",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			res, err := execute(t, newCacheCmd(), fixture.args...)
+			assert.Equal(res, fixture.expected)
+			assert.NoError(err)
+		})
+	}
+}
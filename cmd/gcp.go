@@ -0,0 +1,121 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"tagu/gcp"
+	"tagu/models"
+	"tagu/provider"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// gcpCmd represents the gcp command
+var gcpCmd = &cobra.Command{
+	Use:   "gcp",
+	Short: "Dump labels from GCP with Cloud Asset Inventory",
+	Long: `Search Cloud Asset Inventory for the resources of the projects and their labels
+and resource manager tags. The projects of the folders and the organizations of the
+input file are discovered.
+
+The credentials are read from GOOGLE_OAUTH_ACCESS_TOKEN, the file of
+GOOGLE_APPLICATION_CREDENTIALS, the application default credentials or the gcloud CLI login.
+The calls are billed to the quota_project_id of the credentials file when it has one.`,
+	RunE: gcpCmdRunE,
+}
+
+// gcpGetenv reads the credentials variables, replaced in the unittest
+var gcpGetenv = os.Getenv
+
+func gcpCmdRunE(c *cobra.Command, args []string) error {
+	p, err := gcpProvider(c)
+	if err != nil {
+		return err
+	}
+	return runProvider(c, p)
+}
+
+// gcpProvider builds the GCP provider from the input file and the endpoint flags,
+// the commands without those flags use the default endpoint
+func gcpProvider(c *cobra.Command) (provider.Provider, error) {
+	inputFile, err := c.Flags().GetString("input-file")
+	if err != nil {
+		return nil, err
+	}
+	if inputFile == "" {
+		return nil, errors.New("missing --input-file with the projects, folders or organizations")
+	}
+	spec, err := loadGCPSpec(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	c.Printf("Load configuration file %s\n", inputFile)
+	client := &gcp.Client{Endpoint: gcp.DefaultEndpoint}
+	if c.Flags().Lookup("endpoint") != nil {
+		if client.Endpoint, err = c.Flags().GetString("endpoint"); err != nil {
+			return nil, err
+		}
+		if client.PageSize, err = c.Flags().GetInt("page-size"); err != nil {
+			return nil, err
+		}
+		if client.PageSize < 1 || client.PageSize > gcp.DefaultPageSize {
+			return nil, fmt.Errorf("invalid page-size %d, expected 1 to %d", client.PageSize, gcp.DefaultPageSize)
+		}
+	}
+	if client.Token, err = gcp.DefaultTokenSource(gcpGetenv); err != nil {
+		return nil, err
+	}
+	client.QuotaProject = gcp.QuotaProject(client.Token)
+	return gcp.NewProvider(spec, client), nil
+}
+
+// loadGCPSpec reads the GCP spec file
+func loadGCPSpec(path string) (spec models.GCPSpec, err error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetConfigFile(path)
+	if err = v.ReadInConfig(); err != nil {
+		return spec, fmt.Errorf("%s", err)
+	}
+	if err = v.Unmarshal(&spec); err != nil {
+		return spec, err
+	}
+	return spec, nil
+}
+
+func initGCPFlags(c *cobra.Command) {
+	initProviderCommonFlags(c.Flags())
+	initProviderOutputFlags(c.Flags())
+	c.Flags().String("endpoint", gcp.DefaultEndpoint, "the Cloud Asset API endpoint")
+	c.Flags().Int("page-size", gcp.DefaultPageSize, "the searchAllResources page size, 500 at most")
+}
+
+func init() {
+	rootCmd.AddCommand(gcpCmd)
+	initGCPFlags(gcpCmd)
+	scanProviders[gcp.ProviderName] = gcpProvider
+}
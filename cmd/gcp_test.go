@@ -0,0 +1,133 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tagu/models"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCloudAsset answers every search with a labelled instance of the project
+func fakeCloudAsset(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		project := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/projects/"), ":searchAllResources")
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": []map[string]interface{}{{
+			"name":      "//compute.googleapis.com/projects/" + project + "/zones/europe-west1-b/instances/vm-1",
+			"assetType": "compute.googleapis.com/Instance",
+			"location":  "europe-west1-b",
+			"labels":    map[string]string{"env": "prod"},
+		}}})
+	}))
+}
+
+func TestGCPCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	server := fakeCloudAsset(t)
+	defer server.Close()
+
+	gcpGetenv = func(name string) string {
+		if name == "GOOGLE_OAUTH_ACCESS_TOKEN" {
+			return "token"
+		}
+		return ""
+	}
+	defer func() { gcpGetenv = os.Getenv }()
+
+	spec := filepath.Join(t.TempDir(), "gcp.yaml")
+	assert.NoError(os.WriteFile(spec, []byte("projects:\n  - web-prod\n"), 0o600))
+
+	newGCP := func() *cobra.Command {
+		c := &cobra.Command{Use: "gcp", RunE: gcpCmdRunE}
+		initGCPFlags(c)
+		c.InitDefaultHelpFlag()
+		return c
+	}
+	usage := strings.TrimSpace(newGCP().UsageString())
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Test the projects of the input file",
+			args:     []string{"-i", spec, "--endpoint", server.URL, "--output", "csv"},
+			expected: "Load configuration file " + spec + "\nTARGET    STATUS  CAUSE  RESOURCES\nweb-prod  ok             1\nprovider,scope,location,type,id,key,value\ngcp,web-prod,europe-west1-b,compute.googleapis.com/Instance,//compute.googleapis.com/projects/web-prod/zones/europe-west1-b/instances/vm-1,env,prod",
+		},
+		{
+			name:     "Test the input file is required",
+			args:     []string{},
+			expected: "Error: missing --input-file with the projects, folders or organizations\n" + usage,
+			err:      "missing --input-file with the projects, folders or organizations",
+		},
+		{
+			name:     "Test an invalid page size",
+			args:     []string{"-i", spec, "--page-size", "0"},
+			expected: "Load configuration file " + spec + "\nError: invalid page-size 0, expected 1 to 500\n" + usage,
+			err:      "invalid page-size 0, expected 1 to 500",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			res, err := execute(t, newGCP(), fixture.args...)
+			assert.Equal(fixture.expected, res)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
+
+func TestLoadGCPSpecSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	spec, err := loadGCPSpec("../examples/gcp.yaml")
+	assert.NoError(err)
+	assert.Equal(models.GCPSpec{
+		Projects:        []string{"web-prod"},
+		Folders:         []string{"123456789012"},
+		Organizations:   []string{"987654321098"},
+		FilterResources: []string{"compute.googleapis.com/Instance", "storage.googleapis.com/Bucket"},
+		FilterTags:      []models.Tags{{Key: "env", Values: []string{"prod"}}, {Key: "owner"}},
+	}, spec)
+
+	_, err = loadGCPSpec("missing.yaml")
+	assert.Error(err)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"tagu/k8s"
+	"tagu/models"
+	"tagu/provider"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// k8sCmd represents the k8s command
+var k8sCmd = &cobra.Command{
+	Use:   "k8s",
+	Short: "Dump labels and annotations from Kubernetes",
+	Long: `List the objects of the resource kinds in every kubeconfig context and emit their
+labels as tags, with their annotations when requested. Without input file the
+current context is scanned across all namespaces. A kind the credentials can not
+list, the cluster nodes for instance, fails its context but the other kinds are
+still listed.
+
+The kubeconfig is read from --kubeconfig, KUBECONFIG or $HOME/.kube/config.`,
+	RunE: k8sCmdRunE,
+}
+
+// k8sGetenv reads the kubeconfig variables, replaced in the unittest
+var k8sGetenv = os.Getenv
+
+func k8sCmdRunE(c *cobra.Command, args []string) error {
+	p, err := k8sProvider(c)
+	if err != nil {
+		return err
+	}
+	return runProvider(c, p)
+}
+
+// k8sProvider builds the Kubernetes provider from the input file, the kubeconfig
+// and the flags overriding the spec, the commands without those flags use the spec
+func k8sProvider(c *cobra.Command) (provider.Provider, error) {
+	inputFile, err := c.Flags().GetString("input-file")
+	if err != nil {
+		return nil, err
+	}
+	spec, err := loadK8sSpec(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	if inputFile != "" {
+		c.Printf("Load configuration file %s\n", inputFile)
+	}
+	paths := k8s.DefaultKubeconfig(k8sGetenv)
+	if c.Flags().Lookup("kubeconfig") != nil {
+		if err = k8sSpecFlags(c, &spec); err != nil {
+			return nil, err
+		}
+		kubeconfig, err := c.Flags().GetString("kubeconfig")
+		if err != nil {
+			return nil, err
+		}
+		if kubeconfig != "" {
+			paths = filepath.SplitList(kubeconfig)
+		}
+	}
+	config, err := k8s.LoadKubeconfig(paths)
+	if err != nil {
+		return nil, err
+	}
+	return k8s.NewProvider(spec, config), nil
+}
+
+// k8sSpecFlags overrides the spec with the flags set on the command line
+func k8sSpecFlags(c *cobra.Command, spec *models.KubernetesSpec) (err error) {
+	flags := c.Flags()
+	if flags.Changed("context") {
+		if spec.Contexts, err = flags.GetStringSlice("context"); err != nil {
+			return err
+		}
+	}
+	if flags.Changed("all-contexts") {
+		if spec.AllContexts, err = flags.GetBool("all-contexts"); err != nil {
+			return err
+		}
+	}
+	if flags.Changed("namespace") {
+		if spec.Namespaces, err = flags.GetStringSlice("namespace"); err != nil {
+			return err
+		}
+	}
+	if flags.Changed("kinds") {
+		if spec.Kinds, err = flags.GetStringSlice("kinds"); err != nil {
+			return err
+		}
+	}
+	if flags.Changed("annotations") {
+		if spec.Annotations, err = flags.GetBool("annotations"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadK8sSpec reads the Kubernetes spec, an empty path is an empty spec
+func loadK8sSpec(path string) (spec models.KubernetesSpec, err error) {
+	if path == "" {
+		return spec, nil
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetConfigFile(path)
+	if err = v.ReadInConfig(); err != nil {
+		return spec, fmt.Errorf("%s", err)
+	}
+	if err = v.Unmarshal(&spec); err != nil {
+		return spec, err
+	}
+	return spec, nil
+}
+
+func initK8sFlags(c *cobra.Command) {
+	initProviderCommonFlags(c.Flags())
+	initProviderOutputFlags(c.Flags())
+	c.Flags().String("kubeconfig", "", "the kubeconfig files, KUBECONFIG or $HOME/.kube/config by default")
+	c.Flags().StringSlice("context", []string{}, "the kubeconfig contexts to scan, the current context by default")
+	c.Flags().Bool("all-contexts", false, "scan every context of the kubeconfig")
+	c.Flags().StringSliceP("namespace", "n", []string{}, "the namespaces of the namespaced kinds, all by default")
+	c.Flags().StringSlice("kinds", []string{}, "the resource kinds as resource[.group], deployments.apps for instance")
+	c.Flags().Bool("annotations", false, "emit the annotations prefixed with "+k8s.AnnotationPrefix)
+}
+
+func init() {
+	rootCmd.AddCommand(k8sCmd)
+	initK8sFlags(k8sCmd)
+	scanProviders[k8s.ProviderName] = k8sProvider
+}
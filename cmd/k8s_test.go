@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tagu/models"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKubernetes serves the discovery of the deployments and a deployment in the
+// web namespace, the deployments of every other namespace are forbidden
+func fakeKubernetes(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/apis/apps":
+			json.NewEncoder(w).Encode(map[string]interface{}{"preferredVersion": map[string]string{"version": "v1"}})
+		case "/apis/apps/v1":
+			json.NewEncoder(w).Encode(map[string]interface{}{"resources": []map[string]interface{}{
+				{"name": "deployments", "kind": "Deployment", "namespaced": true, "verbs": []string{"list"}},
+			}})
+		case "/apis/apps/v1/namespaces/web/deployments", "/apis/apps/v1/deployments":
+			json.NewEncoder(w).Encode(map[string]interface{}{"metadata": map[string]string{}, "items": []map[string]interface{}{{
+				"metadata": map[string]interface{}{
+					"name":        "api",
+					"namespace":   "web",
+					"labels":      map[string]string{"team": "web"},
+					"annotations": map[string]string{"owner": "ops"},
+				},
+			}}})
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "reason": "Forbidden", "message": "forbidden"})
+		}
+	}))
+}
+
+func TestK8sCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	server := fakeKubernetes(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	kubeconfig := filepath.Join(dir, "config")
+	assert.NoError(os.WriteFile(kubeconfig, []byte(`
+current-context: dev
+clusters:
+- name: cluster
+  cluster: {server: "`+server.URL+`"}
+users:
+- name: scanner
+  user: {token: token}
+contexts:
+- name: dev
+  context: {cluster: cluster, user: scanner}
+- name: prod
+  context: {cluster: cluster, user: scanner}
+`), 0o600))
+	spec := filepath.Join(dir, "k8s.yaml")
+	assert.NoError(os.WriteFile(spec, []byte("contexts:\n  - prod\nnamespaces:\n  - web\nkinds:\n  - deployments.apps\n"), 0o600))
+
+	k8sGetenv = func(name string) string {
+		if name == "KUBECONFIG" {
+			return kubeconfig
+		}
+		return ""
+	}
+	defer func() { k8sGetenv = os.Getenv }()
+
+	newK8s := func() *cobra.Command {
+		c := &cobra.Command{Use: "k8s", RunE: k8sCmdRunE}
+		initK8sFlags(c)
+		c.InitDefaultHelpFlag()
+		return c
+	}
+	usage := strings.TrimSpace(newK8s().UsageString())
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Test the current context of KUBECONFIG",
+			args:     []string{"--kinds", "deployments.apps", "--output", "csv"},
+			expected: "TARGET  STATUS  CAUSE  RESOURCES\ndev     ok             1\nprovider,scope,location,type,id,key,value\nk8s,dev,web,apps/Deployment,web/api,team,web",
+		},
+		{
+			name:     "Test the input file and the annotations",
+			args:     []string{"-i", spec, "--annotations", "--columns", "team,annotation:owner"},
+			expected: "Load configuration file " + spec + "\nPROVIDER  SCOPE  LOCATION  TYPE             ID       team  annotation:owner\nk8s       prod   web       apps/Deployment  web/api  web   ops\n\nTARGET  STATUS  CAUSE  RESOURCES\nprod    ok             1",
+		},
+		{
+			name:     "Test the flags override the input file",
+			args:     []string{"-i", spec, "--all-contexts", "-n", "data", "--output", "csv"},
+			expected: "Load configuration file " + spec + "\nTARGET  STATUS  CAUSE          RESOURCES\ndev     failed  access-denied  0\nprod    failed  access-denied  0\n\nTARGET  ERROR\ndev     list deployments.apps in data: k8s: status 403: Forbidden: forbidden\nprod    list deployments.apps in data: k8s: status 403: Forbidden: forbidden\nprovider,scope,location,type,id,key,value\nError: 2 of 2 targets failed\n" + usage,
+			err:      "2 of 2 targets failed",
+		},
+		{
+			name:     "Test an unknown context",
+			args:     []string{"--kubeconfig", kubeconfig, "--context", "staging"},
+			expected: "Error: k8s targets: unknown context \"staging\"\n" + usage,
+			err:      `k8s targets: unknown context "staging"`,
+		},
+		{
+			name:     "Test a missing kubeconfig",
+			args:     []string{"--kubeconfig", filepath.Join(dir, "missing")},
+			expected: "Error: open " + filepath.Join(dir, "missing") + ": no such file or directory\n" + usage,
+			err:      "open " + filepath.Join(dir, "missing") + ": no such file or directory",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			res, err := execute(t, newK8s(), fixture.args...)
+			assert.Equal(fixture.expected, res)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+
+	t.Run("Test an unknown context keeps the output file", func(t *testing.T) {
+		output := filepath.Join(dir, "resources.csv")
+		assert.NoError(os.WriteFile(output, []byte("previous scan\n"), 0o644))
+		_, err := execute(t, newK8s(), "--kubeconfig", kubeconfig, "--context", "staging", "--output", "csv", "--output-file", output)
+		assert.EqualError(err, `k8s targets: unknown context "staging"`)
+		data, err := os.ReadFile(output)
+		assert.NoError(err)
+		assert.Equal("previous scan\n", string(data))
+	})
+}
+
+func TestLoadK8sSpecSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	spec, err := loadK8sSpec("../examples/k8s.yaml")
+	assert.NoError(err)
+	assert.Equal(models.KubernetesSpec{
+		Contexts:    []string{"prod-eu", "prod-us"},
+		Namespaces:  []string{"web", "data"},
+		Kinds:       []string{"namespaces", "deployments.apps", "statefulsets.apps", "services"},
+		FilterTags:  []models.Tags{{Key: "team"}, {Key: "env", Values: []string{"prod"}}},
+		Annotations: true,
+	}, spec)
+
+	spec, err = loadK8sSpec("")
+	assert.NoError(err)
+	assert.Equal(models.KubernetesSpec{}, spec)
+
+	_, err = loadK8sSpec("missing.yaml")
+	assert.Error(err)
+}
@@ -0,0 +1,268 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"tagu/aws"
+	"tagu/export"
+	"tagu/provider"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// scanCmd represents the scan command
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Dump the resources tags of a provider in the provider neutral format",
+	Long: `Scan the targets of a provider and write one row per resource tag with the
+provider, scope, location, type and id of the resource. For example:
+
+  tagu scan --provider aws -i spec.yaml --output json`,
+	RunE: scanCmdRunE,
+}
+
+// providerFactory builds a provider from the flags of the command
+type providerFactory func(c *cobra.Command) (provider.Provider, error)
+
+// scanProviders are the providers of the scan command by name, replaced in the unittest
+var scanProviders = map[string]providerFactory{
+	aws.ProviderName: awsProvider,
+}
+
+// providerOutputs are the formats of the output flag of the provider commands
+var providerOutputs = []string{"table", "json", "csv"}
+
+func scanCmdRunE(c *cobra.Command, args []string) error {
+	name, err := c.Flags().GetString("provider")
+	if err != nil {
+		return err
+	}
+	factory, ok := scanProviders[name]
+	if !ok {
+		var names []string
+		for name := range scanProviders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown provider %q, expected %s", name, strings.Join(names, ", "))
+	}
+	p, err := factory(c)
+	if err != nil {
+		return err
+	}
+	return runProvider(c, p)
+}
+
+// awsProvider builds the AWS provider from the spec and the retry and rate limit flags,
+// the concurrency and the target timeout are applied by provider.Scan
+func awsProvider(c *cobra.Command) (provider.Provider, error) {
+	spec, err := awsLoadSpec(c)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := awsScanOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	opts.Concurrency, opts.TargetTimeout = 0, 0
+	return aws.NewProvider(spec, opts), nil
+}
+
+// runProvider scans the targets of p with the timeout, concurrency and fail-on flags
+// and writes the resources in the output format, the partial resources of a
+// stopped scan are written too but nothing is written when the targets discovery failed
+func runProvider(c *cobra.Command, p provider.Provider) error {
+	failOn, err := awsFailOn(c)
+	if err != nil {
+		return err
+	}
+	output, err := providerOutput(c)
+	if err != nil {
+		return err
+	}
+	var opts provider.ScanOptions
+	if opts.TargetTimeout, err = c.Flags().GetDuration("target-timeout"); err != nil {
+		return err
+	}
+	if opts.Concurrency, err = c.Flags().GetInt("concurrency"); err != nil {
+		return err
+	}
+	ctx, cancel, err := awsContext(c)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	report, err := provider.Scan(ctx, p, opts)
+	// Nothing was scanned, the output is left untouched
+	var targetsErr *provider.TargetsError
+	if errors.As(err, &targetsErr) {
+		return err
+	}
+	if werr := writeResources(c, output, report); werr != nil {
+		return werr
+	}
+	if err != nil {
+		return err
+	}
+	return failOnError(failOn, len(report.Targets.Failed()), len(report.Targets))
+}
+
+// providerOutput reads and validates the output, output-file, pivot and columns flags
+func providerOutput(c *cobra.Command) (output awsOutputOptions, err error) {
+	if output.Format, err = c.Flags().GetString("output"); err != nil {
+		return output, err
+	}
+	if output.File, err = c.Flags().GetString("output-file"); err != nil {
+		return output, err
+	}
+	if output.Pivot, err = c.Flags().GetBool("pivot"); err != nil {
+		return output, err
+	}
+	if output.Columns, err = c.Flags().GetStringSlice("columns"); err != nil {
+		return output, err
+	}
+	output.Pivot = output.Pivot || len(output.Columns) > 0
+
+	switch output.Format {
+	case "table":
+		if output.File != "" {
+			return output, errors.New("--output-file is not supported by the table output")
+		}
+	case "csv":
+	case "json":
+		if output.Pivot {
+			return output, errors.New("--pivot is not supported by the json output")
+		}
+	default:
+		return output, fmt.Errorf("invalid output %q, expected %s", output.Format, strings.Join(providerOutputs, ", "))
+	}
+	return output, nil
+}
+
+// writeResources writes the report in the output format, the targets go to
+// stderr when the resources are written to stdout in a machine readable format
+func writeResources(c *cobra.Command, output awsOutputOptions, report provider.Report) error {
+	out := c.OutOrStdout()
+	if output.Format != "table" && output.File == "" {
+		printProviderTargets(c.ErrOrStderr(), report.Targets)
+	} else if output.Format != "table" {
+		printProviderTargets(out, report.Targets)
+		file, err := os.Create(output.File)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	// The key and value columns of the flat table are upper-cased like the provider columns
+	table := export.ResourceFlatTable(report.Resources)
+	headerColumns := len(table.Header)
+	if output.Pivot {
+		table = export.ResourcePivotTable(report.Resources, output.Columns)
+		headerColumns = len(export.ProviderColumns)
+	}
+	switch output.Format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "csv":
+		return export.WriteCSV(out, table)
+	default:
+		printTable(out, table, headerColumns)
+		fmt.Fprintln(out)
+		printProviderTargets(out, report.Targets)
+	}
+	return nil
+}
+
+// printProviderTargets writes the status of each target and the errors of the failed ones
+func printProviderTargets(out io.Writer, targets provider.TargetReports) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tSTATUS\tCAUSE\tRESOURCES")
+	for _, t := range targets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", t.Target, t.Status, t.Cause, t.Count)
+	}
+	w.Flush()
+
+	failed := targets.Failed()
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tERROR")
+	for _, t := range failed {
+		msg := string(t.Status)
+		if t.Err != nil {
+			msg = t.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\n", t.Target, msg)
+	}
+	w.Flush()
+}
+
+// initProviderCommonFlags defines the input file, timeout, fail-on and concurrency flags shared by the provider commands
+func initProviderCommonFlags(flags *pflag.FlagSet) {
+	initProviderScanFlags(flags)
+	flags.String("fail-on", "any", "exit with an error when any, all or none of the targets failed")
+}
+
+// initProviderScanFlags defines the input file, timeout and concurrency flags, the
+// commands running until stopped have no exit code to fail
+func initProviderScanFlags(flags *pflag.FlagSet) {
+	flags.StringP("input-file", "i", "", "the input file")
+	flags.Duration("timeout", 0, "stop the whole scan after this duration (0 means no limit)")
+	flags.Duration("target-timeout", 0, "stop a target scan after this duration (0 means no limit)")
+	flags.Int("concurrency", 4, "number of targets scanned in parallel")
+}
+
+// initProviderOutputFlags defines the output flags of the provider commands
+func initProviderOutputFlags(flags *pflag.FlagSet) {
+	flags.String("output", "table", "the output format, "+strings.Join(providerOutputs, ", "))
+	flags.String("output-file", "", "write the json or csv output to this file")
+	flags.Bool("pivot", false, "write one row per resource and one column per tag key")
+	flags.StringSlice("columns", nil, "the tag key columns of the pivoted output in this order, implies --pivot (default every key)")
+}
+
+func initScanFlags(c *cobra.Command) {
+	c.Flags().StringP("provider", "p", aws.ProviderName, "the provider to scan")
+	initAwsCommonFlags(c.Flags())
+	initProviderOutputFlags(c.Flags())
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+	initScanFlags(scanCmd)
+}
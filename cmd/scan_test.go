@@ -0,0 +1,202 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tagu/provider"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeScanProvider lists a tagged resource per location, the location named
+// "fail" returns an error
+type fakeScanProvider struct {
+	locations []string
+}
+
+func (p fakeScanProvider) Name() string {
+	return "fake"
+}
+
+func (p fakeScanProvider) Targets(ctx context.Context) ([]provider.Target, error) {
+	var targets []provider.Target
+	for _, location := range p.locations {
+		targets = append(targets, provider.Target{Scope: "sub-1", Location: location})
+	}
+	return targets, nil
+}
+
+func (p fakeScanProvider) Resources(ctx context.Context, target provider.Target) ([]provider.Resource, error) {
+	if target.Location == "fail" {
+		return nil, errors.New("forbidden")
+	}
+	return []provider.Resource{
+		{Scope: target.Scope, Location: target.Location, Type: "vm", ID: "vm-1", Tags: map[string]string{"env": "prod", "owner": "web"}},
+	}, nil
+}
+
+func mockScanProviders() func() {
+	previous := scanProviders
+	scanProviders = map[string]providerFactory{
+		"fake": func(c *cobra.Command) (provider.Provider, error) {
+			return fakeScanProvider{locations: []string{"westeurope"}}, nil
+		},
+		"failing": func(c *cobra.Command) (provider.Provider, error) {
+			return fakeScanProvider{locations: []string{"westeurope", "fail"}}, nil
+		},
+	}
+	return func() { scanProviders = previous }
+}
+
+func TestScanCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	defer mockScanProviders()()
+
+	newScan := func() *cobra.Command {
+		scan := &cobra.Command{Use: "scan", RunE: scanCmdRunE}
+		initScanFlags(scan)
+		scan.InitDefaultHelpFlag()
+		return scan
+	}
+	usage := strings.TrimSpace(newScan().UsageString())
+
+	targets := "TARGET            STATUS  CAUSE  RESOURCES\nsub-1/westeurope  ok             1"
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Test the table output",
+			args:     []string{"-p", "fake"},
+			expected: "PROVIDER  SCOPE  LOCATION    TYPE  ID    KEY    VALUE\nfake      sub-1  westeurope  vm    vm-1  env    prod\nfake      sub-1  westeurope  vm    vm-1  owner  web\n\n" + targets,
+		},
+		{
+			name:     "Test the pivoted table output",
+			args:     []string{"-p", "fake", "--columns", "owner"},
+			expected: "PROVIDER  SCOPE  LOCATION    TYPE  ID    owner\nfake      sub-1  westeurope  vm    vm-1  web\n\n" + targets,
+		},
+		{
+			name:     "Test the csv output",
+			args:     []string{"-p", "fake", "--output", "csv"},
+			expected: targets + "\nprovider,scope,location,type,id,key,value\nfake,sub-1,westeurope,vm,vm-1,env,prod\nfake,sub-1,westeurope,vm,vm-1,owner,web",
+		},
+		{
+			name: "Test the failed targets",
+			args: []string{"-p", "failing", "--output", "csv", "--columns", "env"},
+			expected: "TARGET            STATUS  CAUSE  RESOURCES\nsub-1/westeurope  ok             1\nsub-1/fail        failed         0\n\nTARGET      ERROR\nsub-1/fail  forbidden\n" +
+				"provider,scope,location,type,id,env\nfake,sub-1,westeurope,vm,vm-1,prod\nError: 1 of 2 targets failed\n" + usage,
+			err: "1 of 2 targets failed",
+		},
+		{
+			name:     "Test the failed targets with fail-on all",
+			args:     []string{"-p", "failing", "--output", "csv", "--columns", "env", "--fail-on", "all"},
+			expected: "TARGET            STATUS  CAUSE  RESOURCES\nsub-1/westeurope  ok             1\nsub-1/fail        failed         0\n\nTARGET      ERROR\nsub-1/fail  forbidden\nprovider,scope,location,type,id,env\nfake,sub-1,westeurope,vm,vm-1,prod",
+		},
+		{
+			name:     "Test an unknown provider",
+			args:     []string{"-p", "oracle"},
+			expected: "Error: unknown provider \"oracle\", expected failing, fake\n" + usage,
+			err:      "unknown provider \"oracle\", expected failing, fake",
+		},
+		{
+			name:     "Test an invalid output",
+			args:     []string{"-p", "fake", "--output", "xlsx"},
+			expected: "Error: invalid output \"xlsx\", expected table, json, csv\n" + usage,
+			err:      "invalid output \"xlsx\", expected table, json, csv",
+		},
+		{
+			name:     "Test the json output can not be pivoted",
+			args:     []string{"-p", "fake", "--output", "json", "--pivot"},
+			expected: "Error: --pivot is not supported by the json output\n" + usage,
+			err:      "--pivot is not supported by the json output",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			res, err := execute(t, newScan(), fixture.args...)
+			assert.Equal(fixture.expected, res)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
+
+func TestScanJSONSuite(t *testing.T) {
+	assert := assert.New(t)
+	defer mockScanProviders()()
+
+	scan := &cobra.Command{Use: "scan", RunE: scanCmdRunE}
+	initScanFlags(scan)
+	file := filepath.Join(t.TempDir(), "resources.json")
+	res, err := execute(t, scan, "-p", "fake", "--output", "json", "--output-file", file)
+	assert.NoError(err)
+	assert.Equal("TARGET            STATUS  CAUSE  RESOURCES\nsub-1/westeurope  ok             1", res)
+
+	data, err := os.ReadFile(file)
+	assert.NoError(err)
+	var report provider.Report
+	assert.NoError(json.Unmarshal(data, &report))
+	assert.Equal(provider.Report{
+		Provider: "fake",
+		Resources: []provider.Resource{
+			{Provider: "fake", Scope: "sub-1", Location: "westeurope", Type: "vm", ID: "vm-1", Tags: map[string]string{"env": "prod", "owner": "web"}},
+		},
+		Targets: provider.TargetReports{
+			{Target: provider.Target{Scope: "sub-1", Location: "westeurope"}, Status: provider.StatusOK, Count: 1},
+		},
+	}, report)
+}
+
+func TestAwsProviderSuite(t *testing.T) {
+	assert := assert.New(t)
+	defer viper.Reset()
+
+	absConfig, _ := filepath.Abs("../examples/aws-tags.yaml")
+	scan := &cobra.Command{Use: "scan"}
+	scan.SetOut(io.Discard)
+	initScanFlags(scan)
+	assert.NoError(scan.Flags().Parse([]string{"-i", absConfig}))
+	p, err := awsProvider(scan)
+	assert.NoError(err)
+	assert.Equal("aws", p.Name())
+	targets, err := p.Targets(context.TODO())
+	assert.NoError(err)
+	assert.NotEmpty(targets)
+}
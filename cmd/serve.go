@@ -0,0 +1,539 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tagu/aws"
+	"tagu/export"
+	"tagu/models"
+	"tagu/notify"
+	"tagu/query"
+	"tagu/server"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Scan the tags periodically and serve the tagging health metrics",
+	Long: `Scan the spec of --input-file every --interval and expose the results of the last
+scan on /metrics in the Prometheus format with --metrics:
+
+  tagu_resources_total{account,region,service}
+  tagu_tag_coverage_ratio{key,account,region}
+  tagu_policy_violations_total{account,region}, with --compliance-details
+  tagu_scan_duration_seconds, tagu_scans_total{result} and tagu_scan_errors_total{cause}
+
+The cached results are reused within the cache ttl, use --no-cache to scan every time.
+
+With --api the scans are queued on demand and their snapshots queried over HTTP:
+
+  POST /api/v1/scans                    {"scan": "<name>"}, or {"spec": {...}} with --allow-specs, returns the job
+  GET  /api/v1/jobs/{id}                the job status and its snapshot id
+  GET  /api/v1/snapshots?scan=          the stored snapshots
+  GET  /api/v1/snapshots/{id}/results   ?page=&per-page=&where=&account=&region=&service=&key=&value=
+  GET  /api/v1/diff?from=&to=           the tags added, removed or changed between two snapshots,
+                                        the targets failed in either snapshot left out
+  GET  /api/v1/schema                   the JSON schema of the responses
+
+The server has no authentication, it listens on localhost by default. Put an authenticating
+proxy in front before listening on another interface. An ad-hoc spec assumes its role-name
+in its accounts with the server credentials, --allow-specs only suits a trusted network.
+The API keeps the last --api-retain snapshots of each named scan, and of the ad-hoc specs,
+apart from the snapshots of the schedules.
+
+The named scans are read from --config, the scans with a cron schedule run on their own,
+their snapshots are stored, the oldest above retain removed, then their outputs written.
+The {scan} and {time} placeholders of the output files are replaced on every run:
+
+  scans:
+    - name: prod
+      input-file: prod.yaml
+      schedule: "0 */6 * * *"   # or @hourly, @daily, @every 2h
+      retain: 28
+      outputs:
+        - format: sqlite
+          file: history/prod.sqlite
+        - format: csv
+          file: reports/{scan}-{time}.csv
+          columns: [env, owner]
+
+The next and last run of the scheduled scans are served on /api/v1/schedules with --api.
+
+The new policy violations, with --compliance-details, and the tags changed since the previous
+snapshot of the scheduled scans are sent to the notification sinks. The resources of a target
+that failed in either snapshot are left out until the target is scanned again. A finding is
+sent once to each sink, again after resend-after when set, the sent findings are kept in the
+state-file. A sink failing to send receives the violations again on the next run, the tags
+changed since the previous snapshot are only found by their run and are lost:
+
+  notifications:
+    state-file: tagu-notifications.json
+    resend-after: 168h
+    sinks:
+      - type: webhook              # JSON payload signed in X-Tagu-Signature-256
+        url: https://hooks.example.com/tagu
+        secret-env: TAGU_WEBHOOK_SECRET
+        events: [violation]
+      - type: slack
+        url: https://hooks.slack.com/services/...
+        scans: [prod]
+        template: "{{len .Drift}} tags changed in {{.Scan}}"
+      - type: email
+        smtp: smtp.example.com:587
+        from: tagu@example.com
+        to: [cloud-team@example.com]
+        username: tagu
+        password-env: TAGU_SMTP_PASSWORD`,
+	Args: cobra.NoArgs,
+	RunE: serveCmdRunE,
+}
+
+// serveOptions are the flags of the serve command
+type serveOptions struct {
+	Listen     string
+	Interval   time.Duration
+	Metrics    bool
+	Keys       []string
+	API        bool
+	Config     string
+	StoreDir   string
+	QueueSize  int
+	Workers    int
+	AllowSpecs bool
+	APIRetain  int
+}
+
+func serveCmdRunE(c *cobra.Command, args []string) (err error) {
+	opts, err := serveFlags(c)
+	if err != nil {
+		return err
+	}
+	opts.Config = serveConfigPath(opts.Config)
+	if opts.Interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if opts.QueueSize < 1 || opts.Workers < 1 {
+		return errors.New("--queue-size and --workers must be positive")
+	}
+	if opts.APIRetain < 0 {
+		return errors.New("--api-retain must not be negative")
+	}
+	config, err := loadServeConfig(opts.Config)
+	if err != nil {
+		return err
+	}
+	scans, err := loadScans(opts.Config, config)
+	if err != nil {
+		return err
+	}
+	schedules, err := serveSchedules(opts.Config, config, scans)
+	if err != nil {
+		return err
+	}
+	if len(config.Notifications.Sinks) > 0 && len(schedules) == 0 {
+		return errors.New("the notifications require a scheduled scan in --config")
+	}
+	if !opts.Metrics && !opts.API && len(schedules) == 0 {
+		return errors.New("nothing to serve, set --metrics, --api or a scheduled scan in --config")
+	}
+	var spec models.Spec
+	if opts.Metrics {
+		if spec, err = awsLoadSpec(c); err != nil {
+			return err
+		}
+	}
+	scan, err := serveScanFunc(c)
+	if err != nil {
+		return err
+	}
+	var store *server.Store
+	if opts.API || len(schedules) > 0 {
+		if store, err = server.OpenStore(opts.StoreDir); err != nil {
+			return err
+		}
+	}
+	var scheduler *server.Scheduler
+	if len(schedules) > 0 {
+		var scheduled []server.ScheduledScan
+		for _, schedule := range schedules {
+			scheduled = append(scheduled, schedule.ScheduledScan)
+		}
+		notifier, err := notify.New(config.Notifications, os.Getenv)
+		if err != nil {
+			return err
+		}
+		if scheduler, err = server.NewScheduler(scheduled, scan, store, serveAfter(c, schedules, store, notifier)); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context(), os.Interrupt)
+	defer stop()
+	// The scans run with ctx so an interrupt stops the running scan too
+	c.SetContext(ctx)
+
+	var wg sync.WaitGroup
+	var srv *http.Server
+	var serveErr chan error
+	if opts.Metrics || opts.API {
+		mux := http.NewServeMux()
+		srv = &http.Server{Addr: opts.Listen, Handler: mux}
+		if opts.Metrics {
+			metrics := server.NewMetrics(opts.Keys)
+			mux.Handle("/metrics", metrics.Handler())
+			c.Printf("Serving the metrics on %s/metrics every %s\n", opts.Listen, opts.Interval)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				server.Every(ctx, opts.Interval, serveScan(c, scan, spec, metrics))
+			}()
+		}
+		if opts.API {
+			api := &server.API{Queue: server.NewQueue(opts.QueueSize, opts.APIRetain, scan, store), Store: store, Scans: scans, Scheduler: scheduler, AdHoc: opts.AllowSpecs}
+			mux.Handle("/api/", api.Handler())
+			c.Printf("Serving the API on %s/api/v1 with %d named scans\n", opts.Listen, len(scans))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				api.Queue.Run(ctx, opts.Workers)
+			}()
+		}
+		serveErr = make(chan error, 1)
+		go func() {
+			serveErr <- srv.ListenAndServe()
+		}()
+	}
+	if scheduler != nil {
+		for _, schedule := range schedules {
+			c.Printf("Scheduling the scan %s on %q\n", schedule.Name, schedule.Schedule)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.Run(ctx)
+		}()
+	}
+
+	select {
+	case err = <-serveErr:
+		stop()
+		wg.Wait()
+		return err
+	case <-ctx.Done():
+	}
+	wg.Wait()
+	if srv == nil {
+		return nil
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdown)
+}
+
+// serveFlags reads the flags of the serve command
+func serveFlags(c *cobra.Command) (opts serveOptions, err error) {
+	if opts.Listen, err = c.Flags().GetString("listen"); err != nil {
+		return opts, err
+	}
+	if opts.Interval, err = c.Flags().GetDuration("interval"); err != nil {
+		return opts, err
+	}
+	if opts.Metrics, err = c.Flags().GetBool("metrics"); err != nil {
+		return opts, err
+	}
+	if opts.Keys, err = c.Flags().GetStringSlice("keys"); err != nil {
+		return opts, err
+	}
+	if opts.API, err = c.Flags().GetBool("api"); err != nil {
+		return opts, err
+	}
+	if opts.Config, err = c.Flags().GetString("config"); err != nil {
+		return opts, err
+	}
+	if opts.StoreDir, err = c.Flags().GetString("store-dir"); err != nil {
+		return opts, err
+	}
+	if opts.QueueSize, err = c.Flags().GetInt("queue-size"); err != nil {
+		return opts, err
+	}
+	if opts.Workers, err = c.Flags().GetInt("workers"); err != nil {
+		return opts, err
+	}
+	if opts.AllowSpecs, err = c.Flags().GetBool("allow-specs"); err != nil {
+		return opts, err
+	}
+	if opts.APIRetain, err = c.Flags().GetInt("api-retain"); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// serveScan returns the periodic scan, its results replace the metrics
+func serveScan(c *cobra.Command, scan server.ScanFunc, spec models.Spec, metrics *server.Metrics) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		start := time.Now()
+		report, err := scan(ctx, spec)
+		metrics.Observe(report, time.Since(start), err)
+		if err != nil {
+			c.PrintErrf("Scan failed: %s\n", err)
+			return
+		}
+		if failed := len(report.Targets.Failed()); failed > 0 {
+			c.PrintErrf("Scan done, %d of %d targets failed\n", failed, len(report.Targets))
+		}
+	}
+}
+
+// serveScanFunc builds the scan of the API jobs and of the scheduled scans from the flags
+// The scans share the cache, the serve command has no state file, each scan is bounded by the timeout flag
+func serveScanFunc(c *cobra.Command) (server.ScanFunc, error) {
+	where, err := awsWhere(c)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := awsScanOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ComplianceDetails, err = c.Flags().GetBool("compliance-details"); err != nil {
+		return nil, err
+	}
+	if opts.Cache, opts.RefreshCache, err = awsCache(c); err != nil {
+		return nil, err
+	}
+	timeout, err := c.Flags().GetDuration("timeout")
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, spec models.Spec) (aws.Report, error) {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		report, err := awsScan(ctx, spec, opts)
+		if where != nil {
+			report.Results = query.Filter(report.Results, where)
+		}
+		return report, err
+	}, nil
+}
+
+// serveConfigPath returns path, or the root config file $HOME/.tagu.yaml when path is empty and the file exists
+func serveConfigPath(path string) string {
+	if path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	path = filepath.Join(home, ".tagu.yaml")
+	if _, err = os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// loadServeConfig reads the serve config file, an empty path is an empty config
+func loadServeConfig(path string) (config models.ServeConfig, err error) {
+	if path == "" {
+		return config, nil
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetConfigFile(path)
+	if err = v.ReadInConfig(); err != nil {
+		return config, fmt.Errorf("%s", err)
+	}
+	if err = v.Unmarshal(&config); err != nil {
+		return config, fmt.Errorf("invalid serve config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// loadScans loads the spec of every named scan, the relative input
+// files are read from the directory of the config file
+func loadScans(configPath string, config models.ServeConfig) (map[string]models.Spec, error) {
+	scans := map[string]models.Spec{}
+	for i, scan := range config.Scans {
+		if scan.Name == "" || scan.InputFile == "" {
+			return nil, fmt.Errorf("invalid serve config %s: scan %d needs a name and an input-file", configPath, i+1)
+		}
+		if _, ok := scans[scan.Name]; ok {
+			return nil, fmt.Errorf("invalid serve config %s: duplicate scan %q", configPath, scan.Name)
+		}
+		spec, err := loadSpecFile(configRelative(configPath, scan.InputFile))
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", scan.Name, err)
+		}
+		scans[scan.Name] = spec
+	}
+	return scans, nil
+}
+
+// serveSchedule is a scheduled scan of the serve config and its outputs
+type serveSchedule struct {
+	server.ScheduledScan
+	InputFile string
+	Outputs   []awsOutputOptions
+}
+
+// serveSchedules builds the scheduled scans of the config, the relative output
+// files are written to the directory of the config file
+func serveSchedules(configPath string, config models.ServeConfig, specs map[string]models.Spec) ([]serveSchedule, error) {
+	var schedules []serveSchedule
+	for _, scan := range config.Scans {
+		if scan.Schedule == "" {
+			if scan.Retain != 0 || len(scan.Outputs) > 0 {
+				return nil, fmt.Errorf("scan %s: retain and outputs require a schedule", scan.Name)
+			}
+			continue
+		}
+		if _, err := server.ParseSchedule(scan.Schedule); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", scan.Name, err)
+		}
+		if scan.Retain < 0 {
+			return nil, fmt.Errorf("scan %s: retain must not be negative", scan.Name)
+		}
+		schedule := serveSchedule{
+			ScheduledScan: server.ScheduledScan{Name: scan.Name, Schedule: scan.Schedule, Spec: specs[scan.Name], Retain: scan.Retain},
+			InputFile:     configRelative(configPath, scan.InputFile),
+		}
+		for i, o := range scan.Outputs {
+			output := awsOutputOptions{Format: o.Format, File: o.File, Pivot: o.Pivot || len(o.Columns) > 0, Columns: o.Columns, Partition: o.Partition}
+			if output.Format == "table" || output.File == "" {
+				return nil, fmt.Errorf("scan %s: output %d requires a file and the csv, xlsx, sqlite or parquet format", scan.Name, i+1)
+			}
+			if err := checkOutput(output); err != nil {
+				return nil, fmt.Errorf("scan %s: output %d: %w", scan.Name, i+1, err)
+			}
+			output.File = configRelative(configPath, output.File)
+			schedule.Outputs = append(schedule.Outputs, output)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+// configRelative returns path relative to the directory of the config file unless it is absolute
+func configRelative(configPath, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(configPath), path)
+}
+
+// scheduleFile replaces the {scan} and {time} placeholders of an output file
+func scheduleFile(file, scan string, started time.Time) string {
+	return strings.NewReplacer("{scan}", scan, "{time}", started.UTC().Format("20060102T150405Z")).Replace(file)
+}
+
+// serveAfter returns the end of the scheduled runs, it writes the outputs of the
+// stored snapshots, sends the notifications and prints the outcome of the run
+func serveAfter(c *cobra.Command, schedules []serveSchedule, store *server.Store, notifier *notify.Notifier) server.AfterFunc {
+	byName := map[string]serveSchedule{}
+	for _, schedule := range schedules {
+		byName[schedule.Name] = schedule
+	}
+	// The outputs are written one run at a time so their messages do not interleave
+	var mu sync.Mutex
+	return func(scan server.ScheduledScan, run server.ScheduleRun, snapshot *server.Snapshot, report aws.Report) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if snapshot == nil {
+			c.PrintErrf("Scheduled scan %s failed: %s\n", scan.Name, run.Error)
+			return nil
+		}
+		schedule := byName[scan.Name]
+		meta := export.Metadata{Started: run.Started, Finished: run.Finished, InputFile: schedule.InputFile}
+		for _, output := range schedule.Outputs {
+			output.File = scheduleFile(output.File, scan.Name, run.Started)
+			if err := writeReport(c, output, report, meta); err != nil {
+				c.PrintErrf("Scheduled scan %s failed to write %s: %s\n", scan.Name, output.File, err)
+				return fmt.Errorf("output %s: %w", output.File, err)
+			}
+		}
+		if run.Error != "" {
+			c.PrintErrf("Scheduled scan %s failed: %s\n", scan.Name, run.Error)
+			return nil
+		}
+		c.Printf("Scheduled scan %s stored the snapshot %s, %d of %d targets failed\n", scan.Name, snapshot.ID, run.FailedTargets, len(report.Targets))
+		if notifier != nil {
+			serveNotify(c, notifier, store, snapshot, report, run.Finished)
+		}
+		return nil
+	}
+}
+
+// serveNotify sends the policy violations of the run and the tags changed since the
+// previous snapshot of the scan, a notification failure does not fail the run
+func serveNotify(c *cobra.Command, notifier *notify.Notifier, store *server.Store, snapshot *server.Snapshot, report aws.Report, now time.Time) {
+	findings := notify.Violations(report.Results)
+	if previous, err := store.Previous(snapshot.ID); err == nil {
+		findings = append(findings, notify.Drift(server.Diff(previous, snapshot))...)
+	}
+	msg := notify.Message{Scan: snapshot.Scan, Time: now, Snapshot: snapshot.ID, Findings: findings, Failed: snapshot.Targets.Failed()}
+	notified, err := notifier.Notify(c.Context(), msg)
+	if len(notified) > 0 {
+		c.Printf("Scheduled scan %s notified %s\n", snapshot.Scan, strings.Join(notified, ", "))
+	}
+	if err != nil {
+		c.PrintErrf("Scheduled scan %s failed to %s\n", snapshot.Scan, err)
+	}
+}
+
+func initServeFlags(c *cobra.Command) {
+	c.Flags().String("listen", "localhost:9090", "the address of the HTTP server, it has no authentication")
+	c.Flags().Duration("interval", 15*time.Minute, "the delay between two scans")
+	c.Flags().Bool("metrics", false, "serve the tagging health metrics on /metrics")
+	c.Flags().StringSlice("keys", nil, "the keys of the coverage ratio (default every collected key)")
+	c.Flags().Bool("api", false, "serve the scans, jobs and snapshots API on /api/v1")
+	c.Flags().StringP("config", "c", "", "the config file holding the named and scheduled scans (default is $HOME/.tagu.yaml when it exists)")
+	c.Flags().String("store-dir", filepath.Join(aws.DefaultCacheDir(), "snapshots"), "the directory of the API snapshots")
+	c.Flags().Int("queue-size", 10, "the maximum number of API scans waiting for a worker")
+	c.Flags().Int("workers", 1, "the number of API scans running in parallel")
+	c.Flags().Int("api-retain", 10, "the number of API snapshots kept per named scan and for the ad-hoc specs, 0 keeps every snapshot")
+	c.Flags().Bool("allow-specs", false, "accept the ad-hoc specs of the API scans, their roles are assumed with the server credentials")
+	initProviderScanFlags(c.Flags())
+	initAwsClientFlags(c.Flags())
+	initAwsRepeatedScanFlags(c)
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	initServeFlags(serveCmd)
+}
@@ -0,0 +1,454 @@
+/*
+Copyright © 2022 Wissem BEN CHAABANE<benchaaben.wissem@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"tagu/aws"
+	"tagu/models"
+	"tagu/notify"
+	"tagu/server"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// freeAddress returns a local address with a free port
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestServeCmdSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	address := freeAddress(t)
+
+	// The first scan reads the metrics of the running server then stops it
+	var metrics string
+	ctx, cancel := context.WithCancel(context.TODO())
+	awsScan = func(ctx context.Context, spec models.Spec, opts aws.ScanOptions) (aws.Report, error) {
+		defer cancel()
+		for i := 0; i < 50; i++ {
+			resp, err := http.Get("http://" + address + "/metrics")
+			if err != nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			metrics = string(body)
+			break
+		}
+		return mockAwsScan(ctx, spec, opts)
+	}
+	defer func() { awsScan = aws.Scan }()
+
+	fixtures := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Test serve the metrics",
+			args:     []string{"--metrics", "--listen", address, "-i", absConfig + "/examples/aws-tags.yaml", "--no-cache"},
+			expected: "Load configuration file " + absConfig + "/examples/aws-tags.yaml\nServing the metrics on " + address + "/metrics every 15m0s",
+		},
+		{
+			name: "Test serve nothing",
+			args: []string{"-i", absConfig + "/examples/aws-tags.yaml"},
+			err:  "nothing to serve, set --metrics, --api or a scheduled scan in --config",
+		},
+		{
+			name: "Test serve invalid interval",
+			args: []string{"--metrics", "--interval", "0s"},
+			err:  "--interval must be positive",
+		},
+		{
+			name: "Test serve invalid workers",
+			args: []string{"--api", "--workers", "0"},
+			err:  "--queue-size and --workers must be positive",
+		},
+		{
+			name: "Test serve missing config",
+			args: []string{"--api", "--config", absConfig + "/examples/missing.yaml"},
+			err:  "open " + absConfig + "/examples/missing.yaml: no such file or directory",
+		},
+		{
+			name: "Test serve notifications without schedule",
+			args: []string{"--api", "--config", absConfig + "/examples/notify.yaml"},
+			err:  "the notifications require a scheduled scan in --config",
+		},
+		{
+			name: "Test serve rejects the state file",
+			args: []string{"--metrics", "-i", absConfig + "/examples/aws-tags.yaml", "--resume", "state.jsonl"},
+			err:  "unknown flag: --resume",
+		},
+		{
+			name: "Test serve has no exit code to fail",
+			args: []string{"--metrics", "-i", absConfig + "/examples/aws-tags.yaml", "--fail-on", "none"},
+			err:  "unknown flag: --fail-on",
+		},
+		{
+			name: "Test serve invalid where",
+			args: []string{"--metrics", "-i", absConfig + "/examples/aws-tags.yaml", "--where", "env"},
+			err:  `invalid --where: invalid expression at 0: unknown field "env", expected account, region, service, resource, arn, type or tags.<key>`,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			serve := &cobra.Command{Use: "serve", RunE: serveCmdRunE, SilenceUsage: true}
+			initServeFlags(serve)
+			serve.SetContext(ctx)
+
+			defer viper.Reset()
+			res, err := execute(t, serve, fixture.args...)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.expected, res)
+		})
+	}
+	assert.True(strings.Contains(metrics, "tagu_scan_duration_seconds"), metrics)
+}
+
+func TestServeAPISuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	address := freeAddress(t)
+	awsScan = mockAwsScan
+	defer func() { awsScan = aws.Scan }()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	serve := &cobra.Command{Use: "serve", RunE: serveCmdRunE, SilenceUsage: true}
+	initServeFlags(serve)
+	serve.SetContext(ctx)
+	done := make(chan error, 1)
+	go func() {
+		_, err := execute(t, serve, "--api", "--listen", address, "--config", absConfig+"/examples/serve.yaml", "--store-dir", t.TempDir(), "--no-cache")
+		done <- err
+	}()
+
+	// decode sends the request and decodes the response body
+	decode := func(method, path, body string, v interface{}) int {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			var request *http.Request
+			request, err = http.NewRequest(method, "http://"+address+path, strings.NewReader(body))
+			assert.NoError(err)
+			if resp, err = http.DefaultClient.Do(request); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !assert.NoError(err) {
+			return 0
+		}
+		defer resp.Body.Close()
+		assert.NoError(json.NewDecoder(resp.Body).Decode(v))
+		return resp.StatusCode
+	}
+
+	var failed server.ErrorResponse
+	assert.Equal(http.StatusNotFound, decode(http.MethodPost, "/api/v1/scans", `{"scan": "unknown"}`, &failed))
+	assert.Equal(`unknown scan "unknown"`, failed.Error)
+
+	var job server.Job
+	assert.Equal(http.StatusAccepted, decode(http.MethodPost, "/api/v1/scans", `{"scan": "tags"}`, &job))
+	for i := 0; i < 50 && job.Status != server.JobDone; i++ {
+		time.Sleep(10 * time.Millisecond)
+		decode(http.MethodGet, "/api/v1/jobs/"+job.ID, "", &job)
+	}
+	assert.Equal(server.JobDone, job.Status)
+	assert.Equal("tags", job.Scan)
+
+	var page server.ResultsPage
+	assert.Equal(http.StatusOK, decode(http.MethodGet, "/api/v1/snapshots/"+job.Snapshot+"/results?key=env", "", &page))
+	assert.Equal(1, page.Total)
+	assert.Equal("i-12345678", strings.TrimPrefix(page.Results[0].Resource, "instance/"))
+
+	cancel()
+	assert.NoError(<-done)
+}
+
+func TestLoadScansSuite(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	fixtures := []struct {
+		name     string
+		config   string
+		expected []string
+		err      string
+	}{
+		{
+			name:     "Test load the named scans",
+			config:   absConfig + "/examples/serve.yaml",
+			expected: []string{"general", "tags"},
+		},
+		{
+			name:   "Test load a scan without input file",
+			config: write("no-input.yaml", "scans:\n  - name: prod\n"),
+			err:    "invalid serve config " + dir + "/no-input.yaml: scan 1 needs a name and an input-file",
+		},
+		{
+			name:   "Test load a duplicate scan",
+			config: write("duplicate.yaml", "scans:\n  - name: prod\n    input-file: "+absConfig+"/examples/aws-tags.yaml\n  - name: prod\n    input-file: other.yaml\n"),
+			err:    "invalid serve config " + dir + `/duplicate.yaml: duplicate scan "prod"`,
+		},
+		{
+			name:   "Test load a missing input file",
+			config: write("missing.yaml", "scans:\n  - name: prod\n    input-file: prod.yaml\n"),
+			err:    "scan prod: open " + dir + "/prod.yaml: no such file or directory",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			config, err := loadServeConfig(fixture.config)
+			assert.NoError(err)
+			scans, err := loadScans(fixture.config, config)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			var names []string
+			for name, spec := range scans {
+				names = append(names, name)
+				assert.NotEmpty(spec.FilterInput)
+			}
+			sort.Strings(names)
+			assert.Equal(fixture.expected, names)
+		})
+	}
+}
+
+func TestServeSchedulesSuite(t *testing.T) {
+	assert := assert.New(t)
+	specs := map[string]models.Spec{"prod": {RoleName: "reader"}}
+	scan := func(schedule string, retain int, outputs ...models.OutputDefinition) models.ServeConfig {
+		return models.ServeConfig{Scans: []models.ScanDefinition{{Name: "prod", InputFile: "prod.yaml", Schedule: schedule, Retain: retain, Outputs: outputs}}}
+	}
+
+	fixtures := []struct {
+		name     string
+		config   models.ServeConfig
+		expected []serveSchedule
+		err      string
+	}{
+		{
+			name:   "Test schedules without schedule",
+			config: scan("", 0),
+		},
+		{
+			name:   "Test schedules with outputs and without schedule",
+			config: scan("", 3),
+			err:    "scan prod: retain and outputs require a schedule",
+		},
+		{
+			name:   "Test schedules with outputs",
+			config: scan("@daily", 3, models.OutputDefinition{Format: "sqlite", File: "prod.sqlite"}, models.OutputDefinition{Format: "csv", File: "/reports/{scan}-{time}.csv", Columns: []string{"env"}}),
+			expected: []serveSchedule{
+				{
+					ScheduledScan: server.ScheduledScan{Name: "prod", Schedule: "@daily", Spec: models.Spec{RoleName: "reader"}, Retain: 3},
+					InputFile:     "/etc/tagu/prod.yaml",
+					Outputs: []awsOutputOptions{
+						{Format: "sqlite", File: "/etc/tagu/prod.sqlite"},
+						{Format: "csv", File: "/reports/{scan}-{time}.csv", Pivot: true, Columns: []string{"env"}},
+					},
+				},
+			},
+		},
+		{
+			name:   "Test schedules invalid schedule",
+			config: scan("daily", 0),
+			err:    `scan prod: invalid schedule "daily": expected exactly 5 fields, found 1: [daily]`,
+		},
+		{
+			name:   "Test schedules negative retain",
+			config: scan("@daily", -1),
+			err:    "scan prod: retain must not be negative",
+		},
+		{
+			name:   "Test schedules output without file",
+			config: scan("@daily", 0, models.OutputDefinition{Format: "csv"}),
+			err:    "scan prod: output 1 requires a file and the csv, xlsx, sqlite or parquet format",
+		},
+		{
+			name:   "Test schedules invalid output",
+			config: scan("@daily", 0, models.OutputDefinition{Format: "json", File: "prod.json"}),
+			err:    `scan prod: output 1: invalid output "json", expected table, csv, xlsx, sqlite, parquet`,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			schedules, err := serveSchedules("/etc/tagu/tagu.yaml", fixture.config, specs)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.expected, schedules)
+		})
+	}
+}
+
+func TestScheduleFile(t *testing.T) {
+	started := time.Date(2022, 9, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	assert.Equal(t, "reports/prod-20220901T080000Z.csv", scheduleFile("reports/{scan}-{time}.csv", "prod", started))
+}
+
+func TestServeAfter(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	started := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	report, _ := mockAwsScan(context.TODO(), models.Spec{}, aws.ScanOptions{})
+	schedules := []serveSchedule{{
+		ScheduledScan: server.ScheduledScan{Name: "prod"},
+		Outputs:       []awsOutputOptions{{Format: "csv", File: filepath.Join(dir, "{scan}-{time}.csv")}},
+	}}
+	c := &cobra.Command{}
+	out := &strings.Builder{}
+	c.SetOut(out)
+	c.SetErr(out)
+	after := serveAfter(c, schedules, nil, nil)
+
+	snapshot := server.NewSnapshot("prod", server.SourceSchedule, started, started, report)
+	run := server.ScheduleRun{Started: started, Finished: started, Status: server.JobDone, Snapshot: snapshot.ID}
+	assert.NoError(after(schedules[0].ScheduledScan, run, &snapshot, report))
+	data, err := os.ReadFile(filepath.Join(dir, "prod-20220901T100000Z.csv"))
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(string(data), "account,region,service,resource,key,value\n"), string(data))
+	assert.True(strings.HasSuffix(out.String(), "Scheduled scan prod stored the snapshot "+snapshot.ID+", 0 of 1 targets failed\n"), out.String())
+
+	out.Reset()
+	run = server.ScheduleRun{Started: started, Finished: started, Status: server.JobFailed, Error: "scan failed"}
+	assert.NoError(after(schedules[0].ScheduledScan, run, nil, aws.Report{}))
+	assert.Equal("Scheduled scan prod failed: scan failed\n", out.String())
+
+	schedules[0].Outputs[0].File = filepath.Join(dir, "missing", "prod.csv")
+	after = serveAfter(c, schedules, nil, nil)
+	err = after(schedules[0].ScheduledScan, server.ScheduleRun{Started: started}, &snapshot, report)
+	assert.EqualError(err, "output "+filepath.Join(dir, "missing", "prod.csv")+": open "+filepath.Join(dir, "missing", "prod.csv")+": no such file or directory")
+}
+
+func TestServeScheduled(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	dir := t.TempDir()
+	config := filepath.Join(dir, "tagu.yaml")
+	assert.NoError(os.WriteFile(config, []byte("scans:\n  - name: prod\n    input-file: "+absConfig+"/examples/aws-tags.yaml\n    schedule: \"@daily\"\n"), 0o644))
+
+	// The canceled context stops the scheduler at once
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	serve := &cobra.Command{Use: "serve", RunE: serveCmdRunE, SilenceUsage: true}
+	initServeFlags(serve)
+	serve.SetContext(ctx)
+	res, err := execute(t, serve, "--config", config, "--store-dir", filepath.Join(dir, "snapshots"))
+	assert.NoError(err)
+	assert.Equal(`Scheduling the scan prod on "@daily"`, res)
+}
+
+func TestServeNotify(t *testing.T) {
+	assert := assert.New(t)
+	var payloads []notify.WebhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload notify.WebhookPayload
+		assert.NoError(json.NewDecoder(r.Body).Decode(&payload))
+		payloads = append(payloads, payload)
+	}))
+	defer srv.Close()
+	notifier, err := notify.New(models.NotificationsConfig{Sinks: []models.SinkConfig{{Name: "hook", Type: "webhook", URL: srv.URL}}}, os.Getenv)
+	assert.NoError(err)
+
+	started := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	store, _ := server.OpenStore("")
+	report := func(value string, compliant bool) aws.Report {
+		return aws.Report{Results: []aws.RessourceTagResult{{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: value,
+			Compliant: &compliant, NoncompliantKeys: []string{"owner"}}}}
+	}
+	schedules := []serveSchedule{{ScheduledScan: server.ScheduledScan{Name: "prod"}}}
+	c := &cobra.Command{}
+	out := &strings.Builder{}
+	c.SetOut(out)
+	c.SetErr(out)
+	c.SetContext(context.TODO())
+	after := serveAfter(c, schedules, store, notifier)
+
+	// The first run notifies the violation, the second the drift only
+	for i, r := range []aws.Report{report("prod", false), report("dev", false)} {
+		snapshot := server.NewSnapshot("prod", server.SourceSchedule, started.Add(time.Duration(i)*time.Hour), started, r)
+		assert.NoError(store.Put(snapshot))
+		run := server.ScheduleRun{Started: snapshot.Started, Finished: snapshot.Started, Status: server.JobDone, Snapshot: snapshot.ID}
+		assert.NoError(after(schedules[0].ScheduledScan, run, &snapshot, r))
+	}
+
+	assert.Len(payloads, 2)
+	assert.Equal([]notify.Finding{{Kind: notify.KindViolation, ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", NoncompliantKeys: []string{"owner"}}}, payloads[0].Findings)
+	assert.Len(payloads[1].Findings, 1)
+	assert.Equal(notify.KindDrift, payloads[1].Findings[0].Kind)
+	assert.Equal("tagu scan prod: 0 new policy violations, 1 tag changes\n- arn:aws:ec2:us-east-1:1:instance/i-1 env changed from prod to dev\n", payloads[1].Text)
+	assert.Contains(out.String(), "Scheduled scan prod notified hook\n")
+}
+
+func TestLoadServeConfigNotifications(t *testing.T) {
+	assert := assert.New(t)
+	absConfig, _ := filepath.Abs("../")
+	config, err := loadServeConfig(absConfig + "/examples/notify.yaml")
+	assert.NoError(err)
+	assert.Equal(168*time.Hour, config.Notifications.ResendAfter)
+	assert.Equal("tagu-notifications.json", config.Notifications.StateFile)
+	assert.Len(config.Notifications.Sinks, 2)
+	assert.Equal([]string{"violation"}, config.Notifications.Sinks[0].Events)
+	assert.Equal("{{len .Drift}} tags changed in the scan {{.Scan}}", config.Notifications.Sinks[1].Template)
+}
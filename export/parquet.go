@@ -0,0 +1,167 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"tagu/aws"
+)
+
+// HiveDefaultPartition is the partition directory value of an empty account or region,
+// the S3 buckets and the EBS snapshots have no account or region in their ARN
+const HiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// ParquetRow is a resource of a scan in the Parquet files, one row per resource
+//
+//	scan_time  INT64 TIMESTAMP_MILLIS  the start of the scan, UTC
+//	account    UTF8                    not written in the partitioned layout
+//	region     UTF8                    not written in the partitioned layout
+//	service    UTF8                    ec2
+//	resource   UTF8                    instance/i-12345678
+//	arn        UTF8
+//	compliant  BOOLEAN OPTIONAL        only set with the compliance details
+//	tags       MAP<UTF8, UTF8>         the tags of the resource
+type ParquetRow struct {
+	ScanTime  int64             `parquet:"name=scan_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Account   string            `parquet:"name=account, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Region    string            `parquet:"name=region, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Service   string            `parquet:"name=service, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Resource  string            `parquet:"name=resource, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ARN       string            `parquet:"name=arn, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Compliant *bool             `parquet:"name=compliant, type=BOOLEAN, repetitiontype=OPTIONAL"`
+	Tags      map[string]string `parquet:"name=tags, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+// ParquetPartitionRow is a ParquetRow of the partitioned layout, the account and
+// the region are read from the account=/region=/ directories
+type ParquetPartitionRow struct {
+	ScanTime  int64             `parquet:"name=scan_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Service   string            `parquet:"name=service, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Resource  string            `parquet:"name=resource, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ARN       string            `parquet:"name=arn, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Compliant *bool             `parquet:"name=compliant, type=BOOLEAN, repetitiontype=OPTIONAL"`
+	Tags      map[string]string `parquet:"name=tags, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+// ParquetRows groups the results by resource in the results order
+func ParquetRows(results []aws.RessourceTagResult, scanTime time.Time) []ParquetRow {
+	var rows []ParquetRow
+	positions := map[string]int{}
+	for _, r := range results {
+		arn := r.ARN()
+		idx, ok := positions[arn]
+		if !ok {
+			idx = len(rows)
+			positions[arn] = idx
+			rows = append(rows, ParquetRow{
+				ScanTime:  scanTime.UnixNano() / int64(time.Millisecond),
+				Account:   r.Account,
+				Region:    r.Region,
+				Service:   r.Service,
+				Resource:  r.Resource,
+				ARN:       arn,
+				Compliant: r.Compliant,
+				Tags:      map[string]string{},
+			})
+		}
+		if !r.Untagged() {
+			rows[idx].Tags[r.Key] = r.Value
+		}
+	}
+	return rows
+}
+
+// WriteParquet writes the resources of the report as Snappy compressed Parquet.
+// The partitioned layout writes a file per account and region under
+// path/account=<account>/region=<region>/, named after the scan start so the
+// successive scans are added next to each other. An empty account or region is
+// written to the HiveDefaultPartition directory
+// Args:
+// 		path: string, the file, or the root directory of the partitioned layout
+// 		report: aws.Report
+// 		meta: Metadata, the scan_time column is the start of the scan
+// 		partitioned: bool
+// Returns:
+// 		[]string: the written files
+// 		error: if a file can not be written
+func WriteParquet(path string, report aws.Report, meta Metadata, partitioned bool) ([]string, error) {
+	rows := ParquetRows(report.Results, meta.Started)
+	if !partitioned {
+		records := make([]interface{}, len(rows))
+		for i := range rows {
+			records[i] = rows[i]
+		}
+		return []string{path}, writeParquetFile(path, new(ParquetRow), records)
+	}
+
+	partitions := map[string][]interface{}{}
+	for _, row := range rows {
+		dir := filepath.Join(path, "account="+partitionValue(row.Account), "region="+partitionValue(row.Region))
+		partitions[dir] = append(partitions[dir], ParquetPartitionRow{
+			ScanTime:  row.ScanTime,
+			Service:   row.Service,
+			Resource:  row.Resource,
+			ARN:       row.ARN,
+			Compliant: row.Compliant,
+			Tags:      row.Tags,
+		})
+	}
+	var dirs []string
+	for dir := range partitions {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var files []string
+	name := fmt.Sprintf("tags-%s.parquet", meta.Started.UTC().Format("20060102T150405Z"))
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return files, err
+		}
+		file := filepath.Join(dir, name)
+		if err := writeParquetFile(file, new(ParquetPartitionRow), partitions[dir]); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// partitionValue returns the partition directory value, HiveDefaultPartition when empty
+func partitionValue(value string) string {
+	if value == "" {
+		return HiveDefaultPartition
+	}
+	return value
+}
+
+// writeParquetFile writes the records, schema is a pointer to the record type
+func writeParquetFile(path string, schema interface{}, records []interface{}) (err error) {
+	file, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	pw, err := writer.NewParquetWriter(file, schema, 1)
+	if err != nil {
+		return err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	for _, record := range records {
+		if err = pw.Write(record); err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
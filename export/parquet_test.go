@@ -0,0 +1,93 @@
+package export
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"tagu/aws"
+)
+
+var parquetReport = aws.Report{Results: []aws.RessourceTagResult{
+	{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"},
+	{Account: "2", Region: "eu-west-1", Service: "s3", Resource: "logs", Key: "env", Value: "dev", Compliant: awssdk.Bool(false)},
+	{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "owner", Value: "web"},
+}}
+
+var parquetStarted = time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+
+// readParquet reads every row of the file in rows, a pointer to a slice of the schema
+func readParquet(t *testing.T, path string, schema interface{}, rows interface{}) {
+	t.Helper()
+	file, err := local.NewLocalFileReader(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	pr, err := reader.NewParquetReader(file, schema, 1)
+	assert.NoError(t, err)
+	defer pr.ReadStop()
+	assert.NoError(t, pr.Read(rows))
+}
+
+func TestParquetRowsSuite(t *testing.T) {
+	assert := assert.New(t)
+	rows := ParquetRows(parquetReport.Results, parquetStarted)
+	assert.Equal([]ParquetRow{
+		{ScanTime: 1656669600000, Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Tags: map[string]string{"env": "prod", "owner": "web"}},
+		{ScanTime: 1656669600000, Account: "2", Region: "eu-west-1", Service: "s3", Resource: "logs", ARN: "arn:aws:s3:eu-west-1:2:logs", Compliant: awssdk.Bool(false), Tags: map[string]string{"env": "dev"}},
+	}, rows)
+}
+
+func TestWriteParquetSuite(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	meta := Metadata{Started: parquetStarted}
+
+	t.Run("Test single file", func(t *testing.T) {
+		path := filepath.Join(dir, "tags.parquet")
+		files, err := WriteParquet(path, parquetReport, meta, false)
+		assert.NoError(err)
+		assert.Equal([]string{path}, files)
+
+		rows := make([]ParquetRow, 2)
+		readParquet(t, path, new(ParquetRow), &rows)
+		assert.Equal(ParquetRows(parquetReport.Results, parquetStarted), rows)
+	})
+
+	t.Run("Test partitioned layout", func(t *testing.T) {
+		root := filepath.Join(dir, "lake")
+		files, err := WriteParquet(root, parquetReport, meta, true)
+		assert.NoError(err)
+		assert.Equal([]string{
+			filepath.Join(root, "account=1", "region=us-east-1", "tags-20220701T100000Z.parquet"),
+			filepath.Join(root, "account=2", "region=eu-west-1", "tags-20220701T100000Z.parquet"),
+		}, files)
+
+		rows := make([]ParquetPartitionRow, 1)
+		readParquet(t, files[1], new(ParquetPartitionRow), &rows)
+		assert.Equal([]ParquetPartitionRow{
+			{ScanTime: 1656669600000, Service: "s3", Resource: "logs", ARN: "arn:aws:s3:eu-west-1:2:logs", Compliant: awssdk.Bool(false), Tags: map[string]string{"env": "dev"}},
+		}, rows)
+	})
+
+	t.Run("Test global resources partition", func(t *testing.T) {
+		root := filepath.Join(dir, "global")
+		report := aws.Report{Results: []aws.RessourceTagResult{
+			{Service: "s3", Resource: "logs", Key: "env", Value: "dev", ResourceARN: "arn:aws:s3:::logs"},
+		}}
+		files, err := WriteParquet(root, report, meta, true)
+		assert.NoError(err)
+		assert.Equal([]string{
+			filepath.Join(root, "account=__HIVE_DEFAULT_PARTITION__", "region=__HIVE_DEFAULT_PARTITION__", "tags-20220701T100000Z.parquet"),
+		}, files)
+	})
+
+	t.Run("Test invalid path", func(t *testing.T) {
+		_, err := WriteParquet(filepath.Join(dir, "missing", "tags.parquet"), parquetReport, meta, false)
+		assert.Error(err)
+	})
+}
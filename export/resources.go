@@ -0,0 +1,61 @@
+package export
+
+import (
+	"sort"
+
+	"tagu/provider"
+)
+
+// ProviderColumns are the columns identifying a provider neutral resource, before the tag columns
+var ProviderColumns = []string{"provider", "scope", "location", "type", "id"}
+
+func providerRow(r provider.Resource) []string {
+	return []string{r.Provider, r.Scope, r.Location, r.Type, r.ID}
+}
+
+// ResourceFlatTable lays the resources out with one row per tag, the tags of
+// a resource are sorted by key
+// Args:
+// 		resources: []provider.Resource
+// Returns:
+// 		Table: the provider columns followed by the key and the value
+func ResourceFlatTable(resources []provider.Resource) Table {
+	table := Table{Header: append(append([]string{}, ProviderColumns...), "key", "value")}
+	for _, r := range resources {
+		for _, key := range r.Keys() {
+			table.Rows = append(table.Rows, append(providerRow(r), key, r.Tags[key]))
+		}
+	}
+	return table
+}
+
+// ResourcePivotTable lays the resources out with one row per resource and one column per tag key.
+// The key columns are sorted unless selected, a missing tag is an empty cell
+// Args:
+// 		resources: []provider.Resource
+// 		keys: []string, the key columns in this order, every collected key when empty
+// Returns:
+// 		Table: the provider columns followed by the key columns
+func ResourcePivotTable(resources []provider.Resource, keys []string) Table {
+	if len(keys) == 0 {
+		seen := map[string]bool{}
+		for _, r := range resources {
+			for key := range r.Tags {
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+		}
+		sort.Strings(keys)
+	}
+	table := Table{Header: append(append([]string{}, ProviderColumns...), keys...)}
+	for _, r := range resources {
+		row := providerRow(r)
+		for _, key := range keys {
+			row = append(row, r.Tags[key])
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
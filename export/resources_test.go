@@ -0,0 +1,64 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/provider"
+)
+
+var providerResources = []provider.Resource{
+	{Provider: "aws", Scope: "1", Location: "us-east-1", Type: "ec2:instance", ID: "arn:aws:ec2:us-east-1:1:instance/i-1", Tags: map[string]string{"owner": "web", "env": "prod"}},
+	{Provider: "aws", Scope: "1", Location: "", Type: "s3", ID: "arn:aws:s3:::logs", Tags: map[string]string{"env": "dev"}},
+}
+
+func TestResourceFlatTableSuite(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(Table{
+		Header: []string{"provider", "scope", "location", "type", "id", "key", "value"},
+		Rows: [][]string{
+			{"aws", "1", "us-east-1", "ec2:instance", "arn:aws:ec2:us-east-1:1:instance/i-1", "env", "prod"},
+			{"aws", "1", "us-east-1", "ec2:instance", "arn:aws:ec2:us-east-1:1:instance/i-1", "owner", "web"},
+			{"aws", "1", "", "s3", "arn:aws:s3:::logs", "env", "dev"},
+		},
+	}, ResourceFlatTable(providerResources))
+}
+
+func TestResourcePivotTableSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		keys     []string
+		expected Table
+	}{
+		{
+			name: "Test every key in sorted columns",
+			expected: Table{
+				Header: []string{"provider", "scope", "location", "type", "id", "env", "owner"},
+				Rows: [][]string{
+					{"aws", "1", "us-east-1", "ec2:instance", "arn:aws:ec2:us-east-1:1:instance/i-1", "prod", "web"},
+					{"aws", "1", "", "s3", "arn:aws:s3:::logs", "dev", ""},
+				},
+			},
+		},
+		{
+			name: "Test selected columns keep their order",
+			keys: []string{"owner", "team"},
+			expected: Table{
+				Header: []string{"provider", "scope", "location", "type", "id", "owner", "team"},
+				Rows: [][]string{
+					{"aws", "1", "us-east-1", "ec2:instance", "arn:aws:ec2:us-east-1:1:instance/i-1", "web", ""},
+					{"aws", "1", "", "s3", "arn:aws:s3:::logs", "", ""},
+				},
+			},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, ResourcePivotTable(providerResources, fixture.keys))
+		})
+	}
+}
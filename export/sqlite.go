@@ -0,0 +1,169 @@
+package export
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"tagu/aws"
+
+	// Registers the sqlite database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+// Metadata describes the run that produced a report
+type Metadata struct {
+	Started   time.Time
+	Finished  time.Time
+	InputFile string
+}
+
+// sqliteSchema creates the tables on the first export, the next exports append to them
+// A resource belongs to a scan, the same ARN is found once per scan
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS scans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at TEXT NOT NULL,
+		finished_at TEXT NOT NULL,
+		input_file TEXT NOT NULL,
+		targets INTEGER NOT NULL,
+		failed_targets INTEGER NOT NULL,
+		resources INTEGER NOT NULL,
+		tags INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS resources (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scan_id INTEGER NOT NULL REFERENCES scans(id),
+		arn TEXT NOT NULL,
+		account TEXT NOT NULL,
+		region TEXT NOT NULL,
+		service TEXT NOT NULL,
+		resource TEXT NOT NULL,
+		compliant INTEGER,
+		noncompliant_keys TEXT,
+		UNIQUE (scan_id, arn)
+	)`,
+	`CREATE TABLE IF NOT EXISTS tags (
+		resource_id INTEGER NOT NULL REFERENCES resources(id),
+		scan_id INTEGER NOT NULL REFERENCES scans(id),
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (resource_id, key)
+	)`,
+	`CREATE TABLE IF NOT EXISTS errors (
+		scan_id INTEGER NOT NULL REFERENCES scans(id),
+		account TEXT NOT NULL,
+		region TEXT NOT NULL,
+		status TEXT NOT NULL,
+		cause TEXT NOT NULL,
+		message TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS tags_key ON tags (scan_id, key, value)`,
+	`CREATE VIEW IF NOT EXISTS tag_rows AS
+		SELECT r.scan_id, r.arn, r.account, r.region, r.service, r.resource, t.key, t.value
+		FROM resources r JOIN tags t ON t.resource_id = r.id`,
+}
+
+// WriteSQLite appends the report to the SQLite database at path, the database is
+// created when missing. The scan is written in a single transaction, a failed export
+// leaves the previous scans untouched
+// Args:
+// 		path: string
+// 		report: aws.Report
+// 		meta: Metadata
+// Returns:
+// 		int64: the id of the scan in the scans table
+// 		error: if the database can not be opened or written
+func WriteSQLite(path string, report aws.Report, meta Metadata) (scanID int64, err error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	for _, statement := range sqliteSchema {
+		if _, err = db.Exec(statement); err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	resources := map[string]int64{}
+	tags := 0
+	for _, r := range report.Results {
+		resources[r.ARN()] = 0
+		if !r.Untagged() {
+			tags++
+		}
+	}
+	result, err := tx.Exec(`INSERT INTO scans (started_at, finished_at, input_file, targets, failed_targets, resources, tags) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		meta.Started.UTC().Format(time.RFC3339), meta.Finished.UTC().Format(time.RFC3339), meta.InputFile,
+		len(report.Targets), len(report.Targets.Failed()), len(resources), tags)
+	if err != nil {
+		return 0, err
+	}
+	if scanID, err = result.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	insertResource, err := tx.Prepare(`INSERT INTO resources (scan_id, arn, account, region, service, resource, compliant, noncompliant_keys) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertResource.Close()
+	// A key found twice on a resource keeps the last value
+	insertTag, err := tx.Prepare(`INSERT OR REPLACE INTO tags (resource_id, scan_id, key, value) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertTag.Close()
+
+	for _, r := range report.Results {
+		arn := r.ARN()
+		id := resources[arn]
+		if id == 0 {
+			var compliant, keys interface{}
+			if r.Compliant != nil {
+				compliant = *r.Compliant
+				keys = strings.Join(append(append([]string{}, r.NoncompliantKeys...), r.KeysWithNoncompliantValues...), ",")
+			}
+			result, err = insertResource.Exec(scanID, arn, r.Account, r.Region, r.Service, r.Resource, compliant, keys)
+			if err != nil {
+				return 0, err
+			}
+			if id, err = result.LastInsertId(); err != nil {
+				return 0, err
+			}
+			resources[arn] = id
+		}
+		if r.Untagged() {
+			continue
+		}
+		if _, err = insertTag.Exec(id, scanID, r.Key, r.Value); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, t := range report.Targets {
+		if t.Status == aws.StatusOK {
+			continue
+		}
+		message := string(t.Status)
+		if t.Err != nil {
+			message = t.Err.Error()
+		}
+		if _, err = tx.Exec(`INSERT INTO errors (scan_id, account, region, status, cause, message) VALUES (?, ?, ?, ?, ?, ?)`,
+			scanID, t.Account, t.Region, string(t.Status), string(t.Cause), message); err != nil {
+			return 0, err
+		}
+	}
+	return scanID, tx.Commit()
+}
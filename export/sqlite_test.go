@@ -0,0 +1,79 @@
+package export
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+)
+
+func TestWriteSQLiteSuite(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "tags.db")
+	started := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+	meta := Metadata{Started: started, Finished: started.Add(time.Minute), InputFile: "aws-tags.yaml"}
+
+	report := aws.Report{
+		Results: []aws.RessourceTagResult{
+			{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"},
+			{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "team", Value: "web"},
+			{Account: "1", Region: "us-east-1", Service: "s3", Resource: "logs", Key: "env", Value: "dev", Compliant: awssdk.Bool(false), NoncompliantKeys: []string{"team"}},
+		},
+		Targets: aws.TargetReports{
+			{Account: "1", Region: "us-east-1", Status: aws.StatusOK, Count: 3},
+			{Account: "2", Region: "us-east-1", Status: aws.StatusFailed, Cause: aws.CauseAccessDenied, Err: errors.New("access denied")},
+		},
+	}
+
+	fixtures := []struct {
+		name   string
+		scanID int64
+	}{
+		{name: "Test the first scan creates the database", scanID: 1},
+		{name: "Test the next scan is appended", scanID: 2},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			scanID, err := WriteSQLite(path, report, meta)
+			assert.NoError(err)
+			assert.Equal(fixture.scanID, scanID)
+		})
+	}
+
+	db, err := sql.Open("sqlite", path)
+	assert.NoError(err)
+	defer db.Close()
+
+	var resources, tags, failed int
+	var startedAt string
+	assert.NoError(db.QueryRow(`SELECT started_at, resources, tags, failed_targets FROM scans WHERE id = 2`).Scan(&startedAt, &resources, &tags, &failed))
+	assert.Equal("2022-07-01T10:00:00Z", startedAt)
+	assert.Equal([]int{2, 3, 1}, []int{resources, tags, failed})
+
+	var count int
+	assert.NoError(db.QueryRow(`SELECT COUNT(*) FROM tag_rows WHERE key = 'env' AND scan_id = 1`).Scan(&count))
+	assert.Equal(2, count)
+
+	var compliant sql.NullBool
+	var keys sql.NullString
+	assert.NoError(db.QueryRow(`SELECT compliant, noncompliant_keys FROM resources WHERE arn = 'arn:aws:s3:us-east-1:1:logs' AND scan_id = 2`).Scan(&compliant, &keys))
+	assert.Equal(sql.NullBool{Bool: false, Valid: true}, compliant)
+	assert.Equal("team", keys.String)
+
+	var cause, message string
+	assert.NoError(db.QueryRow(`SELECT cause, message FROM errors WHERE scan_id = 1`).Scan(&cause, &message))
+	assert.Equal(string(aws.CauseAccessDenied), cause)
+	assert.Equal("access denied", message)
+}
+
+func TestWriteSQLiteInvalidPathSuite(t *testing.T) {
+	assert := assert.New(t)
+	_, err := WriteSQLite(filepath.Join(t.TempDir(), "missing", "tags.db"), aws.Report{}, Metadata{})
+	assert.Error(err)
+}
@@ -0,0 +1,86 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+
+	"tagu/aws"
+)
+
+// ResourceColumns are the columns identifying a resource, before the tag columns
+var ResourceColumns = []string{"account", "region", "service", "resource"}
+
+// Table is a report laid out in rows and columns
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// FlatTable lays the results out with one row per tag
+// Args:
+// 		results: []aws.RessourceTagResult
+// Returns:
+// 		Table: the resource columns followed by the key and the value
+func FlatTable(results []aws.RessourceTagResult) Table {
+	table := Table{Header: append(append([]string{}, ResourceColumns...), "key", "value")}
+	for _, r := range results {
+		table.Rows = append(table.Rows, []string{r.Account, r.Region, r.Service, r.Resource, r.Key, r.Value})
+	}
+	return table
+}
+
+// PivotTable lays the results out with one row per resource and one column per tag key.
+// The resources keep the order of the results, the key columns are sorted unless
+// selected, a missing tag is an empty cell
+// Args:
+// 		results: []aws.RessourceTagResult
+// 		keys: []string, the key columns in this order, every collected key when empty
+// Returns:
+// 		Table: the resource columns followed by the key columns
+func PivotTable(results []aws.RessourceTagResult, keys []string) Table {
+	if len(keys) == 0 {
+		seen := map[string]bool{}
+		for _, r := range results {
+			if !r.Untagged() && !seen[r.Key] {
+				seen[r.Key] = true
+				keys = append(keys, r.Key)
+			}
+		}
+		sort.Strings(keys)
+	}
+	columns := map[string]int{}
+	for i, key := range keys {
+		columns[key] = len(ResourceColumns) + i
+	}
+
+	table := Table{Header: append(append([]string{}, ResourceColumns...), keys...)}
+	rows := map[string]int{}
+	for _, r := range results {
+		arn := r.ARN()
+		idx, ok := rows[arn]
+		if !ok {
+			idx = len(table.Rows)
+			rows[arn] = idx
+			row := make([]string, len(table.Header))
+			copy(row, []string{r.Account, r.Region, r.Service, r.Resource})
+			table.Rows = append(table.Rows, row)
+		}
+		if column, ok := columns[r.Key]; ok && !r.Untagged() {
+			table.Rows[idx][column] = r.Value
+		}
+	}
+	return table
+}
+
+// WriteCSV writes the header and the rows of the table as CSV
+func WriteCSV(out io.Writer, table Table) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(table.Header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(table.Rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
@@ -0,0 +1,81 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+)
+
+var tableResults = []aws.RessourceTagResult{
+	{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "owner", Value: "web"},
+	{Account: "1", Region: "us-east-1", Service: "s3", Resource: "logs", Key: "env", Value: "dev"},
+	{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"},
+	{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "cost-center", Value: "42, finance"},
+}
+
+func TestFlatTableSuite(t *testing.T) {
+	assert := assert.New(t)
+	table := FlatTable(tableResults[:2])
+	assert.Equal(Table{
+		Header: []string{"account", "region", "service", "resource", "key", "value"},
+		Rows: [][]string{
+			{"1", "us-east-1", "ec2", "instance/i-1", "owner", "web"},
+			{"1", "us-east-1", "s3", "logs", "env", "dev"},
+		},
+	}, table)
+}
+
+func TestPivotTableSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		keys     []string
+		expected Table
+	}{
+		{
+			name: "Test every key in sorted columns",
+			expected: Table{
+				Header: []string{"account", "region", "service", "resource", "cost-center", "env", "owner"},
+				Rows: [][]string{
+					{"1", "us-east-1", "ec2", "instance/i-1", "42, finance", "prod", "web"},
+					{"1", "us-east-1", "s3", "logs", "", "dev", ""},
+				},
+			},
+		},
+		{
+			name: "Test selected columns keep their order",
+			keys: []string{"owner", "env", "team"},
+			expected: Table{
+				Header: []string{"account", "region", "service", "resource", "owner", "env", "team"},
+				Rows: [][]string{
+					{"1", "us-east-1", "ec2", "instance/i-1", "web", "prod", ""},
+					{"1", "us-east-1", "s3", "logs", "", "dev", ""},
+				},
+			},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, PivotTable(tableResults, fixture.keys))
+		})
+	}
+
+	t.Run("Test an untagged resource has empty columns", func(t *testing.T) {
+		results := append([]aws.RessourceTagResult{{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "volume/vol-1"}}, tableResults[0])
+		table := PivotTable(results, nil)
+		assert.Equal([]string{"account", "region", "service", "resource", "owner"}, table.Header)
+		assert.Equal([]string{"1", "us-east-1", "ec2", "volume/vol-1", ""}, table.Rows[0])
+	})
+}
+
+func TestWriteCSVSuite(t *testing.T) {
+	assert := assert.New(t)
+	var out bytes.Buffer
+	assert.NoError(WriteCSV(&out, PivotTable(tableResults, []string{"cost-center"})))
+	assert.Equal("account,region,service,resource,cost-center\n1,us-east-1,ec2,instance/i-1,\"42, finance\"\n1,us-east-1,s3,logs,\n", out.String())
+}
@@ -0,0 +1,139 @@
+package export
+
+import (
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"tagu/aws"
+	"tagu/stats"
+)
+
+// XLSXSheets are the sheets of the workbook in their order
+var XLSXSheets = []string{"Tags", "Resources", "Coverage", "Violations"}
+
+// sheet is a worksheet, the rows hold strings, integers and floats
+type sheet struct {
+	name   string
+	header []string
+	rows   [][]interface{}
+}
+
+func tableSheet(name string, table Table) sheet {
+	s := sheet{name: name, header: table.Header}
+	for _, row := range table.Rows {
+		cells := make([]interface{}, len(row))
+		for i, cell := range row {
+			cells[i] = cell
+		}
+		s.rows = append(s.rows, cells)
+	}
+	return s
+}
+
+// coverageSheet is the share of the resources of each account tagged with each key
+func coverageSheet(results []aws.RessourceTagResult, keys []string) sheet {
+	s := sheet{name: "Coverage", header: []string{"account", "key", "tagged", "total", "coverage %"}}
+	for _, c := range stats.Compute(results, stats.Options{Keys: keys}).Coverage {
+		if c.Dimension == stats.DimensionAccount {
+			s.rows = append(s.rows, []interface{}{c.Group, c.Key, c.Tagged, c.Total, c.Percent})
+		}
+	}
+	return s
+}
+
+// violationsSheet lists the resources not compliant with the tag policies,
+// it is only filled when the results hold the compliance details
+func violationsSheet(results []aws.RessourceTagResult) sheet {
+	s := sheet{name: "Violations", header: append(append([]string{}, ResourceColumns...), "noncompliant keys", "noncompliant values")}
+	seen := map[string]bool{}
+	for _, r := range results {
+		if r.Compliant == nil || *r.Compliant || seen[r.ARN()] {
+			continue
+		}
+		seen[r.ARN()] = true
+		s.rows = append(s.rows, []interface{}{r.Account, r.Region, r.Service, r.Resource,
+			strings.Join(r.NoncompliantKeys, ", "), strings.Join(r.KeysWithNoncompliantValues, ", ")})
+	}
+	return s
+}
+
+// WriteXLSX writes the report as an Excel workbook with the raw tags, the resources
+// pivoted with one column per tag key, the coverage of each key per account and the
+// tag policies violations. The headers are bold and frozen with an autofilter
+// Args:
+// 		out: io.Writer
+// 		report: aws.Report
+// 		keys: []string, the tag key columns and the covered keys, every collected key when empty
+// Returns:
+// 		error: if the workbook can not be built or written
+func WriteXLSX(out io.Writer, report aws.Report, keys []string) error {
+	sheets := []sheet{
+		tableSheet("Tags", FlatTable(report.Results)),
+		tableSheet("Resources", PivotTable(report.Results, keys)),
+		coverageSheet(report.Results, keys),
+		violationsSheet(report.Results),
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	header, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#D9E1F2"}},
+	})
+	if err != nil {
+		return err
+	}
+	for i, s := range sheets {
+		if i == 0 {
+			f.SetSheetName("Sheet1", s.name)
+		} else {
+			f.NewSheet(s.name)
+		}
+		if err = writeSheet(f, s, header); err != nil {
+			return err
+		}
+	}
+	f.SetActiveSheet(0)
+	return f.Write(out)
+}
+
+func writeSheet(f *excelize.File, s sheet, style int) error {
+	header := make([]interface{}, len(s.header))
+	for i, column := range s.header {
+		header[i] = column
+	}
+	if err := f.SetSheetRow(s.name, "A1", &header); err != nil {
+		return err
+	}
+	for i, row := range s.rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		row := row
+		if err = f.SetSheetRow(s.name, cell, &row); err != nil {
+			return err
+		}
+	}
+
+	last, err := excelize.CoordinatesToCellName(len(s.header), 1)
+	if err != nil {
+		return err
+	}
+	if err = f.SetCellStyle(s.name, "A1", last, style); err != nil {
+		return err
+	}
+	lastColumn, err := excelize.ColumnNumberToName(len(s.header))
+	if err != nil {
+		return err
+	}
+	if err = f.SetColWidth(s.name, "A", lastColumn, 18); err != nil {
+		return err
+	}
+	if err = f.AutoFilter(s.name, "A1", last, ""); err != nil {
+		return err
+	}
+	return f.SetPanes(s.name, `{"freeze":true,"split":false,"x_split":0,"y_split":1,"top_left_cell":"A2","active_pane":"bottomLeft"}`)
+}
@@ -0,0 +1,86 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+
+	"tagu/aws"
+)
+
+func TestWriteXLSXSuite(t *testing.T) {
+	assert := assert.New(t)
+	report := aws.Report{Results: []aws.RessourceTagResult{
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod", Compliant: awssdk.Bool(true)},
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-2", Key: "owner", Value: "web", Compliant: awssdk.Bool(false), NoncompliantKeys: []string{"env"}},
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-2", Key: "team", Value: "ops", Compliant: awssdk.Bool(false), NoncompliantKeys: []string{"env"}},
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-3", Compliant: awssdk.Bool(false), NoncompliantKeys: []string{"env", "owner"}},
+	}}
+
+	var out bytes.Buffer
+	assert.NoError(WriteXLSX(&out, report, []string{"env", "owner"}))
+	f, err := excelize.OpenReader(&out)
+	assert.NoError(err)
+	defer f.Close()
+	assert.Equal(XLSXSheets, f.GetSheetList())
+
+	fixtures := []struct {
+		sheet    string
+		expected [][]string
+	}{
+		{
+			sheet: "Tags",
+			expected: [][]string{
+				{"account", "region", "service", "resource", "key", "value"},
+				{"1", "us-east-1", "ec2", "instance/i-1", "env", "prod"},
+				{"1", "us-east-1", "ec2", "instance/i-2", "owner", "web"},
+				{"1", "us-east-1", "ec2", "instance/i-2", "team", "ops"},
+				{"1", "us-east-1", "ec2", "instance/i-3"},
+			},
+		},
+		{
+			sheet: "Resources",
+			expected: [][]string{
+				{"account", "region", "service", "resource", "env", "owner"},
+				{"1", "us-east-1", "ec2", "instance/i-1", "prod"},
+				{"1", "us-east-1", "ec2", "instance/i-2", "", "web"},
+				{"1", "us-east-1", "ec2", "instance/i-3"},
+			},
+		},
+		{
+			sheet: "Coverage",
+			expected: [][]string{
+				{"account", "key", "tagged", "total", "coverage %"},
+				{"1", "env", "1", "3", "33.3"},
+				{"1", "owner", "1", "3", "33.3"},
+			},
+		},
+		{
+			sheet: "Violations",
+			expected: [][]string{
+				{"account", "region", "service", "resource", "noncompliant keys", "noncompliant values"},
+				{"1", "us-east-1", "ec2", "instance/i-2", "env"},
+				{"1", "us-east-1", "ec2", "instance/i-3", "env, owner"},
+			},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run("Test the "+fixture.sheet+" sheet", func(t *testing.T) {
+			rows, err := f.GetRows(fixture.sheet)
+			assert.NoError(err)
+			assert.Equal(fixture.expected, rows)
+		})
+	}
+
+	// The header is bold and filtered
+	style, err := f.GetCellStyle("Tags", "B1")
+	assert.NoError(err)
+	assert.NotZero(style)
+	names := f.GetDefinedName()
+	assert.Len(names, len(XLSXSheets))
+	assert.Equal("_xlnm._FilterDatabase", names[0].Name)
+}
@@ -0,0 +1,232 @@
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tagu/provider"
+)
+
+const (
+	// DefaultScope is the OAuth scope of the Cloud Asset calls
+	DefaultScope = "https://www.googleapis.com/auth/cloud-platform"
+	// DefaultTokenURI is the Google OAuth token endpoint
+	DefaultTokenURI = "https://oauth2.googleapis.com/token"
+)
+
+// gcloudCommand runs the gcloud CLI, replaced in the unittest
+var gcloudCommand = func(ctx context.Context, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, "gcloud", args...).Output()
+}
+
+// TokenSource returns the bearer token of the Cloud Asset calls
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a token obtained out of band, GOOGLE_OAUTH_ACCESS_TOKEN for instance
+type StaticToken string
+
+// Token returns the token as is
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// CredentialsFile is the content of an application default credentials file,
+// either a service account key or the user credentials of gcloud. The user
+// credentials bill the calls to their quota project
+type CredentialsFile struct {
+	Type           string `json:"type"`
+	ClientEmail    string `json:"client_email"`
+	PrivateKey     string `json:"private_key"`
+	TokenURI       string `json:"token_uri"`
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	QuotaProjectID string `json:"quota_project_id"`
+}
+
+// FileToken exchanges the credentials of a file for access tokens, a signed JWT
+// for a service account and the refresh token for the user credentials
+type FileToken struct {
+	Credentials CredentialsFile
+	HTTPClient  *http.Client
+	cache       provider.TokenCache
+}
+
+// Token returns the cached token or requests a new one
+func (f *FileToken) Token(ctx context.Context) (string, error) {
+	return f.cache.Get(ctx, f.fetch)
+}
+
+func (f *FileToken) fetch(ctx context.Context) (string, time.Time, error) {
+	tokenURI := f.Credentials.TokenURI
+	if tokenURI == "" {
+		tokenURI = DefaultTokenURI
+	}
+	var form url.Values
+	switch f.Credentials.Type {
+	case "service_account":
+		assertion, err := signJWT(f.Credentials, tokenURI, time.Now())
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		form = url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	case "authorized_user":
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {f.Credentials.ClientID},
+			"client_secret": {f.Credentials.ClientSecret},
+			"refresh_token": {f.Credentials.RefreshToken},
+		}
+	default:
+		return "", time.Time{}, fmt.Errorf("unsupported credentials type %q", f.Credentials.Type)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := f.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", time.Time{}, &APIError{StatusCode: resp.StatusCode, Status: body.Error, Message: body.ErrorDescription}
+	}
+	return body.AccessToken, time.Now().Add(time.Duration(body.ExpiresIn) * time.Second), nil
+}
+
+// signJWT signs the assertion of a service account with its RS256 private key
+func signJWT(credentials CredentialsFile, audience string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(credentials.PrivateKey))
+	if block == nil {
+		return "", errors.New("invalid service account private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("invalid service account private key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("invalid service account private key: not an RSA key")
+	}
+
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := encode(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encode(map[string]interface{}{
+		"iss":   credentials.ClientEmail,
+		"scope": DefaultScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// CLIToken gets the tokens of the account logged in the gcloud CLI
+type CLIToken struct {
+	cache provider.TokenCache
+}
+
+// Token returns the cached token or asks the gcloud CLI for a new one, gcloud
+// does not tell the expiry so the token is kept five minutes
+func (c *CLIToken) Token(ctx context.Context) (string, error) {
+	return c.cache.Get(ctx, func(ctx context.Context) (string, time.Time, error) {
+		out, err := gcloudCommand(ctx, "auth", "print-access-token")
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+				return "", time.Time{}, fmt.Errorf("gcloud auth print-access-token: %s", strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return "", time.Time{}, fmt.Errorf("gcloud auth print-access-token: %w", err)
+		}
+		return strings.TrimSpace(string(out)), time.Now().Add(5 * time.Minute), nil
+	})
+}
+
+// QuotaProject returns the quota project of the credentials file of the source
+// Args:
+// 		source: TokenSource
+// Returns:
+// 		string: empty when the source is not a credentials file or has no quota project
+func QuotaProject(source TokenSource) string {
+	if file, ok := source.(*FileToken); ok {
+		return file.Credentials.QuotaProjectID
+	}
+	return ""
+}
+
+// DefaultTokenSource picks the credentials from the environment, in this order
+// GOOGLE_OAUTH_ACCESS_TOKEN, the file of GOOGLE_APPLICATION_CREDENTIALS, the
+// application default credentials of gcloud then the gcloud CLI
+// Args:
+// 		getenv: func(string) string, os.Getenv
+// Returns:
+// 		TokenSource
+// 		error: if the credentials file can not be read
+func DefaultTokenSource(getenv func(string) string) (TokenSource, error) {
+	if token := getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return StaticToken(token), nil
+	}
+	path := getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" && getenv("HOME") != "" {
+		adc := filepath.Join(getenv("HOME"), ".config", "gcloud", "application_default_credentials.json")
+		if _, err := os.Stat(adc); err == nil {
+			path = adc
+		}
+	}
+	if path == "" {
+		return &CLIToken{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var credentials CredentialsFile
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", path, err)
+	}
+	return &FileToken{Credentials: credentials}, nil
+}
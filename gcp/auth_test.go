@@ -0,0 +1,166 @@
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignJWTSuite(t *testing.T) {
+	assert := assert.New(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(err)
+	credentials := CredentialsFile{
+		ClientEmail: "scanner@project.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}
+
+	now := time.Unix(1700000000, 0)
+	jwt, err := signJWT(credentials, DefaultTokenURI, now)
+	assert.NoError(err)
+	parts := strings.Split(jwt, ".")
+	assert.Len(parts, 3)
+
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.JSONEq(`{"iss": "scanner@project.iam.gserviceaccount.com", "scope": "`+DefaultScope+`", "aud": "`+DefaultTokenURI+`", "iat": 1700000000, "exp": 1700003600}`, string(claims))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], signature))
+
+	_, err = signJWT(CredentialsFile{PrivateKey: "not a key"}, DefaultTokenURI, now)
+	assert.EqualError(err, "invalid service account private key")
+}
+
+func TestFileTokenSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		r.ParseForm()
+		if r.Form.Get("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "token revoked"})
+			return
+		}
+		assert.Equal("refresh_token", r.Form.Get("grant_type"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token-1", "expires_in": 3600})
+	}))
+	defer server.Close()
+
+	user := &FileToken{Credentials: CredentialsFile{Type: "authorized_user", ClientID: "id", ClientSecret: "secret", RefreshToken: "refresh", TokenURI: server.URL}}
+	for i := 0; i < 2; i++ {
+		token, err := user.Token(context.TODO())
+		assert.NoError(err)
+		assert.Equal("token-1", token)
+	}
+	assert.Equal(1, calls, "the token is cached")
+
+	revoked := &FileToken{Credentials: CredentialsFile{Type: "authorized_user", RefreshToken: "revoked", TokenURI: server.URL}}
+	_, err := revoked.Token(context.TODO())
+	assert.EqualError(err, "gcp: status 400: invalid_grant: token revoked")
+
+	external := &FileToken{Credentials: CredentialsFile{Type: "external_account"}}
+	_, err = external.Token(context.TODO())
+	assert.EqualError(err, `unsupported credentials type "external_account"`)
+}
+
+func TestCLITokenSuite(t *testing.T) {
+	assert := assert.New(t)
+	defer func(previous func(ctx context.Context, args ...string) ([]byte, error)) { gcloudCommand = previous }(gcloudCommand)
+
+	gcloudCommand = func(ctx context.Context, args ...string) ([]byte, error) {
+		assert.Equal([]string{"auth", "print-access-token"}, args)
+		return []byte("cli-token\n"), nil
+	}
+	token, err := (&CLIToken{}).Token(context.TODO())
+	assert.NoError(err)
+	assert.Equal("cli-token", token)
+
+	gcloudCommand = func(ctx context.Context, args ...string) ([]byte, error) {
+		return nil, errors.New("executable file not found in $PATH")
+	}
+	_, err = (&CLIToken{}).Token(context.TODO())
+	assert.EqualError(err, "gcloud auth print-access-token: executable file not found in $PATH")
+}
+
+func TestDefaultTokenSourceSuite(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.json")
+	assert.NoError(os.WriteFile(keyFile, []byte(`{"type": "service_account", "client_email": "scanner@project.iam.gserviceaccount.com"}`), 0o600))
+	adcHome := filepath.Join(dir, "home")
+	assert.NoError(os.MkdirAll(filepath.Join(adcHome, ".config", "gcloud"), 0o700))
+	assert.NoError(os.WriteFile(filepath.Join(adcHome, ".config", "gcloud", "application_default_credentials.json"), []byte(`{"type": "authorized_user", "refresh_token": "refresh", "quota_project_id": "billing"}`), 0o600))
+
+	fixtures := []struct {
+		name     string
+		env      map[string]string
+		expected TokenSource
+		err      bool
+	}{
+		{
+			name:     "Test the access token",
+			env:      map[string]string{"GOOGLE_OAUTH_ACCESS_TOKEN": "token", "GOOGLE_APPLICATION_CREDENTIALS": keyFile},
+			expected: StaticToken("token"),
+		},
+		{
+			name:     "Test the credentials file",
+			env:      map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": keyFile, "HOME": adcHome},
+			expected: &FileToken{Credentials: CredentialsFile{Type: "service_account", ClientEmail: "scanner@project.iam.gserviceaccount.com"}},
+		},
+		{
+			name:     "Test the application default credentials",
+			env:      map[string]string{"HOME": adcHome},
+			expected: &FileToken{Credentials: CredentialsFile{Type: "authorized_user", RefreshToken: "refresh", QuotaProjectID: "billing"}},
+		},
+		{
+			name:     "Test the gcloud CLI without credentials",
+			env:      map[string]string{"HOME": dir},
+			expected: &CLIToken{},
+		},
+		{
+			name: "Test a missing credentials file",
+			env:  map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": filepath.Join(dir, "missing.json")},
+			err:  true,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			getenv := func(name string) string { return fixture.env[name] }
+			source, err := DefaultTokenSource(getenv)
+			if fixture.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.expected, source)
+		})
+	}
+}
+
+func TestQuotaProjectSuite(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("billing", QuotaProject(&FileToken{Credentials: CredentialsFile{Type: "authorized_user", QuotaProjectID: "billing"}}))
+	assert.Equal("", QuotaProject(&FileToken{Credentials: CredentialsFile{Type: "service_account"}}))
+	assert.Equal("", QuotaProject(StaticToken("token")))
+}
@@ -0,0 +1,165 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tagu/provider"
+)
+
+const (
+	// DefaultEndpoint is the Cloud Asset API endpoint
+	DefaultEndpoint = "https://cloudasset.googleapis.com"
+	// DefaultPageSize is the maximum page size of searchAllResources
+	DefaultPageSize = 500
+	// readMask are the fields of the search results read by the provider
+	readMask = "name,assetType,project,location,labels,tags,state,additionalAttributes"
+)
+
+// APIError is an error answered by the Cloud Asset API or the token endpoint
+type APIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Status == "" {
+		return fmt.Sprintf("gcp: status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("gcp: status %d: %s: %s", e.StatusCode, e.Status, e.Message)
+}
+
+// HTTPStatus returns the status code of the answer
+func (e *APIError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// Tag is a resource manager tag bound to a resource
+type Tag struct {
+	TagKey   string `json:"tagKey"`
+	TagValue string `json:"tagValue"`
+}
+
+// SearchResult is a resource found by searchAllResources
+type SearchResult struct {
+	Name                 string                 `json:"name"`
+	AssetType            string                 `json:"assetType"`
+	Project              string                 `json:"project"`
+	Location             string                 `json:"location"`
+	Labels               map[string]string      `json:"labels"`
+	Tags                 []Tag                  `json:"tags"`
+	State                string                 `json:"state"`
+	AdditionalAttributes map[string]interface{} `json:"additionalAttributes"`
+}
+
+// Client searches the resources with the Cloud Asset API, the throttled and the
+// failed calls are retried
+// params:
+// 		endpoint: string, DefaultEndpoint when empty
+// 		token: TokenSource
+// 		quotaProject: string, the project billed for the calls, sent in x-goog-user-project when set
+// 		pageSize: int, DefaultPageSize when zero
+// 		maxAttempts: int, the attempts of each call, 3 when zero
+// 		backoff: time.Duration, the delay before the second attempt doubled on each attempt,
+// 		a Retry-After header takes precedence
+type Client struct {
+	Endpoint     string
+	Token        TokenSource
+	QuotaProject string
+	HTTPClient   *http.Client
+	PageSize     int
+	MaxAttempts  int
+	Backoff      time.Duration
+}
+
+// searchResponse is a page of searchAllResources
+type searchResponse struct {
+	Results       []SearchResult `json:"results"`
+	NextPageToken string         `json:"nextPageToken"`
+}
+
+// Search calls searchAllResources on the scope and follows the pages, onResult is
+// called with each result
+// Args:
+// 		ctx: context.Context
+// 		scope: string, projects/{id}, folders/{number} or organizations/{number}
+// 		query: string, the search query, every resource when empty
+// 		assetTypes: []string, the asset types kept, all when empty
+// 		onResult: func(SearchResult) error, stops the search on error
+// Returns:
+// 		error: if a page can not be fetched or onResult failed
+func (c *Client) Search(ctx context.Context, scope, query string, assetTypes []string, onResult func(SearchResult) error) error {
+	params := url.Values{"readMask": {readMask}}
+	if query != "" {
+		params.Set("query", query)
+	}
+	for _, assetType := range assetTypes {
+		params.Add("assetTypes", assetType)
+	}
+	pageSize := c.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	params.Set("pageSize", strconv.Itoa(pageSize))
+	for {
+		var page searchResponse
+		if err := c.get(ctx, "/v1/"+scope+":searchAllResources?"+params.Encode(), &page); err != nil {
+			return err
+		}
+		for _, result := range page.Results {
+			if err := onResult(result); err != nil {
+				return err
+			}
+		}
+		if page.NextPageToken == "" {
+			return nil
+		}
+		params.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// get decodes the response of the path, the 429 and 5xx answers are retried
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	caller := provider.HTTPCaller{Client: c.HTTPClient, MaxAttempts: c.MaxAttempts, Backoff: c.Backoff}
+	return caller.Call(ctx, func(ctx context.Context) (*http.Request, error) {
+		token, err := c.Token.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("gcp credentials: %w", err)
+		}
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultEndpoint
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if c.QuotaProject != "" {
+			req.Header.Set("x-goog-user-project", c.QuotaProject)
+		}
+		return req, nil
+	}, decodeError, out)
+}
+
+// decodeError returns the APIError of a failed answer
+func decodeError(status int, body []byte) error {
+	apiErr := &APIError{StatusCode: status, Message: http.StatusText(status)}
+	var failure struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &failure) == nil && failure.Error.Message != "" {
+		apiErr.Status, apiErr.Message = failure.Error.Status, failure.Error.Message
+	}
+	return apiErr
+}
@@ -0,0 +1,178 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAsset serves the results of each scope in pages of two results, the page token
+// is the offset of the next page. The scope projects/denied answers 403 and the
+// first throttled calls answer 429. The quota projects of the calls are recorded
+type fakeAsset struct {
+	mu            sync.Mutex
+	results       map[string][]SearchResult
+	throttled     int
+	queries       []string
+	quotaProjects []string
+}
+
+func (f *fakeAsset) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 401, "status": "UNAUTHENTICATED", "message": "bad token"}})
+		return
+	}
+	if f.throttled > 0 {
+		f.throttled--
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 429, "status": "RESOURCE_EXHAUSTED", "message": "quota exceeded"}})
+		return
+	}
+	scope := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), ":searchAllResources")
+	if scope == "projects/denied" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 403, "status": "PERMISSION_DENIED", "message": "no cloudasset.assets.searchAllResources"}})
+		return
+	}
+	params := r.URL.Query()
+	f.queries = append(f.queries, scope+"?"+params.Get("query"))
+	f.quotaProjects = append(f.quotaProjects, r.Header.Get("x-goog-user-project"))
+
+	types := map[string]bool{}
+	for _, assetType := range params["assetTypes"] {
+		types[assetType] = true
+	}
+	var results []SearchResult
+	for _, result := range f.results[scope] {
+		if len(types) == 0 || types[result.AssetType] {
+			results = append(results, result)
+		}
+	}
+	start, _ := strconv.Atoi(params.Get("pageToken"))
+	end := start + 2
+	response := searchResponse{}
+	if end < len(results) {
+		response.NextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(results)
+	}
+	response.Results = results[start:end]
+	json.NewEncoder(w).Encode(response)
+}
+
+func newFakeClient(asset *fakeAsset) (*Client, func()) {
+	server := httptest.NewServer(asset)
+	return &Client{Endpoint: server.URL, Token: StaticToken("secret"), HTTPClient: server.Client(), Backoff: time.Millisecond}, server.Close
+}
+
+func TestClientSearchSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	var results []SearchResult
+	for i := 0; i < 5; i++ {
+		results = append(results, SearchResult{Name: strconv.Itoa(i), AssetType: "compute.googleapis.com/Instance"})
+	}
+	results = append(results, SearchResult{Name: "bucket", AssetType: "storage.googleapis.com/Bucket"})
+
+	fixtures := []struct {
+		name       string
+		asset      *fakeAsset
+		token      TokenSource
+		assetTypes []string
+		names      []string
+		err        string
+	}{
+		{
+			name:  "Test the pages are followed",
+			asset: &fakeAsset{results: map[string][]SearchResult{"projects/web": results}},
+			names: []string{"0", "1", "2", "3", "4", "bucket"},
+		},
+		{
+			name:       "Test the asset types",
+			asset:      &fakeAsset{results: map[string][]SearchResult{"projects/web": results}},
+			assetTypes: []string{"storage.googleapis.com/Bucket"},
+			names:      []string{"bucket"},
+		},
+		{
+			name:       "Test the throttled calls are retried",
+			asset:      &fakeAsset{results: map[string][]SearchResult{"projects/web": results}, throttled: 2},
+			assetTypes: []string{"storage.googleapis.com/Bucket"},
+			names:      []string{"bucket"},
+		},
+		{
+			name:  "Test the retries give up after the attempts",
+			asset: &fakeAsset{results: map[string][]SearchResult{"projects/web": results}, throttled: 3},
+			err:   "gcp: status 429: RESOURCE_EXHAUSTED: quota exceeded",
+		},
+		{
+			name:  "Test an invalid token is not retried",
+			asset: &fakeAsset{results: map[string][]SearchResult{"projects/web": results}, throttled: 3},
+			token: StaticToken("expired"),
+			err:   "gcp: status 401: UNAUTHENTICATED: bad token",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			client, stop := newFakeClient(fixture.asset)
+			defer stop()
+			if fixture.token != nil {
+				client.Token = fixture.token
+			}
+			var names []string
+			err := client.Search(context.TODO(), "projects/web", "", fixture.assetTypes, func(r SearchResult) error {
+				names = append(names, r.Name)
+				return nil
+			})
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(fixture.names, names)
+		})
+	}
+}
+
+func TestClientSearchStopsSuite(t *testing.T) {
+	assert := assert.New(t)
+	asset := &fakeAsset{results: map[string][]SearchResult{"projects/web": {{Name: "0"}, {Name: "1"}, {Name: "2"}}}}
+	client, stop := newFakeClient(asset)
+	defer stop()
+
+	err := client.Search(context.TODO(), "projects/web", "labels.env:*", nil, func(r SearchResult) error {
+		return errors.New("invalid result")
+	})
+	assert.EqualError(err, "invalid result")
+	assert.Equal([]string{"projects/web?labels.env:*"}, asset.queries)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = client.Search(ctx, "projects/web", "", nil, func(r SearchResult) error { return nil })
+	assert.True(errors.Is(err, context.Canceled))
+}
+
+func TestClientQuotaProjectSuite(t *testing.T) {
+	assert := assert.New(t)
+	asset := &fakeAsset{results: map[string][]SearchResult{"projects/web": {{Name: "0"}}}}
+	client, stop := newFakeClient(asset)
+	defer stop()
+
+	onResult := func(r SearchResult) error { return nil }
+	assert.NoError(client.Search(context.TODO(), "projects/web", "", nil, onResult))
+	client.QuotaProject = "billing"
+	assert.NoError(client.Search(context.TODO(), "projects/web", "", nil, onResult))
+	assert.Equal([]string{"", "billing"}, asset.quotaProjects)
+}
@@ -0,0 +1,136 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"tagu/models"
+	"tagu/provider"
+)
+
+const (
+	// ProviderName is the name of the GCP provider
+	ProviderName = "gcp"
+	// ProjectAssetType is the asset type of the projects
+	ProjectAssetType = "cloudresourcemanager.googleapis.com/Project"
+)
+
+// Provider lists the resources of the spec with Cloud Asset Inventory, a target is a project
+type Provider struct {
+	spec   models.GCPSpec
+	client *Client
+}
+
+// NewProvider creates the provider of the spec
+// Args:
+// 		spec: models.GCPSpec
+// 		client: *Client
+// Returns:
+// 		*Provider
+func NewProvider(spec models.GCPSpec, client *Client) *Provider {
+	return &Provider{spec: spec, client: client}
+}
+
+// Name returns gcp
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// Targets returns the projects of the spec followed by the active projects of
+// its folders and organizations, each project once
+func (p *Provider) Targets(ctx context.Context) ([]provider.Target, error) {
+	if len(p.spec.Projects)+len(p.spec.Folders)+len(p.spec.Organizations) == 0 {
+		return nil, errors.New("the spec has no projects, folders or organizations")
+	}
+	var targets []provider.Target
+	seen := map[string]bool{}
+	add := func(project string) {
+		if !seen[project] {
+			seen[project] = true
+			targets = append(targets, provider.Target{Scope: project})
+		}
+	}
+	for _, project := range p.spec.Projects {
+		add(project)
+	}
+
+	var parents []string
+	for _, folder := range p.spec.Folders {
+		parents = append(parents, "folders/"+folder)
+	}
+	for _, organization := range p.spec.Organizations {
+		parents = append(parents, "organizations/"+organization)
+	}
+	for _, parent := range parents {
+		var projects []string
+		err := p.client.Search(ctx, parent, "", []string{ProjectAssetType}, func(r SearchResult) error {
+			if r.State != "" && r.State != "ACTIVE" {
+				return nil
+			}
+			projects = append(projects, projectID(r))
+			return nil
+		})
+		if err != nil {
+			return targets, fmt.Errorf("%s projects: %w", parent, err)
+		}
+		sort.Strings(projects)
+		for _, project := range projects {
+			add(project)
+		}
+	}
+	return targets, nil
+}
+
+// projectID returns the id of a project result, its number when the id is missing
+func projectID(r SearchResult) string {
+	if id, ok := r.AdditionalAttributes["projectId"].(string); ok && id != "" {
+		return id
+	}
+	return strings.TrimPrefix(r.Project, "projects/")
+}
+
+// Resources lists the resources of the project matching the spec filters, the
+// labels and the resource manager tags are the tags of the resources
+func (p *Provider) Resources(ctx context.Context, target provider.Target) ([]provider.Resource, error) {
+	var resources []provider.Resource
+	err := p.client.Search(ctx, "projects/"+target.Scope, BuildQuery(p.spec.FilterTags), p.spec.FilterResources, func(r SearchResult) error {
+		if !provider.MatchValues(p.spec.FilterTags, r.Labels) {
+			return nil
+		}
+		resources = append(resources, provider.Resource{
+			Provider: ProviderName,
+			Scope:    target.Scope,
+			Location: r.Location,
+			Type:     r.AssetType,
+			ID:       r.Name,
+			Tags:     ResourceTags(r),
+		})
+		return nil
+	})
+	return resources, err
+}
+
+// ResourceTags merges the labels and the resource manager tags of a result,
+// the tags keep their namespaced key, 123456789/env, and the short name of their value
+// Args:
+// 		r: SearchResult
+// Returns:
+// 		map[string]string
+func ResourceTags(r SearchResult) map[string]string {
+	tags := map[string]string{}
+	for key, value := range r.Labels {
+		tags[key] = value
+	}
+	for _, tag := range r.Tags {
+		tags[tag.TagKey] = strings.TrimPrefix(tag.TagValue, tag.TagKey+"/")
+	}
+	return tags
+}
+
+// Classify maps the Cloud Asset errors to their cause
+func (p *Provider) Classify(err error) string {
+	return provider.ClassifyHTTP(err)
+}
@@ -0,0 +1,89 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+	"tagu/provider"
+)
+
+var assetResults = map[string][]SearchResult{
+	"folders/42": {
+		{Name: "//cloudresourcemanager.googleapis.com/projects/222", AssetType: ProjectAssetType, Project: "projects/222", State: "ACTIVE", AdditionalAttributes: map[string]interface{}{"projectId": "web-prod"}},
+		{Name: "//cloudresourcemanager.googleapis.com/projects/333", AssetType: ProjectAssetType, Project: "projects/333", State: "DELETE_REQUESTED", AdditionalAttributes: map[string]interface{}{"projectId": "old"}},
+		{Name: "//cloudresourcemanager.googleapis.com/projects/111", AssetType: ProjectAssetType, Project: "projects/111", State: "ACTIVE"},
+	},
+	"projects/web-prod": {
+		{
+			Name: "//compute.googleapis.com/projects/web-prod/zones/europe-west1-b/instances/vm-1", AssetType: "compute.googleapis.com/Instance", Location: "europe-west1-b",
+			Labels: map[string]string{"env": "prod"}, Tags: []Tag{{TagKey: "123456/team", TagValue: "123456/team/web"}},
+		},
+		{Name: "//storage.googleapis.com/logs", AssetType: "storage.googleapis.com/Bucket", Location: "eu", Labels: map[string]string{"env": "dev"}},
+	},
+}
+
+func TestProviderTargetsSuite(t *testing.T) {
+	assert := assert.New(t)
+	client, stop := newFakeClient(&fakeAsset{results: assetResults})
+	defer stop()
+
+	targets, err := NewProvider(models.GCPSpec{Projects: []string{"web-prod", "data"}, Folders: []string{"42"}}, client).Targets(context.TODO())
+	assert.NoError(err)
+	assert.Equal([]provider.Target{{Scope: "web-prod"}, {Scope: "data"}, {Scope: "111"}}, targets)
+
+	_, err = NewProvider(models.GCPSpec{}, client).Targets(context.TODO())
+	assert.EqualError(err, "the spec has no projects, folders or organizations")
+
+	client.Token = StaticToken("expired")
+	_, err = NewProvider(models.GCPSpec{Organizations: []string{"7"}}, client).Targets(context.TODO())
+	assert.EqualError(err, "organizations/7 projects: gcp: status 401: UNAUTHENTICATED: bad token")
+}
+
+func TestProviderScanSuite(t *testing.T) {
+	assert := assert.New(t)
+	asset := &fakeAsset{results: assetResults}
+	client, stop := newFakeClient(asset)
+	defer stop()
+
+	spec := models.GCPSpec{Projects: []string{"web-prod", "denied"}, FilterTags: []models.Tags{{Key: "env"}, {Values: []string{"prod"}}}}
+	report, err := provider.Scan(context.TODO(), NewProvider(spec, client), provider.ScanOptions{})
+	assert.NoError(err)
+	assert.Equal([]provider.Resource{
+		{
+			Provider: "gcp", Scope: "web-prod", Location: "europe-west1-b", Type: "compute.googleapis.com/Instance",
+			ID: "//compute.googleapis.com/projects/web-prod/zones/europe-west1-b/instances/vm-1", Tags: map[string]string{"env": "prod", "123456/team": "web"},
+		},
+	}, report.Resources)
+	assert.Equal(provider.StatusFailed, report.Targets[1].Status)
+	assert.Equal(provider.CauseAccessDenied, report.Targets[1].Cause)
+	assert.Equal([]string{"projects/web-prod?labels.env:*"}, asset.queries)
+}
+
+func TestProviderClassifySuite(t *testing.T) {
+	assert := assert.New(t)
+	p := NewProvider(models.GCPSpec{}, nil)
+
+	fixtures := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "Test unauthenticated", err: &APIError{StatusCode: 401}, expected: provider.CauseAccessDenied},
+		{name: "Test permission denied", err: &APIError{StatusCode: 403}, expected: provider.CauseAccessDenied},
+		{name: "Test resource exhausted", err: &APIError{StatusCode: 429}, expected: provider.CauseThrottled},
+		{name: "Test server error", err: &APIError{StatusCode: 503}, expected: provider.CauseUnknown},
+		{name: "Test network", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: provider.CauseNetwork},
+		{name: "Test other", err: errors.New("invalid result"), expected: provider.CauseUnknown},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, p.Classify(fixture.err))
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package gcp
+
+import (
+	"strings"
+
+	"tagu/models"
+)
+
+// quote returns s as a search query string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// BuildQuery builds the searchAllResources query of the label filters
+// A filter with a key keeps the resources having the label and one of the values if
+// any. The filters with values only are applied by provider.MatchValues as the query can only
+// match words of any label
+// Args:
+// 		filters: []models.Tags
+// Returns:
+// 		string: the query, empty without label filter
+func BuildQuery(filters []models.Tags) string {
+	var terms []string
+	for _, filter := range filters {
+		switch {
+		case filter.Key == "":
+		case len(filter.Values) == 0:
+			terms = append(terms, "labels."+filter.Key+":*")
+		default:
+			var values []string
+			for _, value := range filter.Values {
+				values = append(values, "labels."+filter.Key+"="+quote(value))
+			}
+			terms = append(terms, "("+strings.Join(values, " OR ")+")")
+		}
+	}
+	return strings.Join(terms, " AND ")
+}
@@ -0,0 +1,38 @@
+package gcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+func TestBuildQuerySuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		filters  []models.Tags
+		expected string
+	}{
+		{
+			name: "Test no filter",
+		},
+		{
+			name: "Test every filter",
+			filters: []models.Tags{
+				{Key: "env", Values: []string{"prod", `say "hi"`}},
+				{Key: "owner"},
+				{Values: []string{"dev"}},
+			},
+			expected: `(labels.env="prod" OR labels.env="say \"hi\"") AND labels.owner:*`,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, BuildQuery(fixture.filters))
+		})
+	}
+}
@@ -6,9 +6,20 @@ require (
 	github.com/aws/aws-sdk-go-v2 v1.16.5
 	github.com/aws/aws-sdk-go-v2/config v1.15.11
 	github.com/aws/aws-sdk-go-v2/credentials v1.12.6
+	github.com/aws/aws-sdk-go-v2/service/ec2 v1.46.0
 	github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi v1.11.0 // direct
 	github.com/aws/aws-sdk-go-v2/service/sts v1.16.7
+	github.com/aws/smithy-go v1.11.3
+	github.com/prometheus/client_golang v1.12.2
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/spf13/cobra v1.5.0
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.12.0
 	github.com/stretchr/testify v1.7.1
+	github.com/xitongsys/parquet-go v1.6.2
+	github.com/xitongsys/parquet-go-source v0.0.0-20220315005136-aec0fe3e777c
+	github.com/xuri/excelize/v2 v2.6.1
+	golang.org/x/time v0.3.0
+	gopkg.in/yaml.v3 v3.0.0
+	modernc.org/sqlite v1.20.0
 )
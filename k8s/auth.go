@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"tagu/provider"
+)
+
+// execCommand runs an exec credentials plugin, replaced in the unittest
+var execCommand = func(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.Output()
+}
+
+// Authenticator sets the credentials of an API request
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+// BearerToken authenticates with a static token
+type BearerToken string
+
+// Authenticate sets the Authorization header
+func (t BearerToken) Authenticate(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// BasicAuth authenticates with a username and a password
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate sets the Authorization header
+func (b BasicAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	req.SetBasicAuth(b.Username, b.Password)
+	return nil
+}
+
+// ExecAuth gets the tokens from an exec credentials plugin, aws eks get-token or
+// gke-gcloud-auth-plugin for instance. A token is kept until its expiry, only the
+// plugins returning a token are supported
+type ExecAuth struct {
+	Config ExecConfig
+	cache  provider.TokenCache
+}
+
+// Authenticate sets the Authorization header with the cached or a new token
+func (e *ExecAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	token, err := e.cache.Get(ctx, e.fetch)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// fetch runs the plugin, a token without expirationTimestamp is kept for good
+func (e *ExecAuth) fetch(ctx context.Context) (string, time.Time, error) {
+	apiVersion := e.Config.APIVersion
+	if apiVersion == "" {
+		apiVersion = "client.authentication.k8s.io/v1"
+	}
+	info, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]bool{"interactive": false},
+	})
+	env := []string{"KUBERNETES_EXEC_INFO=" + string(info)}
+	for _, variable := range e.Config.Env {
+		env = append(env, variable.Name+"="+variable.Value)
+	}
+	out, err := execCommand(ctx, env, e.Config.Command, e.Config.Args...)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", time.Time{}, fmt.Errorf("exec %s: %s", e.Config.Command, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", time.Time{}, fmt.Errorf("exec %s: %w", e.Config.Command, err)
+	}
+	var credential struct {
+		Status struct {
+			Token               string    `json:"token"`
+			ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &credential); err != nil {
+		return "", time.Time{}, fmt.Errorf("exec %s: %w", e.Config.Command, err)
+	}
+	if credential.Status.Token == "" {
+		return "", time.Time{}, fmt.Errorf("exec %s: no token in the credential", e.Config.Command)
+	}
+	return credential.Status.Token, credential.Status.ExpirationTimestamp, nil
+}
@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticAuthSuite(t *testing.T) {
+	assert := assert.New(t)
+	req, _ := http.NewRequest(http.MethodGet, "https://cluster.example.com", nil)
+	assert.NoError(BearerToken("token").Authenticate(context.TODO(), req))
+	assert.Equal("Bearer token", req.Header.Get("Authorization"))
+
+	assert.NoError(BasicAuth{Username: "admin", Password: "secret"}.Authenticate(context.TODO(), req))
+	username, password, ok := req.BasicAuth()
+	assert.True(ok)
+	assert.Equal("admin", username)
+	assert.Equal("secret", password)
+}
+
+func TestExecAuthSuite(t *testing.T) {
+	assert := assert.New(t)
+	defer func(previous func(ctx context.Context, env []string, name string, args ...string) ([]byte, error)) {
+		execCommand = previous
+	}(execCommand)
+
+	calls := 0
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	execCommand = func(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+		calls++
+		assert.Equal("aws", name)
+		assert.Equal([]string{"eks", "get-token", "--cluster-name", "prod"}, args)
+		assert.True(strings.HasPrefix(env[0], `KUBERNETES_EXEC_INFO={"apiVersion":"client.authentication.k8s.io/v1beta1"`), env[0])
+		assert.Equal("AWS_PROFILE=ops", env[1])
+		return []byte(`{"kind": "ExecCredential", "status": {"token": "k8s-aws-v1.token", "expirationTimestamp": "` + expires + `"}}`), nil
+	}
+
+	auth := &ExecAuth{Config: ExecConfig{
+		APIVersion: "client.authentication.k8s.io/v1beta1",
+		Command:    "aws",
+		Args:       []string{"eks", "get-token", "--cluster-name", "prod"},
+		Env:        []ExecEnv{{Name: "AWS_PROFILE", Value: "ops"}},
+	}}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://cluster.example.com", nil)
+		assert.NoError(auth.Authenticate(context.TODO(), req))
+		assert.Equal("Bearer k8s-aws-v1.token", req.Header.Get("Authorization"))
+	}
+	assert.Equal(1, calls, "the token is cached until its expiry")
+
+	fixtures := []struct {
+		name string
+		out  string
+		err  error
+		want string
+	}{
+		{name: "Test the plugin fails", err: errors.New("executable file not found in $PATH"), want: "exec aws: executable file not found in $PATH"},
+		{name: "Test the plugin returns no token", out: `{"status": {"clientCertificateData": "cert"}}`, want: "exec aws: no token in the credential"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			execCommand = func(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+				return []byte(fixture.out), fixture.err
+			}
+			req, _ := http.NewRequest(http.MethodGet, "https://cluster.example.com", nil)
+			err := (&ExecAuth{Config: ExecConfig{Command: "aws"}}).Authenticate(context.TODO(), req)
+			assert.EqualError(err, fixture.want)
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tagu/provider"
+)
+
+// DefaultPageSize is the limit of the list calls
+const DefaultPageSize = 500
+
+// APIError is a failure Status answered by the API server
+type APIError struct {
+	StatusCode int
+	Reason     string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("k8s: status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("k8s: status %d: %s: %s", e.StatusCode, e.Reason, e.Message)
+}
+
+// HTTPStatus returns the status code of the answer
+func (e *APIError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// APIResource is a resource kind served by the API server
+type APIResource struct {
+	Group      string
+	Version    string
+	Name       string
+	Kind       string
+	Namespaced bool
+}
+
+// Type returns the group/Kind of the resource, the Kind alone for the core group
+func (r APIResource) Type() string {
+	if r.Group == "" {
+		return r.Kind
+	}
+	return r.Group + "/" + r.Kind
+}
+
+// path returns the list path of the resource in the namespace, every namespace when empty
+func (r APIResource) path(namespace string) string {
+	prefix := "/api/" + r.Version
+	if r.Group != "" {
+		prefix = "/apis/" + r.Group + "/" + r.Version
+	}
+	if r.Namespaced && namespace != "" {
+		prefix += "/namespaces/" + url.PathEscape(namespace)
+	}
+	return prefix + "/" + r.Name
+}
+
+// Object is the metadata of a listed object
+type Object struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+// Client calls the API server of a cluster, the throttled and the failed calls are retried
+// params:
+// 		server: string, the API server URL
+// 		auth: Authenticator, nil for the client certificates and the anonymous users
+// 		pageSize: int, DefaultPageSize when zero
+// 		maxAttempts: int, the attempts of each call, 3 when zero
+// 		backoff: time.Duration, the delay before the second attempt doubled on each attempt,
+// 		a Retry-After header takes precedence
+type Client struct {
+	Server      string
+	HTTPClient  *http.Client
+	Auth        Authenticator
+	PageSize    int
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// discoveryResource is a resource of an APIResourceList
+type discoveryResource struct {
+	Name         string   `json:"name"`
+	SingularName string   `json:"singularName"`
+	Namespaced   bool     `json:"namespaced"`
+	Kind         string   `json:"kind"`
+	ShortNames   []string `json:"shortNames"`
+	Verbs        []string `json:"verbs"`
+}
+
+// Resolve finds a kind written as resource[.group], the resource is matched with
+// the plural, the singular, the short names or the Kind of the group resources
+// Args:
+// 		ctx: context.Context
+// 		kind: string, pods, deploy.apps or Ingress.networking.k8s.io for instance
+// Returns:
+// 		APIResource: the resource in the preferred version of its group
+// 		error: if the kind is unknown or can not be listed
+func (c *Client) Resolve(ctx context.Context, kind string) (APIResource, error) {
+	name, group := kind, ""
+	if i := strings.Index(kind, "."); i > 0 {
+		name, group = kind[:i], kind[i+1:]
+	}
+	resource := APIResource{Group: group, Version: "v1"}
+	path := "/api/v1"
+	if group != "" {
+		var apiGroup struct {
+			PreferredVersion struct {
+				Version string `json:"version"`
+			} `json:"preferredVersion"`
+		}
+		if err := c.get(ctx, "/apis/"+group, &apiGroup); err != nil {
+			return resource, fmt.Errorf("kind %s: %w", kind, err)
+		}
+		resource.Version = apiGroup.PreferredVersion.Version
+		path = "/apis/" + group + "/" + resource.Version
+	}
+	var list struct {
+		Resources []discoveryResource `json:"resources"`
+	}
+	if err := c.get(ctx, path, &list); err != nil {
+		return resource, fmt.Errorf("kind %s: %w", kind, err)
+	}
+	for _, r := range list.Resources {
+		if strings.Contains(r.Name, "/") || !matchKind(name, r) {
+			continue
+		}
+		for _, verb := range r.Verbs {
+			if verb == "list" {
+				resource.Name, resource.Kind, resource.Namespaced = r.Name, r.Kind, r.Namespaced
+				return resource, nil
+			}
+		}
+		return resource, fmt.Errorf("kind %s can not be listed", kind)
+	}
+	return resource, fmt.Errorf("unknown kind %s", kind)
+}
+
+func matchKind(name string, r discoveryResource) bool {
+	if strings.EqualFold(name, r.Name) || strings.EqualFold(name, r.SingularName) || strings.EqualFold(name, r.Kind) {
+		return true
+	}
+	for _, short := range r.ShortNames {
+		if strings.EqualFold(name, short) {
+			return true
+		}
+	}
+	return false
+}
+
+// List lists the objects of the resource and follows the pages, onObject is called
+// with each object. When the continue token expired the list is restarted once from
+// the first page and the objects already seen are skipped
+// Args:
+// 		ctx: context.Context
+// 		resource: APIResource
+// 		namespace: string, every namespace when empty, ignored by the cluster resources
+// 		selector: string, the label selector
+// 		onObject: func(Object) error, stops the list on error
+// Returns:
+// 		error: if a page can not be fetched or onObject failed
+func (c *Client) List(ctx context.Context, resource APIResource, namespace, selector string, onObject func(Object) error) error {
+	params := url.Values{}
+	pageSize := c.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	params.Set("limit", strconv.Itoa(pageSize))
+	if selector != "" {
+		params.Set("labelSelector", selector)
+	}
+	seen := map[string]bool{}
+	restarted := false
+	for {
+		var page struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []Object `json:"items"`
+		}
+		err := c.get(ctx, resource.path(namespace)+"?"+params.Encode(), &page)
+		var apiErr *APIError
+		if params.Get("continue") != "" && !restarted && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusGone {
+			// The continue token is too old, restart the list from the first page
+			params.Del("continue")
+			restarted = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			key := item.Metadata.Namespace + "/" + item.Metadata.Name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if err := onObject(item); err != nil {
+				return err
+			}
+		}
+		if page.Metadata.Continue == "" {
+			return nil
+		}
+		params.Set("continue", page.Metadata.Continue)
+	}
+}
+
+// get decodes the response of the path, the 429 and 5xx answers are retried
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	caller := provider.HTTPCaller{Client: c.HTTPClient, MaxAttempts: c.MaxAttempts, Backoff: c.Backoff}
+	return caller.Call(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Server+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if c.Auth != nil {
+			if err := c.Auth.Authenticate(ctx, req); err != nil {
+				return nil, fmt.Errorf("k8s credentials: %w", err)
+			}
+		}
+		return req, nil
+	}, decodeError, out)
+}
+
+// decodeError returns the APIError of a failure Status
+func decodeError(status int, body []byte) error {
+	apiErr := &APIError{StatusCode: status, Message: http.StatusText(status)}
+	var failure struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &failure) == nil && failure.Message != "" {
+		apiErr.Reason, apiErr.Message = failure.Reason, failure.Message
+	}
+	return apiErr
+}
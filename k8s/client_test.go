@@ -0,0 +1,230 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeObject is an object served by fakeAPIServer
+type fakeObject struct {
+	name, namespace string
+	labels          map[string]string
+	annotations     map[string]string
+}
+
+// fakeAPIServer serves the discovery of the core and the apps groups and the
+// objects of each list path in pages of two objects, the continue token is the
+// offset of the next page. The secrets answer 403, the first throttled calls 429
+// and the first expired calls with a continue token 410
+type fakeAPIServer struct {
+	mu        sync.Mutex
+	token     string
+	objects   map[string][]fakeObject
+	throttled int
+	expired   int
+	requests  []string
+}
+
+var fakeDiscovery = map[string]interface{}{
+	"/api/v1": map[string]interface{}{"resources": []map[string]interface{}{
+		{"name": "namespaces", "singularName": "namespace", "namespaced": false, "kind": "Namespace", "shortNames": []string{"ns"}, "verbs": []string{"get", "list"}},
+		{"name": "pods", "singularName": "pod", "namespaced": true, "kind": "Pod", "shortNames": []string{"po"}, "verbs": []string{"get", "list"}},
+		{"name": "pods/log", "singularName": "", "namespaced": true, "kind": "Pod", "verbs": []string{"get"}},
+		{"name": "secrets", "singularName": "secret", "namespaced": true, "kind": "Secret", "verbs": []string{"get", "list"}},
+		{"name": "bindings", "singularName": "binding", "namespaced": true, "kind": "Binding", "verbs": []string{"create"}},
+	}},
+	"/apis/apps":    map[string]interface{}{"name": "apps", "preferredVersion": map[string]string{"groupVersion": "apps/v1", "version": "v1"}},
+	"/apis/apps/v1": map[string]interface{}{"resources": []map[string]interface{}{{"name": "deployments", "singularName": "deployment", "namespaced": true, "kind": "Deployment", "shortNames": []string{"deploy"}, "verbs": []string{"list"}}}},
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := func(code int, reason, message string) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "status": "Failure", "reason": reason, "message": message, "code": code})
+	}
+	if f.token != "" && r.Header.Get("Authorization") != "Bearer "+f.token {
+		status(http.StatusUnauthorized, "Unauthorized", "Unauthorized")
+		return
+	}
+	if f.throttled > 0 {
+		f.throttled--
+		status(http.StatusTooManyRequests, "TooManyRequests", "too many requests")
+		return
+	}
+	f.requests = append(f.requests, r.URL.RequestURI())
+	if discovery, ok := fakeDiscovery[r.URL.Path]; ok {
+		json.NewEncoder(w).Encode(discovery)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/secrets") {
+		status(http.StatusForbidden, "Forbidden", `secrets is forbidden: User "scanner" cannot list resource "secrets"`)
+		return
+	}
+	objects, ok := f.objects[r.URL.Path]
+	if !ok {
+		status(http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+		return
+	}
+	if f.expired > 0 && r.URL.Query().Get("continue") != "" {
+		f.expired--
+		status(http.StatusGone, "Expired", "The provided continue parameter is too old to display a consistent list result.")
+		return
+	}
+	start, _ := strconv.Atoi(r.URL.Query().Get("continue"))
+	end := start + 2
+	page := map[string]interface{}{"metadata": map[string]string{}}
+	if end < len(objects) {
+		page["metadata"] = map[string]string{"continue": strconv.Itoa(end)}
+	} else {
+		end = len(objects)
+	}
+	var items []interface{}
+	for _, o := range objects[start:end] {
+		items = append(items, map[string]interface{}{"metadata": map[string]interface{}{"name": o.name, "namespace": o.namespace, "labels": o.labels, "annotations": o.annotations}})
+	}
+	page["items"] = items
+	json.NewEncoder(w).Encode(page)
+}
+
+func newFakeClient(server *fakeAPIServer) (*Client, func()) {
+	s := httptest.NewServer(server)
+	return &Client{Server: s.URL, HTTPClient: s.Client(), Backoff: time.Millisecond}, s.Close
+}
+
+func TestClientResolveSuite(t *testing.T) {
+	assert := assert.New(t)
+	client, stop := newFakeClient(&fakeAPIServer{})
+	defer stop()
+
+	fixtures := []struct {
+		name     string
+		kind     string
+		expected APIResource
+		err      string
+	}{
+		{name: "Test a core resource", kind: "pods", expected: APIResource{Version: "v1", Name: "pods", Kind: "Pod", Namespaced: true}},
+		{name: "Test a short name", kind: "ns", expected: APIResource{Version: "v1", Name: "namespaces", Kind: "Namespace"}},
+		{name: "Test a grouped Kind", kind: "Deployment.apps", expected: APIResource{Group: "apps", Version: "v1", Name: "deployments", Kind: "Deployment", Namespaced: true}},
+		{name: "Test a resource that can not be listed", kind: "bindings", err: "kind bindings can not be listed"},
+		{name: "Test an unknown kind", kind: "widgets", err: "unknown kind widgets"},
+		{name: "Test an unknown group", kind: "widgets.example.com", err: "kind widgets.example.com: k8s: status 404: NotFound: the server could not find the requested resource"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			resource, err := client.Resolve(context.TODO(), fixture.kind)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.expected, resource)
+		})
+	}
+}
+
+func TestAPIResourceSuite(t *testing.T) {
+	assert := assert.New(t)
+	pods := APIResource{Version: "v1", Name: "pods", Kind: "Pod", Namespaced: true}
+	deployments := APIResource{Group: "apps", Version: "v1", Name: "deployments", Kind: "Deployment", Namespaced: true}
+	nodes := APIResource{Version: "v1", Name: "nodes", Kind: "Node"}
+
+	assert.Equal("Pod", pods.Type())
+	assert.Equal("apps/Deployment", deployments.Type())
+	assert.Equal("/api/v1/pods", pods.path(""))
+	assert.Equal("/api/v1/namespaces/web/pods", pods.path("web"))
+	assert.Equal("/apis/apps/v1/namespaces/web/deployments", deployments.path("web"))
+	assert.Equal("/api/v1/nodes", nodes.path("web"))
+}
+
+func TestClientListSuite(t *testing.T) {
+	assert := assert.New(t)
+	pods := APIResource{Version: "v1", Name: "pods", Kind: "Pod", Namespaced: true}
+	var objects []fakeObject
+	for i := 0; i < 5; i++ {
+		objects = append(objects, fakeObject{name: "pod-" + strconv.Itoa(i), namespace: "web"})
+	}
+
+	fixtures := []struct {
+		name     string
+		server   *fakeAPIServer
+		auth     Authenticator
+		names    []string
+		requests int
+		err      string
+	}{
+		{
+			name:     "Test the pages are followed",
+			server:   &fakeAPIServer{objects: map[string][]fakeObject{"/api/v1/namespaces/web/pods": objects}},
+			names:    []string{"pod-0", "pod-1", "pod-2", "pod-3", "pod-4"},
+			requests: 3,
+		},
+		{
+			name:     "Test the token and the throttled calls",
+			server:   &fakeAPIServer{token: "secret", throttled: 2, objects: map[string][]fakeObject{"/api/v1/namespaces/web/pods": objects[:1]}},
+			auth:     BearerToken("secret"),
+			names:    []string{"pod-0"},
+			requests: 1,
+		},
+		{
+			name:     "Test an expired continue token restarts the list",
+			server:   &fakeAPIServer{expired: 1, objects: map[string][]fakeObject{"/api/v1/namespaces/web/pods": objects}},
+			names:    []string{"pod-0", "pod-1", "pod-2", "pod-3", "pod-4"},
+			requests: 5,
+		},
+		{
+			name:     "Test the list is restarted once",
+			server:   &fakeAPIServer{expired: 2, objects: map[string][]fakeObject{"/api/v1/namespaces/web/pods": objects}},
+			names:    []string{"pod-0", "pod-1"},
+			requests: 4,
+			err:      "k8s: status 410: Expired: The provided continue parameter is too old to display a consistent list result.",
+		},
+		{
+			name:   "Test an invalid token is not retried",
+			server: &fakeAPIServer{token: "secret", throttled: 3},
+			auth:   BearerToken("expired"),
+			err:    "k8s: status 401: Unauthorized: Unauthorized",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			client, stop := newFakeClient(fixture.server)
+			defer stop()
+			client.Auth = fixture.auth
+			var names []string
+			err := client.List(context.TODO(), pods, "web", "app in (web)", func(o Object) error {
+				names = append(names, o.Metadata.Name)
+				return nil
+			})
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(fixture.names, names)
+			assert.Len(fixture.server.requests, fixture.requests)
+			for _, request := range fixture.server.requests {
+				assert.True(strings.HasPrefix(request, "/api/v1/namespaces/web/pods?"), request)
+				assert.True(strings.HasSuffix(request, "labelSelector=app+in+%28web%29&limit=500"), request)
+			}
+		})
+	}
+
+	client, stop := newFakeClient(&fakeAPIServer{objects: map[string][]fakeObject{"/api/v1/pods": objects}})
+	defer stop()
+	err := client.List(context.TODO(), pods, "", "", func(o Object) error { return errors.New("invalid object") })
+	assert.EqualError(err, "invalid object")
+}
@@ -0,0 +1,269 @@
+package k8s
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kubeconfig is the content of the kubeconfig files, the clusters, the users and the contexts
+type Kubeconfig struct {
+	CurrentContext string         `yaml:"current-context"`
+	Clusters       []NamedCluster `yaml:"clusters"`
+	Users          []NamedUser    `yaml:"users"`
+	Contexts       []NamedContext `yaml:"contexts"`
+}
+
+// NamedCluster is a cluster of the kubeconfig
+type NamedCluster struct {
+	Name    string  `yaml:"name"`
+	Cluster Cluster `yaml:"cluster"`
+}
+
+// Cluster is the API server of a cluster and its certificate authority
+type Cluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+	TLSServerName            string `yaml:"tls-server-name"`
+}
+
+// NamedUser is a user of the kubeconfig
+type NamedUser struct {
+	Name string   `yaml:"name"`
+	User AuthInfo `yaml:"user"`
+}
+
+// AuthInfo is the credentials of a user, a client certificate, a token,
+// a basic auth or an exec plugin
+type AuthInfo struct {
+	ClientCertificate     string      `yaml:"client-certificate"`
+	ClientCertificateData string      `yaml:"client-certificate-data"`
+	ClientKey             string      `yaml:"client-key"`
+	ClientKeyData         string      `yaml:"client-key-data"`
+	Token                 string      `yaml:"token"`
+	TokenFile             string      `yaml:"tokenFile"`
+	Username              string      `yaml:"username"`
+	Password              string      `yaml:"password"`
+	Exec                  *ExecConfig `yaml:"exec"`
+}
+
+// ExecConfig is the command of an exec credentials plugin
+type ExecConfig struct {
+	APIVersion string    `yaml:"apiVersion"`
+	Command    string    `yaml:"command"`
+	Args       []string  `yaml:"args"`
+	Env        []ExecEnv `yaml:"env"`
+}
+
+// ExecEnv is a variable set for an exec credentials plugin
+type ExecEnv struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// NamedContext is a context of the kubeconfig
+type NamedContext struct {
+	Name    string  `yaml:"name"`
+	Context Context `yaml:"context"`
+}
+
+// Context binds a cluster and a user
+type Context struct {
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace"`
+}
+
+// DefaultKubeconfig returns the files of KUBECONFIG, $HOME/.kube/config when not set
+// Args:
+// 		getenv: func(string) string, os.Getenv
+// Returns:
+// 		[]string
+func DefaultKubeconfig(getenv func(string) string) []string {
+	if paths := getenv("KUBECONFIG"); paths != "" {
+		return filepath.SplitList(paths)
+	}
+	return []string{filepath.Join(getenv("HOME"), ".kube", "config")}
+}
+
+// LoadKubeconfig reads and merges the kubeconfig files like kubectl, the first file
+// setting a name or the current context wins. The relative files of the clusters
+// and the users are resolved from the directory of their kubeconfig
+// Args:
+// 		paths: []string
+// Returns:
+// 		*Kubeconfig
+// 		error: if a file can not be read or parsed
+func LoadKubeconfig(paths []string) (*Kubeconfig, error) {
+	merged := &Kubeconfig{}
+	clusters, users, contexts := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var config Kubeconfig
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("invalid kubeconfig %s: %w", path, err)
+		}
+		dir := filepath.Dir(path)
+		if merged.CurrentContext == "" {
+			merged.CurrentContext = config.CurrentContext
+		}
+		for _, cluster := range config.Clusters {
+			if !clusters[cluster.Name] {
+				clusters[cluster.Name] = true
+				cluster.Cluster.CertificateAuthority = resolve(dir, cluster.Cluster.CertificateAuthority)
+				merged.Clusters = append(merged.Clusters, cluster)
+			}
+		}
+		for _, user := range config.Users {
+			if !users[user.Name] {
+				users[user.Name] = true
+				user.User.ClientCertificate = resolve(dir, user.User.ClientCertificate)
+				user.User.ClientKey = resolve(dir, user.User.ClientKey)
+				user.User.TokenFile = resolve(dir, user.User.TokenFile)
+				merged.Users = append(merged.Users, user)
+			}
+		}
+		for _, context := range config.Contexts {
+			if !contexts[context.Name] {
+				contexts[context.Name] = true
+				merged.Contexts = append(merged.Contexts, context)
+			}
+		}
+	}
+	return merged, nil
+}
+
+func resolve(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// ContextNames returns the names of the contexts in the kubeconfig order
+func (k *Kubeconfig) ContextNames() []string {
+	var names []string
+	for _, context := range k.Contexts {
+		names = append(names, context.Name)
+	}
+	return names
+}
+
+// Client builds the API client of a context
+// Args:
+// 		name: string, the context name
+// Returns:
+// 		*Client: the client of the context cluster authenticated as the context user
+// 		error: if the context, its cluster or its user are invalid
+func (k *Kubeconfig) Client(name string) (*Client, error) {
+	var context *Context
+	for i := range k.Contexts {
+		if k.Contexts[i].Name == name {
+			context = &k.Contexts[i].Context
+		}
+	}
+	if context == nil {
+		return nil, fmt.Errorf("unknown context %q", name)
+	}
+	var cluster *Cluster
+	for i := range k.Clusters {
+		if k.Clusters[i].Name == context.Cluster {
+			cluster = &k.Clusters[i].Cluster
+		}
+	}
+	if cluster == nil || cluster.Server == "" {
+		return nil, fmt.Errorf("context %q: unknown cluster %q", name, context.Cluster)
+	}
+	user := AuthInfo{}
+	for i := range k.Users {
+		if k.Users[i].Name == context.User {
+			user = k.Users[i].User
+		}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cluster.InsecureSkipTLSVerify, ServerName: cluster.TLSServerName}
+	ca, err := readData(cluster.CertificateAuthorityData, cluster.CertificateAuthority)
+	if err != nil {
+		return nil, fmt.Errorf("context %q: certificate authority: %w", name, err)
+	}
+	if ca != nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("context %q: invalid certificate authority", name)
+		}
+	}
+	cert, err := readData(user.ClientCertificateData, user.ClientCertificate)
+	if err != nil {
+		return nil, fmt.Errorf("context %q: client certificate: %w", name, err)
+	}
+	key, err := readData(user.ClientKeyData, user.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("context %q: client key: %w", name, err)
+	}
+	if cert != nil || key != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("context %q: client certificate: %w", name, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	auth, err := authenticator(user)
+	if err != nil {
+		return nil, fmt.Errorf("context %q: %w", name, err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		Server:     strings.TrimSuffix(cluster.Server, "/"),
+		HTTPClient: &http.Client{Transport: transport},
+		Auth:       auth,
+	}, nil
+}
+
+// readData returns the base64 data if set, otherwise the content of the file if set
+func readData(data, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
+
+// authenticator returns the request authentication of the user, nil for the
+// client certificates and the anonymous users
+func authenticator(user AuthInfo) (Authenticator, error) {
+	switch {
+	case user.Exec != nil:
+		return &ExecAuth{Config: *user.Exec}, nil
+	case user.Token != "":
+		return BearerToken(user.Token), nil
+	case user.TokenFile != "":
+		token, err := os.ReadFile(user.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return BearerToken(strings.TrimSpace(string(token))), nil
+	case user.Username != "" || user.Password != "":
+		if user.Username == "" {
+			return nil, errors.New("basic auth without username")
+		}
+		return BasicAuth{Username: user.Username, Password: user.Password}, nil
+	}
+	return nil, nil
+}
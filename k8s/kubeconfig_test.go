@@ -0,0 +1,148 @@
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) string {
+	t.Helper()
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestDefaultKubeconfigSuite(t *testing.T) {
+	assert := assert.New(t)
+	env := map[string]string{"HOME": "/home/ops"}
+	getenv := func(name string) string { return env[name] }
+	assert.Equal([]string{"/home/ops/.kube/config"}, DefaultKubeconfig(getenv))
+	env["KUBECONFIG"] = "/etc/a" + string(filepath.ListSeparator) + "/etc/b"
+	assert.Equal([]string{"/etc/a", "/etc/b"}, DefaultKubeconfig(getenv))
+}
+
+func TestLoadKubeconfigSuite(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	first := writeFile(t, filepath.Join(dir, "first"), `
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com
+    certificate-authority: certs/ca.pem
+contexts:
+- name: prod
+  context: {cluster: prod, user: admin, namespace: web}
+users:
+- name: admin
+  user:
+    tokenFile: /var/run/token
+`)
+	second := writeFile(t, filepath.Join(dir, "second"), `
+current-context: dev
+clusters:
+- name: prod
+  cluster: {server: https://other.example.com}
+- name: dev
+  cluster: {server: https://dev.example.com}
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev}
+users:
+- name: dev
+  user: {client-certificate: dev.crt, client-key: dev.key}
+`)
+
+	config, err := LoadKubeconfig([]string{first, second})
+	assert.NoError(err)
+	assert.Equal(&Kubeconfig{
+		CurrentContext: "prod",
+		Clusters: []NamedCluster{
+			{Name: "prod", Cluster: Cluster{Server: "https://prod.example.com", CertificateAuthority: filepath.Join(dir, "certs", "ca.pem")}},
+			{Name: "dev", Cluster: Cluster{Server: "https://dev.example.com"}},
+		},
+		Users: []NamedUser{
+			{Name: "admin", User: AuthInfo{TokenFile: "/var/run/token"}},
+			{Name: "dev", User: AuthInfo{ClientCertificate: filepath.Join(dir, "dev.crt"), ClientKey: filepath.Join(dir, "dev.key")}},
+		},
+		Contexts: []NamedContext{
+			{Name: "prod", Context: Context{Cluster: "prod", User: "admin", Namespace: "web"}},
+			{Name: "dev", Context: Context{Cluster: "dev", User: "dev"}},
+		},
+	}, config)
+	assert.Equal([]string{"prod", "dev"}, config.ContextNames())
+
+	_, err = LoadKubeconfig([]string{filepath.Join(dir, "missing")})
+	assert.Error(err)
+	_, err = LoadKubeconfig([]string{writeFile(t, filepath.Join(dir, "invalid"), "clusters: {")})
+	assert.Error(err)
+}
+
+func TestKubeconfigClientSuite(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer file-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"resources": [{"name": "pods", "kind": "Pod", "namespaced": true, "verbs": ["list"]}]}`))
+	}))
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	tokenFile := writeFile(t, filepath.Join(t.TempDir(), "token"), "file-token\n")
+
+	config := &Kubeconfig{
+		Clusters: []NamedCluster{
+			{Name: "test", Cluster: Cluster{Server: server.URL + "/", CertificateAuthorityData: base64.StdEncoding.EncodeToString(ca)}},
+			{Name: "untrusted", Cluster: Cluster{Server: server.URL}},
+			{Name: "invalid-ca", Cluster: Cluster{Server: server.URL, CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte("not a certificate"))}},
+		},
+		Users: []NamedUser{
+			{Name: "scanner", User: AuthInfo{TokenFile: tokenFile}},
+			{Name: "password-only", User: AuthInfo{Password: "secret"}},
+		},
+		Contexts: []NamedContext{
+			{Name: "test", Context: Context{Cluster: "test", User: "scanner"}},
+			{Name: "untrusted", Context: Context{Cluster: "untrusted", User: "scanner"}},
+			{Name: "invalid-ca", Context: Context{Cluster: "invalid-ca"}},
+			{Name: "no-cluster", Context: Context{Cluster: "missing"}},
+			{Name: "password-only", Context: Context{Cluster: "test", User: "password-only"}},
+		},
+	}
+
+	client, err := config.Client("test")
+	assert.NoError(err)
+	assert.Equal(server.URL, client.Server)
+	resource, err := client.Resolve(context.TODO(), "pods")
+	assert.NoError(err)
+	assert.Equal("Pod", resource.Kind)
+
+	client, err = config.Client("untrusted")
+	assert.NoError(err)
+	_, err = client.Resolve(context.TODO(), "pods")
+	assert.Error(err, "the server certificate is not trusted")
+
+	fixtures := []struct {
+		name string
+		err  string
+	}{
+		{name: "invalid-ca", err: `context "invalid-ca": invalid certificate authority`},
+		{name: "no-cluster", err: `context "no-cluster": unknown cluster "missing"`},
+		{name: "password-only", err: `context "password-only": basic auth without username`},
+		{name: "missing", err: `unknown context "missing"`},
+	}
+	for _, fixture := range fixtures {
+		t.Run("Test the context "+fixture.name, func(t *testing.T) {
+			_, err := config.Client(fixture.name)
+			assert.EqualError(err, fixture.err)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"tagu/models"
+	"tagu/provider"
+)
+
+const (
+	// ProviderName is the name of the Kubernetes provider
+	ProviderName = "k8s"
+	// AnnotationPrefix prefixes the annotation keys in the tags, a label key can not
+	// contain a colon so the annotations never collide with the labels
+	AnnotationPrefix = "annotation:"
+	// lastAppliedAnnotation holds a copy of the object applied by kubectl, it is skipped
+	lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// DefaultKinds are the kinds listed when the spec has none
+var DefaultKinds = []string{
+	"namespaces",
+	"nodes",
+	"services",
+	"persistentvolumeclaims",
+	"deployments.apps",
+	"statefulsets.apps",
+	"daemonsets.apps",
+	"cronjobs.batch",
+	"ingresses.networking.k8s.io",
+}
+
+// Provider lists the objects of the spec kinds, a target is a kubeconfig context
+type Provider struct {
+	spec   models.KubernetesSpec
+	config *Kubeconfig
+}
+
+// NewProvider creates the provider of the spec
+// Args:
+// 		spec: models.KubernetesSpec
+// 		config: *Kubeconfig
+// Returns:
+// 		*Provider
+func NewProvider(spec models.KubernetesSpec, config *Kubeconfig) *Provider {
+	return &Provider{spec: spec, config: config}
+}
+
+// Name returns k8s
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// Targets returns the contexts of the spec, every context with all-contexts and
+// the current context otherwise
+func (p *Provider) Targets(ctx context.Context) ([]provider.Target, error) {
+	names := p.spec.Contexts
+	switch {
+	case p.spec.AllContexts:
+		names = p.config.ContextNames()
+	case len(names) == 0 && p.config.CurrentContext == "":
+		return nil, errors.New("the kubeconfig has no current context, set the contexts")
+	case len(names) == 0:
+		names = []string{p.config.CurrentContext}
+	}
+	known := map[string]bool{}
+	for _, name := range p.config.ContextNames() {
+		known[name] = true
+	}
+	var targets []provider.Target
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown context %q", name)
+		}
+		targets = append(targets, provider.Target{Scope: name})
+	}
+	return targets, nil
+}
+
+// KindsError holds the errors of the kinds that could not be resolved or listed,
+// the other kinds are still listed. It unwraps to the first error which gives the cause
+type KindsError struct {
+	Errs []error
+}
+
+func (e *KindsError) Error() string {
+	var messages []string
+	for _, err := range e.Errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the first error
+func (e *KindsError) Unwrap() error {
+	return e.Errs[0]
+}
+
+// Resources lists the objects of the kinds in the namespaces of the spec, the
+// namespaces are ignored by the cluster kinds. A kind or a namespace that can not be
+// listed is reported in a KindsError with the objects of the others
+func (p *Provider) Resources(ctx context.Context, target provider.Target) ([]provider.Resource, error) {
+	client, err := p.config.Client(target.Scope)
+	if err != nil {
+		return nil, err
+	}
+	kinds := p.spec.Kinds
+	if len(kinds) == 0 {
+		kinds = DefaultKinds
+	}
+	namespaces := p.spec.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	selector := BuildSelector(p.spec.FilterTags)
+
+	var resources []provider.Resource
+	var errs []error
+	for _, kind := range kinds {
+		if ctx.Err() != nil {
+			return resources, ctx.Err()
+		}
+		resource, err := client.Resolve(ctx, kind)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		scopes := namespaces
+		if !resource.Namespaced {
+			scopes = []string{""}
+		}
+		for _, namespace := range scopes {
+			err := client.List(ctx, resource, namespace, selector, func(o Object) error {
+				if !provider.MatchValues(p.spec.FilterTags, o.Metadata.Labels) {
+					return nil
+				}
+				id := o.Metadata.Name
+				if o.Metadata.Namespace != "" {
+					id = o.Metadata.Namespace + "/" + id
+				}
+				resources = append(resources, provider.Resource{
+					Provider: ProviderName,
+					Scope:    target.Scope,
+					Location: o.Metadata.Namespace,
+					Type:     resource.Type(),
+					ID:       id,
+					Tags:     ObjectTags(o, p.spec.Annotations),
+				})
+				return nil
+			})
+			if err != nil && namespace != "" {
+				errs = append(errs, fmt.Errorf("list %s in %s: %w", kind, namespace, err))
+			} else if err != nil {
+				errs = append(errs, fmt.Errorf("list %s: %w", kind, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return resources, &KindsError{Errs: errs}
+	}
+	return resources, nil
+}
+
+// ObjectTags returns the labels of the object followed by its annotations prefixed
+// with AnnotationPrefix when requested
+// Args:
+// 		o: Object
+// 		annotations: bool
+// Returns:
+// 		map[string]string
+func ObjectTags(o Object, annotations bool) map[string]string {
+	tags := map[string]string{}
+	for key, value := range o.Metadata.Labels {
+		tags[key] = value
+	}
+	if annotations {
+		for key, value := range o.Metadata.Annotations {
+			if key != lastAppliedAnnotation {
+				tags[AnnotationPrefix+key] = value
+			}
+		}
+	}
+	return tags
+}
+
+// BuildSelector builds the label selector of the filters with a key, a key with
+// values keeps the objects having one of the values
+// Args:
+// 		filters: []models.Tags
+// Returns:
+// 		string: the selector, empty without such filter
+func BuildSelector(filters []models.Tags) string {
+	var requirements []string
+	for _, filter := range filters {
+		switch {
+		case filter.Key == "":
+		case len(filter.Values) == 0:
+			requirements = append(requirements, filter.Key)
+		default:
+			requirements = append(requirements, filter.Key+" in ("+strings.Join(filter.Values, ",")+")")
+		}
+	}
+	return strings.Join(requirements, ",")
+}
+
+// Classify maps the API server errors to their cause
+func (p *Provider) Classify(err error) string {
+	return provider.ClassifyHTTP(err)
+}
@@ -0,0 +1,148 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+	"tagu/provider"
+)
+
+// fakeKubeconfig returns a kubeconfig with the contexts dev and prod pointing to server
+func fakeKubeconfig(server string) *Kubeconfig {
+	return &Kubeconfig{
+		CurrentContext: "dev",
+		Clusters:       []NamedCluster{{Name: "cluster", Cluster: Cluster{Server: server}}},
+		Users:          []NamedUser{{Name: "scanner", User: AuthInfo{Token: "secret"}}},
+		Contexts: []NamedContext{
+			{Name: "dev", Context: Context{Cluster: "cluster", User: "scanner"}},
+			{Name: "prod", Context: Context{Cluster: "cluster", User: "scanner"}},
+		},
+	}
+}
+
+func TestProviderTargetsSuite(t *testing.T) {
+	assert := assert.New(t)
+	config := fakeKubeconfig("https://cluster.example.com")
+
+	fixtures := []struct {
+		name     string
+		spec     models.KubernetesSpec
+		config   *Kubeconfig
+		expected []provider.Target
+		err      string
+	}{
+		{name: "Test the current context", config: config, expected: []provider.Target{{Scope: "dev"}}},
+		{name: "Test the listed contexts", spec: models.KubernetesSpec{Contexts: []string{"prod"}}, config: config, expected: []provider.Target{{Scope: "prod"}}},
+		{name: "Test all the contexts", spec: models.KubernetesSpec{AllContexts: true, Contexts: []string{"prod"}}, config: config, expected: []provider.Target{{Scope: "dev"}, {Scope: "prod"}}},
+		{name: "Test an unknown context", spec: models.KubernetesSpec{Contexts: []string{"staging"}}, config: config, err: `unknown context "staging"`},
+		{name: "Test no current context", config: &Kubeconfig{}, err: "the kubeconfig has no current context, set the contexts"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			targets, err := NewProvider(fixture.spec, fixture.config).Targets(context.TODO())
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.expected, targets)
+		})
+	}
+}
+
+func TestProviderScanSuite(t *testing.T) {
+	assert := assert.New(t)
+	api := &fakeAPIServer{token: "secret", objects: map[string][]fakeObject{
+		"/api/v1/namespaces": {
+			{name: "web", labels: map[string]string{"team": "web"}},
+			{name: "kube-system"},
+		},
+		"/api/v1/namespaces/web/pods": {
+			{name: "api-0", namespace: "web", labels: map[string]string{"app": "api", "team": "web"}, annotations: map[string]string{
+				"owner":               "ops@example.com",
+				lastAppliedAnnotation: `{"kind":"Pod"}`,
+			}},
+			{name: "api-1", namespace: "web", labels: map[string]string{"app": "api", "team": "data"}},
+		},
+		"/apis/apps/v1/namespaces/web/deployments": {
+			{name: "api", namespace: "web", labels: map[string]string{"team": "web"}},
+		},
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	spec := models.KubernetesSpec{
+		Namespaces:  []string{"web"},
+		Kinds:       []string{"namespaces", "pods", "deployments.apps"},
+		FilterTags:  []models.Tags{{Values: []string{"web"}}},
+		Annotations: true,
+	}
+	report, err := provider.Scan(context.TODO(), NewProvider(spec, fakeKubeconfig(server.URL)), provider.ScanOptions{Concurrency: 2})
+	assert.NoError(err)
+	assert.Equal([]provider.Resource{
+		{Provider: "k8s", Scope: "dev", Type: "Namespace", ID: "web", Tags: map[string]string{"team": "web"}},
+		{Provider: "k8s", Scope: "dev", Location: "web", Type: "Pod", ID: "web/api-0", Tags: map[string]string{"app": "api", "team": "web", "annotation:owner": "ops@example.com"}},
+		{Provider: "k8s", Scope: "dev", Location: "web", Type: "apps/Deployment", ID: "web/api", Tags: map[string]string{"team": "web"}},
+	}, report.Resources)
+	assert.Equal(provider.StatusOK, report.Targets[0].Status)
+	assert.Equal(3, report.Targets[0].Count)
+
+	t.Run("Test a forbidden kind fails the target with the other kinds", func(t *testing.T) {
+		spec := models.KubernetesSpec{Contexts: []string{"dev", "prod"}, Kinds: []string{"secrets", "nodes", "namespaces"}}
+		report, err := provider.Scan(context.TODO(), NewProvider(spec, fakeKubeconfig(server.URL)), provider.ScanOptions{})
+		assert.NoError(err)
+		assert.Len(report.Targets, 2)
+		for _, target := range report.Targets {
+			assert.Equal(provider.StatusFailed, target.Status)
+			assert.Equal(provider.CauseAccessDenied, target.Cause)
+			assert.Equal(2, target.Count, "the namespaces are kept")
+			assert.Contains(target.Error, "list secrets: k8s: status 403: Forbidden")
+			assert.Contains(target.Error, "; unknown kind nodes")
+		}
+	})
+}
+
+func TestBuildSelectorSuite(t *testing.T) {
+	assert := assert.New(t)
+	fixtures := []struct {
+		name     string
+		filters  []models.Tags
+		expected string
+	}{
+		{name: "Test no filter", expected: ""},
+		{name: "Test a key", filters: []models.Tags{{Key: "team"}}, expected: "team"},
+		{name: "Test keys and values", filters: []models.Tags{{Key: "team", Values: []string{"web", "data"}}, {Key: "env"}, {Values: []string{"prod"}}}, expected: "team in (web,data),env"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, BuildSelector(fixture.filters))
+		})
+	}
+}
+
+func TestObjectTagsSuite(t *testing.T) {
+	assert := assert.New(t)
+	o := Object{}
+	o.Metadata.Labels = map[string]string{"team": "web"}
+	o.Metadata.Annotations = map[string]string{"owner": "ops", lastAppliedAnnotation: "{}"}
+	assert.Equal(map[string]string{"team": "web"}, ObjectTags(o, false))
+	assert.Equal(map[string]string{"team": "web", "annotation:owner": "ops"}, ObjectTags(o, true))
+}
+
+func TestProviderClassifySuite(t *testing.T) {
+	assert := assert.New(t)
+	p := NewProvider(models.KubernetesSpec{}, &Kubeconfig{})
+	assert.Equal(provider.CauseAccessDenied, p.Classify(&APIError{StatusCode: 401}))
+	assert.Equal(provider.CauseAccessDenied, p.Classify(&APIError{StatusCode: 403}))
+	assert.Equal(provider.CauseThrottled, p.Classify(&APIError{StatusCode: 429}))
+	assert.Equal(provider.CauseUnknown, p.Classify(&APIError{StatusCode: 500}))
+	assert.Equal(provider.CauseNetwork, p.Classify(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.Equal(provider.CauseUnknown, p.Classify(errors.New("boom")))
+}
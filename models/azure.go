@@ -0,0 +1,15 @@
+package models
+
+// AzureSpec is the input of the Azure Resource Graph scan, it mirrors the
+// general AWS spec with the subscriptions in place of the accounts
+// params:
+// 		subscriptions: []string, every subscription readable by the credentials when empty
+// 		resourceGroups: []string, the resource groups kept in every subscription, all when empty
+// 		filterResources: []string, the resource types kept, microsoft.compute/virtualmachines for instance
+// 		filterTags: []Tags, the tag filters, a resource must match every filter
+type AzureSpec struct {
+	Subscriptions   []string `mapstructure:"subscriptions" json:"subscriptions,omitempty"`
+	ResourceGroups  []string `mapstructure:"resource-groups,omitempty" json:"resource-groups,omitempty"`
+	FilterResources []string `mapstructure:"resources,omitempty" json:"resources,omitempty"`
+	FilterTags      []Tags   `mapstructure:"filter-tags,omitempty" json:"filter-tags,omitempty"`
+}
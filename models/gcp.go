@@ -0,0 +1,17 @@
+package models
+
+// GCPSpec is the input of the Cloud Asset Inventory scan, the projects of the
+// folders and the organizations are discovered
+// params:
+// 		projects: []string, the project ids
+// 		folders: []string, the folder numbers
+// 		organizations: []string, the organization numbers
+// 		filterResources: []string, the asset types kept, compute.googleapis.com/Instance for instance
+// 		filterTags: []Tags, the label filters, a resource must match every filter
+type GCPSpec struct {
+	Projects        []string `mapstructure:"projects,omitempty" json:"projects,omitempty"`
+	Folders         []string `mapstructure:"folders,omitempty" json:"folders,omitempty"`
+	Organizations   []string `mapstructure:"organizations,omitempty" json:"organizations,omitempty"`
+	FilterResources []string `mapstructure:"resources,omitempty" json:"resources,omitempty"`
+	FilterTags      []Tags   `mapstructure:"filter-tags,omitempty" json:"filter-tags,omitempty"`
+}
@@ -1,22 +1,22 @@
 package models
 
 type Tags struct {
-	Key    string   `mapstructure:"key,omitempty"`
-	Values []string `mapstructure:"values,omitempty"`
+	Key    string   `mapstructure:"key,omitempty" json:"key,omitempty"`
+	Values []string `mapstructure:"values,omitempty" json:"values,omitempty"`
 }
 
 type InputTag struct {
-	Account         string   `mapstructure:"account"`
-	Regions         []string `mapstructure:"regions"`
-	FilterResources []string `mapstructure:"resources,omitempty"`
-	FilterTags      []Tags   `mapstructure:"filter-tags,omitempty"`
+	Account         string   `mapstructure:"account" json:"account"`
+	Regions         []string `mapstructure:"regions" json:"regions"`
+	FilterResources []string `mapstructure:"resources,omitempty" json:"resources,omitempty"`
+	FilterTags      []Tags   `mapstructure:"filter-tags,omitempty" json:"filter-tags,omitempty"`
 }
 
 // Spec is the input data passed to
 // the AWS resourcegroupstaggingapi to filter fetched resources
 type Spec struct {
-	RoleName    string     `mapstructure:"role-name"`
-	FilterInput []InputTag `mapstructure:"filter-input"`
+	RoleName    string     `mapstructure:"role-name" json:"role-name,omitempty"`
+	FilterInput []InputTag `mapstructure:"filter-input" json:"filter-input"`
 }
 
 type GeneralSpec struct {
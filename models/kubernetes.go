@@ -0,0 +1,18 @@
+package models
+
+// KubernetesSpec is the input of the Kubernetes scan
+// params:
+// 		contexts: []string, the kubeconfig contexts scanned, the current context when empty
+// 		allContexts: bool, scan every context of the kubeconfig
+// 		namespaces: []string, the namespaces of the namespaced kinds, all when empty
+// 		kinds: []string, the resource kinds as resource[.group], deployments.apps for instance
+// 		filterTags: []Tags, the label filters, a resource must match every filter
+// 		annotations: bool, emit the annotations with the labels
+type KubernetesSpec struct {
+	Contexts    []string `mapstructure:"contexts,omitempty" json:"contexts,omitempty"`
+	AllContexts bool     `mapstructure:"all-contexts,omitempty" json:"all-contexts,omitempty"`
+	Namespaces  []string `mapstructure:"namespaces,omitempty" json:"namespaces,omitempty"`
+	Kinds       []string `mapstructure:"kinds,omitempty" json:"kinds,omitempty"`
+	FilterTags  []Tags   `mapstructure:"filter-tags,omitempty" json:"filter-tags,omitempty"`
+	Annotations bool     `mapstructure:"annotations,omitempty" json:"annotations,omitempty"`
+}
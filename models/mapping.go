@@ -0,0 +1,9 @@
+package models
+
+// Mapping is the remediation mapping of the tag keys and values variants
+// keys maps a key variant to its canonical key, values maps a value variant
+// to its canonical value for each canonical key
+type Mapping struct {
+	Keys   map[string]string            `mapstructure:"keys,omitempty" yaml:"keys,omitempty" json:"keys,omitempty"`
+	Values map[string]map[string]string `mapstructure:"values,omitempty" yaml:"values,omitempty" json:"values,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// PropagationRule copies the tags of a source resource to its related target resources
+// Source and Target are resource types in the service:type format, ec2:instance.
+// Relationship names the resolver finding the source of a target, via-key is the target
+// tag holding the source id for the tag relationship. Keys lists the copied keys, every
+// key except the aws: ones when empty. Overwrite is never, the default, or always
+type PropagationRule struct {
+	Source       string   `mapstructure:"source" yaml:"source" json:"source"`
+	Target       string   `mapstructure:"target" yaml:"target" json:"target"`
+	Relationship string   `mapstructure:"relationship" yaml:"relationship" json:"relationship"`
+	ViaKey       string   `mapstructure:"via-key,omitempty" yaml:"via-key,omitempty" json:"via-key,omitempty"`
+	Keys         []string `mapstructure:"keys,omitempty" yaml:"keys,omitempty" json:"keys,omitempty"`
+	Overwrite    string   `mapstructure:"overwrite,omitempty" yaml:"overwrite,omitempty" json:"overwrite,omitempty"`
+}
+
+// PropagationSpec is the content of a propagation rules file
+type PropagationSpec struct {
+	Rules []PropagationRule `mapstructure:"rules" yaml:"rules" json:"rules"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// ScanDefinition is a named scan of the serve config, the spec is read from the input file
+// params:
+// 		name: string
+// 		inputFile: string, relative to the directory of the config file
+// 		schedule: string, the cron expression of the scheduled runs, empty for the on demand scans
+// 		retain: int, the number of snapshots kept, 0 keeps every snapshot
+// 		outputs: []OutputDefinition, the files written after each scheduled run
+type ScanDefinition struct {
+	Name      string             `mapstructure:"name" yaml:"name" json:"name"`
+	InputFile string             `mapstructure:"input-file" yaml:"input-file" json:"input-file"`
+	Schedule  string             `mapstructure:"schedule" yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	Retain    int                `mapstructure:"retain" yaml:"retain,omitempty" json:"retain,omitempty"`
+	Outputs   []OutputDefinition `mapstructure:"outputs" yaml:"outputs,omitempty" json:"outputs,omitempty"`
+}
+
+// OutputDefinition is a file written after a scheduled run, the {scan} and {time}
+// placeholders of the file are replaced by the scan name and the run start time
+type OutputDefinition struct {
+	Format    string   `mapstructure:"format" yaml:"format" json:"format"`
+	File      string   `mapstructure:"file" yaml:"file" json:"file"`
+	Pivot     bool     `mapstructure:"pivot" yaml:"pivot,omitempty" json:"pivot,omitempty"`
+	Columns   []string `mapstructure:"columns" yaml:"columns,omitempty" json:"columns,omitempty"`
+	Partition bool     `mapstructure:"partition" yaml:"partition,omitempty" json:"partition,omitempty"`
+}
+
+// NotificationsConfig is the notifications section of the serve config
+// params:
+// 		stateFile: string, the findings already notified, kept in memory when empty
+// 		resendAfter: time.Duration, notify again the findings still present after this duration, 0 never
+// 		sinks: []SinkConfig
+type NotificationsConfig struct {
+	StateFile   string        `mapstructure:"state-file" yaml:"state-file,omitempty" json:"state-file,omitempty"`
+	ResendAfter time.Duration `mapstructure:"resend-after" yaml:"resend-after,omitempty" json:"resend-after,omitempty"`
+	Sinks       []SinkConfig  `mapstructure:"sinks" yaml:"sinks" json:"sinks"`
+}
+
+// SinkConfig is a destination of the notifications
+// params:
+// 		name: string, defaults to the type and the position of the sink
+// 		type: string, webhook, slack or email
+// 		events: []string, violation and drift, every event when empty
+// 		scans: []string, the scheduled scans notified, every scan when empty
+// 		template: string, the text/template of the message, the default lists the findings
+// 		url: string, the webhook and slack url
+// 		secretEnv: string, the variable holding the HMAC secret of the webhook signature
+// 		smtp: string, the host:port of the mail server
+// 		from: string
+// 		to: []string
+// 		username: string, the SMTP user, no authentication when empty
+// 		passwordEnv: string, the variable holding the SMTP password
+// 		subject: string, the text/template of the mail subject
+type SinkConfig struct {
+	Name        string   `mapstructure:"name" yaml:"name,omitempty" json:"name,omitempty"`
+	Type        string   `mapstructure:"type" yaml:"type" json:"type"`
+	Events      []string `mapstructure:"events" yaml:"events,omitempty" json:"events,omitempty"`
+	Scans       []string `mapstructure:"scans" yaml:"scans,omitempty" json:"scans,omitempty"`
+	Template    string   `mapstructure:"template" yaml:"template,omitempty" json:"template,omitempty"`
+	URL         string   `mapstructure:"url" yaml:"url,omitempty" json:"url,omitempty"`
+	SecretEnv   string   `mapstructure:"secret-env" yaml:"secret-env,omitempty" json:"secret-env,omitempty"`
+	SMTP        string   `mapstructure:"smtp" yaml:"smtp,omitempty" json:"smtp,omitempty"`
+	From        string   `mapstructure:"from" yaml:"from,omitempty" json:"from,omitempty"`
+	To          []string `mapstructure:"to" yaml:"to,omitempty" json:"to,omitempty"`
+	Username    string   `mapstructure:"username" yaml:"username,omitempty" json:"username,omitempty"`
+	PasswordEnv string   `mapstructure:"password-env" yaml:"password-env,omitempty" json:"password-env,omitempty"`
+	Subject     string   `mapstructure:"subject" yaml:"subject,omitempty" json:"subject,omitempty"`
+}
+
+// ServeConfig is the content of the serve config file
+type ServeConfig struct {
+	Scans         []ScanDefinition    `mapstructure:"scans" yaml:"scans" json:"scans"`
+	Notifications NotificationsConfig `mapstructure:"notifications" yaml:"notifications,omitempty" json:"notifications,omitempty"`
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"tagu/aws"
+	"tagu/server"
+)
+
+// Kind is the event a finding comes from
+type Kind string
+
+const (
+	// KindViolation a resource does not comply with the tag policies
+	KindViolation Kind = "violation"
+	// KindDrift a tag was added, removed or changed since the previous snapshot
+	KindDrift Kind = "drift"
+)
+
+// Kinds are the notified events
+var Kinds = []Kind{KindViolation, KindDrift}
+
+// Finding is a violation or a tag drift, notified once per sink
+type Finding struct {
+	Kind    Kind   `json:"kind"`
+	ARN     string `json:"arn"`
+	Account string `json:"account"`
+	Region  string `json:"region"`
+	// NoncompliantKeys and NoncompliantValues describe a violation
+	NoncompliantKeys   []string `json:"noncompliant-keys,omitempty"`
+	NoncompliantValues []string `json:"noncompliant-values,omitempty"`
+	// Key, Change, From and To describe a drift
+	Key    string            `json:"key,omitempty"`
+	Change server.ChangeKind `json:"change,omitempty"`
+	From   *string           `json:"from,omitempty"`
+	To     *string           `json:"to,omitempty"`
+}
+
+// Fingerprint identifies the finding across the runs
+func (f Finding) Fingerprint() string {
+	data, _ := json.Marshal(f)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Violations returns a finding per noncompliant resource sorted by ARN
+// The results hold the compliance only when the scan requests the compliance details
+// Args:
+// 		results: []aws.RessourceTagResult
+// Returns:
+// 		[]Finding: the violations
+func Violations(results []aws.RessourceTagResult) []Finding {
+	byARN := map[string]*Finding{}
+	var arns []string
+	for _, r := range results {
+		if r.Compliant == nil || *r.Compliant {
+			continue
+		}
+		arn := r.ARN()
+		if _, ok := byARN[arn]; ok {
+			continue
+		}
+		byARN[arn] = &Finding{
+			Kind:               KindViolation,
+			ARN:                arn,
+			Account:            r.Account,
+			Region:             r.Region,
+			NoncompliantKeys:   sorted(r.NoncompliantKeys),
+			NoncompliantValues: sorted(r.KeysWithNoncompliantValues),
+		}
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	findings := []Finding{}
+	for _, arn := range arns {
+		findings = append(findings, *byARN[arn])
+	}
+	return findings
+}
+
+// Drift returns a finding per changed tag
+func Drift(diffs []server.TagDiff) []Finding {
+	findings := []Finding{}
+	for _, d := range diffs {
+		findings = append(findings, Finding{
+			Kind:    KindDrift,
+			ARN:     d.ARN,
+			Account: d.Account,
+			Region:  d.Region,
+			Key:     d.Key,
+			Change:  d.Change,
+			From:    d.From,
+			To:      d.To,
+		})
+	}
+	return findings
+}
+
+func sorted(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	values = append([]string{}, values...)
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+	"tagu/server"
+)
+
+func TestViolationsSuite(t *testing.T) {
+	assert := assert.New(t)
+	result := func(resource, key string, compliant *bool, keys, values []string) aws.RessourceTagResult {
+		return aws.RessourceTagResult{Account: "1", Region: "us-east-1", Service: "ec2", Resource: resource, Key: key, Value: "v",
+			Compliant: compliant, NoncompliantKeys: keys, KeysWithNoncompliantValues: values}
+	}
+
+	fixtures := []struct {
+		name     string
+		results  []aws.RessourceTagResult
+		expected []Finding
+	}{
+		{
+			name:     "Test violations without compliance details",
+			results:  []aws.RessourceTagResult{result("instance/i-1", "env", nil, nil, nil)},
+			expected: []Finding{},
+		},
+		{
+			name: "Test violations of noncompliant resources",
+			results: []aws.RessourceTagResult{
+				result("instance/i-2", "env", awssdk.Bool(false), []string{"owner", "cost-center"}, nil),
+				result("instance/i-2", "team", awssdk.Bool(false), []string{"owner", "cost-center"}, nil),
+				result("instance/i-3", "env", awssdk.Bool(true), nil, nil),
+				result("instance/i-1", "env", awssdk.Bool(false), nil, []string{"env"}),
+			},
+			expected: []Finding{
+				{Kind: KindViolation, ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", NoncompliantValues: []string{"env"}},
+				{Kind: KindViolation, ARN: "arn:aws:ec2:us-east-1:1:instance/i-2", Account: "1", Region: "us-east-1", NoncompliantKeys: []string{"cost-center", "owner"}},
+			},
+		},
+		{
+			name:     "Test the violation of an untagged resource",
+			results:  []aws.RessourceTagResult{result("volume/vol-1", "", awssdk.Bool(false), []string{"env"}, nil)},
+			expected: []Finding{{Kind: KindViolation, ARN: "arn:aws:ec2:us-east-1:1:volume/vol-1", Account: "1", Region: "us-east-1", NoncompliantKeys: []string{"env"}}},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, Violations(fixture.results))
+		})
+	}
+}
+
+func TestDrift(t *testing.T) {
+	diffs := []server.TagDiff{{ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Key: "env", Change: server.TagChanged, From: awssdk.String("prod"), To: awssdk.String("dev")}}
+	assert.Equal(t, []Finding{
+		{Kind: KindDrift, ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Key: "env", Change: server.TagChanged, From: awssdk.String("prod"), To: awssdk.String("dev")},
+	}, Drift(diffs))
+}
+
+func TestFingerprint(t *testing.T) {
+	assert := assert.New(t)
+	finding := Finding{Kind: KindDrift, ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Key: "env", Change: server.TagAdded, To: awssdk.String("prod")}
+	same := finding
+	same.To = awssdk.String("prod")
+	other := finding
+	other.To = awssdk.String("dev")
+
+	assert.Len(finding.Fingerprint(), 64)
+	assert.Equal(finding.Fingerprint(), same.Fingerprint())
+	assert.NotEqual(finding.Fingerprint(), other.Fingerprint())
+}
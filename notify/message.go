@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"tagu/server"
+)
+
+// Message is the findings of a scheduled run sent to a sink
+type Message struct {
+	Scan     string    `json:"scan"`
+	Time     time.Time `json:"time"`
+	Snapshot string    `json:"snapshot,omitempty"`
+	Findings []Finding `json:"findings"`
+	// Failed are the targets that failed in the run, their findings are unknown
+	Failed server.TargetStatuses `json:"-"`
+}
+
+// Violations returns the violations of the message
+func (m Message) Violations() []Finding {
+	return m.findings(KindViolation)
+}
+
+// Drift returns the tag changes of the message
+func (m Message) Drift() []Finding {
+	return m.findings(KindDrift)
+}
+
+func (m Message) findings(kind Kind) []Finding {
+	var findings []Finding
+	for _, f := range m.Findings {
+		if f.Kind == kind {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// DefaultTemplate is the text of the notifications, it lists the first 20 findings of each kind
+const DefaultTemplate = `tagu scan {{.Scan}}: {{len .Violations}} new policy violations, {{len .Drift}} tag changes
+{{- range first 20 .Violations}}
+- {{.ARN}} violates{{if .NoncompliantKeys}} the keys {{join .NoncompliantKeys ", "}}{{end}}{{if .NoncompliantValues}} the values of {{join .NoncompliantValues ", "}}{{end}}
+{{- end}}
+{{- if gt (len .Violations) 20}}
+- and {{more 20 .Violations}} more violations
+{{- end}}
+{{- range first 20 .Drift}}
+- {{.ARN}} {{.Key}} {{.Change}}{{if .From}} from {{value .From}}{{end}}{{if .To}} to {{value .To}}{{end}}
+{{- end}}
+{{- if gt (len .Drift) 20}}
+- and {{more 20 .Drift}} more tag changes
+{{- end}}
+`
+
+// DefaultSubject is the subject of the notification mails
+const DefaultSubject = `tagu scan {{.Scan}}: {{len .Violations}} new policy violations, {{len .Drift}} tag changes`
+
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"first": func(n int, findings []Finding) []Finding {
+		if len(findings) > n {
+			return findings[:n]
+		}
+		return findings
+	},
+	"more": func(n int, findings []Finding) int {
+		return len(findings) - n
+	},
+	"value": func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return *value
+	},
+}
+
+// parse parses a message template, the default template when text is empty
+// The templates use the Message fields and methods and the join, first, more and value functions
+func parse(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// render executes the template on the message
+func render(tmpl *template.Template, msg Message) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, msg); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/server"
+)
+
+// testMessage returns a message of n violations and a drift
+func testMessage(n int) Message {
+	msg := Message{Scan: "prod", Time: time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC), Snapshot: "20220901T100000Z-01020304"}
+	for i := 1; i <= n; i++ {
+		msg.Findings = append(msg.Findings, Finding{Kind: KindViolation, ARN: fmt.Sprintf("arn:aws:ec2:us-east-1:1:instance/i-%d", i), Account: "1", Region: "us-east-1",
+			NoncompliantKeys: []string{"owner"}, NoncompliantValues: []string{"env"}})
+	}
+	msg.Findings = append(msg.Findings, Finding{Kind: KindDrift, ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1",
+		Key: "env", Change: server.TagChanged, From: awssdk.String("prod"), To: awssdk.String("dev")})
+	return msg
+}
+
+func TestRenderSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		template string
+		msg      Message
+		expected string
+		err      string
+	}{
+		{
+			name: "Test render the default template",
+			msg:  testMessage(1),
+			expected: `tagu scan prod: 1 new policy violations, 1 tag changes
+- arn:aws:ec2:us-east-1:1:instance/i-1 violates the keys owner the values of env
+- arn:aws:ec2:us-east-1:1:instance/i-1 env changed from prod to dev
+`,
+		},
+		{
+			name:     "Test render the default template with many findings",
+			msg:      testMessage(22),
+			expected: "- and 2 more violations\n- arn:aws:ec2:us-east-1:1:instance/i-1 env changed from prod to dev\n",
+		},
+		{
+			name:     "Test render a custom template",
+			template: `{{.Scan}} {{.Snapshot}}: {{range .Drift}}{{.Key}} {{value .To}}{{end}}`,
+			msg:      testMessage(0),
+			expected: "prod 20220901T100000Z-01020304: env dev",
+		},
+		{
+			name:     "Test render an invalid template",
+			template: `{{.Scan}`,
+			err:      "invalid template: template: test:1: ",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			tmpl, err := parse("test", fixture.template, DefaultTemplate)
+			if fixture.err != "" {
+				// The parse error details depend on the go version
+				if assert.Error(err) {
+					assert.True(strings.HasPrefix(err.Error(), fixture.err), err.Error())
+				}
+				return
+			}
+			assert.NoError(err)
+			text, err := render(tmpl, fixture.msg)
+			assert.NoError(err)
+			if len(fixture.msg.Findings) > 20 {
+				assert.Contains(text, fixture.expected)
+				return
+			}
+			assert.Equal(fixture.expected, text)
+		})
+	}
+}
+
+func TestDefaultSubject(t *testing.T) {
+	tmpl, err := parse("subject", "", DefaultSubject)
+	assert.NoError(t, err)
+	text, err := render(tmpl, testMessage(2))
+	assert.NoError(t, err)
+	assert.Equal(t, "tagu scan prod: 2 new policy violations, 1 tag changes", text)
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"tagu/models"
+)
+
+// Route is a sink and the findings it receives
+// params:
+// 		name: string, the key of the sink in the state
+// 		sink: Sink
+// 		kinds: []Kind, every kind when empty
+// 		scans: []string, every scan when empty
+type Route struct {
+	Name  string
+	Sink  Sink
+	Kinds []Kind
+	Scans []string
+}
+
+func (r Route) accepts(scan string) bool {
+	if len(r.Scans) == 0 {
+		return true
+	}
+	for _, s := range r.Scans {
+		if s == scan {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Route) filter(findings []Finding) []Finding {
+	if len(r.Kinds) == 0 {
+		return findings
+	}
+	var kept []Finding
+	for _, f := range findings {
+		for _, kind := range r.Kinds {
+			if f.Kind == kind {
+				kept = append(kept, f)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// Notifier sends the new findings of the runs to the routes
+type Notifier struct {
+	Routes []Route
+	State  *State
+}
+
+// Notify sends to each route the findings of the message it did not receive yet
+// A route failing to send receives the violations again on the next run while they last,
+// a drift is only found by the run comparing its two snapshots so it is not sent again
+// Args:
+// 		ctx: context.Context
+// 		msg: Message, the findings of a run
+// Returns:
+// 		[]string: the names of the notified routes
+// 		error: the send errors of the routes and the state file error
+func (n *Notifier) Notify(ctx context.Context, msg Message) ([]string, error) {
+	var notified, errs []string
+	for _, route := range n.Routes {
+		if !route.accepts(msg.Scan) {
+			continue
+		}
+		current := route.filter(msg.Findings)
+		fresh := n.State.Fresh(route.Name, msg.Scan, current, msg.Time)
+		var sent []Finding
+		if len(fresh) > 0 {
+			m := msg
+			m.Findings = fresh
+			if err := route.Sink.Send(ctx, m); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", route.Name, err))
+			} else {
+				sent = fresh
+				notified = append(notified, route.Name)
+			}
+		}
+		n.State.Record(route.Name, msg.Scan, current, sent, msg.Failed, msg.Time)
+	}
+	if err := n.State.Save(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return notified, fmt.Errorf("notify %s", strings.Join(errs, "; "))
+	}
+	return notified, nil
+}
+
+// New builds the notifier of the notifications config
+// Args:
+// 		config: models.NotificationsConfig
+// 		getenv: func(string) string, reads the webhook secrets and the SMTP passwords
+// Returns:
+// 		*Notifier: nil without sinks
+// 		error: if a sink is invalid or the state file can not be read
+func New(config models.NotificationsConfig, getenv func(string) string) (*Notifier, error) {
+	if len(config.Sinks) == 0 {
+		return nil, nil
+	}
+	n := &Notifier{}
+	names := map[string]bool{}
+	for i, sc := range config.Sinks {
+		if sc.Name == "" {
+			sc.Name = fmt.Sprintf("%s-%d", sc.Type, i+1)
+		}
+		if names[sc.Name] {
+			return nil, fmt.Errorf("duplicate sink %q", sc.Name)
+		}
+		names[sc.Name] = true
+		route, err := newRoute(sc, getenv)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %w", sc.Name, err)
+		}
+		n.Routes = append(n.Routes, route)
+	}
+	state, err := OpenState(config.StateFile, config.ResendAfter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications state %s: %w", config.StateFile, err)
+	}
+	n.State = state
+	return n, nil
+}
+
+func newRoute(sc models.SinkConfig, getenv func(string) string) (route Route, err error) {
+	route = Route{Name: sc.Name, Scans: sc.Scans}
+	for _, event := range sc.Events {
+		kind := Kind(event)
+		if kind != KindViolation && kind != KindDrift {
+			return route, fmt.Errorf("invalid event %q, expected violation or drift", event)
+		}
+		route.Kinds = append(route.Kinds, kind)
+	}
+	text, err := parse(sc.Name, sc.Template, DefaultTemplate)
+	if err != nil {
+		return route, err
+	}
+
+	switch sc.Type {
+	case "webhook", "slack":
+		if sc.URL == "" {
+			return route, errors.New("missing url")
+		}
+		if sc.Type == "slack" {
+			route.Sink = &Slack{URL: sc.URL, Template: text}
+			return route, nil
+		}
+		webhook := &Webhook{URL: sc.URL, Template: text}
+		if sc.SecretEnv != "" {
+			if webhook.Secret = []byte(getenv(sc.SecretEnv)); len(webhook.Secret) == 0 {
+				return route, fmt.Errorf("the secret variable %s is empty", sc.SecretEnv)
+			}
+		}
+		route.Sink = webhook
+	case "email":
+		if sc.SMTP == "" || sc.From == "" || len(sc.To) == 0 {
+			return route, errors.New("missing smtp, from or to")
+		}
+		subject, err := parse(sc.Name+"-subject", sc.Subject, DefaultSubject)
+		if err != nil {
+			return route, err
+		}
+		email := &Email{Addr: sc.SMTP, From: sc.From, To: sc.To, Subject: subject, Template: text}
+		if sc.Username != "" {
+			email.Auth = smtp.PlainAuth("", sc.Username, getenv(sc.PasswordEnv), strings.Split(sc.SMTP, ":")[0])
+		}
+		route.Sink = email
+	default:
+		return route, fmt.Errorf("invalid type %q, expected webhook, slack or email", sc.Type)
+	}
+	return route, nil
+}
@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+// recordSink keeps the sent messages, it fails while err is set
+type recordSink struct {
+	messages []Message
+	err      error
+}
+
+func (s *recordSink) Send(ctx context.Context, msg Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func TestNotifierSuite(t *testing.T) {
+	assert := assert.New(t)
+	all, violations, dev := &recordSink{}, &recordSink{}, &recordSink{}
+	state, _ := OpenState("", 0)
+	notifier := &Notifier{
+		Routes: []Route{
+			{Name: "all", Sink: all},
+			{Name: "violations", Sink: violations, Kinds: []Kind{KindViolation}},
+			{Name: "dev", Sink: dev, Scans: []string{"dev"}},
+		},
+		State: state,
+	}
+	msg := testMessage(1)
+
+	notified, err := notifier.Notify(context.TODO(), msg)
+	assert.NoError(err)
+	assert.Equal([]string{"all", "violations"}, notified)
+	assert.Equal([]Message{msg}, all.messages)
+	assert.Len(violations.messages, 1)
+	assert.Equal(msg.Violations(), violations.messages[0].Findings)
+	assert.Empty(dev.messages)
+
+	// The same findings are not sent again
+	notified, err = notifier.Notify(context.TODO(), msg)
+	assert.NoError(err)
+	assert.Empty(notified)
+	assert.Len(all.messages, 1)
+
+	// A failed route receives the findings on the next run
+	more := testMessage(2)
+	all.err = errors.New("unreachable")
+	notified, err = notifier.Notify(context.TODO(), more)
+	assert.EqualError(err, "notify all: unreachable")
+	assert.Equal([]string{"violations"}, notified)
+	all.err = nil
+	notified, err = notifier.Notify(context.TODO(), more)
+	assert.NoError(err)
+	assert.Equal([]string{"all"}, notified)
+	assert.Equal([]Finding{more.Findings[1]}, all.messages[1].Findings)
+
+	// A drift that failed to send is not part of the next run
+	all.err = errors.New("unreachable")
+	_, err = notifier.Notify(context.TODO(), testMessage(3))
+	assert.Error(err)
+	all.err = nil
+	next := testMessage(3)
+	next.Findings = next.Violations()
+	notified, err = notifier.Notify(context.TODO(), next)
+	assert.NoError(err)
+	assert.Equal([]string{"all"}, notified)
+	assert.Equal([]Finding{next.Findings[2]}, all.messages[2].Findings)
+}
+
+func TestNewSuite(t *testing.T) {
+	assert := assert.New(t)
+	getenv := func(name string) string {
+		return map[string]string{"SECRET": "s3cr3t"}[name]
+	}
+
+	fixtures := []struct {
+		name     string
+		sinks    []models.SinkConfig
+		expected []string
+		err      string
+	}{
+		{
+			name: "Test new without sinks",
+		},
+		{
+			name: "Test new sinks",
+			sinks: []models.SinkConfig{
+				{Type: "webhook", URL: "http://localhost/hook", SecretEnv: "SECRET", Events: []string{"violation"}},
+				{Name: "chat", Type: "slack", URL: "http://localhost/slack"},
+				{Type: "email", SMTP: "localhost:25", From: "tagu@example.com", To: []string{"ops@example.com"}, Username: "tagu"},
+			},
+			expected: []string{"webhook-1", "chat", "email-3"},
+		},
+		{
+			name:  "Test new duplicate sink",
+			sinks: []models.SinkConfig{{Name: "chat", Type: "slack", URL: "http://localhost/slack"}, {Name: "chat", Type: "slack", URL: "http://localhost/slack"}},
+			err:   `duplicate sink "chat"`,
+		},
+		{
+			name:  "Test new invalid type",
+			sinks: []models.SinkConfig{{Type: "pager"}},
+			err:   `sink pager-1: invalid type "pager", expected webhook, slack or email`,
+		},
+		{
+			name:  "Test new invalid event",
+			sinks: []models.SinkConfig{{Type: "slack", URL: "http://localhost/slack", Events: []string{"drifts"}}},
+			err:   `sink slack-1: invalid event "drifts", expected violation or drift`,
+		},
+		{
+			name:  "Test new webhook without url",
+			sinks: []models.SinkConfig{{Type: "webhook"}},
+			err:   "sink webhook-1: missing url",
+		},
+		{
+			name:  "Test new webhook with an empty secret",
+			sinks: []models.SinkConfig{{Type: "webhook", URL: "http://localhost/hook", SecretEnv: "MISSING"}},
+			err:   "sink webhook-1: the secret variable MISSING is empty",
+		},
+		{
+			name:  "Test new email without recipient",
+			sinks: []models.SinkConfig{{Type: "email", SMTP: "localhost:25", From: "tagu@example.com"}},
+			err:   "sink email-1: missing smtp, from or to",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			notifier, err := New(models.NotificationsConfig{Sinks: fixture.sinks}, getenv)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			if len(fixture.sinks) == 0 {
+				assert.Nil(notifier)
+				return
+			}
+			var names []string
+			for _, route := range notifier.Routes {
+				names = append(names, route.Name)
+			}
+			assert.Equal(fixture.expected, names)
+			assert.Equal([]byte("s3cr3t"), notifier.Routes[0].Sink.(*Webhook).Secret)
+			assert.Equal([]Kind{KindViolation}, notifier.Routes[0].Kinds)
+		})
+	}
+}
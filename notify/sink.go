@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SignatureHeader holds the HMAC-SHA256 of the webhook body, sha256=<hex>
+const SignatureHeader = "X-Tagu-Signature-256"
+
+// Sink sends the messages to a destination
+type Sink interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// WebhookPayload is the JSON body posted by the webhook sink
+type WebhookPayload struct {
+	Message
+	Text string `json:"text"`
+}
+
+// Webhook posts the message and its findings as JSON
+// params:
+// 		url: string
+// 		secret: []byte, signs the body in the SignatureHeader when set
+// 		template: *template.Template, the text of the payload
+// 		client: *http.Client
+type Webhook struct {
+	URL      string
+	Secret   []byte
+	Template *template.Template
+	Client   *http.Client
+}
+
+// Sign returns the signature of the body, sha256=<hex of the HMAC-SHA256>
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts the payload
+func (w *Webhook) Send(ctx context.Context, msg Message) error {
+	text, err := render(w.Template, msg)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(WebhookPayload{Message: msg, Text: text})
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if len(w.Secret) > 0 {
+		header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+	return post(ctx, w.Client, w.URL, header, body)
+}
+
+// Slack posts the text of the message to a Slack compatible incoming webhook
+type Slack struct {
+	URL      string
+	Template *template.Template
+	Client   *http.Client
+}
+
+// Send posts the text
+func (s *Slack) Send(ctx context.Context, msg Message) error {
+	text, err := render(s.Template, msg)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.URL, http.Header{}, body)
+}
+
+// post sends the JSON body and fails on a status other than 2xx
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Email sends the text of the message by mail
+// params:
+// 		addr: string, the host:port of the SMTP server
+// 		from: string
+// 		to: []string
+// 		auth: smtp.Auth, may be nil
+// 		subject: *template.Template
+// 		template: *template.Template, the body
+type Email struct {
+	Addr     string
+	From     string
+	To       []string
+	Auth     smtp.Auth
+	Subject  *template.Template
+	Template *template.Template
+}
+
+// Send sends the mail, the context is not used by the SMTP client
+func (e *Email) Send(ctx context.Context, msg Message) error {
+	subject, err := render(e.Subject, msg)
+	if err != nil {
+		return err
+	}
+	text, err := render(e.Template, msg)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", strings.ReplaceAll(strings.TrimSpace(subject), "\n", " "))
+	fmt.Fprintf(&b, "Date: %s\r\n", msg.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	return smtp.SendMail(e.Addr, e.Auth, e.From, e.To, []byte(b.String()))
+}
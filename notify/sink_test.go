@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpMail is a mail received by the SMTP stand-in
+type smtpMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// smtpServer starts a minimal SMTP server accepting a single mail, the mail is sent to the channel
+func smtpServer(t *testing.T) (string, <-chan smtpMail) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	mails := make(chan smtpMail, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP")
+		var mail smtpMail
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				mail.From = strings.Trim(strings.TrimPrefix(command, "MAIL FROM:"), "<>")
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				mail.To = append(mail.To, strings.Trim(strings.TrimPrefix(command, "RCPT TO:"), "<>"))
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				mail.Data = data.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				mails <- mail
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return l.Addr().String(), mails
+}
+
+func TestWebhook(t *testing.T) {
+	assert := assert.New(t)
+	var body []byte
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+	}))
+	defer srv.Close()
+
+	tmpl, _ := parse("webhook", "{{.Scan}}", DefaultTemplate)
+	webhook := &Webhook{URL: srv.URL, Secret: []byte("secret"), Template: tmpl}
+	assert.NoError(webhook.Send(context.TODO(), testMessage(1)))
+
+	assert.Equal(Sign([]byte("secret"), body), signature)
+	assert.True(strings.HasPrefix(signature, "sha256="))
+	var payload WebhookPayload
+	assert.NoError(json.Unmarshal(body, &payload))
+	assert.Equal("prod", payload.Text)
+	assert.Equal(testMessage(1), payload.Message)
+}
+
+func TestSign(t *testing.T) {
+	// The signature of the RFC 4231 test case 2
+	assert.Equal(t, "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843", Sign([]byte("Jefe"), []byte("what do ya want for nothing?")))
+}
+
+func TestSlackSuite(t *testing.T) {
+	assert := assert.New(t)
+	var body []byte
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	tmpl, _ := parse("slack", "{{len .Findings}} findings in {{.Scan}}", DefaultTemplate)
+	slack := &Slack{URL: srv.URL, Template: tmpl}
+
+	assert.NoError(slack.Send(context.TODO(), testMessage(1)))
+	assert.Equal(`{"text":"2 findings in prod"}`, string(body))
+
+	status = http.StatusInternalServerError
+	assert.EqualError(slack.Send(context.TODO(), testMessage(1)), srv.URL+" returned 500 Internal Server Error")
+}
+
+func TestEmail(t *testing.T) {
+	assert := assert.New(t)
+	addr, mails := smtpServer(t)
+	subject, _ := parse("subject", "", DefaultSubject)
+	text, _ := parse("body", "{{.Scan}}\n{{len .Violations}} violations\n", DefaultTemplate)
+	email := &Email{Addr: addr, From: "tagu@example.com", To: []string{"ops@example.com", "sec@example.com"}, Subject: subject, Template: text}
+
+	assert.NoError(email.Send(context.TODO(), testMessage(1)))
+	mail := <-mails
+	assert.Equal("tagu@example.com", mail.From)
+	assert.Equal([]string{"ops@example.com", "sec@example.com"}, mail.To)
+	assert.Equal("From: tagu@example.com\r\n"+
+		"To: ops@example.com, sec@example.com\r\n"+
+		"Subject: tagu scan prod: 1 new policy violations, 1 tag changes\r\n"+
+		"Date: Thu, 01 Sep 2022 10:00:00 +0000\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"\r\n"+
+		"prod\r\n"+
+		"1 violations\r\n", mail.Data)
+}
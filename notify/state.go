@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"tagu/server"
+)
+
+// State remembers when each finding was last sent to each sink
+// Only the findings of the last run of a scan are kept, a finding that
+// disappears then comes back is notified again. The findings of a target
+// that failed in the run are kept until the target is scanned again
+type State struct {
+	mu          sync.Mutex
+	path        string
+	resendAfter time.Duration
+	// Sent is the time of the last notification by sink, scan and fingerprint
+	Sent map[string]map[string]map[string]time.Time `json:"sent"`
+	// Targets is the target of each finding by sink, scan and fingerprint
+	Targets map[string]map[string]map[string]FindingTarget `json:"targets,omitempty"`
+}
+
+// FindingTarget is the account and region of a recorded finding
+type FindingTarget struct {
+	Account string `json:"account"`
+	Region  string `json:"region"`
+}
+
+// OpenState loads the state file, an empty path keeps the state in memory
+// Args:
+// 		path: string
+// 		resendAfter: time.Duration, the delay before a finding is sent again, 0 never
+// Returns:
+// 		*State: the state
+// 		error: if the file can not be read
+func OpenState(path string, resendAfter time.Duration) (*State, error) {
+	s := &State{
+		path:        path,
+		resendAfter: resendAfter,
+		Sent:        map[string]map[string]map[string]time.Time{},
+		Targets:     map[string]map[string]map[string]FindingTarget{},
+	}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Sent == nil {
+		s.Sent = map[string]map[string]map[string]time.Time{}
+	}
+	if s.Targets == nil {
+		s.Targets = map[string]map[string]map[string]FindingTarget{}
+	}
+	return s, nil
+}
+
+// Fresh returns the findings never sent to the sink or sent longer than resend-after ago
+func (s *State) Fresh(sink, scan string, findings []Finding, now time.Time) []Finding {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sent := s.Sent[sink][scan]
+	var fresh []Finding
+	for _, f := range findings {
+		last, ok := sent[f.Fingerprint()]
+		if !ok || (s.resendAfter > 0 && now.Sub(last) >= s.resendAfter) {
+			fresh = append(fresh, f)
+		}
+	}
+	return fresh
+}
+
+// Record replaces the findings of the scan with the current ones, the sent
+// findings are stamped with now and the others keep their time. The previous
+// findings of the failed targets are kept, the run could not see them
+func (s *State) Record(sink, scan string, current, sent []Finding, failed server.TargetStatuses, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.Sent[sink][scan]
+	previousTargets := s.Targets[sink][scan]
+	stamped := map[string]bool{}
+	for _, f := range sent {
+		stamped[f.Fingerprint()] = true
+	}
+	next := map[string]time.Time{}
+	targets := map[string]FindingTarget{}
+	for _, f := range current {
+		fp := f.Fingerprint()
+		if stamped[fp] {
+			next[fp] = now.UTC()
+		} else if last, ok := previous[fp]; ok {
+			next[fp] = last
+		} else {
+			continue
+		}
+		targets[fp] = FindingTarget{Account: f.Account, Region: f.Region}
+	}
+	for fp, last := range previous {
+		target, ok := previousTargets[fp]
+		if _, recorded := next[fp]; !recorded && ok && failed.Covers(target.Account, target.Region) {
+			next[fp] = last
+			targets[fp] = target
+		}
+	}
+	if s.Sent[sink] == nil {
+		s.Sent[sink] = map[string]map[string]time.Time{}
+		s.Targets[sink] = map[string]map[string]FindingTarget{}
+	}
+	s.Sent[sink][scan] = next
+	s.Targets[sink][scan] = targets
+}
+
+// Save writes the state file
+func (s *State) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a partial state
+	if err = os.WriteFile(s.path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
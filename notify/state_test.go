@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+	"tagu/server"
+)
+
+func TestStateSuite(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	msg := testMessage(2)
+	first, second, drift := msg.Findings[0], msg.Findings[1], msg.Findings[2]
+
+	state, err := OpenState(path, 24*time.Hour)
+	assert.NoError(err)
+	assert.Equal(msg.Findings, state.Fresh("slack", "prod", msg.Findings, now))
+	state.Record("slack", "prod", msg.Findings, []Finding{first, second}, nil, now)
+	assert.NoError(state.Save())
+
+	// The state is read again from the file
+	state, err = OpenState(path, 24*time.Hour)
+	assert.NoError(err)
+
+	fixtures := []struct {
+		name     string
+		sink     string
+		scan     string
+		findings []Finding
+		now      time.Time
+		expected []Finding
+	}{
+		{
+			name:     "Test fresh findings already sent",
+			sink:     "slack",
+			scan:     "prod",
+			findings: msg.Findings,
+			now:      now.Add(time.Hour),
+			expected: []Finding{drift},
+		},
+		{
+			name:     "Test fresh findings after resend-after",
+			sink:     "slack",
+			scan:     "prod",
+			findings: msg.Findings,
+			now:      now.Add(24 * time.Hour),
+			expected: msg.Findings,
+		},
+		{
+			name:     "Test fresh findings of another sink",
+			sink:     "webhook",
+			scan:     "prod",
+			findings: []Finding{first},
+			now:      now,
+			expected: []Finding{first},
+		},
+		{
+			name:     "Test fresh findings of another scan",
+			sink:     "slack",
+			scan:     "dev",
+			findings: []Finding{first},
+			now:      now,
+			expected: []Finding{first},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, state.Fresh(fixture.sink, fixture.scan, fixture.findings, fixture.now))
+		})
+	}
+
+	// A resolved finding is forgotten and sent again when it comes back
+	state.Record("slack", "prod", []Finding{second}, nil, nil, now.Add(time.Hour))
+	assert.Equal([]Finding{first}, state.Fresh("slack", "prod", []Finding{first, second}, now.Add(2*time.Hour)))
+	assert.Equal(now, state.Sent["slack"]["prod"][second.Fingerprint()])
+
+	// The findings of a failed target are kept until the target is scanned again
+	state.Record("slack", "prod", []Finding{first, second}, []Finding{first}, nil, now.Add(2*time.Hour))
+	failed := server.TargetStatuses{{Account: "1", Region: "us-east-1", Status: aws.StatusTimeout}}
+	state.Record("slack", "prod", nil, nil, failed, now.Add(3*time.Hour))
+	assert.Empty(state.Fresh("slack", "prod", []Finding{first, second}, now.Add(3*time.Hour)))
+	assert.NoError(state.Save())
+	state, err = OpenState(path, 24*time.Hour)
+	assert.NoError(err)
+	state.Record("slack", "prod", nil, nil, server.TargetStatuses{{Account: "2", Region: "us-east-1"}}, now.Add(4*time.Hour))
+	assert.Equal([]Finding{first, second}, state.Fresh("slack", "prod", []Finding{first, second}, now.Add(4*time.Hour)))
+}
+
+func TestOpenStateMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := OpenState(path, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, state.Save())
+	assert.FileExists(t, path)
+}
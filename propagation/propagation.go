@@ -0,0 +1,210 @@
+package propagation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"tagu/aws"
+	"tagu/models"
+)
+
+const (
+	// OverwriteNever only adds the keys missing on the target, the default
+	OverwriteNever = "never"
+	// OverwriteAlways also replaces the values of the target that differ from the source
+	OverwriteAlways = "always"
+)
+
+// Change is an inherited tag to write on a target resource
+// A nil Previous means the key is missing on the target
+type Change struct {
+	Rule     int     `json:"rule"`
+	Target   string  `json:"target"`
+	Source   string  `json:"source"`
+	Key      string  `json:"key"`
+	Previous *string `json:"previous"`
+	Value    string  `json:"value"`
+}
+
+// Skip is an inherited tag that can not be written
+type Skip struct {
+	Rule   int    `json:"rule"`
+	Target string `json:"target"`
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// Plan is the output of Compute
+type Plan struct {
+	Changes []Change       `json:"changes"`
+	Skipped []Skip         `json:"skipped,omitempty"`
+	Writes  []aws.TagWrite `json:"writes"`
+}
+
+// Resources groups the scan results by resource
+// A resource without account in its ARN, an EBS snapshot, keeps an empty account
+func Resources(results []aws.RessourceTagResult) []*Resource {
+	var resources []*Resource
+	byARN := map[string]*Resource{}
+	for _, r := range results {
+		arn := r.ARN()
+		resource, ok := byARN[arn]
+		if !ok {
+			path := strings.Split(r.Resource, "/")
+			resource = &Resource{
+				ARN:     arn,
+				Account: r.Account,
+				Region:  r.Region,
+				Type:    r.Type(),
+				ID:      path[len(path)-1],
+				Tags:    map[string]string{},
+			}
+			byARN[arn] = resource
+			resources = append(resources, resource)
+		}
+		if !r.Untagged() {
+			resource.Tags[r.Key] = r.Value
+		}
+	}
+	return resources
+}
+
+// Validate checks the relationship and overwrite policy of every rule
+func Validate(rules []models.PropagationRule) error {
+	for i, rule := range rules {
+		if rule.Source == "" || rule.Target == "" {
+			return fmt.Errorf("rule %d: source and target are required", i)
+		}
+		if _, ok := Resolvers[rule.Relationship]; !ok {
+			return fmt.Errorf("rule %d: unknown relationship %q", i, rule.Relationship)
+		}
+		if rule.Relationship == "tag" && rule.ViaKey == "" {
+			return fmt.Errorf("rule %d: the tag relationship requires via-key", i)
+		}
+		if rule.Overwrite != "" && rule.Overwrite != OverwriteNever && rule.Overwrite != OverwriteAlways {
+			return fmt.Errorf("rule %d: invalid overwrite %q, expected never or always", i, rule.Overwrite)
+		}
+	}
+	return nil
+}
+
+// Compute applies the rules to the scan results and returns the inherited tags to write.
+// A key inherited with different values from several sources, or that would exceed
+// aws.MaxTagsPerResource on the target, is skipped. The rules apply in order, a key
+// planned by a rule is not changed by the next ones
+// Args:
+// 		results: []aws.RessourceTagResult
+// 		rules: []models.PropagationRule
+// 		relations: []aws.Relation, the EC2 relations of the ec2 relationship
+// Returns:
+// 		Plan: the changes, the skipped keys and the writes grouped by target
+// 		error: if a rule is invalid
+func Compute(results []aws.RessourceTagResult, rules []models.PropagationRule, relations []aws.Relation) (plan Plan, err error) {
+	if err = Validate(rules); err != nil {
+		return plan, err
+	}
+	resources := Resources(results)
+	index := newIndex(resources, relations)
+
+	planned := map[string]map[string]bool{}
+	for _, target := range resources {
+		count := len(target.Tags)
+		for i, rule := range rules {
+			if target.Type != rule.Target {
+				continue
+			}
+			sources := Resolvers[rule.Relationship](index, target, rule.Source, rule.ViaKey)
+			values := map[string]string{}
+			origin := map[string]string{}
+			conflicts := map[string]bool{}
+			for _, source := range sources {
+				for key, value := range source.Tags {
+					if !copied(rule, key) {
+						continue
+					}
+					if previous, ok := values[key]; ok && previous != value {
+						conflicts[key] = true
+					}
+					values[key] = value
+					origin[key] = source.ARN
+				}
+			}
+
+			var keys []string
+			for key := range values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if planned[target.ARN][key] {
+					continue
+				}
+				if conflicts[key] {
+					plan.Skipped = append(plan.Skipped, Skip{Rule: i, Target: target.ARN, Key: key, Reason: "several sources with different values"})
+					continue
+				}
+				current, exists := target.Tags[key]
+				if exists && (current == values[key] || rule.Overwrite != OverwriteAlways) {
+					continue
+				}
+				if !exists && count >= aws.MaxTagsPerResource {
+					plan.Skipped = append(plan.Skipped, Skip{Rule: i, Target: target.ARN, Key: key, Reason: "tags limit reached"})
+					continue
+				}
+				change := Change{Rule: i, Target: target.ARN, Source: origin[key], Key: key, Value: values[key]}
+				if exists {
+					change.Previous = &current
+				} else {
+					count++
+				}
+				plan.Changes = append(plan.Changes, change)
+				if planned[target.ARN] == nil {
+					planned[target.ARN] = map[string]bool{}
+				}
+				planned[target.ARN][key] = true
+			}
+		}
+	}
+	plan.Writes = writes(plan.Changes, index)
+	return plan, nil
+}
+
+// copied reports whether the rule copies the key, the aws: keys are reserved
+func copied(rule models.PropagationRule, key string) bool {
+	if strings.HasPrefix(key, "aws:") {
+		return false
+	}
+	if len(rule.Keys) == 0 {
+		return true
+	}
+	for _, k := range rule.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// writes groups the changes by target, a target without account in its ARN
+// is written with the account of its source
+func writes(changes []Change, index *Index) []aws.TagWrite {
+	var writes []aws.TagWrite
+	positions := map[string]int{}
+	for _, change := range changes {
+		idx, ok := positions[change.Target]
+		if !ok {
+			target := index.byARN[change.Target]
+			account := target.Account
+			if account == "" {
+				account = index.byARN[change.Source].Account
+			}
+			idx = len(writes)
+			positions[change.Target] = idx
+			writes = append(writes, aws.TagWrite{Account: account, Region: target.Region, ARN: change.Target})
+		}
+		value := change.Value
+		writes[idx].Tags = append(writes[idx].Tags, aws.TagChange{Key: change.Key, Previous: change.Previous, Value: &value})
+	}
+	return writes
+}
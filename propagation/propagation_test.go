@@ -0,0 +1,148 @@
+package propagation
+
+import (
+	"fmt"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+	"tagu/models"
+)
+
+func tag(account, region, service, resource, key, value string) aws.RessourceTagResult {
+	return aws.RessourceTagResult{Account: account, Region: region, Service: service, Resource: resource, Key: key, Value: value}
+}
+
+func TestResourcesSuite(t *testing.T) {
+	assert := assert.New(t)
+	resources := Resources([]aws.RessourceTagResult{
+		tag("1", "us-east-1", "ec2", "instance/i-1", "env", "prod"),
+		tag("1", "us-east-1", "ec2", "instance/i-1", "team", "web"),
+		tag("", "us-east-1", "ec2", "snapshot/snap-1", "env", "dev"),
+		tag("1", "us-east-1", "s3", "bucket", "env", "dev"),
+	})
+	assert.Equal([]*Resource{
+		{ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Type: "ec2:instance", ID: "i-1", Tags: map[string]string{"env": "prod", "team": "web"}},
+		{ARN: "arn:aws:ec2:us-east-1::snapshot/snap-1", Region: "us-east-1", Type: "ec2:snapshot", ID: "snap-1", Tags: map[string]string{"env": "dev"}},
+		{ARN: "arn:aws:s3:us-east-1:1:bucket", Account: "1", Region: "us-east-1", Type: "s3", ID: "bucket", Tags: map[string]string{"env": "dev"}},
+	}, resources)
+}
+
+func TestValidateSuite(t *testing.T) {
+	assert := assert.New(t)
+	fixtures := []struct {
+		name string
+		rule models.PropagationRule
+		err  string
+	}{
+		{name: "Test valid rule", rule: models.PropagationRule{Source: "ecs:cluster", Target: "ecs:service", Relationship: "arn"}},
+		{name: "Test missing target", rule: models.PropagationRule{Source: "ecs:cluster", Relationship: "arn"}, err: "rule 0: source and target are required"},
+		{name: "Test unknown relationship", rule: models.PropagationRule{Source: "ecs:cluster", Target: "ecs:service", Relationship: "name"}, err: `rule 0: unknown relationship "name"`},
+		{name: "Test tag without via-key", rule: models.PropagationRule{Source: "ec2:instance", Target: "ec2:volume", Relationship: "tag"}, err: "rule 0: the tag relationship requires via-key"},
+		{name: "Test invalid overwrite", rule: models.PropagationRule{Source: "ecs:cluster", Target: "ecs:service", Relationship: "arn", Overwrite: "sometimes"}, err: `rule 0: invalid overwrite "sometimes", expected never or always`},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			err := Validate([]models.PropagationRule{fixture.rule})
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+		})
+	}
+}
+
+func TestComputeSuite(t *testing.T) {
+	assert := assert.New(t)
+	results := []aws.RessourceTagResult{
+		tag("1", "us-east-1", "ecs", "cluster/prod", "env", "prod"),
+		tag("1", "us-east-1", "ecs", "cluster/prod", "team", "web"),
+		tag("1", "us-east-1", "ecs", "cluster/prod", "aws:cloudformation:stack-name", "stack"),
+		tag("1", "us-east-1", "ecs", "service/prod/api", "env", "dev"),
+		tag("1", "us-east-1", "ec2", "instance/i-1", "owner", "alice"),
+		tag("1", "us-east-1", "ec2", "instance/i-2", "owner", "bob"),
+		tag("1", "us-east-1", "ec2", "volume/vol-1", "instance-id", "i-1"),
+		tag("", "us-east-1", "ec2", "snapshot/snap-1", "volume", "arn:aws:ec2:us-east-1:1:volume/vol-1"),
+	}
+	clusterRule := models.PropagationRule{Source: "ecs:cluster", Target: "ecs:service", Relationship: "arn"}
+	volumeRule := models.PropagationRule{Source: "ec2:instance", Target: "ec2:volume", Relationship: "tag", ViaKey: "instance-id", Keys: []string{"owner"}}
+	snapshotRule := models.PropagationRule{Source: "ec2:volume", Target: "ec2:snapshot", Relationship: "tag", ViaKey: "volume", Keys: []string{"instance-id"}}
+
+	t.Run("Test the keys are copied from the EC2 relations", func(t *testing.T) {
+		rule := models.PropagationRule{Source: "ec2:instance", Target: "ec2:volume", Relationship: "ec2", Keys: []string{"owner"}}
+		plan, err := Compute(results, []models.PropagationRule{rule}, []aws.Relation{{Region: "us-east-1", ID: "vol-1", Related: "i-2"}})
+		assert.NoError(err)
+		assert.Equal([]Change{
+			{Rule: 0, Target: "arn:aws:ec2:us-east-1:1:volume/vol-1", Source: "arn:aws:ec2:us-east-1:1:instance/i-2", Key: "owner", Value: "bob"},
+		}, plan.Changes)
+	})
+
+	t.Run("Test the missing keys are copied", func(t *testing.T) {
+		plan, err := Compute(results, []models.PropagationRule{clusterRule, volumeRule, snapshotRule}, nil)
+		assert.NoError(err)
+		assert.Equal([]Change{
+			{Rule: 0, Target: "arn:aws:ecs:us-east-1:1:service/prod/api", Source: "arn:aws:ecs:us-east-1:1:cluster/prod", Key: "team", Value: "web"},
+			{Rule: 1, Target: "arn:aws:ec2:us-east-1:1:volume/vol-1", Source: "arn:aws:ec2:us-east-1:1:instance/i-1", Key: "owner", Value: "alice"},
+			{Rule: 2, Target: "arn:aws:ec2:us-east-1::snapshot/snap-1", Source: "arn:aws:ec2:us-east-1:1:volume/vol-1", Key: "instance-id", Value: "i-1"},
+		}, plan.Changes)
+		assert.Empty(plan.Skipped)
+		// The snapshot has no account in its ARN, it is written with the volume account
+		assert.Equal(aws.TagWrite{
+			Account: "1",
+			Region:  "us-east-1",
+			ARN:     "arn:aws:ec2:us-east-1::snapshot/snap-1",
+			Tags:    []aws.TagChange{{Key: "instance-id", Value: awssdk.String("i-1")}},
+		}, plan.Writes[2])
+	})
+
+	t.Run("Test overwrite always replaces the differing values", func(t *testing.T) {
+		rule := clusterRule
+		rule.Overwrite = OverwriteAlways
+		rule.Keys = []string{"env"}
+		plan, err := Compute(results, []models.PropagationRule{rule}, nil)
+		assert.NoError(err)
+		assert.Equal([]Change{
+			{Target: "arn:aws:ecs:us-east-1:1:service/prod/api", Source: "arn:aws:ecs:us-east-1:1:cluster/prod", Key: "env", Previous: awssdk.String("dev"), Value: "prod"},
+		}, plan.Changes)
+		assert.Equal([]aws.TagChange{{Key: "env", Previous: awssdk.String("dev"), Value: awssdk.String("prod")}}, plan.Writes[0].Tags)
+	})
+
+	t.Run("Test several sources with different values are skipped", func(t *testing.T) {
+		// Two services named api in different clusters share the id of the tag
+		conflicting := append([]aws.RessourceTagResult{
+			tag("1", "us-east-1", "ecs", "service/dev/api", "env", "staging"),
+			tag("1", "us-east-1", "ecs", "service/dev/api", "team", "web"),
+			tag("1", "us-east-1", "ec2", "instance/i-3", "service", "api"),
+		}, results...)
+		rule := models.PropagationRule{Source: "ecs:service", Target: "ec2:instance", Relationship: "tag", ViaKey: "service"}
+		plan, err := Compute(conflicting, []models.PropagationRule{rule}, nil)
+		assert.NoError(err)
+		assert.Equal([]Change{
+			{Target: "arn:aws:ec2:us-east-1:1:instance/i-3", Source: "arn:aws:ecs:us-east-1:1:service/dev/api", Key: "team", Value: "web"},
+		}, plan.Changes)
+		assert.Equal([]Skip{
+			{Target: "arn:aws:ec2:us-east-1:1:instance/i-3", Key: "env", Reason: "several sources with different values"},
+		}, plan.Skipped)
+	})
+
+	t.Run("Test the tags limit", func(t *testing.T) {
+		full := append([]aws.RessourceTagResult(nil), results...)
+		for i := 0; i < aws.MaxTagsPerResource-1; i++ {
+			full = append(full, tag("1", "us-east-1", "ecs", "service/prod/api", fmt.Sprintf("key-%02d", i), "v"))
+		}
+		plan, err := Compute(full, []models.PropagationRule{clusterRule}, nil)
+		assert.NoError(err)
+		assert.Empty(plan.Changes)
+		assert.Equal([]Skip{
+			{Target: "arn:aws:ecs:us-east-1:1:service/prod/api", Key: "team", Reason: "tags limit reached"},
+		}, plan.Skipped)
+	})
+
+	t.Run("Test invalid rules", func(t *testing.T) {
+		_, err := Compute(results, []models.PropagationRule{{Source: "a", Target: "b", Relationship: "parent"}}, nil)
+		assert.EqualError(err, `rule 0: unknown relationship "parent"`)
+	})
+}
@@ -0,0 +1,124 @@
+package propagation
+
+import (
+	"regexp"
+	"strings"
+
+	"tagu/aws"
+)
+
+// Resource is a scanned resource and its tags
+type Resource struct {
+	ARN     string
+	Account string
+	Region  string
+	// Type is the resource type in the service:type format
+	Type string
+	// ID is the last segment of the resource path, i-12345678 for an instance
+	ID   string
+	Tags map[string]string
+}
+
+// Index looks the resources up by ARN and by type and id, and the ids
+// related to an EC2 resource by region and id
+type Index struct {
+	byARN   map[string]*Resource
+	byType  map[string]map[string][]*Resource
+	related map[[2]string][]string
+}
+
+func newIndex(resources []*Resource, relations []aws.Relation) *Index {
+	index := &Index{byARN: map[string]*Resource{}, byType: map[string]map[string][]*Resource{}, related: map[[2]string][]string{}}
+	for _, relation := range relations {
+		key := [2]string{relation.Region, relation.ID}
+		index.related[key] = append(index.related[key], relation.Related)
+	}
+	for _, r := range resources {
+		index.byARN[r.ARN] = r
+		if index.byType[r.Type] == nil {
+			index.byType[r.Type] = map[string][]*Resource{}
+		}
+		index.byType[r.Type][r.ID] = append(index.byType[r.Type][r.ID], r)
+	}
+	return index
+}
+
+// Resolver returns the sources of type sourceType related to the target resource
+// via is the via-key of the rule
+type Resolver func(index *Index, target *Resource, sourceType, via string) []*Resource
+
+// Resolvers are the relationships usable in the rules
+// arn: the source is derived from the target ARN, the listener of a load balancer
+// tag: the via-key tag of the target holds the source id or ARN
+// ec2: the source is described by EC2, the instance of a volume or a network interface,
+// the requester of a network interface and the volume of a snapshot
+var Resolvers = map[string]Resolver{
+	"arn": resolveARN,
+	"tag": resolveTag,
+	"ec2": resolveEC2,
+}
+
+// arnPattern derives the ARN of the parent from the ARN of a well-known child
+type arnPattern struct {
+	child  *regexp.Regexp
+	parent string
+}
+
+var arnPatterns = []arnPattern{
+	// Load balancer listeners and listener rules
+	{regexp.MustCompile(`^(arn:[^:]+:elasticloadbalancing:[^:]*:[^:]*):listener/(app|net|gwy)/([^/]+)/([^/]+)/[^/]+$`), "$1:loadbalancer/$2/$3/$4"},
+	{regexp.MustCompile(`^(arn:[^:]+:elasticloadbalancing:[^:]*:[^:]*):listener-rule/(app|net|gwy)/([^/]+)/([^/]+)/([^/]+)/[^/]+$`), "$1:listener/$2/$3/$4/$5"},
+	// ECS services and tasks of a cluster
+	{regexp.MustCompile(`^(arn:[^:]+:ecs:[^:]*:[^:]*):(service|task)/([^/]+)/[^/]+$`), "$1:cluster/$3"},
+	// EKS node groups, add-ons and Fargate profiles of a cluster
+	{regexp.MustCompile(`^(arn:[^:]+:eks:[^:]*:[^:]*):(nodegroup|addon|fargateprofile)/([^/]+)/.+$`), "$1:cluster/$3"},
+}
+
+func resolveARN(index *Index, target *Resource, sourceType, via string) []*Resource {
+	for _, pattern := range arnPatterns {
+		if !pattern.child.MatchString(target.ARN) {
+			continue
+		}
+		parent := index.byARN[pattern.child.ReplaceAllString(target.ARN, pattern.parent)]
+		if parent != nil && parent.Type == sourceType {
+			return []*Resource{parent}
+		}
+	}
+	return nil
+}
+
+func resolveTag(index *Index, target *Resource, sourceType, via string) []*Resource {
+	value, ok := target.Tags[via]
+	if !ok || value == "" {
+		return nil
+	}
+	return index.lookup(target, sourceType, value)
+}
+
+func resolveEC2(index *Index, target *Resource, sourceType, via string) []*Resource {
+	var sources []*Resource
+	for _, related := range index.related[[2]string{target.Region, target.ID}] {
+		sources = append(sources, index.lookup(target, sourceType, related)...)
+	}
+	return sources
+}
+
+// lookup returns the sources of type sourceType matching the id or ARN value
+func (index *Index) lookup(target *Resource, sourceType, value string) []*Resource {
+	if strings.HasPrefix(value, "arn:") {
+		if source := index.byARN[value]; source != nil && source.Type == sourceType {
+			return []*Resource{source}
+		}
+		return nil
+	}
+	var sources []*Resource
+	for _, source := range index.byType[sourceType][value] {
+		// An id is only unique within its account and region
+		if source.Account == target.Account || target.Account == "" {
+			if source.Region == target.Region {
+				sources = append(sources, source)
+			}
+		}
+	}
+	return sources
+}
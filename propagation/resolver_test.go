@@ -0,0 +1,66 @@
+package propagation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+)
+
+func TestResolversSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	resources := []*Resource{
+		{ARN: "arn:aws:elasticloadbalancing:us-east-1:1:loadbalancer/app/web/50dc6c495c0c9188", Account: "1", Region: "us-east-1", Type: "elasticloadbalancing:loadbalancer", ID: "50dc6c495c0c9188"},
+		{ARN: "arn:aws:elasticloadbalancing:us-east-1:1:listener/app/web/50dc6c495c0c9188/f2f7dc8efc522ab2", Account: "1", Region: "us-east-1", Type: "elasticloadbalancing:listener", ID: "f2f7dc8efc522ab2"},
+		{ARN: "arn:aws:elasticloadbalancing:us-east-1:1:listener-rule/app/web/50dc6c495c0c9188/f2f7dc8efc522ab2/9683b2d02a6cabee", Account: "1", Region: "us-east-1", Type: "elasticloadbalancing:listener-rule", ID: "9683b2d02a6cabee"},
+		{ARN: "arn:aws:ecs:us-east-1:1:cluster/prod", Account: "1", Region: "us-east-1", Type: "ecs:cluster", ID: "prod"},
+		{ARN: "arn:aws:ecs:us-east-1:1:service/prod/api", Account: "1", Region: "us-east-1", Type: "ecs:service", ID: "api"},
+		{ARN: "arn:aws:eks:us-east-1:1:cluster/k8s", Account: "1", Region: "us-east-1", Type: "eks:cluster", ID: "k8s"},
+		{ARN: "arn:aws:eks:us-east-1:1:nodegroup/k8s/workers/a2b3", Account: "1", Region: "us-east-1", Type: "eks:nodegroup", ID: "a2b3"},
+		{ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Type: "ec2:instance", ID: "i-1"},
+		{ARN: "arn:aws:ec2:eu-west-1:1:instance/i-1", Account: "1", Region: "eu-west-1", Type: "ec2:instance", ID: "i-1"},
+		{ARN: "arn:aws:ec2:us-east-1:1:volume/vol-1", Account: "1", Region: "us-east-1", Type: "ec2:volume", ID: "vol-1", Tags: map[string]string{"instance-id": "i-1"}},
+		{ARN: "arn:aws:ec2:us-east-1::snapshot/snap-1", Region: "us-east-1", Type: "ec2:snapshot", ID: "snap-1", Tags: map[string]string{"volume": "arn:aws:ec2:us-east-1:1:volume/vol-1"}},
+		{ARN: "arn:aws:ec2:us-east-1:1:volume/vol-2", Account: "1", Region: "us-east-1", Type: "ec2:volume", ID: "vol-2", Tags: map[string]string{"instance-id": "i-9"}},
+		{ARN: "arn:aws:ec2:us-east-1:1:network-interface/eni-1", Account: "1", Region: "us-east-1", Type: "ec2:network-interface", ID: "eni-1"},
+	}
+	index := newIndex(resources, []aws.Relation{
+		{Region: "us-east-1", ID: "vol-2", Related: "i-1"},
+		{Region: "us-east-1", ID: "snap-1", Related: "vol-2"},
+		{Region: "us-east-1", ID: "eni-1", Related: "i-1"},
+		{Region: "us-east-1", ID: "eni-1", Related: "amazon-elb"},
+	})
+
+	fixtures := []struct {
+		name         string
+		relationship string
+		target       int
+		sourceType   string
+		via          string
+		expected     []*Resource
+	}{
+		{name: "Test listener to load balancer", relationship: "arn", target: 1, sourceType: "elasticloadbalancing:loadbalancer", expected: []*Resource{resources[0]}},
+		{name: "Test listener rule to listener", relationship: "arn", target: 2, sourceType: "elasticloadbalancing:listener", expected: []*Resource{resources[1]}},
+		{name: "Test ECS service to cluster", relationship: "arn", target: 4, sourceType: "ecs:cluster", expected: []*Resource{resources[3]}},
+		{name: "Test EKS node group to cluster", relationship: "arn", target: 6, sourceType: "eks:cluster", expected: []*Resource{resources[5]}},
+		{name: "Test ARN of another source type", relationship: "arn", target: 1, sourceType: "ecs:cluster"},
+		{name: "Test unknown ARN pattern", relationship: "arn", target: 9, sourceType: "ec2:instance"},
+		{name: "Test tag with the source id in the same region", relationship: "tag", target: 9, sourceType: "ec2:instance", via: "instance-id", expected: []*Resource{resources[7]}},
+		{name: "Test tag with the source ARN", relationship: "tag", target: 10, sourceType: "ec2:volume", via: "volume", expected: []*Resource{resources[9]}},
+		{name: "Test tag with an unknown source", relationship: "tag", target: 11, sourceType: "ec2:instance", via: "instance-id"},
+		{name: "Test missing via-key tag", relationship: "tag", target: 9, sourceType: "ec2:instance", via: "owner"},
+		{name: "Test EC2 volume to its attached instance", relationship: "ec2", target: 11, sourceType: "ec2:instance", expected: []*Resource{resources[7]}},
+		{name: "Test EC2 snapshot to its volume", relationship: "ec2", target: 10, sourceType: "ec2:volume", expected: []*Resource{resources[11]}},
+		{name: "Test EC2 network interface to its instance", relationship: "ec2", target: 12, sourceType: "ec2:instance", expected: []*Resource{resources[7]}},
+		{name: "Test EC2 resource without relation", relationship: "ec2", target: 9, sourceType: "ec2:instance"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			sources := Resolvers[fixture.relationship](index, resources[fixture.target], fixture.sourceType, fixture.via)
+			assert.Equal(fixture.expected, sources)
+		})
+	}
+}
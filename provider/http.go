@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatusError is implemented by the errors answered by the HTTP APIs of the providers
+type StatusError interface {
+	error
+	HTTPStatus() int
+}
+
+// ClassifyHTTP maps the errors of the HTTP APIs to their cause, 401 and 403 are
+// access-denied and 429 is throttled
+// Args:
+// 		err: error
+// Returns:
+// 		string: one of the Cause constants
+func ClassifyHTTP(err error) string {
+	var statusErr StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr) && (statusErr.HTTPStatus() == http.StatusUnauthorized || statusErr.HTTPStatus() == http.StatusForbidden):
+		return CauseAccessDenied
+	case errors.As(err, &statusErr) && statusErr.HTTPStatus() == http.StatusTooManyRequests:
+		return CauseThrottled
+	case errors.As(err, &netErr):
+		return CauseNetwork
+	}
+	return CauseUnknown
+}
+
+// HTTPCaller calls an HTTP API, the throttled and the failed calls are retried
+// params:
+// 		client: *http.Client, http.DefaultClient when nil
+// 		maxAttempts: int, the attempts of each call, 3 when zero
+// 		backoff: time.Duration, the delay before the second attempt doubled on each attempt,
+// 		a Retry-After header takes precedence
+type HTTPCaller struct {
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// Call sends the request until it succeeds, the network errors and the 429 and 5xx
+// answers are retried
+// Args:
+// 		ctx: context.Context
+// 		newRequest: func(context.Context) (*http.Request, error), builds the request of each attempt, its errors are not retried
+// 		decodeError: func(status int, body []byte) error, the error of an answer other than 200
+// 		out: interface{}, the JSON answer is decoded into it
+// Returns:
+// 		error: the error of the last attempt
+func (c HTTPCaller) Call(ctx context.Context, newRequest func(context.Context) (*http.Request, error), decodeError func(status int, body []byte) error, out interface{}) error {
+	attempts := c.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	backoff := c.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		retry, err := c.send(ctx, newRequest, decodeError, out)
+		if err == nil || retry == nil || attempt >= attempts {
+			return err
+		}
+		delay := backoff << (attempt - 1)
+		if *retry > 0 {
+			delay = *retry
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// send makes one attempt, retry is nil when the error must not be retried, otherwise
+// it holds the Retry-After delay of the answer, zero when the backoff applies
+func (c HTTPCaller) send(ctx context.Context, newRequest func(context.Context) (*http.Request, error), decodeError func(status int, body []byte) error, out interface{}) (retry *time.Duration, err error) {
+	req, err := newRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var delay time.Duration
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return &delay, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil, json.NewDecoder(resp.Body).Decode(out)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	apiErr := decodeError(resp.StatusCode, data)
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return nil, apiErr
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+	return &delay, apiErr
+}
+
+// TokenCache keeps a token until a minute before its expiry, a token without
+// expiry is kept for good
+type TokenCache struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Get returns the cached token or fetches a new one
+// Args:
+// 		ctx: context.Context
+// 		fetch: func(context.Context) (string, time.Time, error), returns a new token and its expiry
+// Returns:
+// 		string: the token
+// 		error: the error of fetch
+func (c *TokenCache) Get(ctx context.Context, fetch func(ctx context.Context) (string, time.Time, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && (c.expires.IsZero() || time.Now().Add(time.Minute).Before(c.expires)) {
+		return c.token, nil
+	}
+	token, expires, err := fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expires = token, expires
+	return token, nil
+}
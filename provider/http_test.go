@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStatusError int
+
+func (e fakeStatusError) Error() string {
+	return fmt.Sprintf("status %d", int(e))
+}
+
+func (e fakeStatusError) HTTPStatus() int {
+	return int(e)
+}
+
+func TestClassifyHTTPSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "Test unauthorized", err: fakeStatusError(401), expected: CauseAccessDenied},
+		{name: "Test wrapped forbidden", err: fmt.Errorf("list: %w", fakeStatusError(403)), expected: CauseAccessDenied},
+		{name: "Test too many requests", err: fakeStatusError(429), expected: CauseThrottled},
+		{name: "Test server error", err: fakeStatusError(503), expected: CauseUnknown},
+		{name: "Test network", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: CauseNetwork},
+		{name: "Test other", err: errors.New("boom"), expected: CauseUnknown},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, ClassifyHTTP(fixture.err))
+		})
+	}
+}
+
+func TestHTTPCallerSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		statuses []int
+		calls    int
+		err      string
+	}{
+		{name: "Test OK", statuses: []int{200}, calls: 1},
+		{name: "Test the throttled and failed calls are retried", statuses: []int{429, 503, 200}, calls: 3},
+		{name: "Test the retries give up after the attempts", statuses: []int{500, 500, 500, 200}, calls: 3, err: "status 500"},
+		{name: "Test a client error is not retried", statuses: []int{404, 200}, calls: 1, err: "status 404"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := fixture.statuses[calls]
+				calls++
+				w.WriteHeader(status)
+				w.Write([]byte(`{"value": "ok"}`))
+			}))
+			defer server.Close()
+
+			caller := HTTPCaller{Client: server.Client(), Backoff: time.Millisecond}
+			var out struct {
+				Value string `json:"value"`
+			}
+			err := caller.Call(context.TODO(), func(ctx context.Context) (*http.Request, error) {
+				return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			}, func(status int, body []byte) error {
+				return fakeStatusError(status)
+			}, &out)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+				assert.Equal("ok", out.Value)
+			}
+			assert.Equal(fixture.calls, calls)
+		})
+	}
+}
+
+func TestTokenCacheSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name    string
+		expires time.Time
+		calls   int
+	}{
+		{name: "Test the token is kept until its expiry", expires: time.Now().Add(time.Hour), calls: 1},
+		{name: "Test a token about to expire is fetched again", expires: time.Now().Add(30 * time.Second), calls: 2},
+		{name: "Test a token without expiry is kept", calls: 1},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			var cache TokenCache
+			calls := 0
+			fetch := func(ctx context.Context) (string, time.Time, error) {
+				calls++
+				return "token", fixture.expires, nil
+			}
+			for i := 0; i < 2; i++ {
+				token, err := cache.Get(context.TODO(), fetch)
+				assert.NoError(err)
+				assert.Equal("token", token)
+			}
+			assert.Equal(fixture.calls, calls)
+		})
+	}
+
+	var cache TokenCache
+	_, err := cache.Get(context.TODO(), func(ctx context.Context) (string, time.Time, error) {
+		return "", time.Time{}, errors.New("no credentials")
+	})
+	assert.EqualError(err, "no credentials")
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"tagu/models"
+)
+
+// Resource is a cloud resource and its tags in a provider neutral form
+// params:
+// 		provider: string, the name of the provider, aws for instance
+// 		scope: string, the ownership boundary, an AWS account, an Azure subscription, a GCP project
+// 		location: string, the region, location or zone of the resource, empty for the global resources
+// 		type: string, the provider resource type, service:type for AWS
+// 		id: string, the provider unique id, the ARN for AWS
+// 		tags: map[string]string, the tags or labels of the resource
+type Resource struct {
+	Provider string            `json:"provider"`
+	Scope    string            `json:"scope"`
+	Location string            `json:"location"`
+	Type     string            `json:"type"`
+	ID       string            `json:"id"`
+	Tags     map[string]string `json:"tags"`
+}
+
+// Keys returns the sorted tag keys of the resource
+func (r Resource) Keys() []string {
+	keys := make([]string, 0, len(r.Tags))
+	for key := range r.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MatchValues tells whether the tags match the filters with values only, one of the
+// tags must have one of the values of each such filter. The APIs can only filter on
+// the keys, the providers apply these filters to the resources they list
+// Args:
+// 		filters: []models.Tags
+// 		tags: map[string]string
+// Returns:
+// 		bool
+func MatchValues(filters []models.Tags, tags map[string]string) bool {
+	for _, filter := range filters {
+		if filter.Key != "" || len(filter.Values) == 0 {
+			continue
+		}
+		found := false
+		for _, value := range tags {
+			for _, expected := range filter.Values {
+				found = found || value == expected
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Target is a unit of discovery scanned independently of the others
+// params:
+// 		scope: string
+// 		location: string
+// 		id: string, distinguishes the targets of the same scope and location, empty when there is one
+type Target struct {
+	Scope    string `json:"scope"`
+	Location string `json:"location"`
+	ID       string `json:"id,omitempty"`
+}
+
+// String returns the scope followed by the location and the id if any
+func (t Target) String() string {
+	parts := []string{t.Scope}
+	if t.Location != "" || t.ID != "" {
+		parts = append(parts, t.Location)
+	}
+	if t.ID != "" {
+		parts = append(parts, t.ID)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Provider discovers the targets of its configuration and lists their resources with their tags
+type Provider interface {
+	// Name is the provider name set on the resources
+	Name() string
+	// Targets returns the targets to scan in a stable order
+	Targets(ctx context.Context) ([]Target, error)
+	// Resources lists the tagged resources of a target, the resources listed before
+	// an error are returned with it
+	Resources(ctx context.Context, target Target) ([]Resource, error)
+}
+
+// TagWrite is the tags to set and the keys to remove on a resource
+type TagWrite struct {
+	Resource Resource          `json:"resource"`
+	Set      map[string]string `json:"set,omitempty"`
+	Remove   []string          `json:"remove,omitempty"`
+}
+
+// WriteResult is the outcome of a TagWrite
+type WriteResult struct {
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// Writer is implemented by the providers able to write tags
+type Writer interface {
+	// WriteTags applies the writes, a failed resource is reported in its result
+	// and the error is only returned when the writes were stopped
+	WriteTags(ctx context.Context, writes []TagWrite) ([]WriteResult, error)
+}
+
+// Classifier is implemented by the providers sorting their errors into causes
+// such as access-denied or throttled
+type Classifier interface {
+	Classify(err error) string
+}
+
+// The causes returned by the classifiers, they match the causes of the aws package
+const (
+	// CauseAccessDenied the credentials are not allowed to list the target
+	CauseAccessDenied = "access-denied"
+	// CauseThrottled the API rejected the calls because of the request rate
+	CauseThrottled = "throttled"
+	// CauseNetwork the request never reached the API
+	CauseNetwork = "network"
+	// CauseUnknown any other error
+	CauseUnknown = "unknown"
+)
@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/models"
+)
+
+func TestResourceKeysSuite(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"env", "owner"}, Resource{Tags: map[string]string{"owner": "web", "env": "prod"}}.Keys())
+	assert.Equal([]string{}, Resource{}.Keys())
+}
+
+func TestTargetStringSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		target   Target
+		expected string
+	}{
+		{
+			name:     "Test scope and location",
+			target:   Target{Scope: "123456789012", Location: "us-east-1"},
+			expected: "123456789012/us-east-1",
+		},
+		{
+			name:     "Test the id follows the location",
+			target:   Target{Scope: "123456789012", Location: "us-east-1", ID: "4f2a"},
+			expected: "123456789012/us-east-1/4f2a",
+		},
+		{
+			name:     "Test a global target",
+			target:   Target{Scope: "my-project"},
+			expected: "my-project",
+		},
+		{
+			name:     "Test a global target with an id",
+			target:   Target{Scope: "my-project", ID: "folder"},
+			expected: "my-project//folder",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, fixture.target.String())
+		})
+	}
+}
+
+func TestMatchValuesSuite(t *testing.T) {
+	assert := assert.New(t)
+	filters := []models.Tags{{Key: "env", Values: []string{"prod"}}, {Values: []string{"dev", "test"}}}
+
+	fixtures := []struct {
+		name     string
+		filters  []models.Tags
+		tags     map[string]string
+		expected bool
+	}{
+		{name: "Test a value matches", filters: filters, tags: map[string]string{"stage": "test"}, expected: true},
+		{name: "Test no value matches", filters: filters, tags: map[string]string{"env": "prod"}, expected: false},
+		{name: "Test no tags", filters: filters, tags: nil, expected: false},
+		{name: "Test the key filters are ignored", filters: []models.Tags{{Key: "team", Values: []string{"data"}}}, tags: map[string]string{"team": "web"}, expected: true},
+		{name: "Test each filter must match", filters: []models.Tags{{Values: []string{"prod"}}, {Values: []string{"data"}}}, tags: map[string]string{"env": "prod"}, expected: false},
+		{name: "Test no filters", filters: nil, tags: nil, expected: true},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, MatchValues(fixture.filters, fixture.tags))
+		})
+	}
+}
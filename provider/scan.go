@@ -0,0 +1,176 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TargetStatus is the final state of a scanned target
+type TargetStatus string
+
+const (
+	// StatusOK the target was fully scanned
+	StatusOK TargetStatus = "ok"
+	// StatusFailed the target scan returned an error
+	StatusFailed TargetStatus = "failed"
+	// StatusTimeout the target scan exceeded the target or the global timeout
+	StatusTimeout TargetStatus = "timeout"
+	// StatusCanceled the target scan was interrupted
+	StatusCanceled TargetStatus = "canceled"
+	// StatusSkipped the target was never scanned
+	StatusSkipped TargetStatus = "skipped"
+)
+
+// ScanOptions holds the tuning parameters of a Scan
+// params:
+// 		concurrency: int, number of targets scanned in parallel
+// 		targetTimeout: time.Duration, zero means no limit
+type ScanOptions struct {
+	Concurrency   int
+	TargetTimeout time.Duration
+}
+
+// TargetReport is the outcome of a single target scan
+type TargetReport struct {
+	Target
+	Status TargetStatus `json:"status"`
+	Cause  string       `json:"cause,omitempty"`
+	Count  int          `json:"count"`
+	Error  string       `json:"error,omitempty"`
+	Err    error        `json:"-"`
+}
+
+// TargetReports is the status of every scanned target
+type TargetReports []TargetReport
+
+// Failed returns the targets that did not complete, either on error or timeout
+func (r TargetReports) Failed() TargetReports {
+	var failed TargetReports
+	for _, target := range r {
+		if target.Status == StatusFailed || target.Status == StatusTimeout {
+			failed = append(failed, target)
+		}
+	}
+	return failed
+}
+
+// TargetsError is returned by Scan when the targets of the provider can not be
+// discovered, nothing was scanned
+type TargetsError struct {
+	Provider string
+	Err      error
+}
+
+func (e *TargetsError) Error() string {
+	return fmt.Sprintf("%s targets: %s", e.Provider, e.Err)
+}
+
+// Unwrap returns the discovery error
+func (e *TargetsError) Unwrap() error {
+	return e.Err
+}
+
+// Report is the output of a Scan, it keeps the resources collected so far
+// even when the scan was stopped before the end
+type Report struct {
+	Provider  string        `json:"provider"`
+	Resources []Resource    `json:"resources"`
+	Targets   TargetReports `json:"targets"`
+}
+
+// Scan lists the resources of every target of the provider
+// The targets are spread over opts.Concurrency workers, a failed target is recorded
+// with its cause and the scan moves on, only a done ctx stops the scan. The
+// resources are returned in the targets order
+// Args:
+// 		ctx: context.Context
+// 		p: Provider
+// 		opts: ScanOptions
+// Returns:
+// 		Report: the collected resources and the status of each target
+// 		error: a *TargetsError if the targets can not be discovered, or if the scan was stopped before the end
+func Scan(ctx context.Context, p Provider, opts ScanOptions) (report Report, err error) {
+	report.Provider = p.Name()
+	targets, err := p.Targets(ctx)
+	if err != nil {
+		return report, &TargetsError{Provider: p.Name(), Err: err}
+	}
+	results := make([]targetResult, len(targets))
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx] = scanTarget(ctx, p, targets[idx], opts)
+			}
+		}()
+	}
+	for idx := range targets {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	report.Resources = []Resource{}
+	for _, result := range results {
+		report.Resources = append(report.Resources, result.resources...)
+		report.Targets = append(report.Targets, result.TargetReport)
+	}
+	if ctx.Err() != nil {
+		return report, fmt.Errorf("scan stopped: %w", ctx.Err())
+	}
+	return report, nil
+}
+
+type targetResult struct {
+	TargetReport
+	resources []Resource
+}
+
+// scanTarget lists the resources of a target bounded by the target timeout
+// and classifies how it ended, a target picked after ctx is done is skipped
+func scanTarget(ctx context.Context, p Provider, target Target, opts ScanOptions) (result targetResult) {
+	result.TargetReport = TargetReport{Target: target, Status: StatusSkipped}
+	if ctx.Err() != nil {
+		return result
+	}
+	tctx, cancel := context.WithCancel(ctx)
+	if opts.TargetTimeout > 0 {
+		tctx, cancel = context.WithTimeout(ctx, opts.TargetTimeout)
+	}
+	defer cancel()
+
+	resources, err := p.Resources(tctx, target)
+	for i := range resources {
+		resources[i].Provider = p.Name()
+	}
+	result.resources = resources
+	result.Count = len(resources)
+	result.Err = err
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Status = StatusOK
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.Canceled):
+		result.Status = StatusCanceled
+	case errors.Is(tctx.Err(), context.DeadlineExceeded):
+		result.Status = StatusTimeout
+	default:
+		result.Status = StatusFailed
+		if classifier, ok := p.(Classifier); ok {
+			result.Cause = classifier.Classify(err)
+		}
+	}
+	return result
+}
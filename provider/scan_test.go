@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProvider lists one resource per location, the location named "hang"
+// blocks until the context is done and "fail" returns an error after a resource
+type fakeProvider struct {
+	locations []string
+	err       error
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Targets(ctx context.Context) ([]Target, error) {
+	var targets []Target
+	for _, location := range p.locations {
+		targets = append(targets, Target{Scope: "scope", Location: location})
+	}
+	return targets, p.err
+}
+
+func (p *fakeProvider) Resources(ctx context.Context, target Target) ([]Resource, error) {
+	resource := Resource{Scope: target.Scope, Location: target.Location, Type: "vm", ID: target.Location + "/vm-1", Tags: map[string]string{"env": "prod"}}
+	switch target.Location {
+	case "hang":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case "fail":
+		return []Resource{resource}, errors.New("forbidden")
+	}
+	return []Resource{resource}, nil
+}
+
+func (p *fakeProvider) Classify(err error) string {
+	return "access-denied"
+}
+
+func TestScanSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name          string
+		provider      *fakeProvider
+		timeout       time.Duration
+		targetTimeout time.Duration
+		statuses      []TargetStatus
+		causes        []string
+		count         int
+		err           string
+	}{
+		{
+			name:     "Scan all targets OK",
+			provider: &fakeProvider{locations: []string{"east", "west"}},
+			statuses: []TargetStatus{StatusOK, StatusOK},
+			causes:   []string{"", ""},
+			count:    2,
+		},
+		{
+			name:     "Scan keeps the resources of a failed target",
+			provider: &fakeProvider{locations: []string{"east", "fail"}},
+			statuses: []TargetStatus{StatusOK, StatusFailed},
+			causes:   []string{"", "access-denied"},
+			count:    2,
+		},
+		{
+			name:          "Scan continues after a target timeout",
+			provider:      &fakeProvider{locations: []string{"east", "hang", "west"}},
+			targetTimeout: 10 * time.Millisecond,
+			statuses:      []TargetStatus{StatusOK, StatusTimeout, StatusOK},
+			causes:        []string{"", "", ""},
+			count:         2,
+		},
+		{
+			name:     "Scan stops on the global timeout",
+			provider: &fakeProvider{locations: []string{"east", "hang", "west"}},
+			timeout:  20 * time.Millisecond,
+			statuses: []TargetStatus{StatusOK, StatusTimeout, StatusSkipped},
+			causes:   []string{"", "", ""},
+			count:    1,
+			err:      "scan stopped: context deadline exceeded",
+		},
+		{
+			name:     "Scan fails when the targets can not be discovered",
+			provider: &fakeProvider{err: errors.New("no credentials")},
+			err:      "fake targets: no credentials",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			ctx := context.Background()
+			if fixture.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, fixture.timeout)
+				defer cancel()
+			}
+			report, err := Scan(ctx, fixture.provider, ScanOptions{TargetTimeout: fixture.targetTimeout})
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+			} else {
+				assert.NoError(err)
+			}
+			var targetsErr *TargetsError
+			assert.Equal(fixture.provider.err != nil, errors.As(err, &targetsErr))
+			var statuses []TargetStatus
+			var causes []string
+			for _, target := range report.Targets {
+				statuses = append(statuses, target.Status)
+				causes = append(causes, target.Cause)
+			}
+			assert.Equal(fixture.statuses, statuses)
+			assert.Equal(fixture.causes, causes)
+			assert.Len(report.Resources, fixture.count)
+			for _, resource := range report.Resources {
+				assert.Equal("fake", resource.Provider)
+			}
+		})
+	}
+}
+
+func TestScanConcurrencySuite(t *testing.T) {
+	assert := assert.New(t)
+	p := &fakeProvider{locations: []string{"a", "b", "c", "d", "e"}}
+	report, err := Scan(context.Background(), p, ScanOptions{Concurrency: 3})
+	assert.NoError(err)
+	var ids []string
+	for _, resource := range report.Resources {
+		ids = append(ids, resource.ID)
+	}
+	assert.Equal([]string{"a/vm-1", "b/vm-1", "c/vm-1", "d/vm-1", "e/vm-1"}, ids)
+}
+
+func TestReportFailedSuite(t *testing.T) {
+	assert := assert.New(t)
+	targets := TargetReports{
+		{Target: Target{Location: "a"}, Status: StatusOK},
+		{Target: Target{Location: "b"}, Status: StatusFailed},
+		{Target: Target{Location: "c"}, Status: StatusTimeout},
+		{Target: Target{Location: "d"}, Status: StatusSkipped},
+	}
+	failed := targets.Failed()
+	assert.Len(failed, 2)
+	assert.Equal("b", failed[0].Location)
+	assert.Equal("c", failed[1].Location)
+}
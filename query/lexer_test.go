@@ -0,0 +1,47 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenizeSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name     string
+		expr     string
+		expected []token
+		err      string
+	}{
+		{
+			name: "Test operators and identifiers",
+			expr: `tags.cost-center!="a\"b"||-1.5`,
+			expected: []token{
+				{tokenIdent, "tags", 0},
+				{tokenOperator, ".", 4},
+				{tokenIdent, "cost-center", 5},
+				{tokenOperator, "!=", 16},
+				{tokenString, `a"b`, 18},
+				{tokenOperator, "||", 24},
+				{tokenNumber, "-1.5", 26},
+				{tokenEOF, "", 30},
+			},
+		},
+		{name: "Test unterminated string", expr: `env == "prod`, err: "invalid expression at 7: unterminated string"},
+		{name: "Test unexpected character", expr: `env = "prod"`, err: `invalid expression at 4: unexpected character '='`},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			tokens, err := tokenize(fixture.expr)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.expected, tokens)
+		})
+	}
+}
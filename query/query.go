@@ -0,0 +1,457 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"tagu/aws"
+)
+
+// Fields are the resource attributes usable in an expression next to tags.<key>
+var Fields = []string{"account", "region", "service", "resource", "arn", "type"}
+
+// Resource is the view of a resource an expression is evaluated on
+type Resource struct {
+	Fields map[string]string
+	Tags   map[string]string
+}
+
+// node is a parsed expression, an operand evaluates to a value and a condition to a boolean
+// A missing tag evaluates to a nil value
+type node interface {
+	value(r Resource) *string
+	boolean() bool
+}
+
+// Expression is a compiled where expression
+type Expression struct {
+	source string
+	root   node
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Match evaluates the expression on the resource
+func (e *Expression) Match(r Resource) bool {
+	return truth(e.root.value(r))
+}
+
+var (
+	trueValue  = "true"
+	falseValue = "false"
+)
+
+func boolValue(b bool) *string {
+	if b {
+		return &trueValue
+	}
+	return &falseValue
+}
+
+func truth(v *string) bool {
+	return v != nil && *v == trueValue
+}
+
+type literal struct {
+	text   string
+	isBool bool
+}
+
+func (n literal) value(r Resource) *string { return &n.text }
+func (n literal) boolean() bool            { return n.isBool }
+
+type field struct {
+	name string
+	tag  bool
+}
+
+func (n field) value(r Resource) *string {
+	values := r.Fields
+	if n.tag {
+		values = r.Tags
+	}
+	if v, ok := values[n.name]; ok {
+		return &v
+	}
+	return nil
+}
+func (n field) boolean() bool { return false }
+
+type has struct {
+	field field
+}
+
+func (n has) value(r Resource) *string { return boolValue(n.field.value(r) != nil) }
+func (n has) boolean() bool            { return true }
+
+type not struct {
+	operand node
+}
+
+func (n not) value(r Resource) *string { return boolValue(!truth(n.operand.value(r))) }
+func (n not) boolean() bool            { return true }
+
+type logical struct {
+	op          string
+	left, right node
+}
+
+func (n logical) value(r Resource) *string {
+	left := truth(n.left.value(r))
+	if n.op == "&&" {
+		return boolValue(left && truth(n.right.value(r)))
+	}
+	return boolValue(left || truth(n.right.value(r)))
+}
+func (n logical) boolean() bool { return true }
+
+type match struct {
+	negate  bool
+	operand node
+	re      *regexp.Regexp
+}
+
+func (n match) value(r Resource) *string {
+	v := n.operand.value(r)
+	if v == nil {
+		return boolValue(n.negate)
+	}
+	return boolValue(n.re.MatchString(*v) != n.negate)
+}
+func (n match) boolean() bool { return true }
+
+type compare struct {
+	op          string
+	left, right node
+}
+
+// value compares the numbers numerically and the other values as strings,
+// a missing tag is only equal to another missing tag and is never ordered
+func (n compare) value(r Resource) *string {
+	left, right := n.left.value(r), n.right.value(r)
+	if left == nil || right == nil {
+		switch n.op {
+		case "==":
+			return boolValue(left == nil && right == nil)
+		case "!=":
+			return boolValue(left != nil || right != nil)
+		}
+		return boolValue(false)
+	}
+	cmp := strings.Compare(*left, *right)
+	if l, err := strconv.ParseFloat(*left, 64); err == nil {
+		if r, err := strconv.ParseFloat(*right, 64); err == nil {
+			cmp = 0
+			if l < r {
+				cmp = -1
+			} else if l > r {
+				cmp = 1
+			}
+		}
+	}
+	switch n.op {
+	case "==":
+		return boolValue(cmp == 0)
+	case "!=":
+		return boolValue(cmp != 0)
+	case "<":
+		return boolValue(cmp < 0)
+	case "<=":
+		return boolValue(cmp <= 0)
+	case ">":
+		return boolValue(cmp > 0)
+	}
+	return boolValue(cmp >= 0)
+}
+func (n compare) boolean() bool { return true }
+
+// parser is a recursive descent parser of the grammar
+//
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | compare
+//	compare = operand [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) operand | ( "=~" | "!~" ) string ]
+//	operand = "(" or ")" | "has" "(" field ")" | field | string | number | "true" | "false"
+//	field   = name | "tags" "." key | "tags" "[" string "]"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOperator && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return p.unexpected(fmt.Sprintf("expected %q", op))
+	}
+	return nil
+}
+
+func (p *parser) unexpected(msg string) error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return &SyntaxError{t.pos, msg + ", found the end of the expression"}
+	}
+	return &SyntaxError{t.pos, fmt.Sprintf("%s, found %q", msg, t.text)}
+}
+
+// condition checks that n is a boolean operand of a logical operator
+func (p *parser) condition(n node, pos int) (node, error) {
+	if !n.boolean() {
+		return nil, &SyntaxError{pos, "expected a condition, use has() to test a tag"}
+	}
+	return n, nil
+}
+
+func (p *parser) or() (node, error) {
+	pos := p.peek().pos
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		if left, err = p.condition(left, pos); err != nil {
+			return nil, err
+		}
+		pos = p.peek().pos
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		if right, err = p.condition(right, pos); err != nil {
+			return nil, err
+		}
+		left = logical{"||", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	pos := p.peek().pos
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		if left, err = p.condition(left, pos); err != nil {
+			return nil, err
+		}
+		pos = p.peek().pos
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if right, err = p.condition(right, pos); err != nil {
+			return nil, err
+		}
+		left = logical{"&&", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.accept("!") {
+		pos := p.peek().pos
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if operand, err = p.condition(operand, pos); err != nil {
+			return nil, err
+		}
+		return not{operand}, nil
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (node, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return left, nil
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return compare{t.text, left, right}, nil
+	case "=~", "!~":
+		p.next()
+		pattern := p.next()
+		if pattern.kind != tokenString {
+			return nil, &SyntaxError{pattern.pos, "expected a regular expression string"}
+		}
+		re, err := regexp.Compile(pattern.text)
+		if err != nil {
+			return nil, &SyntaxError{pattern.pos, err.Error()}
+		}
+		return match{t.text == "!~", left, re}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) operand() (node, error) {
+	start := p.pos
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return literal{text: t.text}, nil
+	case tokenNumber:
+		if _, err := strconv.ParseFloat(t.text, 64); err != nil {
+			return nil, &SyntaxError{t.pos, "invalid number " + t.text}
+		}
+		return literal{text: t.text}, nil
+	case tokenOperator:
+		if t.text == "(" {
+			n, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		}
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return literal{text: t.text, isBool: true}, nil
+		case "has":
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			f, err := p.field(p.next())
+			if err != nil {
+				return nil, err
+			}
+			return has{f}, p.expect(")")
+		}
+		return p.field(t)
+	}
+	p.pos = start
+	return nil, p.unexpected("expected a value")
+}
+
+func (p *parser) field(t token) (field, error) {
+	if t.kind != tokenIdent {
+		return field{}, &SyntaxError{t.pos, "expected a field"}
+	}
+	if t.text != "tags" {
+		for _, name := range Fields {
+			if name == t.text {
+				return field{name: name}, nil
+			}
+		}
+		return field{}, &SyntaxError{t.pos, fmt.Sprintf("unknown field %q, expected %s or tags.<key>", t.text, strings.Join(Fields, ", "))}
+	}
+	if p.accept(".") {
+		key := p.next()
+		if key.kind != tokenIdent {
+			return field{}, &SyntaxError{key.pos, "expected a tag key"}
+		}
+		return field{name: key.text, tag: true}, nil
+	}
+	if p.accept("[") {
+		key := p.next()
+		if key.kind != tokenString {
+			return field{}, &SyntaxError{key.pos, "expected a quoted tag key"}
+		}
+		return field{name: key.text, tag: true}, p.expect("]")
+	}
+	return field{}, p.unexpected(`expected tags.<key> or tags["<key>"]`)
+}
+
+// Compile parses a where expression
+// Args:
+// 		expr: string, service == "ec2" && !has(tags.owner) || tags.env =~ "^prod"
+// Returns:
+// 		*Expression: the compiled expression
+// 		error: a *SyntaxError if the expression is invalid or is not a condition
+func Compile(expr string) (*Expression, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected("expected an operator")
+	}
+	if root, err = p.condition(root, 0); err != nil {
+		return nil, err
+	}
+	return &Expression{source: expr, root: root}, nil
+}
+
+// Filter keeps the tags of the resources matching the expression
+// Every tag of a resource is kept when the resource matches
+// Args:
+// 		results: []aws.RessourceTagResult
+// 		expr: *Expression
+// Returns:
+// 		[]aws.RessourceTagResult: the results of the matching resources in their order
+func Filter(results []aws.RessourceTagResult, expr *Expression) []aws.RessourceTagResult {
+	resources := map[string]Resource{}
+	for _, r := range results {
+		arn := r.ARN()
+		resource, ok := resources[arn]
+		if !ok {
+			resource = Resource{
+				Fields: map[string]string{
+					"account":  r.Account,
+					"region":   r.Region,
+					"service":  r.Service,
+					"resource": r.Resource,
+					"arn":      arn,
+					"type":     r.Type(),
+				},
+				Tags: map[string]string{},
+			}
+			resources[arn] = resource
+		}
+		if !r.Untagged() {
+			resource.Tags[r.Key] = r.Value
+		}
+	}
+
+	matches := map[string]bool{}
+	for arn, resource := range resources {
+		matches[arn] = expr.Match(resource)
+	}
+	var filtered []aws.RessourceTagResult
+	for _, r := range results {
+		if matches[r.ARN()] {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,101 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+)
+
+func TestCompileSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name string
+		expr string
+		err  string
+	}{
+		{name: "Test valid expression", expr: `service == "ec2" && !has(tags.owner) || tags.env =~ "^prod"`},
+		{name: "Test quoted tag key", expr: `tags["aws:cloudformation:stack-name"] != ""`},
+		{name: "Test a value is not a condition", expr: `tags.env`, err: "invalid expression at 0: expected a condition, use has() to test a tag"},
+		{name: "Test a value operand of a logical operator", expr: `has(tags.env) && region`, err: "invalid expression at 17: expected a condition, use has() to test a tag"},
+		{name: "Test unknown field", expr: `owner == "me"`, err: `invalid expression at 0: unknown field "owner", expected account, region, service, resource, arn, type or tags.<key>`},
+		{name: "Test invalid regular expression", expr: `tags.env =~ "("`, err: "invalid expression at 12: error parsing regexp: missing closing ): `(`"},
+		{name: "Test regular expression not a string", expr: `tags.env =~ prod`, err: "invalid expression at 12: expected a regular expression string"},
+		{name: "Test missing parenthesis", expr: `(has(tags.env)`, err: `invalid expression at 14: expected ")", found the end of the expression`},
+		{name: "Test trailing operand", expr: `has(tags.env) "x"`, err: `invalid expression at 14: expected an operator, found "x"`},
+		{name: "Test missing operand", expr: `tags.env ==`, err: "invalid expression at 11: expected a value, found the end of the expression"},
+		{name: "Test tags without key", expr: `has(tags)`, err: `invalid expression at 8: expected tags.<key> or tags["<key>"], found ")"`},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			expr, err := Compile(fixture.expr)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.expr, expr.String())
+		})
+	}
+}
+
+func TestMatchSuite(t *testing.T) {
+	assert := assert.New(t)
+	resource := Resource{
+		Fields: map[string]string{"account": "123456789012", "region": "us-east-1", "service": "ec2", "resource": "instance/i-1", "arn": "arn:aws:ec2:us-east-1:123456789012:instance/i-1", "type": "ec2:instance"},
+		Tags:   map[string]string{"env": "production", "size": "10", "aws:createdBy": "me"},
+	}
+
+	fixtures := []struct {
+		expr     string
+		expected bool
+	}{
+		{`service == "ec2"`, true},
+		{`service != "ec2"`, false},
+		{`has(tags.env) && !has(tags.owner)`, true},
+		{`tags.env =~ "^prod"`, true},
+		{`tags.env !~ "^prod"`, false},
+		{`tags.owner =~ ".*"`, false},
+		{`tags.owner !~ "x"`, true},
+		{`tags.owner == "me"`, false},
+		{`tags.owner != "me"`, true},
+		{`tags.owner == tags.team`, true},
+		{`tags.size > 9`, true},
+		{`tags.size >= 10 && tags.size <= 10`, true},
+		{`tags.size < "9"`, false},
+		{`tags.env > "dev"`, true},
+		{`tags.owner < "z"`, false},
+		{`tags["aws:createdBy"] == "me"`, true},
+		{`service == "s3" && has(tags.env) || type == "ec2:instance"`, true},
+		{`service == "s3" && (has(tags.env) || type == "ec2:instance")`, false},
+		{`!(region == "us-east-1")`, false},
+		{`true`, true},
+		{`false || !true`, false},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.expr, func(t *testing.T) {
+			expr, err := Compile(fixture.expr)
+			assert.NoError(err)
+			assert.Equal(fixture.expected, expr.Match(resource))
+		})
+	}
+}
+
+func TestFilterSuite(t *testing.T) {
+	assert := assert.New(t)
+	results := []aws.RessourceTagResult{
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"},
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-2", Key: "env", Value: "dev"},
+		{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "owner", Value: "web"},
+		{Account: "1", Region: "us-east-1", Service: "s3", Resource: "logs", Key: "env", Value: "prod"},
+	}
+
+	expr, err := Compile(`type == "ec2:instance" && tags.env == "prod"`)
+	assert.NoError(err)
+	// Every tag of the matching resource is kept, not only the tested ones
+	assert.Equal([]aws.RessourceTagResult{results[0], results[2]}, Filter(results, expr))
+}
@@ -0,0 +1,310 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tagu/aws"
+	"tagu/models"
+	"tagu/query"
+)
+
+const (
+	// DefaultPerPage is the page size of the results without per-page
+	DefaultPerPage = 100
+	// MaxPerPage is the maximum page size of the results
+	MaxPerPage = 1000
+)
+
+// Schema is the JSON schema of the API responses
+//go:embed schema.json
+var Schema []byte
+
+// ScanRequest is the body of POST /api/v1/scans, either the name of a
+// configured scan or a spec
+type ScanRequest struct {
+	Scan string       `json:"scan,omitempty"`
+	Spec *models.Spec `json:"spec,omitempty"`
+}
+
+// ResultsPage is a page of the results of a snapshot
+type ResultsPage struct {
+	Snapshot SnapshotInfo             `json:"snapshot"`
+	Page     int                      `json:"page"`
+	PerPage  int                      `json:"per-page"`
+	Total    int                      `json:"total"`
+	Results  []aws.RessourceTagResult `json:"results"`
+}
+
+// DiffResponse is the tags changed between two snapshots
+type DiffResponse struct {
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Changes []TagDiff `json:"changes"`
+}
+
+// ErrorResponse is the body of every error
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// API serves the scans, the jobs and the snapshots over HTTP
+//
+//	POST /api/v1/scans                    queue a scan, 202 with the job
+//	GET  /api/v1/jobs/{id}                the job status and its snapshot id
+//	GET  /api/v1/snapshots?scan=          the snapshots, the oldest first
+//	GET  /api/v1/snapshots/{id}/results   a page of the results, see Results
+//	GET  /api/v1/diff?from=&to=           the tags changed between two snapshots
+//	GET  /api/v1/schedules                the next and last run of the scheduled scans
+//	GET  /api/v1/schema                   the JSON schema of the responses
+type API struct {
+	Queue *Queue
+	Store *Store
+	// Scans are the specs of the named scans
+	Scans map[string]models.Spec
+	// Scheduler runs the scheduled scans, may be nil
+	Scheduler *Scheduler
+	// AdHoc accepts the specs of POST /api/v1/scans, their roles are assumed
+	// with the server credentials, only the named scans run otherwise
+	AdHoc bool
+}
+
+// Handler returns the API routes
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/scans", a.submit)
+	mux.HandleFunc("/api/v1/jobs/", a.job)
+	mux.HandleFunc("/api/v1/snapshots", a.snapshots)
+	mux.HandleFunc("/api/v1/snapshots/", a.snapshot)
+	mux.HandleFunc("/api/v1/diff", a.diff)
+	mux.HandleFunc("/api/v1/schedules", a.schedules)
+	mux.HandleFunc("/api/v1/schema", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(Schema)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+// allow rejects the requests of another method
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return false
+	}
+	return true
+}
+
+func (a *API) submit(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+	var request ScanRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid scan request: %w", err))
+		return
+	}
+
+	var spec models.Spec
+	switch {
+	case (request.Scan == "") == (request.Spec == nil):
+		writeError(w, http.StatusBadRequest, errors.New("invalid scan request: set either scan or spec"))
+		return
+	case request.Spec != nil && !a.AdHoc:
+		writeError(w, http.StatusForbidden, errors.New("the ad-hoc specs are disabled, submit a named scan"))
+		return
+	case request.Spec != nil:
+		spec = *request.Spec
+		if len(spec.FilterInput) == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid scan request: the spec has no filter-input"))
+			return
+		}
+	default:
+		var ok bool
+		if spec, ok = a.Scans[request.Scan]; !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown scan %q", request.Scan))
+			return
+		}
+	}
+
+	job, err := a.Queue.Submit(request.Scan, spec)
+	if errors.Is(err, ErrQueueFull) {
+		writeError(w, http.StatusTooManyRequests, err)
+		return
+	}
+	if errors.Is(err, ErrQueueStopped) {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (a *API) job(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	job, err := a.Queue.Get(strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (a *API) snapshots(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	infos := a.Store.List(r.URL.Query().Get("scan"))
+	if infos == nil {
+		infos = []SnapshotInfo{}
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// snapshot serves /api/v1/snapshots/{id} and /api/v1/snapshots/{id}/results
+func (a *API) snapshot(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/snapshots/"), "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "results") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+	snapshot, err := a.Store.Get(parts[0])
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("snapshot %w", err))
+		return
+	}
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, snapshot.SnapshotInfo)
+		return
+	}
+	page, err := Results(snapshot, r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Results filters and paginates the results of a snapshot
+// The account, region, service, key and value parameters keep the matching tags,
+// where keeps the resources matching the expression. The pages start at 1
+// Args:
+// 		snapshot: *Snapshot
+// 		params: map[string][]string, the query parameters
+// Returns:
+// 		ResultsPage: the page
+// 		error: if a parameter is invalid
+func Results(snapshot *Snapshot, params map[string][]string) (page ResultsPage, err error) {
+	get := func(name string) string {
+		if values := params[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	page = ResultsPage{Snapshot: snapshot.SnapshotInfo, Page: 1, PerPage: DefaultPerPage, Results: []aws.RessourceTagResult{}}
+	if value := get("page"); value != "" {
+		if page.Page, err = strconv.Atoi(value); err != nil || page.Page < 1 {
+			return page, fmt.Errorf("invalid page %q", value)
+		}
+	}
+	if value := get("per-page"); value != "" {
+		if page.PerPage, err = strconv.Atoi(value); err != nil || page.PerPage < 1 || page.PerPage > MaxPerPage {
+			return page, fmt.Errorf("invalid per-page %q, expected 1 to %d", value, MaxPerPage)
+		}
+	}
+
+	results := snapshot.Results
+	if where := get("where"); where != "" {
+		expr, err := query.Compile(where)
+		if err != nil {
+			return page, fmt.Errorf("invalid where: %w", err)
+		}
+		results = query.Filter(results, expr)
+	}
+	var filtered []aws.RessourceTagResult
+	for _, r := range results {
+		if matchParam(get("account"), r.Account) && matchParam(get("region"), r.Region) && matchParam(get("service"), r.Service) &&
+			matchParam(get("key"), r.Key) && matchParam(get("value"), r.Value) {
+			filtered = append(filtered, r)
+		}
+	}
+
+	page.Total = len(filtered)
+	start := (page.Page - 1) * page.PerPage
+	if start < len(filtered) {
+		end := start + page.PerPage
+		if end > len(filtered) {
+			end = len(filtered)
+		}
+		page.Results = filtered[start:end]
+	}
+	return page, nil
+}
+
+func matchParam(param, value string) bool {
+	return param == "" || param == value
+}
+
+// diff compares two snapshots, without from the snapshot of the same scan preceding to is used
+func (a *API) diff(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if to == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing to snapshot"))
+		return
+	}
+	newer, err := a.Store.Get(to)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("snapshot %s %w", to, err))
+		return
+	}
+	var older *Snapshot
+	if from == "" {
+		if older, err = a.Store.Previous(newer.ID); err != nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no snapshot before %s", to))
+			return
+		}
+	} else if older, err = a.Store.Get(from); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("snapshot %s %w", from, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, DiffResponse{From: older.ID, To: newer.ID, Changes: Diff(older, newer)})
+}
+
+func (a *API) schedules(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	statuses := []ScheduleStatus{}
+	if a.Scheduler != nil {
+		statuses = a.Scheduler.Status()
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+	"tagu/models"
+)
+
+// newTestAPI returns an API holding two snapshots of the prod scan
+func newTestAPI(t *testing.T) (*API, Snapshot, Snapshot) {
+	t.Helper()
+	started := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	tag := func(account, resource, key, value string) aws.RessourceTagResult {
+		return aws.RessourceTagResult{Account: account, Region: "us-east-1", Service: "ec2", Resource: resource, Key: key, Value: value}
+	}
+	older := NewSnapshot("prod", SourceSchedule, started, started, aws.Report{Results: []aws.RessourceTagResult{
+		tag("1", "instance/i-1", "env", "prod"),
+	}})
+	newer := NewSnapshot("prod", SourceSchedule, started.Add(time.Hour), started.Add(time.Hour), aws.Report{Results: []aws.RessourceTagResult{
+		tag("1", "instance/i-1", "env", "staging"),
+		tag("1", "instance/i-2", "env", "prod"),
+		tag("2", "instance/i-3", "env", "prod"),
+		tag("2", "instance/i-3", "owner", "web"),
+	}})
+	store, _ := OpenStore("")
+	assert.NoError(t, store.Put(older))
+	assert.NoError(t, store.Put(newer))
+	scan := func(ctx context.Context, spec models.Spec) (aws.Report, error) {
+		return aws.Report{}, nil
+	}
+	api := &API{
+		Queue: NewQueue(1, 0, scan, store),
+		Store: store,
+		Scans: map[string]models.Spec{"prod": {FilterInput: []models.InputTag{{Account: "1"}}}},
+	}
+	return api, older, newer
+}
+
+func TestAPISuite(t *testing.T) {
+	assert := assert.New(t)
+	api, older, newer := newTestAPI(t)
+	handler := api.Handler()
+
+	fixtures := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		adHoc    bool
+		status   int
+		expected string
+	}{
+		{
+			name:     "Test submit an unknown scan",
+			method:   http.MethodPost,
+			path:     "/api/v1/scans",
+			body:     `{"scan": "dev"}`,
+			status:   http.StatusNotFound,
+			expected: `{"error":"unknown scan \"dev\""}`,
+		},
+		{
+			name:     "Test submit a scan and a spec",
+			method:   http.MethodPost,
+			path:     "/api/v1/scans",
+			body:     `{"scan": "prod", "spec": {"filter-input": []}}`,
+			status:   http.StatusBadRequest,
+			expected: `{"error":"invalid scan request: set either scan or spec"}`,
+		},
+		{
+			name:     "Test submit a spec without filter input",
+			method:   http.MethodPost,
+			path:     "/api/v1/scans",
+			body:     `{"spec": {"role-name": "reader"}}`,
+			adHoc:    true,
+			status:   http.StatusBadRequest,
+			expected: `{"error":"invalid scan request: the spec has no filter-input"}`,
+		},
+		{
+			name:     "Test submit a spec without the ad-hoc specs",
+			method:   http.MethodPost,
+			path:     "/api/v1/scans",
+			body:     `{"spec": {"role-name": "admin", "filter-input": [{"account": "999999999999"}]}}`,
+			status:   http.StatusForbidden,
+			expected: `{"error":"the ad-hoc specs are disabled, submit a named scan"}`,
+		},
+		{
+			name:     "Test submit an invalid body",
+			method:   http.MethodPost,
+			path:     "/api/v1/scans",
+			body:     `{"name": "prod"}`,
+			status:   http.StatusBadRequest,
+			expected: `{"error":"invalid scan request: json: unknown field \"name\""}`,
+		},
+		{
+			name:     "Test get the scans",
+			method:   http.MethodGet,
+			path:     "/api/v1/scans",
+			status:   http.StatusMethodNotAllowed,
+			expected: `{"error":"method GET not allowed"}`,
+		},
+		{
+			name:     "Test get an unknown job",
+			method:   http.MethodGet,
+			path:     "/api/v1/jobs/unknown",
+			status:   http.StatusNotFound,
+			expected: `{"error":"job not found"}`,
+		},
+		{
+			name:     "Test list the snapshots of an unknown scan",
+			method:   http.MethodGet,
+			path:     "/api/v1/snapshots?scan=dev",
+			status:   http.StatusOK,
+			expected: `[]`,
+		},
+		{
+			name:     "Test list the schedules without scheduler",
+			method:   http.MethodGet,
+			path:     "/api/v1/schedules",
+			status:   http.StatusOK,
+			expected: `[]`,
+		},
+		{
+			name:     "Test get an unknown snapshot",
+			method:   http.MethodGet,
+			path:     "/api/v1/snapshots/unknown/results",
+			status:   http.StatusNotFound,
+			expected: `{"error":"snapshot not found"}`,
+		},
+		{
+			name:     "Test get an unknown snapshot path",
+			method:   http.MethodGet,
+			path:     "/api/v1/snapshots/" + newer.ID + "/tags",
+			status:   http.StatusNotFound,
+			expected: `{"error":"unknown path /api/v1/snapshots/` + newer.ID + `/tags"}`,
+		},
+		{
+			name:     "Test get the results with an invalid page",
+			method:   http.MethodGet,
+			path:     "/api/v1/snapshots/" + newer.ID + "/results?per-page=5000",
+			status:   http.StatusBadRequest,
+			expected: `{"error":"invalid per-page \"5000\", expected 1 to 1000"}`,
+		},
+		{
+			name:     "Test diff without snapshot",
+			method:   http.MethodGet,
+			path:     "/api/v1/diff",
+			status:   http.StatusBadRequest,
+			expected: `{"error":"missing to snapshot"}`,
+		},
+		{
+			name:     "Test diff the first snapshot",
+			method:   http.MethodGet,
+			path:     "/api/v1/diff?to=" + older.ID,
+			status:   http.StatusNotFound,
+			expected: `{"error":"no snapshot before ` + older.ID + `"}`,
+		},
+		{
+			name:   "Test diff with the previous snapshot",
+			method: http.MethodGet,
+			path:   "/api/v1/diff?to=" + newer.ID,
+			status: http.StatusOK,
+			expected: `{"from":"` + older.ID + `","to":"` + newer.ID + `","changes":[` +
+				`{"arn":"arn:aws:ec2:us-east-1:1:instance/i-1","account":"1","region":"us-east-1","key":"env","change":"changed","from":"prod","to":"staging"},` +
+				`{"arn":"arn:aws:ec2:us-east-1:1:instance/i-2","account":"1","region":"us-east-1","key":"env","change":"added","to":"prod"},` +
+				`{"arn":"arn:aws:ec2:us-east-1:2:instance/i-3","account":"2","region":"us-east-1","key":"env","change":"added","to":"prod"},` +
+				`{"arn":"arn:aws:ec2:us-east-1:2:instance/i-3","account":"2","region":"us-east-1","key":"owner","change":"added","to":"web"}]}`,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			api.AdHoc = fixture.adHoc
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(fixture.method, fixture.path, strings.NewReader(fixture.body)))
+			assert.Equal(fixture.status, rec.Code)
+			assert.Equal("application/json", rec.Header().Get("Content-Type"))
+			assert.Equal(fixture.expected, strings.TrimSpace(rec.Body.String()))
+		})
+	}
+}
+
+func TestAPISubmit(t *testing.T) {
+	assert := assert.New(t)
+	api, _, _ := newTestAPI(t)
+	handler := api.Handler()
+	submit := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/scans", strings.NewReader(`{"scan": "prod"}`)))
+		return rec
+	}
+
+	// The queue holds a single job and no worker runs
+	rec := submit()
+	assert.Equal(http.StatusAccepted, rec.Code)
+	var job Job
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &job))
+	assert.Equal(JobQueued, job.Status)
+	assert.Equal("prod", job.Scan)
+	assert.Equal("/api/v1/jobs/"+job.ID, rec.Header().Get("Location"))
+
+	rec = submit()
+	assert.Equal(http.StatusTooManyRequests, rec.Code)
+	assert.Equal(`{"error":"the job queue is full"}`, strings.TrimSpace(rec.Body.String()))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+job.ID, nil))
+	assert.Equal(http.StatusOK, rec.Code)
+}
+
+func TestResultsSuite(t *testing.T) {
+	assert := assert.New(t)
+	api, _, newer := newTestAPI(t)
+	snapshot, _ := api.Store.Get(newer.ID)
+
+	fixtures := []struct {
+		name      string
+		params    map[string][]string
+		total     int
+		resources []string
+		err       string
+	}{
+		{
+			name:      "Test results first page",
+			total:     4,
+			resources: []string{"instance/i-1", "instance/i-2", "instance/i-3", "instance/i-3"},
+		},
+		{
+			name:      "Test results second page",
+			params:    map[string][]string{"page": {"2"}, "per-page": {"3"}},
+			total:     4,
+			resources: []string{"instance/i-3"},
+		},
+		{
+			name:   "Test results page after the end",
+			params: map[string][]string{"page": {"3"}, "per-page": {"3"}},
+			total:  4,
+		},
+		{
+			name:      "Test results filtered by account and key",
+			params:    map[string][]string{"account": {"2"}, "key": {"owner"}},
+			total:     1,
+			resources: []string{"instance/i-3"},
+		},
+		{
+			name:      "Test results filtered by an expression",
+			params:    map[string][]string{"where": {`tags.env == "prod" && !has(tags.owner)`}},
+			total:     1,
+			resources: []string{"instance/i-2"},
+		},
+		{
+			name:   "Test results invalid expression",
+			params: map[string][]string{"where": {"env"}},
+			err:    `invalid where: invalid expression at 0: unknown field "env", expected account, region, service, resource, arn, type or tags.<key>`,
+		},
+		{
+			name:   "Test results invalid page",
+			params: map[string][]string{"page": {"0"}},
+			err:    `invalid page "0"`,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			page, err := Results(snapshot, fixture.params)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.total, page.Total)
+			var resources []string
+			for _, r := range page.Results {
+				resources = append(resources, r.Resource)
+			}
+			assert.Equal(fixture.resources, resources)
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	assert := assert.New(t)
+	var schema map[string]interface{}
+	assert.NoError(json.Unmarshal(Schema, &schema))
+	assert.Equal("https://json-schema.org/draft/2020-12/schema", schema["$schema"])
+
+	rec := httptest.NewRecorder()
+	(&API{}).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/schema", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("application/schema+json", rec.Header().Get("Content-Type"))
+	assert.Equal(Schema, rec.Body.Bytes())
+}
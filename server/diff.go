@@ -0,0 +1,82 @@
+package server
+
+import (
+	"sort"
+
+	"tagu/aws"
+)
+
+// ChangeKind is how a tag changed between two snapshots
+type ChangeKind string
+
+const (
+	// TagAdded the key is only in the newer snapshot
+	TagAdded ChangeKind = "added"
+	// TagRemoved the key is only in the older snapshot
+	TagRemoved ChangeKind = "removed"
+	// TagChanged the key has another value in the newer snapshot
+	TagChanged ChangeKind = "changed"
+)
+
+// TagDiff is a tag that differs between two snapshots
+type TagDiff struct {
+	ARN     string     `json:"arn"`
+	Account string     `json:"account"`
+	Region  string     `json:"region"`
+	Key     string     `json:"key"`
+	Change  ChangeKind `json:"change"`
+	From    *string    `json:"from,omitempty"`
+	To      *string    `json:"to,omitempty"`
+}
+
+type tagLocation struct {
+	arn, key string
+}
+
+// Diff compares the tags of two snapshots, the changes are sorted by ARN and key.
+// A resource missing from a snapshot has all its tags added or removed. The resources
+// of the targets that failed in either snapshot are left out, their tags are unknown
+// Args:
+// 		from: *Snapshot, the older snapshot
+// 		to: *Snapshot, the newer snapshot
+// Returns:
+// 		[]TagDiff: the added, removed and changed tags
+func Diff(from, to *Snapshot) []TagDiff {
+	failed := append(from.Targets.Failed(), to.Targets.Failed()...)
+	tags := func(results []aws.RessourceTagResult) map[tagLocation]aws.RessourceTagResult {
+		found := map[tagLocation]aws.RessourceTagResult{}
+		for _, r := range results {
+			if !r.Untagged() && !failed.Covers(r.Account, r.Region) {
+				found[tagLocation{r.ARN(), r.Key}] = r
+			}
+		}
+		return found
+	}
+	older, newer := tags(from.Results), tags(to.Results)
+
+	diffs := []TagDiff{}
+	for location, r := range newer {
+		previous, ok := older[location]
+		value := r.Value
+		switch {
+		case !ok:
+			diffs = append(diffs, TagDiff{ARN: location.arn, Account: r.Account, Region: r.Region, Key: r.Key, Change: TagAdded, To: &value})
+		case previous.Value != r.Value:
+			before := previous.Value
+			diffs = append(diffs, TagDiff{ARN: location.arn, Account: r.Account, Region: r.Region, Key: r.Key, Change: TagChanged, From: &before, To: &value})
+		}
+	}
+	for location, r := range older {
+		if _, ok := newer[location]; !ok {
+			value := r.Value
+			diffs = append(diffs, TagDiff{ARN: location.arn, Account: r.Account, Region: r.Region, Key: r.Key, Change: TagRemoved, From: &value})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].ARN != diffs[j].ARN {
+			return diffs[i].ARN < diffs[j].ARN
+		}
+		return diffs[i].Key < diffs[j].Key
+	})
+	return diffs
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+)
+
+func TestDiffSuite(t *testing.T) {
+	assert := assert.New(t)
+	tag := func(resource, key, value string) aws.RessourceTagResult {
+		return aws.RessourceTagResult{Account: "1", Region: "us-east-1", Service: "ec2", Resource: resource, Key: key, Value: value}
+	}
+
+	fixtures := []struct {
+		name     string
+		from     []aws.RessourceTagResult
+		to       []aws.RessourceTagResult
+		failed   TargetStatuses
+		expected []TagDiff
+	}{
+		{
+			name:     "Test diff same tags",
+			from:     []aws.RessourceTagResult{tag("instance/i-1", "env", "prod")},
+			to:       []aws.RessourceTagResult{tag("instance/i-1", "env", "prod")},
+			expected: []TagDiff{},
+		},
+		{
+			name: "Test diff added, removed and changed tags",
+			from: []aws.RessourceTagResult{tag("instance/i-1", "env", "prod"), tag("instance/i-1", "owner", "web"), tag("instance/i-2", "env", "dev")},
+			to:   []aws.RessourceTagResult{tag("instance/i-1", "env", "staging"), tag("instance/i-1", "team", "ops"), tag("instance/i-2", "env", "dev")},
+			expected: []TagDiff{
+				{ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Key: "env", Change: TagChanged, From: awssdk.String("prod"), To: awssdk.String("staging")},
+				{ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Key: "owner", Change: TagRemoved, From: awssdk.String("web")},
+				{ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Key: "team", Change: TagAdded, To: awssdk.String("ops")},
+			},
+		},
+		{
+			name:     "Test diff the last tag removed",
+			from:     []aws.RessourceTagResult{tag("instance/i-1", "env", "prod")},
+			to:       []aws.RessourceTagResult{tag("instance/i-1", "", "")},
+			expected: []TagDiff{{ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Key: "env", Change: TagRemoved, From: awssdk.String("prod")}},
+		},
+		{
+			name: "Test diff new and deleted resources",
+			from: []aws.RessourceTagResult{tag("instance/i-1", "env", "prod")},
+			to:   []aws.RessourceTagResult{tag("instance/i-2", "env", "prod")},
+			expected: []TagDiff{
+				{ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Key: "env", Change: TagRemoved, From: awssdk.String("prod")},
+				{ARN: "arn:aws:ec2:us-east-1:1:instance/i-2", Account: "1", Region: "us-east-1", Key: "env", Change: TagAdded, To: awssdk.String("prod")},
+			},
+		},
+		{
+			name: "Test diff skips the failed targets",
+			from: []aws.RessourceTagResult{tag("instance/i-1", "env", "prod"), {Account: "2", Region: "us-east-1", Service: "ec2", Resource: "instance/i-3", Key: "env", Value: "prod"}},
+			to:   []aws.RessourceTagResult{tag("instance/i-1", "env", "dev")},
+			failed: TargetStatuses{
+				{Account: "1", Region: "eu-west-1", Status: aws.StatusOK},
+				{Account: "2", Region: "us-east-1", Status: aws.StatusTimeout},
+			},
+			expected: []TagDiff{
+				{ARN: "arn:aws:ec2:us-east-1:1:instance/i-1", Account: "1", Region: "us-east-1", Key: "env", Change: TagChanged, From: awssdk.String("prod"), To: awssdk.String("dev")},
+			},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			from := &Snapshot{Results: fixture.from}
+			to := &Snapshot{SnapshotInfo: SnapshotInfo{Targets: fixture.failed}, Results: fixture.to}
+			assert.Equal(fixture.expected, Diff(from, to))
+			// The failed targets of either snapshot are left out
+			from.Targets, to.Targets = to.Targets, from.Targets
+			assert.Equal(fixture.expected, Diff(from, to))
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"tagu/aws"
+	"tagu/models"
+)
+
+// ErrQueueFull is returned when the queue holds its maximum of pending jobs
+var ErrQueueFull = errors.New("the job queue is full")
+
+// ErrQueueStopped is returned when the workers of the queue stopped
+var ErrQueueStopped = errors.New("the job queue is stopped")
+
+// JobStatus is the state of a scan job
+type JobStatus string
+
+const (
+	// JobQueued the job waits for a worker
+	JobQueued JobStatus = "queued"
+	// JobRunning the scan is running
+	JobRunning JobStatus = "running"
+	// JobDone the snapshot of the scan is stored, some targets may have failed
+	JobDone JobStatus = "done"
+	// JobFailed the scan stopped before the end or its snapshot could not be stored
+	JobFailed JobStatus = "failed"
+)
+
+// maxJobs is the number of jobs remembered, the oldest finished jobs are forgotten
+const maxJobs = 1000
+
+// Job is a scan submitted to the queue
+type Job struct {
+	ID       string     `json:"id"`
+	Scan     string     `json:"scan,omitempty"`
+	Status   JobStatus  `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Snapshot string     `json:"snapshot,omitempty"`
+}
+
+// ScanFunc scans the spec
+type ScanFunc func(ctx context.Context, spec models.Spec) (aws.Report, error)
+
+type jobRequest struct {
+	id   string
+	spec models.Spec
+}
+
+// Queue runs the submitted scans on a fixed number of workers and stores their snapshots
+// At most size jobs wait for a worker, a job submitted to a full queue is rejected
+type Queue struct {
+	mu      sync.Mutex
+	pending chan jobRequest
+	jobs    map[string]*Job
+	order   []string
+	scan    ScanFunc
+	store   *Store
+	retain  int
+	stopped bool
+}
+
+// NewQueue creates a queue of size pending jobs
+// Args:
+// 		size: int
+// 		retain: int, the number of snapshots kept per scan, and for the ad-hoc specs, 0 keeps every snapshot
+// 		scan: ScanFunc
+// 		store: *Store, receives the snapshot of each job
+// Returns:
+// 		*Queue: the queue, its workers are started by Run
+func NewQueue(size, retain int, scan ScanFunc, store *Store) *Queue {
+	return &Queue{
+		pending: make(chan jobRequest, size),
+		jobs:    map[string]*Job{},
+		scan:    scan,
+		store:   store,
+		retain:  retain,
+	}
+}
+
+// Submit queues the scan of the spec
+// Args:
+// 		scan: string, the name of the scan, empty for an ad-hoc spec
+// 		spec: models.Spec
+// Returns:
+// 		Job: the queued job
+// 		error: ErrQueueFull if the queue is full, ErrQueueStopped after Run returned
+func (q *Queue) Submit(scan string, spec models.Spec) (Job, error) {
+	now := time.Now().UTC()
+	job := &Job{ID: newID(now), Scan: scan, Status: JobQueued, Created: now}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return Job{}, ErrQueueStopped
+	}
+	select {
+	case q.pending <- jobRequest{id: job.ID, spec: spec}:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	q.jobs[job.ID] = job
+	q.order = append(q.order, job.ID)
+	q.forget()
+	return *job, nil
+}
+
+// forget drops the oldest finished jobs above maxJobs
+func (q *Queue) forget() {
+	for i := 0; len(q.jobs) > maxJobs && i < len(q.order); {
+		job := q.jobs[q.order[i]]
+		if job.Status == JobDone || job.Status == JobFailed {
+			delete(q.jobs, job.ID)
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+// Get returns a copy of the job or ErrNotFound
+func (q *Queue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// Run starts the workers and returns when ctx is done and the running jobs ended,
+// the jobs still queued are failed and the next submits rejected
+func (q *Queue) Run(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// A done ctx wins over the queued jobs
+			for ctx.Err() == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case request := <-q.pending:
+					q.run(ctx, request)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stopped = true
+	finished := time.Now().UTC()
+	for {
+		select {
+		case request := <-q.pending:
+			job := q.jobs[request.id]
+			job.Status = JobFailed
+			job.Error = "the server stopped before the job started"
+			job.Finished = &finished
+		default:
+			return
+		}
+	}
+}
+
+// update changes the job under the lock
+func (q *Queue) update(id string, fn func(job *Job)) Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fn(q.jobs[id])
+	return *q.jobs[id]
+}
+
+func (q *Queue) run(ctx context.Context, request jobRequest) {
+	started := time.Now().UTC()
+	job := q.update(request.id, func(job *Job) {
+		job.Status = JobRunning
+		job.Started = &started
+	})
+
+	report, err := q.scan(ctx, request.spec)
+	finished := time.Now().UTC()
+	var snapshot Snapshot
+	if err == nil {
+		snapshot = NewSnapshot(job.Scan, SourceAPI, started, finished, report)
+		if err = q.store.Put(snapshot); err == nil {
+			_, err = q.store.Prune(job.Scan, SourceAPI, q.retain)
+		}
+	}
+	q.update(request.id, func(job *Job) {
+		job.Finished = &finished
+		job.Status = JobDone
+		job.Snapshot = snapshot.ID
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+		}
+	})
+}
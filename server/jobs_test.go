@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+	"tagu/models"
+)
+
+// wait polls the job until it is done or failed
+func wait(t *testing.T, q *Queue, id string) Job {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		job, err := q.Get(id)
+		assert.NoError(t, err)
+		if job.Status == JobDone || job.Status == JobFailed {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestQueueSuite(t *testing.T) {
+	assert := assert.New(t)
+	results := []aws.RessourceTagResult{{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"}}
+	scan := func(ctx context.Context, spec models.Spec) (aws.Report, error) {
+		if spec.RoleName == "broken" {
+			return aws.Report{}, errors.New("scan failed")
+		}
+		return aws.Report{Results: results}, nil
+	}
+	store, _ := OpenStore("")
+	q := NewQueue(2, 0, scan, store)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go q.Run(ctx, 1)
+
+	fixtures := []struct {
+		name   string
+		scan   string
+		spec   models.Spec
+		status JobStatus
+		err    string
+	}{
+		{
+			name:   "Test run a named scan",
+			scan:   "prod",
+			status: JobDone,
+		},
+		{
+			name:   "Test run a failed scan",
+			spec:   models.Spec{RoleName: "broken"},
+			status: JobFailed,
+			err:    "scan failed",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			job, err := q.Submit(fixture.scan, fixture.spec)
+			assert.NoError(err)
+			assert.Equal(JobQueued, job.Status)
+			job = wait(t, q, job.ID)
+			assert.Equal(fixture.status, job.Status)
+			assert.Equal(fixture.err, job.Error)
+			assert.NotNil(job.Started)
+			assert.NotNil(job.Finished)
+			if fixture.status == JobDone {
+				snapshot, err := store.Get(job.Snapshot)
+				assert.NoError(err)
+				assert.Equal(fixture.scan, snapshot.Scan)
+				assert.Equal(results, snapshot.Results)
+			} else {
+				assert.Empty(job.Snapshot)
+			}
+		})
+	}
+
+	_, err := q.Get("unknown")
+	assert.Equal(ErrNotFound, err)
+}
+
+func TestQueueRetain(t *testing.T) {
+	assert := assert.New(t)
+	scan := func(ctx context.Context, spec models.Spec) (aws.Report, error) {
+		return aws.Report{}, nil
+	}
+	store, _ := OpenStore("")
+	started := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	scheduled := NewSnapshot("prod", SourceSchedule, started, started, aws.Report{})
+	assert.NoError(store.Put(scheduled))
+	q := NewQueue(1, 2, scan, store)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go q.Run(ctx, 1)
+
+	var last Job
+	for _, name := range []string{"prod", "prod", "prod", "", "", ""} {
+		job, err := q.Submit(name, models.Spec{})
+		assert.NoError(err)
+		last = wait(t, q, job.ID)
+		assert.Equal(JobDone, last.Status)
+	}
+
+	// Each named scan and the ad-hoc specs keep their last snapshots, the schedule keeps its own
+	assert.Len(store.history("prod", SourceAPI), 2)
+	assert.Len(store.history("", SourceAPI), 2)
+	assert.Len(store.history("prod", SourceSchedule), 1)
+	assert.Equal(last.Snapshot, store.history("", SourceAPI)[1].ID)
+}
+
+func TestQueueStopped(t *testing.T) {
+	assert := assert.New(t)
+	store, _ := OpenStore("")
+	running := make(chan bool)
+	scan := func(ctx context.Context, spec models.Spec) (aws.Report, error) {
+		running <- true
+		<-ctx.Done()
+		return aws.Report{}, ctx.Err()
+	}
+	q := NewQueue(2, 0, scan, store)
+	ctx, cancel := context.WithCancel(context.TODO())
+	stopped := make(chan bool)
+	go func() {
+		q.Run(ctx, 1)
+		close(stopped)
+	}()
+
+	first, err := q.Submit("prod", models.Spec{})
+	assert.NoError(err)
+	<-running
+	second, err := q.Submit("prod", models.Spec{})
+	assert.NoError(err)
+	cancel()
+	<-stopped
+
+	job, _ := q.Get(first.ID)
+	assert.Equal(JobFailed, job.Status)
+	assert.Equal("context canceled", job.Error)
+	job, _ = q.Get(second.ID)
+	assert.Equal(JobFailed, job.Status)
+	assert.Equal("the server stopped before the job started", job.Error)
+	assert.NotNil(job.Finished)
+	_, err = q.Submit("prod", models.Spec{})
+	assert.Equal(ErrQueueStopped, err)
+}
+
+func TestQueueFull(t *testing.T) {
+	assert := assert.New(t)
+	store, _ := OpenStore("")
+	// Without workers the jobs stay queued
+	q := NewQueue(1, 0, nil, store)
+	_, err := q.Submit("prod", models.Spec{})
+	assert.NoError(err)
+	_, err = q.Submit("prod", models.Spec{})
+	assert.Equal(ErrQueueFull, err)
+}
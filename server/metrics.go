@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"tagu/aws"
+)
+
+// Metrics exposes the tagging health of the last scan to Prometheus
+// The gauges are replaced after each scan, the counters add up since the start
+type Metrics struct {
+	mu         sync.Mutex
+	keys       []string
+	registry   *prometheus.Registry
+	resources  *prometheus.GaugeVec
+	coverage   *prometheus.GaugeVec
+	violations *prometheus.GaugeVec
+	failed     prometheus.Gauge
+	duration   prometheus.Gauge
+	last       prometheus.Gauge
+	scans      *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics and their registry
+// Args:
+// 		keys: []string, the keys of the coverage ratio, every collected key when empty
+// Returns:
+// 		*Metrics: the metrics to update with Observe
+func NewMetrics(keys []string) *Metrics {
+	m := &Metrics{
+		keys:     keys,
+		registry: prometheus.NewRegistry(),
+		resources: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "tagu_resources_total",
+			Help: "Number of resources found by the last scan, tagged or not.",
+		}, []string{"account", "region", "service"}),
+		coverage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "tagu_tag_coverage_ratio",
+			Help: "Share of the resources tagged with the key in the last scan, between 0 and 1.",
+		}, []string{"key", "account", "region"}),
+		violations: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "tagu_policy_violations_total",
+			Help: "Number of resources not compliant with the tag policies in the last scan, only set with the compliance details.",
+		}, []string{"account", "region"}),
+		failed: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tagu_scan_failed_targets",
+			Help: "Number of account/region targets that failed or timed out in the last scan.",
+		}),
+		duration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tagu_scan_duration_seconds",
+			Help: "Duration of the last scan.",
+		}),
+		last: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tagu_last_scan_timestamp_seconds",
+			Help: "Unix time of the end of the last scan.",
+		}),
+		scans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tagu_scans_total",
+			Help: "Number of scans by result, ok or error.",
+		}, []string{"result"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tagu_scan_errors_total",
+			Help: "Number of failed account/region targets by cause.",
+		}, []string{"cause"}),
+	}
+	m.registry.MustRegister(m.resources, m.coverage, m.violations, m.failed, m.duration, m.last, m.scans, m.errors)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Observe replaces the gauges with the results of a scan and counts the scan
+// and its failed targets. A stopped scan still updates the gauges with its partial results
+// Args:
+// 		report: aws.Report
+// 		duration: time.Duration
+// 		err: error, the scan error if any
+func (m *Metrics) Observe(report aws.Report, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.resources.Reset()
+	m.coverage.Reset()
+	m.violations.Reset()
+
+	type location struct{ account, region string }
+	resources := map[string]bool{}
+	totals := map[location]int{}
+	tagged := map[location]map[string]int{}
+	keys := map[string]bool{}
+	for _, r := range report.Results {
+		where := location{r.Account, r.Region}
+		if tagged[where] == nil {
+			tagged[where] = map[string]int{}
+		}
+		if !r.Untagged() {
+			tagged[where][r.Key]++
+			keys[r.Key] = true
+		}
+		arn := r.ARN()
+		if resources[arn] {
+			continue
+		}
+		resources[arn] = true
+		totals[where]++
+		m.resources.WithLabelValues(r.Account, r.Region, r.Service).Inc()
+		if r.Compliant != nil && !*r.Compliant {
+			m.violations.WithLabelValues(r.Account, r.Region).Inc()
+		}
+	}
+
+	covered := m.keys
+	if len(covered) == 0 {
+		for key := range keys {
+			covered = append(covered, key)
+		}
+		sort.Strings(covered)
+	}
+	for where, total := range totals {
+		for _, key := range covered {
+			m.coverage.WithLabelValues(key, where.account, where.region).Set(float64(tagged[where][key]) / float64(total))
+		}
+	}
+
+	failed := report.Targets.Failed()
+	for _, target := range failed {
+		cause := string(target.Cause)
+		if target.Status == aws.StatusTimeout {
+			cause = string(aws.StatusTimeout)
+		}
+		m.errors.WithLabelValues(cause).Inc()
+	}
+	m.failed.Set(float64(len(failed)))
+	m.duration.Set(duration.Seconds())
+	m.last.SetToCurrentTime()
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.scans.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+)
+
+// scrape returns the sorted metric lines of the handler starting with one of the prefixes
+func scrape(t *testing.T, m *Metrics, prefixes ...string) []string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	assert.NoError(t, err)
+	var lines []string
+	for _, line := range strings.Split(string(body), "\n") {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(line, prefix) {
+				lines = append(lines, line)
+			}
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestMetricsSuite(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMetrics(nil)
+
+	report := aws.Report{
+		Results: []aws.RessourceTagResult{
+			{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod", Compliant: awssdk.Bool(true)},
+			{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "owner", Value: "web", Compliant: awssdk.Bool(true)},
+			{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-2", Key: "env", Value: "dev", Compliant: awssdk.Bool(false)},
+			{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-3", Compliant: awssdk.Bool(false)},
+		},
+		Targets: aws.TargetReports{
+			{Account: "1", Region: "us-east-1", Status: aws.StatusOK},
+			{Account: "2", Region: "us-east-1", Status: aws.StatusFailed, Cause: aws.CauseAccessDenied},
+			{Account: "3", Region: "us-east-1", Status: aws.StatusTimeout},
+		},
+	}
+	m.Observe(report, 2*time.Second, nil)
+
+	assert.Equal([]string{
+		`tagu_policy_violations_total{account="1",region="us-east-1"} 2`,
+		`tagu_resources_total{account="1",region="us-east-1",service="ec2"} 3`,
+		`tagu_scan_duration_seconds 2`,
+		`tagu_scan_errors_total{cause="access-denied"} 1`,
+		`tagu_scan_errors_total{cause="timeout"} 1`,
+		`tagu_scan_failed_targets 2`,
+		`tagu_scans_total{result="ok"} 1`,
+		`tagu_tag_coverage_ratio{account="1",key="env",region="us-east-1"} 0.6666666666666666`,
+		`tagu_tag_coverage_ratio{account="1",key="owner",region="us-east-1"} 0.3333333333333333`,
+	}, scrape(t, m, "tagu_resources_total", "tagu_tag_coverage_ratio", "tagu_policy_violations_total", "tagu_scan_failed_targets", "tagu_scan_duration_seconds", "tagu_scans_total", "tagu_scan_errors_total"))
+
+	t.Run("Test the gauges are replaced and the counters add up", func(t *testing.T) {
+		m := NewMetrics([]string{"team"})
+		m.Observe(report, time.Second, nil)
+		m.Observe(aws.Report{Results: report.Results[2:]}, time.Second, errors.New("scan stopped"))
+		assert.Equal([]string{
+			`tagu_resources_total{account="1",region="us-east-1",service="ec2"} 2`,
+			`tagu_scans_total{result="error"} 1`,
+			`tagu_scans_total{result="ok"} 1`,
+			`tagu_tag_coverage_ratio{account="1",key="team",region="us-east-1"} 0`,
+		}, scrape(t, m, "tagu_resources_total", "tagu_tag_coverage_ratio", "tagu_scans_total"))
+		assert.NotEmpty(scrape(t, m, "tagu_last_scan_timestamp_seconds"))
+	})
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"tagu/aws"
+	"tagu/models"
+)
+
+// ScheduledScan is a named scan run on a cron schedule
+// params:
+// 		name: string
+// 		schedule: string, a cron expression, see ParseSchedule
+// 		spec: models.Spec
+// 		retain: int, the number of snapshots of the scan kept, 0 keeps every snapshot
+type ScheduledScan struct {
+	Name     string
+	Schedule string
+	Spec     models.Spec
+	Retain   int
+}
+
+// ScheduleRun is the outcome of a scheduled run
+type ScheduleRun struct {
+	Started       time.Time `json:"started"`
+	Finished      time.Time `json:"finished"`
+	Status        JobStatus `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	Snapshot      string    `json:"snapshot,omitempty"`
+	FailedTargets int       `json:"failed-targets"`
+}
+
+// ScheduleStatus is the state of a scheduled scan
+// A run due while the previous one is still running is skipped
+type ScheduleStatus struct {
+	Scan     string       `json:"scan"`
+	Schedule string       `json:"schedule"`
+	Running  bool         `json:"running"`
+	Next     time.Time    `json:"next"`
+	Runs     int          `json:"runs"`
+	Failures int          `json:"failures"`
+	Skipped  int          `json:"skipped"`
+	LastRun  *ScheduleRun `json:"last-run,omitempty"`
+}
+
+// AfterFunc is called at the end of every scheduled run, before the oldest snapshots are pruned.
+// The snapshot is nil when the run failed. It writes the outputs of the scan, an error fails the run
+type AfterFunc func(scan ScheduledScan, run ScheduleRun, snapshot *Snapshot, report aws.Report) error
+
+type scheduleEntry struct {
+	scan     ScheduledScan
+	schedule cron.Schedule
+	status   ScheduleStatus
+}
+
+// Scheduler runs the scheduled scans and stores their snapshots
+type Scheduler struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	entries []*scheduleEntry
+	scan    ScanFunc
+	store   *Store
+	after   AfterFunc
+}
+
+// ParseSchedule parses a standard cron expression of 5 fields, minute hour day-of-month month
+// day-of-week, or a descriptor such as @daily, @hourly or @every 6h
+func ParseSchedule(expr string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+	}
+	return schedule, nil
+}
+
+// NewScheduler creates the scheduler of the scans
+// Args:
+// 		scans: []ScheduledScan
+// 		scan: ScanFunc
+// 		store: *Store, receives the snapshot of each run
+// 		after: AfterFunc, called after each stored snapshot, may be nil
+// Returns:
+// 		*Scheduler: the scheduler, started by Run
+// 		error: if a schedule is invalid
+func NewScheduler(scans []ScheduledScan, scan ScanFunc, store *Store, after AfterFunc) (*Scheduler, error) {
+	s := &Scheduler{scan: scan, store: store, after: after}
+	for _, sc := range scans {
+		schedule, err := ParseSchedule(sc.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", sc.Name, err)
+		}
+		s.entries = append(s.entries, &scheduleEntry{
+			scan:     sc,
+			schedule: schedule,
+			status:   ScheduleStatus{Scan: sc.Name, Schedule: sc.Schedule},
+		})
+	}
+	return s, nil
+}
+
+// Run starts the due scans until ctx is done then waits for the running scans
+func (s *Scheduler) Run(ctx context.Context) {
+	defer s.wg.Wait()
+	if len(s.entries) == 0 {
+		<-ctx.Done()
+		return
+	}
+	for {
+		timer := time.NewTimer(time.Until(s.Due(ctx, time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Due starts the scans due at now in the background, the first call only
+// plans the next run of every scan
+// Args:
+// 		ctx: context.Context, the context of the started scans
+// 		now: time.Time
+// Returns:
+// 		time.Time: the time of the next run
+func (s *Scheduler) Due(ctx context.Context, now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	for _, e := range s.entries {
+		if e.status.Next.IsZero() {
+			e.status.Next = e.schedule.Next(now)
+		} else if !now.Before(e.status.Next) {
+			if e.status.Running {
+				e.status.Skipped++
+			} else {
+				e.status.Running = true
+				s.wg.Add(1)
+				go s.run(ctx, e)
+			}
+			e.status.Next = e.schedule.Next(now)
+		}
+		if next.IsZero() || e.status.Next.Before(next) {
+			next = e.status.Next
+		}
+	}
+	return next
+}
+
+// Wait returns when the started scans ended
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Status returns the state of every scheduled scan in the configuration order
+func (s *Scheduler) Status() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := []ScheduleStatus{}
+	for _, e := range s.entries {
+		status := e.status
+		if status.LastRun != nil {
+			run := *status.LastRun
+			status.LastRun = &run
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (s *Scheduler) run(ctx context.Context, e *scheduleEntry) {
+	defer s.wg.Done()
+	run := ScheduleRun{Started: time.Now().UTC(), Status: JobDone}
+	var stored *Snapshot
+	report, err := s.scan(ctx, e.scan.Spec)
+	if err == nil {
+		snapshot := NewSnapshot(e.scan.Name, SourceSchedule, run.Started, time.Now(), report)
+		if err = s.store.Put(snapshot); err == nil {
+			stored = &snapshot
+			run.Snapshot = snapshot.ID
+		}
+	}
+	run.Finished = time.Now().UTC()
+	run.FailedTargets = len(report.Targets.Failed())
+	if err != nil {
+		run.Status = JobFailed
+		run.Error = err.Error()
+	}
+	if s.after != nil {
+		err = failRun(&run, err, s.after(e.scan, run, stored, report))
+	}
+	// The previous snapshots are pruned last so the after func can compare them
+	if stored != nil {
+		_, perr := s.store.Prune(e.scan.Name, SourceSchedule, e.scan.Retain)
+		err = failRun(&run, err, perr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.status.Running = false
+	e.status.Runs++
+	if err != nil {
+		e.status.Failures++
+	}
+	e.status.LastRun = &run
+}
+
+// failRun records the first error of the run
+func failRun(run *ScheduleRun, err, next error) error {
+	if err != nil || next == nil {
+		return err
+	}
+	run.Status = JobFailed
+	run.Error = next.Error()
+	return next
+}
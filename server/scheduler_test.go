@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+	"tagu/models"
+)
+
+func TestParseSchedule(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2022, 9, 1, 10, 20, 0, 0, time.UTC)
+
+	fixtures := []struct {
+		name     string
+		expr     string
+		expected time.Time
+		err      string
+	}{
+		{
+			name:     "Test parse a cron expression",
+			expr:     "0 */6 * * *",
+			expected: time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Test parse a descriptor",
+			expr:     "@daily",
+			expected: time.Date(2022, 9, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Test parse an interval",
+			expr:     "@every 2h",
+			expected: time.Date(2022, 9, 1, 12, 20, 0, 0, time.UTC),
+		},
+		{
+			name: "Test parse an invalid expression",
+			expr: "0 */6 * *",
+			err:  `invalid schedule "0 */6 * *": expected exactly 5 fields, found 4: [0 */6 * *]`,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(fixture.expr)
+			if fixture.err != "" {
+				assert.EqualError(err, fixture.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(fixture.expected, schedule.Next(start))
+		})
+	}
+}
+
+func TestSchedulerSuite(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	results := []aws.RessourceTagResult{{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"}}
+	release := make(chan struct{})
+	scan := func(ctx context.Context, spec models.Spec) (aws.Report, error) {
+		switch spec.RoleName {
+		case "broken":
+			return aws.Report{}, errors.New("scan failed")
+		case "slow":
+			<-release
+		}
+		return aws.Report{Results: results, Targets: aws.TargetReports{{Account: "1", Region: "us-east-1", Status: aws.StatusOK}}}, nil
+	}
+	var mu sync.Mutex
+	var after []string
+	afterFunc := func(scan ScheduledScan, run ScheduleRun, snapshot *Snapshot, report aws.Report) error {
+		mu.Lock()
+		defer mu.Unlock()
+		after = append(after, scan.Name+" "+string(run.Status))
+		return nil
+	}
+	store, _ := OpenStore("")
+	s, err := NewScheduler([]ScheduledScan{
+		{Name: "hourly", Schedule: "@hourly", Retain: 2},
+		{Name: "broken", Schedule: "30 * * * *", Spec: models.Spec{RoleName: "broken"}},
+		{Name: "slow", Schedule: "@every 10m", Spec: models.Spec{RoleName: "slow"}},
+	}, scan, store, afterFunc)
+	assert.NoError(err)
+	ctx := context.TODO()
+
+	// The first call plans the runs
+	assert.Equal(start.Add(10*time.Minute), s.Due(ctx, start))
+	// The slow scan starts then is skipped while running
+	assert.Equal(start.Add(20*time.Minute), s.Due(ctx, start.Add(10*time.Minute)))
+	assert.Equal(start.Add(30*time.Minute), s.Due(ctx, start.Add(20*time.Minute)))
+	close(release)
+	s.Wait()
+	// Every scan is due
+	for hour := 1; hour <= 3; hour++ {
+		s.Due(ctx, start.Add(time.Duration(hour)*time.Hour))
+		s.Wait()
+	}
+
+	statuses := s.Status()
+	assert.Len(statuses, 3)
+	hourly, broken, slow := statuses[0], statuses[1], statuses[2]
+
+	assert.Equal("hourly", hourly.Scan)
+	assert.Equal(3, hourly.Runs)
+	assert.Equal(0, hourly.Failures)
+	assert.Equal(start.Add(4*time.Hour), hourly.Next)
+	assert.Equal(JobDone, hourly.LastRun.Status)
+	assert.NotEmpty(hourly.LastRun.Snapshot)
+	// The oldest snapshot is removed above retain
+	snapshots := store.List("hourly")
+	assert.Len(snapshots, 2)
+	assert.Equal(hourly.LastRun.Snapshot, snapshots[1].ID)
+
+	assert.Equal(3, broken.Runs)
+	assert.Equal(3, broken.Failures)
+	assert.Equal(start.Add(3*time.Hour+30*time.Minute), broken.Next)
+	assert.Equal(JobFailed, broken.LastRun.Status)
+	assert.Equal("scan failed", broken.LastRun.Error)
+	assert.Empty(broken.LastRun.Snapshot)
+	assert.Empty(store.List("broken"))
+
+	assert.Equal(4, slow.Runs)
+	assert.Equal(1, slow.Skipped)
+	assert.False(slow.Running)
+	assert.Len(store.List("slow"), 4)
+
+	assert.Len(after, 10)
+	assert.Contains(after, "broken failed")
+}
+
+func TestSchedulerAfterError(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	scan := func(ctx context.Context, spec models.Spec) (aws.Report, error) {
+		return aws.Report{}, nil
+	}
+	afterFunc := func(scan ScheduledScan, run ScheduleRun, snapshot *Snapshot, report aws.Report) error {
+		return errors.New("output failed")
+	}
+	store, _ := OpenStore("")
+	s, err := NewScheduler([]ScheduledScan{{Name: "hourly", Schedule: "@hourly"}}, scan, store, afterFunc)
+	assert.NoError(err)
+	s.Due(context.TODO(), start)
+	s.Due(context.TODO(), start.Add(time.Hour))
+	s.Wait()
+
+	status := s.Status()[0]
+	assert.Equal(1, status.Failures)
+	assert.Equal(JobFailed, status.LastRun.Status)
+	assert.Equal("output failed", status.LastRun.Error)
+	// The snapshot is stored before the outputs
+	assert.Len(store.List("hourly"), 1)
+}
+
+func TestNewSchedulerInvalid(t *testing.T) {
+	_, err := NewScheduler([]ScheduledScan{{Name: "prod", Schedule: "@fortnightly"}}, nil, nil, nil)
+	assert.EqualError(t, err, `scan prod: invalid schedule "@fortnightly": unrecognized descriptor: @fortnightly`)
+}
+
+func TestSchedulerRun(t *testing.T) {
+	s, err := NewScheduler(nil, nil, nil, nil)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	// Run returns once ctx is done
+	s.Run(ctx)
+	assert.Empty(t, s.Status())
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// Every calls fn immediately then every interval until ctx is done, a run
+// longer than the interval delays the next one instead of overlapping it
+// Args:
+// 		ctx: context.Context
+// 		interval: time.Duration
+// 		fn: func(ctx context.Context)
+func Every(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fn(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEverySuite(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	runs := 0
+	Every(ctx, time.Millisecond, func(ctx context.Context) {
+		runs++
+		if runs == 3 {
+			cancel()
+		}
+	})
+	assert.Equal(3, runs)
+
+	// A done context still runs once
+	Every(ctx, time.Hour, func(ctx context.Context) {
+		runs++
+	})
+	assert.Equal(4, runs)
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tagu/aws"
+)
+
+// ErrNotFound is returned for an unknown snapshot or job
+var ErrNotFound = errors.New("not found")
+
+// TargetStatus is a serializable aws.TargetReport
+type TargetStatus struct {
+	Account   string           `json:"account"`
+	Region    string           `json:"region"`
+	Status    aws.TargetStatus `json:"status"`
+	Cause     aws.ErrorCause   `json:"cause,omitempty"`
+	Count     int              `json:"count"`
+	Throttles int64            `json:"throttles"`
+	Cached    bool             `json:"cached,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// Source is the origin of a snapshot, each origin prunes its own snapshots only
+type Source string
+
+const (
+	// SourceSchedule the snapshot of a scheduled scan
+	SourceSchedule Source = "schedule"
+	// SourceAPI the snapshot of a scan submitted to the API
+	SourceAPI Source = "api"
+)
+
+// TargetStatuses are the targets of a snapshot
+type TargetStatuses []TargetStatus
+
+// Failed returns the targets that did not complete, their resources are missing
+// from the snapshot or partial
+func (t TargetStatuses) Failed() TargetStatuses {
+	var failed TargetStatuses
+	for _, target := range t {
+		if target.Status != aws.StatusOK {
+			failed = append(failed, target)
+		}
+	}
+	return failed
+}
+
+// Covers reports whether a resource of the account and region may belong to one of
+// the targets. A global resource, without region, may belong to any target of its
+// account and a target without account to any account
+func (t TargetStatuses) Covers(account, region string) bool {
+	for _, target := range t {
+		if (target.Account == "" || target.Account == account) && (region == "" || target.Region == "" || target.Region == region) {
+			return true
+		}
+	}
+	return false
+}
+
+// SnapshotInfo describes a snapshot without its results
+type SnapshotInfo struct {
+	ID        string         `json:"id"`
+	Scan      string         `json:"scan,omitempty"`
+	Source    Source         `json:"source,omitempty"`
+	Started   time.Time      `json:"started"`
+	Finished  time.Time      `json:"finished"`
+	Resources int            `json:"resources"`
+	Tags      int            `json:"tags"`
+	Targets   TargetStatuses `json:"targets"`
+}
+
+// Snapshot is the results of a scan at a point in time
+type Snapshot struct {
+	SnapshotInfo
+	Results []aws.RessourceTagResult `json:"results"`
+}
+
+// NewSnapshot builds the snapshot of a scan report
+// Args:
+// 		scan: string, the name of the scan, empty for an ad-hoc spec
+// 		source: Source
+// 		started: time.Time
+// 		finished: time.Time
+// 		report: aws.Report
+// Returns:
+// 		Snapshot: with a new random id
+func NewSnapshot(scan string, source Source, started, finished time.Time, report aws.Report) Snapshot {
+	s := Snapshot{
+		SnapshotInfo: SnapshotInfo{
+			ID:       newID(started),
+			Scan:     scan,
+			Source:   source,
+			Started:  started.UTC(),
+			Finished: finished.UTC(),
+			Targets:  TargetStatuses{},
+		},
+		Results: report.Results,
+	}
+	resources := map[string]bool{}
+	for _, r := range report.Results {
+		resources[r.ARN()] = true
+		if !r.Untagged() {
+			s.Tags++
+		}
+	}
+	s.Resources = len(resources)
+	for _, t := range report.Targets {
+		status := TargetStatus{Account: t.Account, Region: t.Region, Status: t.Status, Cause: t.Cause, Count: t.Count, Throttles: t.Throttles, Cached: t.Cached}
+		if t.Err != nil {
+			status.Error = t.Err.Error()
+		}
+		s.Targets = append(s.Targets, status)
+	}
+	return s
+}
+
+// newID returns a sortable unique id, the time followed by random bytes
+func newID(t time.Time) string {
+	random := make([]byte, 4)
+	rand.Read(random)
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(random)
+}
+
+// Store keeps the snapshots in memory, and in dir as one JSON file per snapshot when set
+type Store struct {
+	mu        sync.RWMutex
+	dir       string
+	snapshots map[string]*Snapshot
+}
+
+// OpenStore loads the snapshots of dir, an empty dir keeps the snapshots in memory only
+// A snapshot written without source belongs to the schedule of its scan, or to the API
+// for an ad-hoc spec
+// Args:
+// 		dir: string
+// Returns:
+// 		*Store: the store
+// 		error: if dir can not be created or a snapshot can not be read
+func OpenStore(dir string) (*Store, error) {
+	s := &Store{dir: dir, snapshots: map[string]*Snapshot{}}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var snapshot Snapshot
+		if err = json.Unmarshal(data, &snapshot); err != nil {
+			return nil, errors.New("invalid snapshot " + file + ": " + err.Error())
+		}
+		if snapshot.Source == "" {
+			snapshot.Source = SourceSchedule
+			if snapshot.Scan == "" {
+				snapshot.Source = SourceAPI
+			}
+		}
+		s.snapshots[snapshot.ID] = &snapshot
+	}
+	return s, nil
+}
+
+// Put adds the snapshot, it is written to the store directory first
+func (s *Store) Put(snapshot Snapshot) error {
+	if s.dir != "" {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		// Write then rename so a reader never sees a partial snapshot
+		path := filepath.Join(s.dir, snapshot.ID+".json")
+		if err = os.WriteFile(path+".tmp", data, 0o644); err != nil {
+			return err
+		}
+		if err = os.Rename(path+".tmp", path); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[snapshot.ID] = &snapshot
+	return nil
+}
+
+// Get returns the snapshot or ErrNotFound
+func (s *Store) Get(id string) (*Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot, ok := s.snapshots[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return snapshot, nil
+}
+
+// Previous returns the snapshot of the same scan and source preceding id or ErrNotFound
+func (s *Store) Previous(id string) (*Snapshot, error) {
+	snapshot, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	previous := ""
+	for _, info := range s.history(snapshot.Scan, snapshot.Source) {
+		if info.ID == id {
+			break
+		}
+		previous = info.ID
+	}
+	if previous == "" {
+		return nil, ErrNotFound
+	}
+	return s.Get(previous)
+}
+
+// List returns the snapshots of the scan, every snapshot when scan is empty,
+// the oldest first
+func (s *Store) List(scan string) []SnapshotInfo {
+	return s.filter(func(snapshot *Snapshot) bool {
+		return scan == "" || snapshot.Scan == scan
+	})
+}
+
+// history returns the snapshots of the scan from the source, the ad-hoc ones when
+// scan is empty, the oldest first
+func (s *Store) history(scan string, source Source) []SnapshotInfo {
+	return s.filter(func(snapshot *Snapshot) bool {
+		return snapshot.Scan == scan && snapshot.Source == source
+	})
+}
+
+// filter returns the matching snapshots, the oldest first
+func (s *Store) filter(match func(snapshot *Snapshot) bool) []SnapshotInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var infos []SnapshotInfo
+	for _, snapshot := range s.snapshots {
+		if match(snapshot) {
+			infos = append(infos, snapshot.SnapshotInfo)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].Started.Equal(infos[j].Started) {
+			return infos[i].Started.Before(infos[j].Started)
+		}
+		return strings.Compare(infos[i].ID, infos[j].ID) < 0
+	})
+	return infos
+}
+
+// Prune removes the oldest snapshots of the scan from the source above keep, keep lower
+// than one keeps every snapshot. An empty scan prunes the ad-hoc snapshots
+// Args:
+// 		scan: string
+// 		source: Source, the snapshots of the other sources are kept
+// 		keep: int
+// Returns:
+// 		[]string: the ids of the removed snapshots
+// 		error: if a snapshot file can not be removed
+func (s *Store) Prune(scan string, source Source, keep int) ([]string, error) {
+	infos := s.history(scan, source)
+	if keep < 1 || len(infos) <= keep {
+		return nil, nil
+	}
+	var removed []string
+	for _, info := range infos[:len(infos)-keep] {
+		if s.dir != "" {
+			if err := os.Remove(filepath.Join(s.dir, info.ID+".json")); err != nil && !os.IsNotExist(err) {
+				return removed, err
+			}
+		}
+		s.mu.Lock()
+		delete(s.snapshots, info.ID)
+		s.mu.Unlock()
+		removed = append(removed, info.ID)
+	}
+	return removed, nil
+}
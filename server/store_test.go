@@ -0,0 +1,198 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	started := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	report := aws.Report{
+		Results: []aws.RessourceTagResult{
+			{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"},
+			{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "owner", Value: "web"},
+			{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-2", Key: "env", Value: "dev"},
+		},
+		Targets: aws.TargetReports{
+			{Account: "1", Region: "us-east-1", Status: aws.StatusOK, Count: 3},
+			{Account: "2", Region: "us-east-1", Status: aws.StatusFailed, Cause: aws.CauseAccessDenied, Err: errors.New("denied")},
+		},
+	}
+
+	snapshot := NewSnapshot("prod", SourceSchedule, started, started.Add(time.Minute), report)
+	assert.Regexp(`^20220901T100000Z-[0-9a-f]{8}$`, snapshot.ID)
+	assert.Equal("prod", snapshot.Scan)
+	assert.Equal(2, snapshot.Resources)
+	assert.Equal(3, snapshot.Tags)
+	assert.Equal(TargetStatuses{
+		{Account: "1", Region: "us-east-1", Status: aws.StatusOK, Count: 3},
+		{Account: "2", Region: "us-east-1", Status: aws.StatusFailed, Cause: aws.CauseAccessDenied, Error: "denied"},
+	}, snapshot.Targets)
+	assert.Equal(snapshot.Targets[1:], snapshot.Targets.Failed())
+}
+
+func TestTargetStatusesCovers(t *testing.T) {
+	assert := assert.New(t)
+	failed := TargetStatuses{{Account: "1", Region: "us-east-1"}, {Region: "eu-west-1"}}
+	fixtures := []struct {
+		name            string
+		account, region string
+		expected        bool
+	}{
+		{"Covers the failed target", "1", "us-east-1", true},
+		{"Covers the global resources of the account", "1", "", true},
+		{"Covers the region of a target without account", "2", "eu-west-1", true},
+		{"Skips another region", "1", "us-west-2", false},
+		{"Skips another account", "2", "us-east-1", false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, failed.Covers(fixture.account, fixture.region))
+		})
+	}
+}
+
+func TestStoreSuite(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	started := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	results := []aws.RessourceTagResult{{Account: "1", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"}}
+
+	store, err := OpenStore(dir)
+	assert.NoError(err)
+	newer := NewSnapshot("prod", SourceSchedule, started.Add(time.Hour), started.Add(time.Hour), aws.Report{Results: results})
+	older := NewSnapshot("prod", SourceSchedule, started, started, aws.Report{Results: results})
+	other := NewSnapshot("dev", SourceSchedule, started, started, aws.Report{})
+	for _, snapshot := range []Snapshot{newer, older, other} {
+		assert.NoError(store.Put(snapshot))
+	}
+
+	// The snapshots are read again from the directory
+	store, err = OpenStore(dir)
+	assert.NoError(err)
+
+	fixtures := []struct {
+		name     string
+		scan     string
+		expected []string
+	}{
+		{
+			name:     "Test list the snapshots of a scan",
+			scan:     "prod",
+			expected: []string{older.ID, newer.ID},
+		},
+		{
+			name:     "Test list every snapshot",
+			expected: []string{older.ID, other.ID, newer.ID},
+		},
+		{
+			name: "Test list an unknown scan",
+			scan: "unknown",
+		},
+	}
+	if other.ID < older.ID {
+		fixtures[1].expected = []string{other.ID, older.ID, newer.ID}
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			var ids []string
+			for _, info := range store.List(fixture.scan) {
+				ids = append(ids, info.ID)
+			}
+			assert.Equal(fixture.expected, ids)
+		})
+	}
+
+	snapshot, err := store.Get(newer.ID)
+	assert.NoError(err)
+	assert.Equal(results, snapshot.Results)
+	_, err = store.Get("unknown")
+	assert.Equal(ErrNotFound, err)
+
+	tmp, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.NoError(err)
+	assert.Empty(tmp)
+}
+
+func TestOpenStoreInvalid(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644))
+	_, err := OpenStore(dir)
+	assert.EqualError(t, err, "invalid snapshot "+filepath.Join(dir, "broken.json")+": unexpected end of JSON input")
+}
+
+func TestStorePrune(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	started := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	store, err := OpenStore(dir)
+	assert.NoError(err)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		snapshot := NewSnapshot("prod", SourceSchedule, started.Add(time.Duration(i)*time.Hour), started, aws.Report{})
+		assert.NoError(store.Put(snapshot))
+		ids = append(ids, snapshot.ID)
+	}
+	assert.NoError(store.Put(NewSnapshot("dev", SourceSchedule, started, started, aws.Report{})))
+	api := NewSnapshot("prod", SourceAPI, started, started, aws.Report{})
+	assert.NoError(store.Put(api))
+
+	removed, err := store.Prune("prod", SourceSchedule, 0)
+	assert.NoError(err)
+	assert.Empty(removed)
+	removed, err = store.Prune("prod", SourceSchedule, 1)
+	assert.NoError(err)
+	assert.Equal(ids[:2], removed)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.NoError(err)
+	assert.Len(files, 3)
+	// The snapshot of the API scan of the same name is kept
+	assert.Equal([]string{api.ID, ids[2]}, []string{store.List("prod")[0].ID, store.List("prod")[1].ID})
+	assert.Len(store.List("dev"), 1)
+}
+
+func TestOpenStoreSource(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "named.json"), []byte(`{"id":"named","scan":"prod"}`), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "adhoc.json"), []byte(`{"id":"adhoc"}`), 0o644))
+	store, err := OpenStore(dir)
+	assert.NoError(err)
+
+	// The snapshots written without source keep their previous pruning
+	named, _ := store.Get("named")
+	assert.Equal(SourceSchedule, named.Source)
+	adhoc, _ := store.Get("adhoc")
+	assert.Equal(SourceAPI, adhoc.Source)
+}
+
+func TestStorePrevious(t *testing.T) {
+	assert := assert.New(t)
+	started := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	store, _ := OpenStore("")
+	older := NewSnapshot("prod", SourceSchedule, started, started, aws.Report{})
+	other := NewSnapshot("dev", SourceSchedule, started.Add(time.Minute), started, aws.Report{})
+	api := NewSnapshot("prod", SourceAPI, started.Add(time.Minute), started, aws.Report{})
+	newer := NewSnapshot("prod", SourceSchedule, started.Add(time.Hour), started, aws.Report{})
+	for _, snapshot := range []Snapshot{older, other, api, newer} {
+		assert.NoError(store.Put(snapshot))
+	}
+
+	previous, err := store.Previous(newer.ID)
+	assert.NoError(err)
+	assert.Equal(older.ID, previous.ID)
+	_, err = store.Previous(older.ID)
+	assert.Equal(ErrNotFound, err)
+	_, err = store.Previous("unknown")
+	assert.Equal(ErrNotFound, err)
+}
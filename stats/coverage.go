@@ -0,0 +1,196 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+
+	"tagu/aws"
+)
+
+// Dimension is a resource attribute the coverage is grouped by
+type Dimension string
+
+const (
+	// DimensionAccount groups the resources by account
+	DimensionAccount Dimension = "account"
+	// DimensionRegion groups the resources by region
+	DimensionRegion Dimension = "region"
+	// DimensionService groups the resources by service
+	DimensionService Dimension = "service"
+	// DimensionResourceType groups the resources by service:type
+	DimensionResourceType Dimension = "resource-type"
+)
+
+// Dimensions are the coverage groups in the report order
+var Dimensions = []Dimension{DimensionAccount, DimensionRegion, DimensionService, DimensionResourceType}
+
+// Options tunes the statistics
+// params:
+// 		keys: []string, the keys to report, every collected key when empty
+// 		top: int, the number of most used values kept per key
+type Options struct {
+	Keys []string
+	Top  int
+}
+
+// ValueCount is the number of resources using a tag value
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// KeyStats is the overall usage of a tag key
+type KeyStats struct {
+	Key         string       `json:"key"`
+	Resources   int          `json:"resources"`
+	Coverage    float64      `json:"coverage"`
+	Cardinality int          `json:"cardinality"`
+	TopValues   []ValueCount `json:"top-values"`
+}
+
+// Coverage is the share of the resources of a group tagged with a key
+type Coverage struct {
+	Dimension Dimension `json:"dimension"`
+	Group     string    `json:"group"`
+	Key       string    `json:"key"`
+	Tagged    int       `json:"tagged"`
+	Total     int       `json:"total"`
+	Percent   float64   `json:"percent"`
+}
+
+// Report is the output of Compute
+type Report struct {
+	Resources int        `json:"resources"`
+	Keys      []KeyStats `json:"keys"`
+	Coverage  []Coverage `json:"coverage"`
+}
+
+// resource is a distinct resource of the results and its tags
+type resource struct {
+	groups map[Dimension]string
+	tags   map[string]string
+}
+
+// Compute aggregates the scan results into the coverage of each key per account,
+// region, service and resource type, the key cardinality and its top values.
+// A resource without any tag has a single untagged row, it is counted in every total
+// Args:
+// 		results: []aws.RessourceTagResult
+// 		opts: Options
+// Returns:
+// 		Report: the keys sorted by name and the coverage sorted by dimension, group and key
+func Compute(results []aws.RessourceTagResult, opts Options) Report {
+	resources := map[string]*resource{}
+	var order []string
+	seenKeys := map[string]bool{}
+	for _, r := range results {
+		id := strings.Join([]string{r.Account, r.Region, r.Service, r.Resource}, "/")
+		res, ok := resources[id]
+		if !ok {
+			res = &resource{
+				groups: map[Dimension]string{
+					DimensionAccount:      r.Account,
+					DimensionRegion:       r.Region,
+					DimensionService:      r.Service,
+					DimensionResourceType: r.Type(),
+				},
+				tags: map[string]string{},
+			}
+			resources[id] = res
+			order = append(order, id)
+		}
+		if !r.Untagged() {
+			res.tags[r.Key] = r.Value
+			seenKeys[r.Key] = true
+		}
+	}
+
+	keys := opts.Keys
+	if len(keys) == 0 {
+		for key := range seenKeys {
+			keys = append(keys, key)
+		}
+	}
+	keys = append([]string{}, keys...)
+	sort.Strings(keys)
+
+	report := Report{Resources: len(resources)}
+	for _, key := range keys {
+		values := map[string]int{}
+		tagged := 0
+		for _, id := range order {
+			if value, ok := resources[id].tags[key]; ok {
+				tagged++
+				values[value]++
+			}
+		}
+		report.Keys = append(report.Keys, KeyStats{
+			Key:         key,
+			Resources:   tagged,
+			Coverage:    percent(tagged, len(resources)),
+			Cardinality: len(values),
+			TopValues:   topValues(values, opts.Top),
+		})
+	}
+
+	for _, dimension := range Dimensions {
+		totals := map[string]int{}
+		tagged := map[[2]string]int{}
+		for _, id := range order {
+			res := resources[id]
+			group := res.groups[dimension]
+			totals[group]++
+			for _, key := range keys {
+				if _, ok := res.tags[key]; ok {
+					tagged[[2]string{group, key}]++
+				}
+			}
+		}
+		var groups []string
+		for group := range totals {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+		for _, group := range groups {
+			for _, key := range keys {
+				count := tagged[[2]string{group, key}]
+				report.Coverage = append(report.Coverage, Coverage{
+					Dimension: dimension,
+					Group:     group,
+					Key:       key,
+					Tagged:    count,
+					Total:     totals[group],
+					Percent:   percent(count, totals[group]),
+				})
+			}
+		}
+	}
+	return report
+}
+
+// percent returns part of total as a percentage truncated to one decimal
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part*1000/total) / 10
+}
+
+// topValues returns the n most used values, the ties sorted by value
+// n lower than one keeps every value
+func topValues(values map[string]int, n int) []ValueCount {
+	var counts []ValueCount
+	for value, count := range values {
+		counts = append(counts, ValueCount{Value: value, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
@@ -0,0 +1,56 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+)
+
+func fixtureResults() []aws.RessourceTagResult {
+	return []aws.RessourceTagResult{
+		{Account: "111111111111", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "cost-center", Value: "42"},
+		{Account: "111111111111", Region: "us-east-1", Service: "ec2", Resource: "instance/i-1", Key: "env", Value: "prod"},
+		{Account: "111111111111", Region: "us-east-1", Service: "ec2", Resource: "instance/i-2", Key: "env", Value: "prod"},
+		{Account: "222222222222", Region: "eu-west-1", Service: "ec2", Resource: "volume/vol-1", Key: "env", Value: "dev"},
+		{Account: "222222222222", Region: "eu-west-1", Service: "s3", Resource: "bucket", Key: "cost-center", Value: "42"},
+	}
+}
+
+func TestComputeSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	report := Compute(fixtureResults(), Options{Top: 1})
+	assert.Equal(4, report.Resources)
+	assert.Equal([]KeyStats{
+		{Key: "cost-center", Resources: 2, Coverage: 50, Cardinality: 1, TopValues: []ValueCount{{Value: "42", Count: 2}}},
+		{Key: "env", Resources: 3, Coverage: 75, Cardinality: 2, TopValues: []ValueCount{{Value: "prod", Count: 2}}},
+	}, report.Keys)
+	assert.Len(report.Coverage, 2*(2+2+2+3))
+	assert.Contains(report.Coverage, Coverage{Dimension: DimensionAccount, Group: "111111111111", Key: "cost-center", Tagged: 1, Total: 2, Percent: 50})
+	assert.Contains(report.Coverage, Coverage{Dimension: DimensionService, Group: "ec2", Key: "env", Tagged: 3, Total: 3, Percent: 100})
+	assert.Contains(report.Coverage, Coverage{Dimension: DimensionResourceType, Group: "s3", Key: "env", Tagged: 0, Total: 1, Percent: 0})
+	assert.Equal(DimensionAccount, report.Coverage[0].Dimension)
+	assert.Equal(DimensionResourceType, report.Coverage[len(report.Coverage)-1].Dimension)
+
+	// The requested keys are reported even when no resource uses them
+	report = Compute(fixtureResults(), Options{Keys: []string{"team", "env"}})
+	assert.Equal("env", report.Keys[0].Key)
+	assert.Equal(KeyStats{Key: "team"}, report.Keys[1])
+	assert.Equal([]ValueCount{{Value: "prod", Count: 2}, {Value: "dev", Count: 1}}, report.Keys[0].TopValues)
+
+	// The untagged resources are counted in the totals without adding a key
+	results := append(fixtureResults(), aws.RessourceTagResult{Account: "111111111111", Region: "us-east-1", Service: "ec2", Resource: "instance/i-3"})
+	report = Compute(results, Options{})
+	assert.Equal(5, report.Resources)
+	assert.Len(report.Keys, 2)
+	assert.Equal(KeyStats{Key: "env", Resources: 3, Coverage: 60, Cardinality: 2, TopValues: []ValueCount{{Value: "prod", Count: 2}, {Value: "dev", Count: 1}}}, report.Keys[1])
+	assert.Contains(report.Coverage, Coverage{Dimension: DimensionResourceType, Group: "ec2:instance", Key: "env", Tagged: 2, Total: 3, Percent: 66.6})
+
+	// Three resources out of nine
+	assert.Equal(33.3, percent(3, 9))
+	assert.Equal(0.0, percent(0, 0))
+
+	assert.Equal(Report{}, Compute(nil, Options{}))
+}
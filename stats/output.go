@@ -0,0 +1,173 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+
+	"tagu/models"
+)
+
+// Formats are the supported report formats
+var Formats = []string{"table", "json", "html"}
+
+// Write writes the report in the given format
+// Args:
+// 		w: io.Writer
+// 		format: string, one of Formats
+// 		report: Report
+// Returns:
+// 		error: if the format is unknown or the report can not be written
+func Write(w io.Writer, format string, report Report) error {
+	switch format {
+	case "table":
+		return WriteTable(w, report)
+	case "json":
+		return WriteJSON(w, report)
+	case "html":
+		return WriteHTML(w, report)
+	}
+	return fmt.Errorf("invalid format %q, expected %s", format, strings.Join(Formats, ", "))
+}
+
+// WriteTable writes the keys summary followed by the coverage of each group
+func WriteTable(w io.Writer, report Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "KEY\tRESOURCES\tCOVERAGE\tCARDINALITY\tTOP VALUES\n")
+	for _, key := range report.Keys {
+		fmt.Fprintf(tw, "%s\t%d/%d\t%.1f%%\t%d\t%s\n", key.Key, key.Resources, report.Resources, key.Coverage, key.Cardinality, formatValues(key.TopValues))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "DIMENSION\tGROUP\tKEY\tTAGGED\tCOVERAGE\n")
+	for _, c := range report.Coverage {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%d\t%.1f%%\n", c.Dimension, c.Group, c.Key, c.Tagged, c.Total, c.Percent)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as indented JSON
+func WriteJSON(w io.Writer, report Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// WriteHTML writes the report as a self-contained HTML page, the styles are inlined
+// so the file can be shared without any other asset
+func WriteHTML(w io.Writer, report Report) error {
+	return htmlReport.Execute(w, struct {
+		Report
+		Dimensions []Dimension
+	}{report, Dimensions})
+}
+
+// WriteVariants writes the variant groups as a table or JSON
+// Args:
+// 		w: io.Writer
+// 		format: string, table or json
+// 		report: VariantReport
+// Returns:
+// 		error: if the format is unknown or the report can not be written
+func WriteVariants(w io.Writer, format string, report VariantReport) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "KIND\tKEY\tCANONICAL\tVARIANTS\n")
+		for _, group := range report.Keys {
+			fmt.Fprintf(tw, "key\t\t%s\t%s\n", group.Canonical, formatVariants(group.Variants))
+		}
+		for _, group := range report.Values {
+			fmt.Fprintf(tw, "value\t%s\t%s\t%s\n", group.Key, group.Canonical, formatVariants(group.Variants))
+		}
+		return tw.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return fmt.Errorf("invalid format %q, expected table, json", format)
+}
+
+// WriteMapping writes the remediation mapping as YAML
+func WriteMapping(w io.Writer, mapping models.Mapping) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(mapping); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func formatVariants(variants []Variant) string {
+	var parts []string
+	for _, v := range variants {
+		parts = append(parts, fmt.Sprintf("%s(%d)", v.Name, v.Resources))
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatValues(values []ValueCount) string {
+	var parts []string
+	for _, v := range values {
+		parts = append(parts, fmt.Sprintf("%s(%d)", v.Value, v.Count))
+	}
+	return strings.Join(parts, ",")
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"values": formatValues,
+	"coverage": func(coverage []Coverage, dimension Dimension) []Coverage {
+		var filtered []Coverage
+		for _, c := range coverage {
+			if c.Dimension == dimension {
+				filtered = append(filtered, c)
+			}
+		}
+		return filtered
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Tag coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+.bar { background: #eee; width: 200px; height: 12px; }
+.bar div { background: #3a7; height: 12px; }
+</style>
+</head>
+<body>
+<h1>Tag coverage</h1>
+<p>{{.Resources}} tagged resources</p>
+<h2>Keys</h2>
+<table>
+<tr><th>Key</th><th>Resources</th><th>Coverage</th><th></th><th>Cardinality</th><th>Top values</th></tr>
+{{- range .Keys}}
+<tr><td>{{.Key}}</td><td>{{.Resources}}</td><td>{{printf "%.1f" .Coverage}}%</td><td><div class="bar"><div style="width: {{printf "%.1f" .Coverage}}%"></div></div></td><td>{{.Cardinality}}</td><td>{{values .TopValues}}</td></tr>
+{{- end}}
+</table>
+{{- range $dimension := .Dimensions}}
+<h2>Coverage by {{$dimension}}</h2>
+<table>
+<tr><th>{{$dimension}}</th><th>Key</th><th>Tagged</th><th>Coverage</th><th></th></tr>
+{{- range coverage $.Coverage $dimension}}
+<tr><td>{{.Group}}</td><td>{{.Key}}</td><td>{{.Tagged}}/{{.Total}}</td><td>{{printf "%.1f" .Percent}}%</td><td><div class="bar"><div style="width: {{printf "%.1f" .Percent}}%"></div></div></td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
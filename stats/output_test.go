@@ -0,0 +1,55 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSuite(t *testing.T) {
+	assert := assert.New(t)
+	report := Compute(fixtureResults()[:3], Options{Top: 2})
+
+	t.Run("Write a table", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		assert.NoError(Write(out, "table", report))
+		assert.Equal(`KEY          RESOURCES  COVERAGE  CARDINALITY  TOP VALUES
+cost-center  1/2        50.0%     1            42(1)
+env          2/2        100.0%    1            prod(2)
+
+DIMENSION      GROUP         KEY          TAGGED  COVERAGE
+account        111111111111  cost-center  1/2     50.0%
+account        111111111111  env          2/2     100.0%
+region         us-east-1     cost-center  1/2     50.0%
+region         us-east-1     env          2/2     100.0%
+service        ec2           cost-center  1/2     50.0%
+service        ec2           env          2/2     100.0%
+resource-type  ec2:instance  cost-center  1/2     50.0%
+resource-type  ec2:instance  env          2/2     100.0%
+`, out.String())
+	})
+
+	t.Run("Write JSON", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		assert.NoError(Write(out, "json", report))
+		var decoded Report
+		assert.NoError(json.Unmarshal(out.Bytes(), &decoded))
+		assert.Equal(report, decoded)
+	})
+
+	t.Run("Write HTML", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		assert.NoError(Write(out, "html", report))
+		html := out.String()
+		assert.Contains(html, "<style>")
+		assert.Contains(html, "<h2>Coverage by resource-type</h2>")
+		assert.Contains(html, `<tr><td>cost-center</td><td>1</td><td>50.0%</td><td><div class="bar"><div style="width: 50.0%"></div></div></td><td>1</td><td>42(1)</td></tr>`)
+		assert.NotContains(html, "ZgotmplZ")
+	})
+
+	t.Run("Write an unknown format", func(t *testing.T) {
+		assert.EqualError(Write(new(bytes.Buffer), "xml", report), `invalid format "xml", expected table, json, html`)
+	})
+}
@@ -0,0 +1,353 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"tagu/aws"
+	"tagu/models"
+)
+
+// VariantOptions tunes how the keys and values are clustered
+// Without options only the spellings with the same normalized form are clustered
+// params:
+// 		maxDistance: int, the edit distance between two normalized forms of the same cluster, 0 disables it
+// 		prefix: bool, a normalized form prefixing a single other one, env and environment, joins its cluster
+type VariantOptions struct {
+	MaxDistance int
+	Prefix      bool
+}
+
+// Variant is a spelling of a key or value and the number of resources using it
+type Variant struct {
+	Name      string `json:"name"`
+	Resources int    `json:"resources"`
+}
+
+// VariantGroup is a cluster of spellings of the same key or value
+// Key is the canonical key of the values clusters and empty for the keys clusters
+type VariantGroup struct {
+	Key       string    `json:"key,omitempty"`
+	Canonical string    `json:"canonical"`
+	Variants  []Variant `json:"variants"`
+}
+
+// VariantReport is the output of Variants
+type VariantReport struct {
+	Keys   []VariantGroup `json:"keys"`
+	Values []VariantGroup `json:"values"`
+}
+
+// Normalize lowers the name and drops the separators
+func Normalize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '_', '.', ':', '/', ' ':
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+// Variants clusters the tag keys then the values of each canonical key by normalized form
+// and reports the clusters having more than one spelling. The canonical spelling of a
+// cluster is the one used by the most resources
+// Args:
+// 		results: []aws.RessourceTagResult
+// 		opts: VariantOptions
+// Returns:
+// 		VariantReport: the keys and values clusters sorted by canonical name
+func Variants(results []aws.RessourceTagResult, opts VariantOptions) (report VariantReport) {
+	keyUsage := map[string]map[string]bool{}
+	for _, r := range results {
+		if !r.Untagged() {
+			use(keyUsage, r.Key, resourceID(r))
+		}
+	}
+	report.Keys = clusters(keyUsage, opts)
+
+	canonical := map[string]string{}
+	for _, group := range report.Keys {
+		for _, variant := range group.Variants {
+			canonical[variant.Name] = group.Canonical
+		}
+	}
+	valueUsage := map[string]map[string]map[string]bool{}
+	for _, r := range results {
+		if r.Untagged() {
+			continue
+		}
+		key := r.Key
+		if c, ok := canonical[key]; ok {
+			key = c
+		}
+		if valueUsage[key] == nil {
+			valueUsage[key] = map[string]map[string]bool{}
+		}
+		use(valueUsage[key], r.Value, resourceID(r))
+	}
+	var keys []string
+	for key := range valueUsage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, group := range clusters(valueUsage[key], opts) {
+			group.Key = key
+			report.Values = append(report.Values, group)
+		}
+	}
+	return report
+}
+
+// Mapping returns the remediation mapping renaming every variant to its canonical spelling
+func (r VariantReport) Mapping() models.Mapping {
+	mapping := models.Mapping{}
+	for _, group := range r.Keys {
+		for _, variant := range group.Variants {
+			if variant.Name == group.Canonical {
+				continue
+			}
+			if mapping.Keys == nil {
+				mapping.Keys = map[string]string{}
+			}
+			mapping.Keys[variant.Name] = group.Canonical
+		}
+	}
+	for _, group := range r.Values {
+		for _, variant := range group.Variants {
+			if variant.Name == group.Canonical {
+				continue
+			}
+			if mapping.Values == nil {
+				mapping.Values = map[string]map[string]string{}
+			}
+			if mapping.Values[group.Key] == nil {
+				mapping.Values[group.Key] = map[string]string{}
+			}
+			mapping.Values[group.Key][variant.Name] = group.Canonical
+		}
+	}
+	return mapping
+}
+
+func resourceID(r aws.RessourceTagResult) string {
+	return strings.Join([]string{r.Account, r.Region, r.Service, r.Resource}, "/")
+}
+
+func use(usage map[string]map[string]bool, name, resource string) {
+	if usage[name] == nil {
+		usage[name] = map[string]bool{}
+	}
+	usage[name][resource] = true
+}
+
+// clusters joins the names with the same normalized form or close enough
+// normalized forms and returns the clusters of more than one name
+func clusters(usage map[string]map[string]bool, opts VariantOptions) []VariantGroup {
+	var names []string
+	for name := range usage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	forms := make([]string, len(names))
+	for i, name := range names {
+		forms[i] = Normalize(name)
+	}
+	var pairs map[string]string
+	if opts.Prefix {
+		pairs = prefixPairs(forms)
+	}
+
+	parent := make([]int, len(names))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			if forms[i] != forms[j] && distinct(forms[i], forms[j]) {
+				continue
+			}
+			partner, paired := pairs[forms[i]]
+			if forms[i] == forms[j] || similar(names[i], names[j], opts) || (paired && partner == forms[j]) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := map[int][]Variant{}
+	for i, name := range names {
+		root := find(i)
+		members[root] = append(members[root], Variant{Name: name, Resources: len(usage[name])})
+	}
+	var groups []VariantGroup
+	for _, variants := range members {
+		if len(variants) < 2 {
+			continue
+		}
+		sort.Slice(variants, func(i, j int) bool {
+			if variants[i].Resources != variants[j].Resources {
+				return variants[i].Resources > variants[j].Resources
+			}
+			// Prefer the lower case spelling on a tie
+			li, lj := variants[i].Name == strings.ToLower(variants[i].Name), variants[j].Name == strings.ToLower(variants[j].Name)
+			if li != lj {
+				return li
+			}
+			return variants[i].Name < variants[j].Name
+		})
+		groups = append(groups, VariantGroup{Canonical: variants[0].Name, Variants: variants})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Canonical < groups[j].Canonical
+	})
+	return groups
+}
+
+// similar reports whether two names are close enough to share a cluster. The names
+// are compared word by word when they have as many words, us-west-1 and us-east-1 are
+// then too far, else by normalized form. The edit distance must stay below half of
+// the shortest word so short names do not all match
+func similar(a, b string, opts VariantOptions) bool {
+	if opts.MaxDistance == 0 {
+		return false
+	}
+	wa, wb := words(a), words(b)
+	if len(wa) != len(wb) {
+		wa, wb = []string{Normalize(a)}, []string{Normalize(b)}
+	}
+	total := 0
+	for i := range wa {
+		if wa[i] == wb[i] {
+			continue
+		}
+		short := wa[i]
+		if len(wb[i]) < len(short) {
+			short = wb[i]
+		}
+		d := distance(wa[i], wb[i])
+		if 2*d >= len(short) {
+			return false
+		}
+		total += d
+	}
+	return total <= opts.MaxDistance
+}
+
+// distinct reports whether two normalized forms name different things however close they
+// are: their numbers differ, web1 and web2 or useast1 and useast2, or they only differ by a
+// short suffix, teama and teamb or env and envs
+func distinct(a, b string) bool {
+	if strings.Join(numbers(a), " ") != strings.Join(numbers(b), " ") {
+		return true
+	}
+	ra, rb := []rune(a), []rune(b)
+	for len(ra) > 0 && len(rb) > 0 && ra[0] == rb[0] {
+		ra, rb = ra[1:], rb[1:]
+	}
+	// A shared ending, prod and prd, puts the difference inside the forms
+	if len(ra) > 0 && len(rb) > 0 && ra[len(ra)-1] == rb[len(rb)-1] {
+		return false
+	}
+	return len(ra) <= 2 && len(rb) <= 2
+}
+
+// numbers returns the digit runs of the name
+func numbers(name string) []string {
+	return strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsDigit(r)
+	})
+}
+
+// words splits the lower case name on the separators and between letters and digits
+func words(name string) []string {
+	var words []string
+	var word []rune
+	for _, r := range strings.ToLower(name) {
+		if Normalize(string(r)) == "" || (len(word) > 0 && unicode.IsDigit(r) != unicode.IsDigit(word[len(word)-1])) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = nil
+		}
+		if Normalize(string(r)) != "" {
+			word = append(word, r)
+		}
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// prefixPairs returns the partner of each normalized form in a direct prefix pair, a form
+// of three characters at least prefixing a single other form, env and environment.
+// A prefix of several forms, app of application and appname, pairs none of them so
+// the prefix matches never chain unrelated names into one cluster
+func prefixPairs(forms []string) map[string]string {
+	partners := map[string]map[string]bool{}
+	link := func(a, b string) {
+		if partners[a] == nil {
+			partners[a] = map[string]bool{}
+		}
+		partners[a][b] = true
+	}
+	for _, short := range forms {
+		for _, long := range forms {
+			if len(short) >= 3 && len(long) > len(short) && strings.HasPrefix(long, short) {
+				link(short, long)
+				link(long, short)
+			}
+		}
+	}
+	pairs := map[string]string{}
+	for form, others := range partners {
+		for other := range others {
+			if len(others) == 1 && len(partners[other]) == 1 {
+				pairs[form] = other
+			}
+		}
+	}
+	return pairs
+}
+
+// distance returns the Levenshtein distance between a and b
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,193 @@
+package stats
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tagu/aws"
+	"tagu/models"
+)
+
+func variantResults() []aws.RessourceTagResult {
+	tag := func(resource, key, value string) aws.RessourceTagResult {
+		return aws.RessourceTagResult{Account: "111111111111", Region: "us-east-1", Service: "ec2", Resource: resource, Key: key, Value: value}
+	}
+	return []aws.RessourceTagResult{
+		tag("instance/i-1", "env", "prod"),
+		tag("instance/i-2", "env", "prod"),
+		tag("instance/i-3", "Env", "PROD"),
+		tag("instance/i-4", "environment", "production"),
+		tag("instance/i-5", "env", "dev"),
+		tag("instance/i-1", "cost_center", "42"),
+		tag("instance/i-2", "CostCenter", "42"),
+		tag("instance/i-3", "team", "web"),
+	}
+}
+
+func TestNormalizeSuite(t *testing.T) {
+	assert := assert.New(t)
+	fixtures := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Normalize the case", "CostCenter", "costcenter"},
+		{"Normalize the separators", "cost-center_id.v2:a/b c", "costcenteridv2abc"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, Normalize(fixture.input))
+		})
+	}
+}
+
+func TestSimilarSuite(t *testing.T) {
+	assert := assert.New(t)
+	opts := VariantOptions{MaxDistance: 2, Prefix: true}
+	fixtures := []struct {
+		name     string
+		a, b     string
+		opts     VariantOptions
+		expected bool
+	}{
+		{"Same normalized form", "costcenter", "costcenter", opts, true},
+		{"Prefix", "env", "environment", opts, false},
+		{"Typo", "prod", "prd", opts, true},
+		{"Typo in a word", "cost-centre", "cost-center", opts, true},
+		{"Short names", "dev", "env", opts, false},
+		{"Too far", "staging", "testing", opts, false},
+		{"Different word", "us-west-1", "us-east-1", opts, false},
+		{"Edit distance disabled", "prod", "prd", VariantOptions{}, false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, similar(fixture.a, fixture.b, fixture.opts))
+		})
+	}
+	assert.Equal(3, distance("kitten", "sitting"))
+}
+
+func TestDistinctSuite(t *testing.T) {
+	assert := assert.New(t)
+	fixtures := []struct {
+		name     string
+		a, b     string
+		expected bool
+	}{
+		{"Different numbers", "web1", "web2", true},
+		{"Different region numbers", "useast1", "useast2", true},
+		{"Additional number", "web", "web1", true},
+		{"Short suffix", "teama", "teamb", true},
+		{"Plural", "env", "envs", true},
+		{"Typo inside the form", "prod", "prd", false},
+		{"Long suffix", "env", "environment", false},
+		{"Same numbers", "costcentre42", "costcenter42", false},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, distinct(fixture.a, fixture.b))
+		})
+	}
+}
+
+func TestPrefixPairsSuite(t *testing.T) {
+	assert := assert.New(t)
+	fixtures := []struct {
+		name     string
+		forms    []string
+		expected map[string]string
+	}{
+		{"Direct pair", []string{"env", "environment", "env", "team"}, map[string]string{"env": "environment", "environment": "env"}},
+		{"Shared prefix", []string{"app", "application", "appname"}, map[string]string{}},
+		{"Chained prefixes", []string{"own", "owner", "owneremail"}, map[string]string{}},
+		{"Short prefix", []string{"ab", "abcdef"}, map[string]string{}},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			assert.Equal(fixture.expected, prefixPairs(fixture.forms))
+		})
+	}
+
+	t.Run("Test a shared prefix joins no cluster", func(t *testing.T) {
+		tag := func(resource, key string) aws.RessourceTagResult {
+			return aws.RessourceTagResult{Account: "111111111111", Region: "us-east-1", Service: "ec2", Resource: resource, Key: key, Value: "web"}
+		}
+		results := []aws.RessourceTagResult{tag("instance/i-1", "app"), tag("instance/i-2", "application"), tag("instance/i-3", "appname"), tag("instance/i-4", "App")}
+		report := Variants(results, VariantOptions{MaxDistance: 2, Prefix: true})
+		assert.Equal([]VariantGroup{{Canonical: "app", Variants: []Variant{{Name: "app", Resources: 1}, {Name: "App", Resources: 1}}}}, report.Keys)
+	})
+}
+
+func TestVariantsSuite(t *testing.T) {
+	assert := assert.New(t)
+
+	report := Variants(variantResults(), VariantOptions{MaxDistance: 2, Prefix: true})
+	assert.Equal([]VariantGroup{
+		{Canonical: "cost_center", Variants: []Variant{{Name: "cost_center", Resources: 1}, {Name: "CostCenter", Resources: 1}}},
+		{Canonical: "env", Variants: []Variant{{Name: "env", Resources: 3}, {Name: "environment", Resources: 1}, {Name: "Env", Resources: 1}}},
+	}, report.Keys)
+	// The values of the key variants are clustered under the canonical key
+	assert.Equal([]VariantGroup{
+		{Key: "env", Canonical: "prod", Variants: []Variant{{Name: "prod", Resources: 2}, {Name: "production", Resources: 1}, {Name: "PROD", Resources: 1}}},
+	}, report.Values)
+
+	assert.Equal(models.Mapping{
+		Keys:   map[string]string{"CostCenter": "cost_center", "Env": "env", "environment": "env"},
+		Values: map[string]map[string]string{"env": {"PROD": "prod", "production": "prod"}},
+	}, report.Mapping())
+
+	assert.Equal(VariantReport{}, Variants(nil, VariantOptions{}))
+
+	t.Run("Test distinct values are never clustered", func(t *testing.T) {
+		tag := func(resource, key, value string) aws.RessourceTagResult {
+			return aws.RessourceTagResult{Account: "111111111111", Region: "us-east-1", Service: "ec2", Resource: resource, Key: key, Value: value}
+		}
+		results := []aws.RessourceTagResult{
+			tag("instance/i-1", "region", "us-east-1"), tag("instance/i-2", "region", "us-east-2"), tag("instance/i-3", "region", "us-west-1"),
+			tag("instance/i-1", "team", "team-a"), tag("instance/i-2", "team", "team-b"), tag("instance/i-3", "team", "Team_A"),
+			tag("instance/i-1", "name", "web1"), tag("instance/i-2", "name", "web2"),
+		}
+		for _, opts := range []VariantOptions{{}, {MaxDistance: 2, Prefix: true}} {
+			report := Variants(results, opts)
+			assert.Equal(models.Mapping{Values: map[string]map[string]string{"team": {"Team_A": "team-a"}}}, report.Mapping())
+		}
+	})
+
+	t.Run("Test the edit distance is opt-in", func(t *testing.T) {
+		report := Variants(variantResults(), VariantOptions{})
+		assert.Equal(models.Mapping{
+			Keys:   map[string]string{"CostCenter": "cost_center", "Env": "env"},
+			Values: map[string]map[string]string{"env": {"PROD": "prod"}},
+		}, report.Mapping())
+	})
+	assert.Equal(models.Mapping{}, VariantReport{}.Mapping())
+}
+
+func TestWriteVariantsSuite(t *testing.T) {
+	assert := assert.New(t)
+	report := Variants(variantResults(), VariantOptions{MaxDistance: 2, Prefix: true})
+
+	out := new(bytes.Buffer)
+	assert.NoError(WriteVariants(out, "table", report))
+	assert.Equal(`KIND   KEY  CANONICAL    VARIANTS
+key         cost_center  cost_center(1),CostCenter(1)
+key         env          env(3),environment(1),Env(1)
+value  env  prod         prod(2),production(1),PROD(1)
+`, out.String())
+
+	assert.EqualError(WriteVariants(out, "html", report), `invalid format "html", expected table, json`)
+
+	out.Reset()
+	assert.NoError(WriteMapping(out, report.Mapping()))
+	assert.Equal(`keys:
+  CostCenter: cost_center
+  Env: env
+  environment: env
+values:
+  env:
+    PROD: prod
+    production: prod
+`, out.String())
+}